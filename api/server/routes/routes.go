@@ -14,6 +14,7 @@ import (
 	"github.com/blacktop/ipsw/api/server/routes/kernel"
 	"github.com/blacktop/ipsw/api/server/routes/macho"
 	"github.com/blacktop/ipsw/api/server/routes/mount"
+	"github.com/blacktop/ipsw/api/server/routes/wiki"
 	"github.com/gin-gonic/gin"
 )
 
@@ -38,4 +39,5 @@ func Add(rg *gin.RouterGroup) {
 	// pongo.AddRoutes(rg) // TODO: add pongo routes
 	// sepfw.AddRoutes(rg) // TODO: add sepfw routes
 	// symbolicate.AddRoutes(rg) // TODO: add symbolicate routes
+	wiki.AddRoutes(rg)
 }
@@ -0,0 +1,75 @@
+package wiki
+
+import (
+	"sync"
+	"time"
+
+	"github.com/blacktop/ipsw/internal/download"
+	"golang.org/x/sync/singleflight"
+)
+
+// DefaultCacheTTL is how long scraped wiki results are served from the cache
+const DefaultCacheTTL = time.Hour
+
+type cacheEntry struct {
+	fws     []download.WikiFirmware
+	expires time.Time
+}
+
+// firmwareCache is a TTL cache of wiki results shared by all requests; concurrent misses for
+// the same key are collapsed into a single scrape
+type firmwareCache struct {
+	mu      sync.RWMutex
+	ttl     time.Duration
+	entries map[string]cacheEntry
+	group   singleflight.Group
+	now     func() time.Time
+}
+
+func newFirmwareCache(ttl time.Duration) *firmwareCache {
+	if ttl <= 0 {
+		ttl = DefaultCacheTTL
+	}
+	return &firmwareCache{
+		ttl:     ttl,
+		entries: make(map[string]cacheEntry),
+		now:     time.Now,
+	}
+}
+
+var cache = newFirmwareCache(DefaultCacheTTL)
+
+// SetCacheTTL sets how long scraped wiki results are cached (and drops the cached results)
+func SetCacheTTL(ttl time.Duration) {
+	cache = newFirmwareCache(ttl)
+}
+
+// get returns the cached results for key, calling fetch on a miss; it reports whether the results were cached
+func (c *firmwareCache) get(key string, fetch func() ([]download.WikiFirmware, error)) ([]download.WikiFirmware, bool, error) {
+	c.mu.RLock()
+	e, ok := c.entries[key]
+	c.mu.RUnlock()
+	if ok && c.now().Before(e.expires) {
+		return e.fws, true, nil
+	}
+
+	v, err, _ := c.group.Do(key, func() (any, error) {
+		fws, err := fetch()
+		if err != nil {
+			return nil, err // errors aren't cached so a rate limit or network error can be retried
+		}
+		c.mu.Lock()
+		c.entries[key] = cacheEntry{fws: fws, expires: c.now().Add(c.ttl)}
+		for k, e := range c.entries {
+			if !c.now().Before(e.expires) {
+				delete(c.entries, k)
+			}
+		}
+		c.mu.Unlock()
+		return fws, nil
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return v.([]download.WikiFirmware), false, nil
+}
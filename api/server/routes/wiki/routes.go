@@ -0,0 +1,43 @@
+// Package wiki contains the /wiki routes
+package wiki
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+// AddRoutes adds the wiki routes to the router
+func AddRoutes(rg *gin.RouterGroup) {
+	wg := rg.Group("/wiki")
+	// swagger:route GET /wiki/ipsws Wiki getWikiIPSWs
+	//
+	// IPSWs
+	//
+	// Get the IPSWs listed on theapplewiki.com (results are cached).
+	//
+	//     Produces:
+	//     - application/json
+	//
+	//     Responses:
+	//       200: wikiFirmwaresResponse
+	//       400: genericError
+	//       404: genericError
+	//       500: genericError
+	//       503: genericError
+	wg.GET("/ipsws", getIPSWs)
+	// swagger:route GET /wiki/otas Wiki getWikiOTAs
+	//
+	// OTAs
+	//
+	// Get the OTAs listed on theapplewiki.com (results are cached).
+	//
+	//     Produces:
+	//     - application/json
+	//
+	//     Responses:
+	//       200: wikiFirmwaresResponse
+	//       400: genericError
+	//       404: genericError
+	//       500: genericError
+	//       503: genericError
+	wg.GET("/otas", getOTAs)
+}
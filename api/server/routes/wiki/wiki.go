@@ -0,0 +1,170 @@
+package wiki
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/blacktop/ipsw/api/types"
+	"github.com/blacktop/ipsw/internal/download"
+	"github.com/blacktop/ipsw/pkg/info"
+	"github.com/gin-gonic/gin"
+	semver "github.com/hashicorp/go-version"
+)
+
+// the scrape layer (swapped out in tests)
+var (
+	getWikiIPSWs = download.GetWikiIPSWsWithConfig
+	getWikiOTAs  = download.GetWikiOTAsWithConfig
+)
+
+// dlConfig is the network config the wiki is scraped with
+var dlConfig *download.DownloadConfig
+
+// SetDownloadConfig sets the network settings (proxy, CA bundle, rate limit...) the wiki is scraped with
+func SetDownloadConfig(dl *download.DownloadConfig) {
+	dlConfig = dl
+}
+
+// swagger:parameters getWikiIPSWs getWikiOTAs
+type wikiParams struct {
+	// device product type (i.e. iPhone14,5)
+	// in:query
+	// required: true
+	Device string `form:"device" json:"device" binding:"required"`
+	// OS version (i.e. 17.0)
+	// in:query
+	Version string `form:"version" json:"version"`
+	// OS build (i.e. 21A329)
+	// in:query
+	Build string `form:"build" json:"build"`
+	// list the beta firmwares
+	// in:query
+	Beta bool `form:"beta" json:"beta"`
+	// OS lineage (ios, ipados, tvos, watchos, macos or bridgeos)
+	// in:query
+	OS string `form:"os" json:"os"`
+	// sort order (newest, oldest or none)
+	// in:query
+	Sort string `form:"sort" json:"sort"`
+}
+
+// swagger:response wikiFirmwaresResponse
+type wikiFirmwaresResponse struct {
+	// in:body
+	Body []download.WikiFirmware `json:"body"`
+}
+
+// config validates the params up front (a bad device or version must not reach the scraper)
+func (p wikiParams) config(ota bool) (*download.WikiConfig, error) {
+	db, err := info.GetIpswDB()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get ipsw db: %v", err)
+	}
+	device := db.CanonicalProductType(p.Device)
+	if _, err := db.LookupDevice(device); err != nil {
+		return nil, err
+	}
+	if len(p.Version) > 0 && !ota {
+		if _, err := semver.NewVersion(p.Version); err != nil {
+			return nil, fmt.Errorf("invalid version '%s': %v", p.Version, err)
+		}
+	}
+	switch download.WikiSortOrder(strings.ToLower(p.Sort)) {
+	case "", download.WikiSortNone, download.WikiSortNewest, download.WikiSortOldest:
+	default:
+		return nil, fmt.Errorf("invalid sort order '%s' (expected newest, oldest or none)", p.Sort)
+	}
+	switch strings.ToLower(p.OS) {
+	case "", download.WikiOSiOS, download.WikiOSiPadOS, download.WikiOStvOS, download.WikiOSwatchOS, download.WikiOSmacOS, download.WikiOSbridgeOS:
+	default:
+		return nil, fmt.Errorf("invalid os '%s'", p.OS)
+	}
+	return &download.WikiConfig{
+		Device:    device,
+		Version:   p.Version,
+		Build:     strings.ToUpper(p.Build),
+		IPSW:      !ota,
+		OTA:       ota,
+		Beta:      p.Beta,
+		OS:        strings.ToLower(p.OS),
+		SortOrder: download.WikiSortOrder(strings.ToLower(p.Sort)),
+	}, nil
+}
+
+// cacheKey is the same for requests that scrape the same results (builds are filtered after the scrape)
+func cacheKey(kind string, cfg *download.WikiConfig) string {
+	return strings.Join([]string{kind, cfg.Device, cfg.Version, fmt.Sprint(cfg.Beta), cfg.OS, string(cfg.SortOrder)}, "|")
+}
+
+func getIPSWs(c *gin.Context) {
+	getFirmwares(c, "ipsws", getWikiIPSWs)
+}
+
+func getOTAs(c *gin.Context) {
+	getFirmwares(c, "otas", getWikiOTAs)
+}
+
+func getFirmwares(c *gin.Context, kind string, scrape func(*download.WikiConfig, *download.DownloadConfig) ([]download.WikiFirmware, error)) {
+	var params wikiParams
+	if err := c.ShouldBindQuery(&params); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, types.GenericError{Error: err.Error()})
+		return
+	}
+	cfg, err := params.config(kind == "otas")
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, types.GenericError{Error: err.Error()})
+		return
+	}
+
+	fws, cached, err := cache.get(cacheKey(kind, cfg), func() ([]download.WikiFirmware, error) {
+		all := *cfg
+		all.Build = "" // every build is scraped (and cached) and filtered below
+		return scrape(&all, dlConfig)
+	})
+	if err != nil {
+		c.AbortWithStatusJSON(errorStatus(err), types.GenericError{Error: err.Error()})
+		return
+	}
+
+	if cached {
+		c.Header("X-Cache", "HIT")
+	} else {
+		c.Header("X-Cache", "MISS")
+	}
+	c.IndentedJSON(http.StatusOK, filterFirmwares(fws, cfg))
+}
+
+// filterFirmwares returns the firmwares in the scraped wiki pages that match cfg (the pages list every device in the family)
+func filterFirmwares(fws []download.WikiFirmware, cfg *download.WikiConfig) []download.WikiFirmware {
+	matches := []download.WikiFirmware{}
+	for _, fw := range fws {
+		if len(cfg.Version) > 0 && !strings.HasPrefix(fw.Version, cfg.Version) {
+			continue
+		}
+		if !fw.MatchesBuild(cfg.Device, cfg.Build) {
+			continue
+		}
+		if !slices.ContainsFunc(fw.Devices, func(d string) bool { return strings.EqualFold(d, cfg.Device) }) {
+			continue
+		}
+		matches = append(matches, fw)
+	}
+	return matches
+}
+
+// errorStatus maps the wiki scraper's errors to HTTP statuses
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, download.ErrWikiNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, download.ErrWikiRateLimited):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, download.ErrWikiNetwork):
+		return http.StatusBadGateway
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,172 @@
+package wiki
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/blacktop/ipsw/internal/download"
+	"github.com/gin-gonic/gin"
+)
+
+func newTestRouter(t *testing.T, ttl time.Duration) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	SetCacheTTL(ttl)
+	t.Cleanup(func() {
+		SetCacheTTL(DefaultCacheTTL)
+		SetDownloadConfig(nil)
+		getWikiIPSWs = download.GetWikiIPSWsWithConfig
+		getWikiOTAs = download.GetWikiOTAsWithConfig
+	})
+	r := gin.New()
+	AddRoutes(r.Group("/v1"))
+	return r
+}
+
+func get(r *gin.Engine, url string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, url, nil))
+	return w
+}
+
+func TestGetWikiIPSWs(t *testing.T) {
+	r := newTestRouter(t, time.Hour)
+	conf := &download.DownloadConfig{Proxy: "http://proxy.example.com:8080", RateLimit: 1}
+	SetDownloadConfig(conf)
+
+	var calls atomic.Int32
+	getWikiIPSWs = func(cfg *download.WikiConfig, dl *download.DownloadConfig) ([]download.WikiFirmware, error) {
+		calls.Add(1)
+		if dl != conf {
+			t.Errorf("scrape download config = %+v, want the daemon's %+v", dl, conf)
+		}
+		if !cfg.IPSW || cfg.Device != "iPhone14,5" || cfg.Version != "17.0" || !cfg.Beta || len(cfg.Build) > 0 {
+			t.Errorf("unexpected wiki config %+v", cfg)
+		}
+		return []download.WikiFirmware{
+			{Version: "17.0", Build: "21A5248v", Devices: []string{"iPhone14,5"}},
+			{Version: "17.0", Build: "21A5248v", Devices: []string{"iPhone14,7"}},
+			{Version: "17.0", Build: "21A5277h", Devices: []string{"iPhone14,5"}},
+		}, nil
+	}
+
+	w := get(r, "/v1/wiki/ipsws?device=iphone14,5&version=17.0&build=21a5248v&beta=true")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+	var fws []download.WikiFirmware
+	if err := json.Unmarshal(w.Body.Bytes(), &fws); err != nil {
+		t.Fatal(err)
+	}
+	if len(fws) != 1 || fws[0].Build != "21A5248v" {
+		t.Errorf("firmwares = %+v", fws)
+	}
+	if got := w.Header().Get("X-Cache"); got != "MISS" {
+		t.Errorf("X-Cache = %q, want MISS", got)
+	}
+
+	w = get(r, "/v1/wiki/ipsws?device=iPhone14,5&version=17.0&build=21A5277&beta=true")
+	fws = nil
+	if err := json.Unmarshal(w.Body.Bytes(), &fws); err != nil {
+		t.Fatal(err)
+	}
+	if got := w.Header().Get("X-Cache"); w.Code != http.StatusOK || got != "HIT" || len(fws) != 1 || fws[0].Build != "21A5277h" {
+		t.Errorf("second request: status = %d, X-Cache = %q, firmwares = %+v", w.Code, got, fws)
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("scraped %d times, want 1", n)
+	}
+}
+
+func TestGetWikiCacheConcurrent(t *testing.T) {
+	r := newTestRouter(t, time.Hour)
+
+	var calls atomic.Int32
+	release := make(chan struct{})
+	getWikiOTAs = func(cfg *download.WikiConfig, dl *download.DownloadConfig) ([]download.WikiFirmware, error) {
+		calls.Add(1)
+		<-release
+		return []download.WikiFirmware{{Version: "17.1", Build: "21B80", Devices: []string{cfg.Device}}}, nil
+	}
+
+	var wg sync.WaitGroup
+	codes := make([]int, 8)
+	for i := range codes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			codes[i] = get(r, "/v1/wiki/otas?device=iPhone14,5").Code
+		}(i)
+	}
+	time.Sleep(50 * time.Millisecond) // let the requests pile up on the first scrape
+	close(release)
+	wg.Wait()
+
+	for i, code := range codes {
+		if code != http.StatusOK {
+			t.Errorf("request %d: status = %d", i, code)
+		}
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("scraped %d times, want 1", n)
+	}
+}
+
+func TestGetWikiCacheExpires(t *testing.T) {
+	r := newTestRouter(t, time.Minute)
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+
+	var calls atomic.Int32
+	getWikiIPSWs = func(cfg *download.WikiConfig, dl *download.DownloadConfig) ([]download.WikiFirmware, error) {
+		calls.Add(1)
+		return nil, nil
+	}
+
+	if w := get(r, "/v1/wiki/ipsws?device=iPhone14,5"); w.Code != http.StatusOK || w.Body.String() != "[]" {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+	get(r, "/v1/wiki/ipsws?device=iPhone14,5")
+	now = now.Add(2 * time.Minute)
+	get(r, "/v1/wiki/ipsws?device=iPhone14,5")
+	if n := calls.Load(); n != 2 {
+		t.Errorf("scraped %d times, want 2", n)
+	}
+}
+
+func TestGetWikiErrors(t *testing.T) {
+	r := newTestRouter(t, time.Hour)
+
+	var calls atomic.Int32
+	getWikiIPSWs = func(cfg *download.WikiConfig, dl *download.DownloadConfig) ([]download.WikiFirmware, error) {
+		calls.Add(1)
+		return nil, fmt.Errorf("%w: slow down", download.ErrWikiRateLimited)
+	}
+
+	tests := []struct {
+		url  string
+		want int
+	}{
+		{"/v1/wiki/ipsws", http.StatusBadRequest},
+		{"/v1/wiki/ipsws?device=iPhone99,1", http.StatusBadRequest},
+		{"/v1/wiki/ipsws?device=iPhone14,5&version=seventeen", http.StatusBadRequest},
+		{"/v1/wiki/ipsws?device=iPhone14,5&sort=random", http.StatusBadRequest},
+		{"/v1/wiki/ipsws?device=iPhone14,5&os=android", http.StatusBadRequest},
+		{"/v1/wiki/ipsws?device=iPhone14,5", http.StatusServiceUnavailable},
+		{"/v1/wiki/ipsws?device=iPhone14,5", http.StatusServiceUnavailable}, // errors aren't cached
+	}
+	for _, tt := range tests {
+		if w := get(r, tt.url); w.Code != tt.want {
+			t.Errorf("GET %s: status = %d, want %d (%s)", tt.url, w.Code, tt.want, w.Body)
+		}
+	}
+	if n := calls.Load(); n != 2 {
+		t.Errorf("scraped %d times, want 2", n)
+	}
+}
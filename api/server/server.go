@@ -28,13 +28,16 @@ import (
 	"os/signal"
 	"path/filepath"
 	"runtime"
+	"strconv"
 	"syscall"
 	"time"
 
 	"github.com/apex/log"
 	"github.com/blacktop/ipsw/api"
 	"github.com/blacktop/ipsw/api/server/routes"
+	"github.com/blacktop/ipsw/api/server/routes/wiki"
 	"github.com/blacktop/ipsw/api/types"
+	"github.com/blacktop/ipsw/internal/download"
 	"github.com/gin-gonic/gin"
 )
 
@@ -45,6 +48,10 @@ type Config struct {
 	Socket  string
 	Debug   bool
 	LogFile string
+	// WikiCacheTTL is how long the /wiki routes cache scraped results
+	WikiCacheTTL time.Duration
+	// Download is the network config the daemon's scrapers use (proxy, CA bundle, rate limit...)
+	Download *download.DownloadConfig
 }
 
 // Server is the main server struct
@@ -83,12 +90,18 @@ func (s *Server) Start() error {
 		})
 	})
 
+	s.router.GET("/healthz", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"status": "ok"})
+	})
+
 	rg := s.router.Group("/v" + api.DefaultVersion)
 
+	wiki.SetCacheTTL(s.conf.WikiCacheTTL)
+	wiki.SetDownloadConfig(s.conf.Download)
 	routes.Add(rg)
 
 	s.server = &http.Server{
-		Addr:    fmt.Sprintf(":%d", s.conf.Port),
+		Addr:    net.JoinHostPort(s.conf.Host, strconv.Itoa(s.conf.Port)),
 		Handler: s.router,
 	}
 
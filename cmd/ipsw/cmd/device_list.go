@@ -27,6 +27,7 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/blacktop/ipsw/pkg/info"
 	"github.com/blacktop/ipsw/pkg/xcode"
 	"github.com/olekukonko/tablewriter"
 	"github.com/spf13/cobra"
@@ -34,6 +35,7 @@ import (
 
 func init() {
 	rootCmd.AddCommand(deviceListCmd)
+	deviceListCmd.Flags().String("chip", "", "Only list devices using chip (i.e. T8120, 0x8120 or \"A16 Bionic\")")
 }
 
 // deviceListCmd represents the deviceList command
@@ -64,6 +66,24 @@ var deviceListCmd = &cobra.Command{
 			return err
 		}
 
+		if chip, _ := cmd.Flags().GetString("chip"); len(chip) > 0 {
+			db, err := info.GetIpswDB()
+			if err != nil {
+				return err
+			}
+			devs, err := db.DevicesForChip(chip)
+			if err != nil {
+				return err
+			}
+			var filtered []xcode.Device
+			for _, device := range devices {
+				if _, ok := (*devs)[device.ProductType]; ok {
+					filtered = append(filtered, device)
+				}
+			}
+			devices = filtered
+		}
+
 		sort.Sort(xcode.ByProductType{Devices: devices})
 
 		data := [][]string{}
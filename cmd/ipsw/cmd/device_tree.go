@@ -69,6 +69,7 @@ var deviceTreeCmd = &cobra.Command{
 		// settings
 		proxy, _ := cmd.Flags().GetString("proxy")
 		insecure, _ := cmd.Flags().GetBool("insecure")
+		timeout, _ := cmd.Flags().GetDuration("timeout")
 		// flags
 		remoteFlag, _ := cmd.Flags().GetBool("remote")
 		asJSON, _ := cmd.Flags().GetBool("json")
@@ -77,6 +78,7 @@ var deviceTreeCmd = &cobra.Command{
 			zr, err := download.NewRemoteZipReader(args[0], &download.RemoteConfig{
 				Proxy:    proxy,
 				Insecure: insecure,
+				Timeout:  timeout,
 			})
 			if err != nil {
 				return errors.Wrap(err, "failed to create new remote zip reader")
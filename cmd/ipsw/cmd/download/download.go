@@ -32,8 +32,6 @@ import (
 )
 
 type downloadFlags struct {
-	Proxy        string
-	Insecure     bool
 	Confirm      bool
 	SkipAll      bool
 	ResumeAll    bool
@@ -52,8 +50,7 @@ var dFlg downloadFlags
 
 func init() {
 	// Persistent Flags which will work for this command and all subcommands
-	DownloadCmd.PersistentFlags().StringVar(&dFlg.Proxy, "proxy", "", "HTTP/HTTPS proxy")
-	DownloadCmd.PersistentFlags().BoolVar(&dFlg.Insecure, "insecure", false, "do not verify ssl certs")
+	AddDownloadConfigFlags(DownloadCmd.PersistentFlags())
 	DownloadCmd.PersistentFlags().BoolVarP(&dFlg.Confirm, "confirm", "y", false, "do not prompt user for confirmation")
 	DownloadCmd.PersistentFlags().BoolVar(&dFlg.SkipAll, "skip-all", false, "always skip resumable IPSWs")
 	DownloadCmd.PersistentFlags().BoolVar(&dFlg.ResumeAll, "resume-all", false, "always resume resumable IPSWs")
@@ -61,6 +58,9 @@ func init() {
 	DownloadCmd.PersistentFlags().BoolVarP(&dFlg.RemoveCommas, "remove-commas", "_", false, "replace commas in IPSW filename with underscores")
 	viper.BindPFlag("download.proxy", DownloadCmd.Flags().Lookup("proxy"))
 	viper.BindPFlag("download.insecure", DownloadCmd.Flags().Lookup("insecure"))
+	viper.BindPFlag("download.ca-bundle", DownloadCmd.Flags().Lookup("ca-bundle"))
+	viper.BindPFlag("download.rate-limit", DownloadCmd.Flags().Lookup("rate-limit"))
+	viper.BindPFlag("download.retries", DownloadCmd.Flags().Lookup("retries"))
 	viper.BindPFlag("download.confirm", DownloadCmd.Flags().Lookup("confirm"))
 	viper.BindPFlag("download.skip-all", DownloadCmd.Flags().Lookup("skip-all"))
 	viper.BindPFlag("download.resume-all", DownloadCmd.Flags().Lookup("resume-all"))
@@ -79,6 +79,7 @@ func init() {
 	viper.BindPFlag("download.model", DownloadCmd.Flags().Lookup("model"))
 	viper.BindPFlag("download.version", DownloadCmd.Flags().Lookup("version"))
 	viper.BindPFlag("download.build", DownloadCmd.Flags().Lookup("build"))
+	DownloadCmd.RegisterFlagCompletionFunc("device", completeDevices)
 }
 
 func filterIPSWs(cmd *cobra.Command, macos bool) ([]download.IPSW, error) {
@@ -279,7 +279,10 @@ var downloadAppledbCmd = &cobra.Command{
 					}
 				}
 			} else { // NORMAL MODE
-				downloader := download.NewDownload(proxy, insecure, skipAll, resumeAll, restartAll, false, viper.GetBool("verbose"))
+				downloader, err := download.NewDownload(proxy, insecure, skipAll, resumeAll, restartAll, false, viper.GetBool("verbose"), viper.GetDuration("timeout"))
+				if err != nil {
+					return err
+				}
 				for idx, result := range results {
 					var url string
 					for _, link := range result.Links {
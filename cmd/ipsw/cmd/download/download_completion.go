@@ -0,0 +1,131 @@
+/*
+Copyright © 2018-2023 blacktop
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package download
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/blacktop/ipsw/internal/download"
+	"github.com/blacktop/ipsw/pkg/info"
+	"github.com/spf13/cobra"
+)
+
+var (
+	getWikiVersions = download.GetWikiVersionsWithConfig
+	// wikiCompletionCachePath is the file the wiki versions are cached in (download.cache-dir overrides the user cache dir)
+	wikiCompletionCachePath = func(dl *download.DownloadConfig) (string, error) {
+		if len(dl.CacheDir) > 0 {
+			return filepath.Join(dl.CacheDir, "wiki_versions.json"), nil
+		}
+		dir, err := os.UserCacheDir()
+		if err != nil {
+			return "", err
+		}
+		return filepath.Join(dir, "ipsw", "wiki_versions.json"), nil
+	}
+)
+
+// completeDevices completes --device with the product types in the ipsw db (i.e. iPhone15,4)
+func completeDevices(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	db, err := info.GetIpswDB()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	var devices []string
+	for prod, dev := range *db {
+		if strings.HasPrefix(strings.ToLower(prod), strings.ToLower(toComplete)) {
+			devices = append(devices, fmt.Sprintf("%s\t%s", prod, dev.Name))
+		}
+	}
+	slices.Sort(devices)
+	return devices, cobra.ShellCompDirectiveNoFileComp
+}
+
+type wikiVersionsCacheEntry struct {
+	Time     time.Time `json:"time"`
+	Versions []string  `json:"versions"`
+}
+
+// completeWikiVersions completes the wiki's --version with the major versions it has firmware pages for
+func completeWikiVersions(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if cmd != wikiCmd && cmd.Parent() != wikiCmd {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	cfg := &download.WikiConfig{}
+	cfg.Device, _ = cmd.Flags().GetString("device")
+	cfg.OTA, _ = cmd.Flags().GetBool("ota")
+	cfg.Beta, _ = cmd.Flags().GetBool("beta")
+	cfg.IPSW = !cfg.OTA
+
+	dl, err := ResolveDownloadConfig(cmd)
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	versions, err := cachedWikiVersions(cfg, dl)
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp // completions degrade silently (i.e. offline)
+	}
+	var matches []string
+	for _, v := range versions {
+		if strings.HasPrefix(v, toComplete) {
+			matches = append(matches, v)
+		}
+	}
+	return matches, cobra.ShellCompDirectiveNoFileComp | cobra.ShellCompDirectiveNoSpace
+}
+
+// cachedWikiVersions returns the wiki versions for cfg from the completion cache (refreshing it if older
+// than dl's cache TTL, so completing doesn't hit the network every keystroke)
+func cachedWikiVersions(cfg *download.WikiConfig, dl *download.DownloadConfig) ([]string, error) {
+	key := fmt.Sprintf("ota=%t,beta=%t,device=%s", cfg.OTA, cfg.Beta, strings.ToLower(cfg.Device))
+
+	cache := make(map[string]wikiVersionsCacheEntry)
+	path, err := wikiCompletionCachePath(dl)
+	if err == nil {
+		if data, err := os.ReadFile(path); err == nil {
+			json.Unmarshal(data, &cache) // a corrupt cache is just refreshed
+		}
+	}
+	if entry, ok := cache[key]; ok && time.Since(entry.Time) < dl.CacheFreshness() {
+		return entry.Versions, nil
+	}
+
+	versions, err := getWikiVersions(cfg, dl)
+	if err != nil {
+		return nil, err
+	}
+	if len(path) > 0 {
+		cache[key] = wikiVersionsCacheEntry{Time: time.Now(), Versions: versions}
+		if data, err := json.Marshal(cache); err == nil {
+			if err := os.MkdirAll(filepath.Dir(path), 0750); err == nil {
+				os.WriteFile(path, data, 0660)
+			}
+		}
+	}
+	return versions, nil
+}
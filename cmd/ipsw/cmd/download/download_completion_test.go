@@ -0,0 +1,68 @@
+package download
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/blacktop/ipsw/internal/download"
+	"github.com/spf13/cobra"
+)
+
+func TestCompleteDevices(t *testing.T) {
+	devices, directive := completeDevices(wikiCmd, nil, "iphone15")
+	if directive != cobra.ShellCompDirectiveNoFileComp {
+		t.Errorf("directive = %v, want NoFileComp", directive)
+	}
+	var prods []string
+	for _, d := range devices {
+		prod, _, _ := strings.Cut(d, "\t")
+		if !strings.HasPrefix(prod, "iPhone15") {
+			t.Errorf("candidate %q does not match the prefix", d)
+		}
+		prods = append(prods, prod)
+	}
+	for _, want := range []string{"iPhone15,2", "iPhone15,3", "iPhone15,4", "iPhone15,5"} {
+		if !strings.Contains(strings.Join(prods, " "), want) {
+			t.Errorf("candidates %v are missing %s", prods, want)
+		}
+	}
+}
+
+func TestCompleteWikiVersions(t *testing.T) {
+	cachePath := filepath.Join(t.TempDir(), "wiki_versions.json")
+	origVersions, origPath := getWikiVersions, wikiCompletionCachePath
+	t.Cleanup(func() { getWikiVersions, wikiCompletionCachePath = origVersions, origPath })
+	wikiCompletionCachePath = func(*download.DownloadConfig) (string, error) { return cachePath, nil }
+
+	calls := 0
+	getWikiVersions = func(cfg *download.WikiConfig, dl *download.DownloadConfig) ([]string, error) {
+		calls++
+		return []string{"17", "16", "15", "1"}, nil
+	}
+	for i := 0; i < 2; i++ {
+		got, _ := completeWikiVersions(wikiCmd, nil, "1")
+		if want := []string{"17", "16", "15", "1"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("completeWikiVersions(1) = %v, want %v", got, want)
+		}
+	}
+	if got, _ := completeWikiVersions(wikiCmd, nil, "16"); !reflect.DeepEqual(got, []string{"16"}) {
+		t.Errorf("completeWikiVersions(16) = %v, want [16]", got)
+	}
+	if calls != 1 {
+		t.Errorf("wiki was queried %d times, want 1 (cached)", calls)
+	}
+
+	// offline (and not cached yet): no candidates, no error
+	getWikiVersions = func(cfg *download.WikiConfig, dl *download.DownloadConfig) ([]string, error) {
+		return nil, download.ErrWikiNetwork
+	}
+	if got, _ := completeWikiVersions(wikiCmd, []string{}, ""); len(got) != 4 {
+		t.Errorf("completeWikiVersions() = %v, want the cached versions", got)
+	}
+	cachePath = filepath.Join(t.TempDir(), "wiki_versions.json")
+	if got, directive := completeWikiVersions(wikiCmd, nil, ""); got != nil || directive != cobra.ShellCompDirectiveNoFileComp {
+		t.Errorf("offline completeWikiVersions() = %v, %v; want nothing", got, directive)
+	}
+}
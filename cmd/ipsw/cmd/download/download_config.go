@@ -0,0 +1,89 @@
+/*
+Copyright © 2018-2023 blacktop
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package download
+
+import (
+	"fmt"
+
+	"github.com/blacktop/ipsw/internal/download"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+// downloadConfigFlags maps the download.* config keys to the persistent flags that override them
+var downloadConfigFlags = map[string]string{
+	"download.proxy":      "proxy",
+	"download.insecure":   "insecure",
+	"download.ca-bundle":  "ca-bundle",
+	"download.rate-limit": "rate-limit",
+	"download.retries":    "retries",
+}
+
+// resolveDownloadConfig resolves the network settings from v's config file, the IPSW_DOWNLOAD_* env vars
+// and the flags (in increasing precedence); download.cache-dir and download.cache-ttl are config/env only and
+// the per-request timeout is the global timeout (the root --timeout flag)
+func resolveDownloadConfig(v *viper.Viper, flags *pflag.FlagSet) (*download.DownloadConfig, error) {
+	for key, name := range downloadConfigFlags {
+		if flag := flags.Lookup(name); flag != nil {
+			v.BindPFlag(key, flag)
+		}
+	}
+	conf := &download.DownloadConfig{
+		Proxy:     v.GetString("download.proxy"),
+		CABundle:  v.GetString("download.ca-bundle"),
+		Insecure:  v.GetBool("download.insecure"),
+		CacheDir:  v.GetString("download.cache-dir"),
+		CacheTTL:  v.GetDuration("download.cache-ttl"),
+		RateLimit: v.GetFloat64("download.rate-limit"),
+		Retries:   v.GetInt("download.retries"),
+		Timeout:   v.GetDuration("timeout"),
+	}
+	if conf.RateLimit < 0 {
+		return nil, fmt.Errorf("--rate-limit must be >= 0")
+	}
+	if conf.Retries < 0 {
+		return nil, fmt.Errorf("--retries must be >= 0")
+	}
+	if conf.Timeout < 0 {
+		return nil, fmt.Errorf("--timeout must be >= 0")
+	}
+	if conf.CacheTTL < 0 {
+		return nil, fmt.Errorf("download.cache-ttl must be >= 0")
+	}
+	return conf, nil
+}
+
+// AddDownloadConfigFlags adds the network flags resolved by ResolveDownloadConfig to flags
+// (the download commands get them as persistent flags, other commands that download can add them too)
+func AddDownloadConfigFlags(flags *pflag.FlagSet) {
+	flags.String("proxy", "", "HTTP/HTTPS proxy")
+	flags.Bool("insecure", false, "do not verify ssl certs")
+	flags.String("ca-bundle", "", "PEM file of extra root CAs (i.e. for a TLS-intercepting proxy)")
+	flags.Float64("rate-limit", 0, "max requests per second (0 is unlimited)")
+	flags.Int("retries", 0, "retries for failed requests (with exponential backoff)")
+}
+
+// ResolveDownloadConfig resolves the network settings for cmd from the global config
+func ResolveDownloadConfig(cmd *cobra.Command) (*download.DownloadConfig, error) {
+	return resolveDownloadConfig(viper.GetViper(), cmd.Flags())
+}
@@ -0,0 +1,123 @@
+package download
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+func newDownloadConfigViper(t *testing.T, config string) *viper.Viper {
+	t.Helper()
+	v := viper.New()
+	v.SetConfigType("yaml")
+	if err := v.ReadConfig(strings.NewReader(config)); err != nil {
+		t.Fatal(err)
+	}
+	v.SetEnvPrefix("ipsw")
+	v.SetEnvKeyReplacer(strings.NewReplacer("-", "_", ".", "_"))
+	v.AutomaticEnv()
+	return v
+}
+
+func newDownloadConfigFlags() *pflag.FlagSet {
+	flags := pflag.NewFlagSet("download", pflag.ContinueOnError)
+	AddDownloadConfigFlags(flags)
+	return flags
+}
+
+func TestResolveDownloadConfigPrecedence(t *testing.T) {
+	config := `
+download:
+  proxy: http://config:8080
+  retries: 1
+  rate-limit: 2
+  ca-bundle: /config/ca.pem
+  cache-dir: /config/cache
+  cache-ttl: 1h
+`
+	t.Setenv("IPSW_DOWNLOAD_RETRIES", "3")
+	t.Setenv("IPSW_DOWNLOAD_CA_BUNDLE", "/env/ca.pem")
+
+	flags := newDownloadConfigFlags()
+	if err := flags.Parse([]string{"--retries", "5"}); err != nil {
+		t.Fatal(err)
+	}
+	dl, err := resolveDownloadConfig(newDownloadConfigViper(t, config), flags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dl.Proxy != "http://config:8080" { // config only
+		t.Errorf("Proxy = %q, want the config file's", dl.Proxy)
+	}
+	if dl.RateLimit != 2 {
+		t.Errorf("RateLimit = %v, want the config file's", dl.RateLimit)
+	}
+	if dl.CABundle != "/env/ca.pem" { // env beats config
+		t.Errorf("CABundle = %q, want the env's", dl.CABundle)
+	}
+	if dl.Retries != 5 { // flag beats env and config
+		t.Errorf("Retries = %d, want the flag's", dl.Retries)
+	}
+	if dl.CacheDir != "/config/cache" || dl.CacheFreshness() != time.Hour {
+		t.Errorf("cache = %q/%v, want the config file's", dl.CacheDir, dl.CacheFreshness())
+	}
+
+	// unset everywhere: the flag defaults
+	dl, err = resolveDownloadConfig(newDownloadConfigViper(t, ""), newDownloadConfigFlags())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dl.Proxy != "" || dl.Insecure || dl.RateLimit != 0 || dl.Retries != 3 || dl.CacheFreshness() != 15*time.Minute {
+		t.Errorf("defaults = %+v", dl)
+	}
+
+	// the global timeout (the root --timeout flag, the config file's timeout or IPSW_TIMEOUT)
+	t.Setenv("IPSW_TIMEOUT", "30s")
+	dl, err = resolveDownloadConfig(newDownloadConfigViper(t, "timeout: 1m\n"), newDownloadConfigFlags())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts := dl.ClientOptions(); opts.Timeout != 30*time.Second {
+		t.Errorf("Timeout = %v, want the env's", opts.Timeout)
+	}
+
+	flags = newDownloadConfigFlags()
+	flags.Parse([]string{"--rate-limit", "-1"})
+	if _, err := resolveDownloadConfig(newDownloadConfigViper(t, ""), flags); err == nil {
+		t.Error("expected an error for a negative --rate-limit")
+	}
+}
+
+func TestResolveDownloadConfigProxyReachesTransport(t *testing.T) {
+	var proxied atomic.Int32
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Host == "firmware.invalid" {
+			proxied.Add(1)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer proxy.Close()
+
+	dl, err := resolveDownloadConfig(newDownloadConfigViper(t, "download:\n  proxy: "+proxy.URL+"\n"), newDownloadConfigFlags())
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := dl.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.Get("http://firmware.invalid/iPhone15,2_17.0_21A329_Restore.ipsw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if proxied.Load() != 1 {
+		t.Errorf("proxy received %d requests, want 1", proxied.Load())
+	}
+}
@@ -387,7 +387,10 @@ var ipswCmd = &cobra.Command{
 							"signed":  i.Signed,
 						}).Info("Getting IPSW")
 
-						downloader := download.NewDownload(proxy, insecure, skipAll, resumeAll, restartAll, false, viper.GetBool("verbose"))
+						downloader, err := download.NewDownload(proxy, insecure, skipAll, resumeAll, restartAll, false, viper.GetBool("verbose"), viper.GetDuration("timeout"))
+						if err != nil {
+							return err
+						}
 						downloader.URL = i.URL
 						downloader.Sha1 = i.SHA1
 						downloader.DestName = destName
@@ -146,7 +146,10 @@ var downloadKdkCmd = &cobra.Command{
 
 		if _, err := os.Stat(destName); os.IsNotExist(err) {
 			log.Infof("Downloading to %s...", destName)
-			downloader := download.NewDownload(proxy, insecure, skipAll, resumeAll, restartAll, false, viper.GetBool("verbose"))
+			downloader, err := download.NewDownload(proxy, insecure, skipAll, resumeAll, restartAll, false, viper.GetBool("verbose"), viper.GetDuration("timeout"))
+			if err != nil {
+				return err
+			}
 			downloader.URL = aKDK.URL
 			downloader.DestName = destName
 			if err := downloader.Do(); err != nil {
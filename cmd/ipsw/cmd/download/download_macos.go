@@ -193,7 +193,7 @@ var macosCmd = &cobra.Command{
 
 		if cont {
 			for _, prod := range prods {
-				if err := prod.DownloadInstaller(workDir, proxy, insecure, skipAll, resumeAll, restartAll, ignoreSha1, assistantOnly); err != nil {
+				if err := prod.DownloadInstaller(workDir, proxy, insecure, skipAll, resumeAll, restartAll, ignoreSha1, assistantOnly, viper.GetDuration("timeout")); err != nil {
 					return err
 				}
 			}
@@ -30,6 +30,7 @@ import (
 	"runtime"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/AlecAivazis/survey/v2"
 	"github.com/apex/log"
@@ -253,6 +254,11 @@ var otaDLCmd = &cobra.Command{
 			}
 		}
 
+		otaTimeout := 90 * time.Second
+		if t := viper.GetDuration("timeout"); t > 0 {
+			otaTimeout = t
+		}
+
 		otaXML, err := download.NewOTA(as, download.OtaConf{
 			Platform:        strings.ToLower(platform),
 			Beta:            getBeta,
@@ -265,7 +271,7 @@ var otaDLCmd = &cobra.Command{
 			DeviceBlackList: doNotDownload,
 			Proxy:           proxy,
 			Insecure:        insecure,
-			Timeout:         90,
+			Timeout:         otaTimeout,
 		})
 		if err != nil {
 			return fmt.Errorf("failed to parse remote OTA XML: %v", err)
@@ -349,6 +355,7 @@ var otaDLCmd = &cobra.Command{
 					zr, err := download.NewRemoteZipReader(o.BaseURL+o.RelativePath, &download.RemoteConfig{
 						Proxy:    proxy,
 						Insecure: insecure,
+						Timeout:  viper.GetDuration("timeout"),
 					})
 					if err != nil {
 						return fmt.Errorf("failed to open remote zip to OTA: %v", err)
@@ -458,7 +465,10 @@ var otaDLCmd = &cobra.Command{
 					}
 				}
 			} else {
-				downloader := download.NewDownload(proxy, insecure, skipAll, resumeAll, restartAll, false, viper.GetBool("verbose"))
+				downloader, err := download.NewDownload(proxy, insecure, skipAll, resumeAll, restartAll, false, viper.GetBool("verbose"), viper.GetDuration("timeout"))
+				if err != nil {
+					return err
+				}
 				for _, o := range otas {
 					folder := filepath.Join(destPath, fmt.Sprintf("%s%s_OTAs", o.ProductSystemName, strings.TrimPrefix(o.OSVersion, "9.9.")))
 					os.MkdirAll(folder, 0750)
@@ -22,61 +22,157 @@ THE SOFTWARE.
 package download
 
 import (
+	"archive/zip"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/url"
 	"os"
 	"path/filepath"
-	"regexp"
+	"slices"
 	"sort"
 	"strings"
+	"text/tabwriter"
+	"time"
 
 	"github.com/AlecAivazis/survey/v2"
 	"github.com/apex/log"
 	"github.com/blacktop/ipsw/internal/commands/extract"
+	"github.com/blacktop/ipsw/internal/commands/img4"
+	"github.com/blacktop/ipsw/internal/db"
 	"github.com/blacktop/ipsw/internal/download"
+	"github.com/blacktop/ipsw/internal/remotezip"
 	"github.com/blacktop/ipsw/internal/utils"
 	"github.com/blacktop/ipsw/pkg/info"
 	"github.com/blacktop/ipsw/pkg/kernelcache"
 	"github.com/blacktop/ipsw/pkg/ota"
 	"github.com/blacktop/ipsw/pkg/plist"
+	"github.com/blacktop/ipsw/pkg/tss"
+	"github.com/dustin/go-humanize"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
+	"golang.org/x/term"
 )
 
 func init() {
 	DownloadCmd.AddCommand(wikiCmd)
 	wikiCmd.Flags().Bool("ipsw", false, "Download IPSWs")
 	wikiCmd.Flags().Bool("ota", false, "Download OTAs")
+	wikiCmd.Flags().Bool("keys", false, "Download firmware keys (one JSON file per device/build)")
+	wikiCmd.Flags().Bool("force", false, "Overwrite existing keys JSON files")
+	wikiCmd.Flags().String("decrypt", "", "Decrypt a local im4p with the --keys for its component (requires --device and --build)")
+	wikiCmd.Flags().String("key-material", "", fmt.Sprintf("Save the --keys as TSS-ready key material grouped by component tag (%s)", strings.Join(download.WikiKeyMaterialFormats, ", ")))
+	wikiCmd.Flags().String("component", "", "Print only the --keys IV/key for this component (i.e. iBoot, Kernelcache; requires --device and --build)")
 	wikiCmd.Flags().Bool("kernel", false, "Extract kernelcache from remote IPSW")
-	wikiCmd.Flags().String("pattern", "", "Download remote files that match regex")
+	wikiCmd.Flags().StringArray("pattern", []string{}, "Download remote files that match regex (can be used multiple times)")
+	wikiCmd.Flags().String("max-size", "", "Refuse to download more than this with --pattern (e.g. 500MB)")
+	wikiCmd.Flags().String("manifest", "", "Write a JSON manifest of the files downloaded with --pattern to this file ('-' for stdout)")
 	wikiCmd.Flags().Bool("beta", false, "Download beta IPSWs/OTAs")
+	wikiCmd.Flags().String("os", "", "Filter by OS lineage (ios, ipados, tvos, watchos, macos, bridgeos)")
 	wikiCmd.Flags().String("pv", "", "OTA prerequisite version")
 	wikiCmd.Flags().String("pb", "", "OTA prerequisite build")
 	wikiCmd.Flags().Bool("json", false, "Parse URLs and store metadata in local JSON database")
 	wikiCmd.Flags().StringP("output", "o", "", "Folder to download files to")
-	wikiCmd.Flags().String("db", "wiki_db.json", "Path to local JSON database (will use CWD by default)")
+	wikiCmd.Flags().String("output-template", "", "Go template over the firmware fields for each file's folder under --output (e.g. \"{{.Product}}/{{.Version}}/{{.Build}}/\")")
+	wikiCmd.Flags().StringArray("mirror", []string{}, "Rewrite download URLs to a mirror as from-prefix=to-prefix (can be used multiple times; falls back to the original URL on 404)")
+	wikiCmd.Flags().String("index", "", "Path to the index of downloaded firmwares used to skip re-downloads (default is $HOME/.config/ipsw/wiki_index.json)")
+	wikiCmd.Flags().Bool("no-index", false, "Do NOT consult or update the index of downloaded firmwares")
+	wikiCmd.Flags().String("resume-session", "", "Resume the interrupted download session saved in this JSON file (default is <output>/"+download.SessionFileName+" for multi-file downloads)")
+	wikiCmd.Flags().Bool("link", false, "Hardlink (or copy) already downloaded firmwares into --output instead of skipping them")
+	wikiCmd.Flags().String("db", "wiki_db.json", "Path to local JSON database (will use CWD by default); a .db/.sqlite path accumulates every scrape in a SQLite database instead")
+	wikiCmd.Flags().Bool("history", false, "Print the firmwares recorded in the SQLite --db (filtered by --device/--build/--since) and exit")
+	wikiCmd.Flags().String("since", "", "Only --history firmwares released on or after this date (YYYY-MM-DD)")
 	wikiCmd.Flags().BoolP("flat", "f", false, "Do NOT perserve directory structure when downloading with --pattern")
+	wikiCmd.Flags().String("progress", string(utils.ProgressBar), "Progress output style (bar, json, none)")
+	wikiCmd.Flags().Bool("no-trunc", false, "Do NOT truncate the firmware table to the terminal width")
+	wikiCmd.Flags().String("sort", "none", "Sort order (newest, oldest, none)")
+	wikiCmd.Flags().Int("workers", 1, "Number of wiki pages to fetch at a time")
+	wikiCmd.Flags().String("crawl-report", "", "Write a JSON report of the wiki crawl (pages fetched, retries, parse errors...) to this file")
+	wikiCmd.Flags().Bool("lang-links", false, "Also parse the localized versions of the firmware pages for firmwares they alone list")
+	wikiCmd.Flags().Bool("print-json", false, "Print the matching firmwares as JSON and exit")
+	wikiCmd.Flags().StringSlice("group-by", []string{}, fmt.Sprintf("Group the --print-json output by these keys in order (%s)", strings.Join(download.WikiGroupKeys, ", ")))
+	wikiCmd.Flags().Bool("urls", false, "Print the matching firmware URLs (one per line) and exit, failing if there are none (alias: --only-url)")
+	wikiCmd.Flags().SetNormalizeFunc(func(f *pflag.FlagSet, name string) pflag.NormalizedName {
+		if name == "only-url" { // alias of --urls
+			name = "urls"
+		}
+		return pflag.NormalizedName(name)
+	})
+	wikiCmd.Flags().Bool("dry-run", false, "Print a table of what would be downloaded and exit")
+	wikiCmd.Flags().Bool("table", false, "Print the matching firmwares as a bordered table and exit")
+	wikiCmd.Flags().String("format", "", "Print each matching firmware with a Go template and exit (see 'ipsw download wiki format' for the fields)")
+	wikiCmd.Flags().Bool("check-signed", false, "Check if Apple still signs each firmware's build (for its first device) in the --table and --print-json output")
+	wikiCmd.Flags().Duration("check-signed-timeout", 2*time.Minute, "Give up on the --check-signed TSS checks after this long")
+	wikiCmd.Flags().String("min-tls", "", fmt.Sprintf("Minimum TLS version for the wiki queries and downloads (%s)", strings.Join(download.TLSVersions, ", ")))
+	wikiCmd.Flags().Bool("device-names", false, "Resolve the devices to their marketing names (i.e. iPhone 14 Pro) in the --table, --dry-run, --print-json and --format output")
 	wikiCmd.SetHelpFunc(func(c *cobra.Command, s []string) {
 		DownloadCmd.PersistentFlags().MarkHidden("white-list")
 		DownloadCmd.PersistentFlags().MarkHidden("black-list")
 		DownloadCmd.PersistentFlags().MarkHidden("model") // TODO: remove this?
-		c.Parent().HelpFunc()(c, s)
+		// NOTE: not c.Parent() as the wiki subcommands inherit this func
+		DownloadCmd.HelpFunc()(c, s)
 	})
 	viper.BindPFlag("download.wiki.ipsw", wikiCmd.Flags().Lookup("ipsw"))
 	viper.BindPFlag("download.wiki.ota", wikiCmd.Flags().Lookup("ota"))
+	viper.BindPFlag("download.wiki.keys", wikiCmd.Flags().Lookup("keys"))
+	viper.BindPFlag("download.wiki.force", wikiCmd.Flags().Lookup("force"))
+	viper.BindPFlag("download.wiki.decrypt", wikiCmd.Flags().Lookup("decrypt"))
+	viper.BindPFlag("download.wiki.key-material", wikiCmd.Flags().Lookup("key-material"))
+	viper.BindPFlag("download.wiki.component", wikiCmd.Flags().Lookup("component"))
 	viper.BindPFlag("download.wiki.kernel", wikiCmd.Flags().Lookup("kernel"))
 	viper.BindPFlag("download.wiki.pattern", wikiCmd.Flags().Lookup("pattern"))
+	viper.BindPFlag("download.wiki.max-size", wikiCmd.Flags().Lookup("max-size"))
+	viper.BindPFlag("download.wiki.manifest", wikiCmd.Flags().Lookup("manifest"))
 	viper.BindPFlag("download.wiki.beta", wikiCmd.Flags().Lookup("beta"))
+	viper.BindPFlag("download.wiki.os", wikiCmd.Flags().Lookup("os"))
 	viper.BindPFlag("download.wiki.pv", wikiCmd.Flags().Lookup("pv"))
 	viper.BindPFlag("download.wiki.pb", wikiCmd.Flags().Lookup("pb"))
 	viper.BindPFlag("download.wiki.json", wikiCmd.Flags().Lookup("json"))
 	viper.BindPFlag("download.wiki.output", wikiCmd.Flags().Lookup("output"))
+	viper.BindPFlag("download.wiki.output-template", wikiCmd.Flags().Lookup("output-template"))
+	viper.BindPFlag("download.wiki.mirror", wikiCmd.Flags().Lookup("mirror"))
+	viper.BindPFlag("download.wiki.index", wikiCmd.Flags().Lookup("index"))
+	viper.BindPFlag("download.wiki.no-index", wikiCmd.Flags().Lookup("no-index"))
+	viper.BindPFlag("download.wiki.resume-session", wikiCmd.Flags().Lookup("resume-session"))
+	viper.BindPFlag("download.wiki.link", wikiCmd.Flags().Lookup("link"))
 	viper.BindPFlag("download.wiki.db", wikiCmd.Flags().Lookup("db"))
+	viper.BindPFlag("download.wiki.history", wikiCmd.Flags().Lookup("history"))
+	viper.BindPFlag("download.wiki.since", wikiCmd.Flags().Lookup("since"))
 	viper.BindPFlag("download.wiki.flat", wikiCmd.Flags().Lookup("flat"))
+	viper.BindPFlag("download.wiki.progress", wikiCmd.Flags().Lookup("progress"))
+	viper.BindPFlag("download.wiki.no-trunc", wikiCmd.Flags().Lookup("no-trunc"))
+	viper.BindPFlag("download.wiki.sort", wikiCmd.Flags().Lookup("sort"))
+	viper.BindPFlag("download.wiki.workers", wikiCmd.Flags().Lookup("workers"))
+	viper.BindPFlag("download.wiki.crawl-report", wikiCmd.Flags().Lookup("crawl-report"))
+	viper.BindPFlag("download.wiki.lang-links", wikiCmd.Flags().Lookup("lang-links"))
+	viper.BindPFlag("download.wiki.print-json", wikiCmd.Flags().Lookup("print-json"))
+	viper.BindPFlag("download.wiki.group-by", wikiCmd.Flags().Lookup("group-by"))
+	viper.BindPFlag("download.wiki.urls", wikiCmd.Flags().Lookup("urls"))
+	viper.BindPFlag("download.wiki.dry-run", wikiCmd.Flags().Lookup("dry-run"))
+	viper.BindPFlag("download.wiki.table", wikiCmd.Flags().Lookup("table"))
+	viper.BindPFlag("download.wiki.format", wikiCmd.Flags().Lookup("format"))
+	viper.BindPFlag("download.wiki.check-signed", wikiCmd.Flags().Lookup("check-signed"))
+	viper.BindPFlag("download.wiki.check-signed-timeout", wikiCmd.Flags().Lookup("check-signed-timeout"))
+	viper.BindPFlag("download.wiki.device-names", wikiCmd.Flags().Lookup("device-names"))
+	viper.BindPFlag("download.wiki.min-tls", wikiCmd.Flags().Lookup("min-tls"))
 
-	wikiCmd.MarkFlagsMutuallyExclusive("ipsw", "ota")
+	wikiCmd.MarkFlagsMutuallyExclusive("ipsw", "ota", "keys")
+	wikiCmd.MarkFlagsMutuallyExclusive("print-json", "urls", "dry-run", "table", "format", "json", "history")
 	wikiCmd.MarkFlagDirname("output")
+	wikiCmd.RegisterFlagCompletionFunc("group-by", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return download.WikiGroupKeys, cobra.ShellCompDirectiveNoFileComp
+	})
+	wikiCmd.RegisterFlagCompletionFunc("key-material", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return download.WikiKeyMaterialFormats, cobra.ShellCompDirectiveNoFileComp
+	})
+	wikiCmd.RegisterFlagCompletionFunc("min-tls", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return download.TLSVersions, cobra.ShellCompDirectiveNoFileComp
+	})
+	// NOTE: --version is a download persistent flag (completeWikiVersions only completes it for the wiki commands)
+	DownloadCmd.RegisterFlagCompletionFunc("version", completeWikiVersions)
 }
 
 // wikiCmd represents the wiki command
@@ -93,8 +189,6 @@ var wikiCmd = &cobra.Command{
 			log.SetLevel(log.DebugLevel)
 		}
 
-		viper.BindPFlag("download.proxy", cmd.Flags().Lookup("proxy"))
-		viper.BindPFlag("download.insecure", cmd.Flags().Lookup("insecure"))
 		viper.BindPFlag("download.confirm", cmd.Flags().Lookup("confirm"))
 		viper.BindPFlag("download.skip-all", cmd.Flags().Lookup("skip-all"))
 		viper.BindPFlag("download.resume-all", cmd.Flags().Lookup("resume-all"))
@@ -105,8 +199,15 @@ var wikiCmd = &cobra.Command{
 		viper.BindPFlag("download.build", cmd.Flags().Lookup("build"))
 
 		// settings
-		proxy := viper.GetString("download.proxy")
-		insecure := viper.GetBool("download.insecure")
+		dl, err := ResolveDownloadConfig(cmd)
+		if err != nil {
+			return err
+		}
+		if dl.MinTLS, err = download.ParseTLSVersion(viper.GetString("download.wiki.min-tls")); err != nil {
+			return fmt.Errorf("invalid --min-tls: %v", err)
+		}
+		proxy := dl.Proxy
+		insecure := dl.Insecure
 		confirm := viper.GetBool("download.confirm")
 		skipAll := viper.GetBool("download.skip-all")
 		resumeAll := viper.GetBool("download.resume-all")
@@ -119,38 +220,193 @@ var wikiCmd = &cobra.Command{
 		// flags
 		dlIPSWs := viper.GetBool("download.wiki.ipsw")
 		dlOTAs := viper.GetBool("download.wiki.ota")
+		dlKeys := viper.GetBool("download.wiki.keys")
 		kernel := viper.GetBool("download.wiki.kernel")
-		pattern := viper.GetString("download.wiki.pattern")
+		patterns := viper.GetStringSlice("download.wiki.pattern")
 		output := viper.GetString("download.wiki.output")
 		flat := viper.GetBool("download.wiki.flat")
+		progress := utils.ProgressStyle(viper.GetString("download.wiki.progress"))
+		sortOrder := download.WikiSortOrder(viper.GetString("download.wiki.sort"))
+
+		if viper.GetBool("download.wiki.history") {
+			return printWikiHistory(cmd.OutOrStdout(), viper.GetString("download.wiki.db"), device, build, viper.GetString("download.wiki.since"))
+		}
 
 		// validate flags
-		if !dlIPSWs && !dlOTAs {
-			return fmt.Errorf("must specify one of --ipsw or --ota")
+		if keys := viper.GetStringSlice("download.wiki.group-by"); len(keys) > 0 {
+			if !viper.GetBool("download.wiki.print-json") {
+				return fmt.Errorf("--group-by requires --print-json")
+			}
+			if _, err := download.ParseWikiGroupKeys(keys); err != nil {
+				return err
+			}
+		}
+		if viper.GetBool("download.wiki.json") && isWikiSQLite(viper.GetString("download.wiki.db")) {
+			return fmt.Errorf("--json requires a JSON --db")
 		}
-		if len(device) == 0 && len(version) == 0 && len(build) == 0 {
+		resumeSession := viper.GetString("download.wiki.resume-session")
+		if !dlIPSWs && !dlOTAs && !dlKeys {
+			if len(resumeSession) == 0 {
+				return fmt.Errorf("must specify one of --ipsw, --ota, --keys or --resume-session")
+			}
+		} else if len(device) == 0 && len(version) == 0 && len(build) == 0 {
 			return fmt.Errorf("must specify at least one of --device, --version, or --build")
 		}
-		if kernel && len(pattern) > 0 {
+		if kernel && len(patterns) > 0 {
 			return fmt.Errorf("cannot use --kernel and --pattern together")
 		}
+		component := viper.GetString("download.wiki.component")
+		if len(component) > 0 {
+			if !dlKeys {
+				return fmt.Errorf("--component requires --keys")
+			}
+			if len(viper.GetString("download.wiki.decrypt")) > 0 {
+				return fmt.Errorf("cannot use --component and --decrypt together")
+			}
+			if len(device) == 0 || len(build) == 0 {
+				return fmt.Errorf("--component requires both --device and --build")
+			}
+		}
+		keyMaterial := viper.GetString("download.wiki.key-material")
+		if len(keyMaterial) > 0 {
+			if !dlKeys {
+				return fmt.Errorf("--key-material requires --keys")
+			}
+			if len(component) > 0 || len(viper.GetString("download.wiki.decrypt")) > 0 {
+				return fmt.Errorf("cannot use --key-material with --component or --decrypt")
+			}
+			if !slices.Contains(download.WikiKeyMaterialFormats, keyMaterial) {
+				return fmt.Errorf("invalid --key-material format '%s' (expected one of: %s)", keyMaterial, strings.Join(download.WikiKeyMaterialFormats, ", "))
+			}
+		}
+		if format := viper.GetString("download.wiki.format"); len(format) > 0 {
+			if _, err := download.NewWikiFormat(format); err != nil {
+				return err
+			}
+		}
+		if viper.GetBool("download.wiki.check-signed") && !viper.GetBool("download.wiki.print-json") && !viper.GetBool("download.wiki.table") && len(viper.GetString("download.wiki.format")) == 0 {
+			return fmt.Errorf("--check-signed requires --print-json, --table or --format")
+		}
+		var maxSize uint64
+		if ms := viper.GetString("download.wiki.max-size"); len(ms) > 0 {
+			var err error
+			if maxSize, err = humanize.ParseBytes(ms); err != nil {
+				return fmt.Errorf("invalid --max-size %s: %v", ms, err)
+			}
+		}
+		var manifests []*remotezip.Manifest
+		if _, err := utils.NewProgressReporter(progress, os.Stdout, ""); err != nil {
+			return err
+		}
 
 		var destPath string
 		if len(output) > 0 {
 			destPath = filepath.Clean(output)
 		}
+		outputTemplate := viper.GetString("download.wiki.output-template")
+		outTmpl, err := download.NewWikiOutputTemplate(destPath, outputTemplate)
+		if err != nil {
+			return err
+		}
+		mirrors, err := download.ParseMirrorRules(viper.GetStringSlice("download.wiki.mirror"))
+		if err != nil {
+			return err
+		}
+		dlConf := &download.WikiDownloadConfig{Mirrors: mirrors, Link: viper.GetBool("download.wiki.link")}
+		if !viper.GetBool("download.wiki.no-index") {
+			indexPath := viper.GetString("download.wiki.index")
+			if len(indexPath) == 0 {
+				if indexPath, err = wikiIndexPath(); err != nil {
+					return err
+				}
+			}
+			dlConf.Index = download.OpenHashIndex(indexPath)
+		}
 
-		if dlIPSWs { /* DOWNLOAD IPSWs */
-			ipsws, err := download.GetWikiIPSWs(&download.WikiConfig{
+		if !dlIPSWs && !dlOTAs && !dlKeys { /* RESUME SESSION */
+			return resumeWikiSession(resumeSession, func(destName string) (*download.Download, error) {
+				downloader, err := download.NewDownload(proxy, insecure, skipAll, resumeAll, restartAll, false, viper.GetBool("verbose"), viper.GetDuration("timeout"))
+				if err != nil {
+					return nil, err
+				}
+				if progress != utils.ProgressBar {
+					downloader.Progress, _ = utils.NewProgressReporter(progress, os.Stdout, destName)
+				}
+				return downloader, nil
+			}, dlConf)
+		}
+
+		if dlKeys { /* DOWNLOAD KEYS */
+			keys, err := getWikiFirmwareKeys(&download.WikiConfig{
 				Device:  device,
 				Version: version,
 				Build:   build,
-				IPSW:    dlIPSWs,
-				OTA:     dlOTAs,
-				Beta:    viper.GetBool("download.wiki.beta"),
-			}, proxy, insecure)
+			}, dl)
+			if err != nil {
+				return fmt.Errorf("failed querying theiphonewiki.com: %w", err)
+			}
+			if im4p := viper.GetString("download.wiki.decrypt"); len(im4p) > 0 {
+				return decryptWithWikiKeys(im4p, destPath, device, build, keys)
+			}
+			if len(component) > 0 {
+				return printWikiComponentKeys(cmd.OutOrStdout(), keys, device, build, component, viper.GetBool("download.wiki.print-json"))
+			}
+			if len(destPath) == 0 {
+				destPath = "."
+			}
+			if len(keyMaterial) > 0 {
+				summary, err := download.WriteWikiKeyMaterial(destPath, keys, keyMaterial, viper.GetBool("download.wiki.force"))
+				if err != nil {
+					return err
+				}
+				log.WithFields(log.Fields{
+					"written": summary.Written,
+					"skipped": summary.Skipped,
+					"missing": summary.Missing,
+				}).Infof("Saved key material to %s", destPath)
+				return nil
+			}
+			summary, err := download.WriteWikiFWKeys(destPath, keys, viper.GetBool("download.wiki.force"))
 			if err != nil {
-				return fmt.Errorf("failed querying theiphonewiki.com: %v", err)
+				return err
+			}
+			log.WithFields(log.Fields{
+				"written": summary.Written,
+				"skipped": summary.Skipped,
+				"missing": summary.Missing,
+			}).Infof("Saved firmware keys to %s", destPath)
+			return nil
+		}
+
+		var crawlReport io.Writer
+		if path := viper.GetString("download.wiki.crawl-report"); len(path) > 0 {
+			f, err := os.Create(path)
+			if err != nil {
+				return fmt.Errorf("failed to create crawl report: %v", err)
+			}
+			defer f.Close()
+			crawlReport = f
+		}
+
+		if dlIPSWs { /* DOWNLOAD IPSWs */
+			ipsws, err := getWikiIPSWs(&download.WikiConfig{
+				Device:           device,
+				Version:          version,
+				Build:            build,
+				IPSW:             dlIPSWs,
+				OTA:              dlOTAs,
+				Beta:             viper.GetBool("download.wiki.beta"),
+				OS:               viper.GetString("download.wiki.os"),
+				SortOrder:        sortOrder,
+				Workers:          viper.GetInt("download.wiki.workers"),
+				ReportWriter:     crawlReport,
+				IncludeLangLinks: viper.GetBool("download.wiki.lang-links"),
+			}, dl)
+			if err != nil {
+				return fmt.Errorf("failed querying theiphonewiki.com: %w", err)
+			}
+			if err := recordWikiScrape(viper.GetString("download.wiki.db"), ipsws); err != nil {
+				return err
 			}
 
 			// ipsws, err := download.ScrapeIPSWs(viper.GetBool("download.wiki.beta"))
@@ -161,7 +417,7 @@ var wikiCmd = &cobra.Command{
 			var filteredIPSW []download.WikiFirmware
 			for _, ipsw := range ipsws {
 				if len(version) > 0 || len(build) > 0 {
-					if strings.HasPrefix(ipsw.Version, version) || strings.EqualFold(ipsw.Build, build) {
+					if wikiVersionMatches(ipsw, version, build) {
 						if len(device) > 0 {
 							for _, dev := range ipsw.Devices {
 								if strings.EqualFold(dev, device) {
@@ -195,6 +451,13 @@ var wikiCmd = &cobra.Command{
 				}
 			}
 
+			if err := checkWikiSigned(filteredIPSW, dl); err != nil {
+				return err
+			}
+			if listed, err := listWikiFirmwares(cmd.OutOrStdout(), filteredIPSW); listed {
+				return err
+			}
+
 			if viper.GetBool("download.wiki.json") {
 				db := make(map[string]*info.Info)
 				if f, err := os.Open(viper.GetString("download.wiki.db")); err == nil { // try and load existing DB
@@ -220,6 +483,7 @@ var wikiCmd = &cobra.Command{
 					zr, err := download.NewRemoteZipReader(ipsw.URL, &download.RemoteConfig{
 						Proxy:    proxy,
 						Insecure: insecure,
+						Timeout:  viper.GetDuration("timeout"),
 					})
 					if err != nil {
 						log.Errorf("failed to create remote zip reader of ipsw: %v", err)
@@ -258,65 +522,116 @@ var wikiCmd = &cobra.Command{
 				cont := true
 				if !confirm {
 					if len(filteredIPSW) > 1 { // if filtered to a single device skip the prompt
-						cont = false
-						prompt := &survey.Confirm{
-							Message: fmt.Sprintf("You are about to download %d IPSW files. Continue?", len(filteredIPSW)),
+						if kernel || len(patterns) > 0 {
+							if err := renderWikiTable(os.Stdout, filteredIPSW); err != nil {
+								return err
+							}
+							cont = false
+							prompt := &survey.Confirm{
+								Message: fmt.Sprintf("You are about to download %d IPSW files. Continue?", len(filteredIPSW)),
+							}
+							survey.AskOne(prompt, &cont)
+						} else if cont, err = confirmWikiDownload(os.Stdout, filteredIPSW, "IPSW", destPath, dl); err != nil {
+							return err
 						}
-						survey.AskOne(prompt, &cont)
 					}
 				}
 
 				if cont {
-					if kernel || len(pattern) > 0 {
+					if kernel || len(patterns) > 0 {
 						for _, ipsw := range filteredIPSW {
 							d, v, b := download.ParseIpswURLString(ipsw.URL)
 							log.WithFields(log.Fields{"devices": d, "build": b, "version": v}).Info("Parsing remote IPSW")
 
-							config := &extract.Config{
-								URL:      ipsw.URL,
-								Pattern:  pattern,
-								Proxy:    proxy,
-								Insecure: insecure,
-								Flatten:  flat,
-								Progress: true,
-								Output:   destPath,
-							}
-
 							// REMOTE KERNEL MODE
 							if kernel {
 								log.Info("Extracting remote kernelcache")
-								if _, err := extract.Kernelcache(config); err != nil {
+								if _, err := extract.Kernelcache(&extract.Config{
+									URL:      ipsw.URL,
+									Proxy:    proxy,
+									Insecure: insecure,
+									Timeout:  viper.GetDuration("timeout"),
+									Progress: progress != utils.ProgressNone,
+									Output:   destPath,
+								}); err != nil {
 									return fmt.Errorf("failed to extract kernelcache from remote IPSW: %v", err)
 								}
 							}
 							// PATTERN MATCHING MODE
-							if len(pattern) > 0 {
-								log.Infof("Downloading files matching pattern %#v", pattern)
-								if _, err := extract.Search(config); err != nil {
+							if len(patterns) > 0 {
+								log.Infof("Downloading files matching pattern(s) %q", patterns)
+								zr, err := download.NewRemoteZipReader(ipsw.URL, &download.RemoteConfig{
+									Proxy:    proxy,
+									Insecure: insecure,
+									Timeout:  viper.GetDuration("timeout"),
+								})
+								if err != nil {
+									return fmt.Errorf("failed to open remote IPSW: %w", err)
+								}
+								inf, err := info.ParseZipFiles(zr.File)
+								if err != nil {
+									return fmt.Errorf("failed to parse remote IPSW metadata: %v", err)
+								}
+								folder, err := inf.GetFolder()
+								if err != nil {
+									return fmt.Errorf("failed to get folder from remote IPSW metadata: %v", err)
+								}
+								m, err := extractWikiPatterns(cmd.OutOrStdout(), zr, &remotezip.Config{
+									Patterns: patterns,
+									Output:   filepath.Join(destPath, folder),
+									Flatten:  flat,
+									MaxSize:  maxSize,
+								})
+								if err != nil {
 									return err
 								}
+								m.URL = ipsw.URL
+								manifests = append(manifests, m)
 							}
 						}
 					} else { // NORMAL MODE
-						for _, ipsw := range filteredIPSW {
-							destName := getDestName(ipsw.URL, removeCommas)
-							if len(destPath) > 0 {
-								destName = filepath.Join(filepath.Clean(destPath), destName)
+						dests := make([]string, len(filteredIPSW))
+						for i, ipsw := range filteredIPSW {
+							dir, err := outTmpl.Dir(ipsw)
+							if err != nil {
+								return err
 							}
+							dests[i] = filepath.Join(dir, getDestName(ipsw.URL, removeCommas))
+						}
+						sess, err := openWikiSession(viper.GetString("download.wiki.resume-session"), destPath, filteredIPSW, dests)
+						if err != nil {
+							return err
+						}
+						for i, ipsw := range filteredIPSW {
+							destName := dests[i]
 							if err := os.MkdirAll(filepath.Dir(destName), 0755); err != nil {
 								return fmt.Errorf("failed to create directory: %v", err)
 							}
-							if _, err := os.Stat(destName); os.IsNotExist(err) {
+							if sess != nil && sess.Completed(ipsw.URL, destName) {
+								log.Warnf("IPSW already downloaded (in session %s): %s", sess.Path(), destName)
+								continue
+							}
+							done, err := wikiDownloaded(ipsw, destName)
+							if err != nil {
+								return err
+							}
+							if !done {
 								log.WithFields(log.Fields{
 									"devices": ipsw.Devices,
 									"build":   ipsw.Build,
 									"version": fmt.Sprintf("%s%s", ipsw.Version, ipsw.VersionExtra),
 								}).Info("Getting IPSW")
 
-								downloader := download.NewDownload(proxy, insecure, skipAll, resumeAll, restartAll, false, viper.GetBool("verbose"))
-								downloader.URL = ipsw.URL
-								downloader.Sha1 = ipsw.Sha1Hash
-								downloader.DestName = destName
+								downloader, err := download.NewDownload(proxy, insecure, skipAll, resumeAll, restartAll, false, viper.GetBool("verbose"), viper.GetDuration("timeout"))
+								if err != nil {
+									return err
+								}
+								if progress != utils.ProgressBar {
+									downloader.Progress, _ = utils.NewProgressReporter(progress, os.Stdout, destName)
+								}
+								if err := downloadWikiFirmware(ipsw, destName, downloader, dlConf, sess); err != nil {
+									return err
+								}
 
 								// append sha1 and filename to checksums file
 								f, err := os.OpenFile("checksums.txt.sha1", os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
@@ -336,16 +651,24 @@ var wikiCmd = &cobra.Command{
 				}
 			}
 		} else { /* DOWNLOAD OTAs */
-			otas, err := download.GetWikiOTAs(&download.WikiConfig{
-				Device:  device,
-				Version: version,
-				Build:   build,
-				IPSW:    dlIPSWs,
-				OTA:     dlOTAs,
-				Beta:    viper.GetBool("download.wiki.beta"),
-			}, proxy, insecure)
+			otas, err := getWikiOTAs(&download.WikiConfig{
+				Device:           device,
+				Version:          version,
+				Build:            build,
+				IPSW:             dlIPSWs,
+				OTA:              dlOTAs,
+				Beta:             viper.GetBool("download.wiki.beta"),
+				OS:               viper.GetString("download.wiki.os"),
+				SortOrder:        sortOrder,
+				Workers:          viper.GetInt("download.wiki.workers"),
+				ReportWriter:     crawlReport,
+				IncludeLangLinks: viper.GetBool("download.wiki.lang-links"),
+			}, dl)
 			if err != nil {
-				return fmt.Errorf("failed querying theiphonewiki.com: %v", err)
+				return fmt.Errorf("failed querying theiphonewiki.com: %w", err)
+			}
+			if err := recordWikiScrape(viper.GetString("download.wiki.db"), otas); err != nil {
+				return err
 			}
 
 			// otas, err := download.ScrapeOTAs(viper.GetBool("download.wiki.beta"))
@@ -365,7 +688,7 @@ var wikiCmd = &cobra.Command{
 			var filteredOTAs []download.WikiFirmware
 			for _, ota := range otas {
 				if len(version) > 0 || len(build) > 0 {
-					if strings.HasPrefix(ota.Version, version) || strings.EqualFold(ota.Build, build) {
+					if wikiVersionMatches(ota, version, build) {
 						log.Debugf("prerequisite version: %s, prerequisite build: %s", viper.GetString("download.wiki.pv"), viper.GetString("download.wiki.pb"))
 						if !strings.EqualFold(ota.PrerequisiteVersion, viper.GetString("download.wiki.pv")) &&
 							!strings.EqualFold(ota.Build, viper.GetString("download.wiki.pb")) {
@@ -402,6 +725,13 @@ var wikiCmd = &cobra.Command{
 				}
 			}
 
+			if err := checkWikiSigned(filteredOTAs, dl); err != nil {
+				return err
+			}
+			if listed, err := listWikiFirmwares(cmd.OutOrStdout(), filteredOTAs); listed {
+				return err
+			}
+
 			if viper.GetBool("download.wiki.json") {
 				db := make(map[string]info.InfoJSON)
 				if f, err := os.Open(viper.GetString("download.wiki.db")); err == nil { // try and load existing DB
@@ -428,6 +758,7 @@ var wikiCmd = &cobra.Command{
 						zr, err := download.NewRemoteZipReader(ota.URL, &download.RemoteConfig{
 							Proxy:    proxy,
 							Insecure: insecure,
+							Timeout:  viper.GetDuration("timeout"),
 						})
 						if err != nil {
 							log.Errorf("failed to create remote zip reader of ipsw: %v", err)
@@ -476,16 +807,23 @@ var wikiCmd = &cobra.Command{
 				if !confirm {
 					// if filtered to a single device skip the prompt
 					if len(filteredOTAs) > 1 {
-						cont = false
-						prompt := &survey.Confirm{
-							Message: fmt.Sprintf("You are about to download %d OTA files. Continue?", len(filteredOTAs)),
+						if kernel || len(patterns) > 0 {
+							if err := renderWikiTable(os.Stdout, filteredOTAs); err != nil {
+								return err
+							}
+							cont = false
+							prompt := &survey.Confirm{
+								Message: fmt.Sprintf("You are about to download %d OTA files. Continue?", len(filteredOTAs)),
+							}
+							survey.AskOne(prompt, &cont)
+						} else if cont, err = confirmWikiDownload(os.Stdout, filteredOTAs, "OTA", destPath, dl); err != nil {
+							return err
 						}
-						survey.AskOne(prompt, &cont)
 					}
 				}
 
 				if cont {
-					if kernel || len(pattern) > 0 {
+					if kernel || len(patterns) > 0 {
 						for _, o := range filteredOTAs {
 							log.WithFields(log.Fields{
 								"version": o.Version,
@@ -497,6 +835,7 @@ var wikiCmd = &cobra.Command{
 							zr, err := download.NewRemoteZipReader(o.URL, &download.RemoteConfig{
 								Proxy:    proxy,
 								Insecure: insecure,
+								Timeout:  viper.GetDuration("timeout"),
 							})
 							if err != nil {
 								return fmt.Errorf("failed to open remote zip to OTA: %v", err)
@@ -509,23 +848,34 @@ var wikiCmd = &cobra.Command{
 							if err != nil {
 								log.Errorf("failed to get folder from remote zip metadata: %v", err)
 							}
-							folder = filepath.Join(destPath, folder)
 
 							if kernel { // REMOTE KERNEL MODE
 								log.Info("Extracting remote kernelcache")
-								_, err = kernelcache.RemoteParse(zr, folder)
+								_, err = kernelcache.RemoteParse(zr, filepath.Join(destPath, folder))
 								if err != nil {
 									return fmt.Errorf("failed to download kernelcache from remote ota: %v", err)
 								}
 							}
 							// PATTERN MATCHING MODE
-							if len(pattern) > 0 {
-								re, err := regexp.Compile(pattern)
+							if len(patterns) > 0 {
+								re, err := remotezip.Compile(patterns)
 								if err != nil {
-									return fmt.Errorf("failed to compile regex for pattern '%s': %v", pattern, err)
+									return err
 								}
-								log.Infof("Downloading files matching pattern %#v", pattern)
-								if _, err := utils.SearchZip(zr.File, re, folder, flat, true); err != nil {
+								pattern := re.String()
+								log.Infof("Downloading files matching pattern(s) %q", patterns)
+								m, err := extractWikiPatterns(cmd.OutOrStdout(), zr, &remotezip.Config{
+									Patterns: patterns,
+									Output:   filepath.Join(destPath, folder),
+									Flatten:  flat,
+									MaxSize:  maxSize,
+								})
+								if err == nil {
+									m.URL = o.URL
+									manifests = append(manifests, m)
+								} else if !errors.Is(err, remotezip.ErrNoMatch) {
+									return err
+								} else {
 									utils.Indent(log.Warn, 2)("0 files matched pattern in remote OTA zip. Now checking payloadv2 payloads...")
 									rfiles, err := ota.RemoteList(zr)
 									if err != nil {
@@ -538,9 +888,9 @@ var wikiCmd = &cobra.Command{
 										}
 									}
 									if len(matches) == 0 {
-										return fmt.Errorf("no files matched pattern %#v in remote OTA zip", pattern)
+										return fmt.Errorf("no files matched pattern(s) %q in remote OTA zip", patterns)
 									}
-									err = ota.RemoteExtract(zr, pattern, folder, func(path string) bool {
+									err = ota.RemoteExtract(zr, pattern, filepath.Join(destPath, folder), func(path string) bool {
 										for i, v := range matches {
 											if strings.HasSuffix(v, filepath.Base(path)) {
 												matches = append(matches[:i], matches[i+1:]...)
@@ -555,10 +905,18 @@ var wikiCmd = &cobra.Command{
 							}
 						}
 					} else { // NORMAL MODE
-						downloader := download.NewDownload(proxy, insecure, skipAll, resumeAll, restartAll, false, viper.GetBool("verbose"))
-						for _, o := range filteredOTAs {
+						downloader, err := download.NewDownload(proxy, insecure, skipAll, resumeAll, restartAll, false, viper.GetBool("verbose"), viper.GetDuration("timeout"))
+						if err != nil {
+							return err
+						}
+						dests := make([]string, len(filteredOTAs))
+						for i, o := range filteredOTAs {
 							folder := filepath.Join(destPath, fmt.Sprintf("%s%s_OTAs", o.Version, o.VersionExtra))
-							os.MkdirAll(folder, 0750)
+							if len(outputTemplate) > 0 {
+								if folder, err = outTmpl.Dir(o); err != nil {
+									return err
+								}
+							}
 							var devices string
 							if len(o.Devices) > 0 {
 								sort.Strings(o.Devices)
@@ -568,22 +926,35 @@ var wikiCmd = &cobra.Command{
 									devices = strings.Join(o.Devices, "_")
 								}
 							}
-							url := o.URL
-							destName := filepath.Join(folder, fmt.Sprintf("%s_%s", devices, getDestName(url, removeCommas)))
-							if _, err := os.Stat(destName); os.IsNotExist(err) {
+							dests[i] = filepath.Join(folder, fmt.Sprintf("%s_%s", devices, getDestName(o.URL, removeCommas)))
+						}
+						sess, err := openWikiSession(viper.GetString("download.wiki.resume-session"), destPath, filteredOTAs, dests)
+						if err != nil {
+							return err
+						}
+						for i, o := range filteredOTAs {
+							destName := dests[i]
+							os.MkdirAll(filepath.Dir(destName), 0750)
+							if sess != nil && sess.Completed(o.URL, destName) {
+								log.Warnf("OTA already downloaded (in session %s): %s", sess.Path(), destName)
+								continue
+							}
+							done, err := wikiDownloaded(o, destName)
+							if err != nil {
+								return err
+							}
+							if !done {
 								log.WithFields(log.Fields{
 									"device": strings.Join(o.Devices, " "),
 									"model":  o.BoardID,
 									"build":  o.Build,
 								}).Info(fmt.Sprintf("Getting %s%s OTA", o.Version, o.VersionExtra))
-								// download file
-								downloader.URL = url
-								downloader.DestName = destName
-								if err := downloader.Do(); err != nil {
-									return fmt.Errorf("failed to download file: %v", err)
+								if progress != utils.ProgressBar {
+									downloader.Progress, _ = utils.NewProgressReporter(progress, os.Stdout, destName)
+								}
+								if err := downloadWikiFirmware(o, destName, downloader, dlConf, sess); err != nil {
+									return err
 								}
-							} else if err != nil {
-								return fmt.Errorf("failed to stat file %s: %v", destName, err)
 							} else {
 								log.Warnf("OTA already exists: %s", destName)
 							}
@@ -593,6 +964,315 @@ var wikiCmd = &cobra.Command{
 			}
 		}
 
-		return nil
+		return writeWikiManifest(cmd.OutOrStdout(), manifests)
 	},
 }
+
+// scrape layer (swapped out in tests)
+var (
+	getWikiIPSWs        = download.GetWikiIPSWsWithConfig
+	getWikiOTAs         = download.GetWikiOTAsWithConfig
+	getWikiFirmwareKeys = download.GetWikiFirmwareKeysWithConfig
+	checkSigning        = tss.CheckSigning
+)
+
+// checkWikiSigned sets the signing status of fws when --check-signed is set
+func checkWikiSigned(fws []download.WikiFirmware, dl *download.DownloadConfig) error {
+	if !viper.GetBool("download.wiki.check-signed") || len(fws) == 0 {
+		return nil
+	}
+	log.Infof("Checking if %d firmware(s) are still signed", len(fws))
+	return checkSigning(context.Background(), fws, &tss.SigningConfig{
+		Download: dl,
+		Timeout:  viper.GetDuration("download.wiki.check-signed-timeout"),
+	})
+}
+
+// decryptWithWikiKeys decrypts im4p with the wiki keys for exactly device and build
+func decryptWithWikiKeys(im4p, destPath, device, build string, keys []download.WikiFWKeys) error {
+	if len(device) == 0 || len(build) == 0 {
+		return fmt.Errorf("--decrypt requires both --device and --build")
+	}
+	for _, k := range keys {
+		if !strings.EqualFold(k.Device, device) || !strings.EqualFold(k.Build, build) {
+			continue
+		}
+		var output string
+		if len(destPath) > 0 {
+			if err := os.MkdirAll(destPath, 0750); err != nil {
+				return fmt.Errorf("failed to create output directory: %v", err)
+			}
+			output = filepath.Join(destPath, filepath.Base(im4p)+".dec")
+		}
+		if _, err := img4.DecryptWithWikiKeys(im4p, output, &k); err != nil {
+			return fmt.Errorf("failed to decrypt %s: %w", im4p, err)
+		}
+		return nil
+	}
+	return fmt.Errorf("no firmware keys on the wiki for %s %s", device, build)
+}
+
+// printWikiComponentKeys prints the wiki IV/key of component for exactly device and build
+func printWikiComponentKeys(w io.Writer, keys []download.WikiFWKeys, device, build, component string, asJSON bool) error {
+	for _, k := range keys {
+		if !strings.EqualFold(k.Device, device) || !strings.EqualFold(k.Build, build) {
+			continue
+		}
+		ck, err := k.Component(component)
+		if err != nil {
+			return err
+		}
+		if asJSON {
+			dat, err := json.Marshal(ck)
+			if err != nil {
+				return fmt.Errorf("failed to marshal component keys: %v", err)
+			}
+			fmt.Fprintln(w, string(dat))
+			return nil
+		}
+		if !ck.Encrypted {
+			fmt.Fprintf(w, "%s (%s %s) is not encrypted\n", ck.Component, k.Device, k.Build)
+			return nil
+		}
+		fmt.Fprintf(w, "IV:  %s\nKey: %s\n", ck.IV, ck.Key)
+		return nil
+	}
+	return fmt.Errorf("%w: no firmware keys on the wiki for %s %s", download.ErrWikiNotFound, device, build)
+}
+
+// downloadWikiFirmware downloads fw to destName (through the first matching mirror, if any) unless it was already downloaded;
+// its progress is recorded in sess (if any)
+func downloadWikiFirmware(fw download.WikiFirmware, destName string, downloader *download.Download, conf *download.WikiDownloadConfig, sess *download.Session) error {
+	var res *download.WikiDownloadResult
+	var err error
+	if sess != nil {
+		res, err = sess.Download(fw, destName, downloader, conf)
+	} else {
+		res, err = download.DownloadWikiFirmware(fw, destName, downloader, conf)
+	}
+	if err != nil {
+		return err
+	}
+	if res.Mirrored {
+		utils.Indent(log.WithField("url", res.URL).Debug, 2)("Downloaded from mirror")
+	}
+	return nil
+}
+
+// wikiIndexPath returns the default download index path (next to the config file)
+func wikiIndexPath() (string, error) {
+	if len(viper.ConfigFileUsed()) > 0 {
+		return filepath.Join(filepath.Dir(viper.ConfigFileUsed()), "wiki_index.json"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".config", "ipsw", "wiki_index.json"), nil
+}
+
+// wikiDownloaded returns true if destName already holds fw (logging when it exists but doesn't match the wiki's hash)
+func wikiDownloaded(fw download.WikiFirmware, destName string) (bool, error) {
+	done, err := fw.Downloaded(destName)
+	if err != nil {
+		return false, fmt.Errorf("failed to check existing file %s: %v", destName, err)
+	}
+	if !done {
+		if _, err := os.Stat(destName); err == nil {
+			log.Warnf("%s exists but does not match the wiki's SHA1 (re-downloading)", destName)
+		}
+	}
+	return done, nil
+}
+
+// wikiVersionMatches reports whether fw is the --version or the --build requested (both matching as prefixes,
+// the build case-insensitively; unset flags never match)
+func wikiVersionMatches(fw download.WikiFirmware, version, build string) bool {
+	return (len(version) > 0 && strings.HasPrefix(fw.Version, version)) ||
+		(len(build) > 0 && strings.HasPrefix(strings.ToUpper(fw.Build), strings.ToUpper(build)))
+}
+
+// listWikiFirmwares handles the --print-json, --urls (or --only-url), --table and --dry-run modes; it returns true if one of them was requested
+func listWikiFirmwares(w io.Writer, fws []download.WikiFirmware) (bool, error) {
+	if viper.GetBool("download.wiki.device-names") {
+		for i := range fws {
+			if err := fws[i].ResolveDeviceNames(); err != nil {
+				log.WithError(err).Warn("failed to resolve device names")
+				break
+			}
+		}
+	}
+	switch {
+	case viper.GetBool("download.wiki.print-json"):
+		if fws == nil {
+			fws = []download.WikiFirmware{}
+		}
+		var out any = fws
+		if keys := viper.GetStringSlice("download.wiki.group-by"); len(keys) > 0 {
+			by, err := download.ParseWikiGroupKeys(keys)
+			if err != nil {
+				return true, err
+			}
+			out = download.GroupWikiFirmwares(fws, by...)
+			if len(fws) == 0 {
+				out = struct{}{}
+			}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(out); err != nil {
+			return true, fmt.Errorf("failed to encode firmwares as JSON: %v", err)
+		}
+	case viper.GetBool("download.wiki.urls"):
+		if len(fws) == 0 {
+			return true, fmt.Errorf("no matching firmwares found")
+		}
+		for _, fw := range fws {
+			if _, err := fmt.Fprintln(w, fw.URL); err != nil {
+				return true, err
+			}
+		}
+	case viper.GetBool("download.wiki.table"):
+		if err := download.RenderWikiGrid(w, fws); err != nil {
+			return true, err
+		}
+	case len(viper.GetString("download.wiki.format")) > 0:
+		format, err := download.NewWikiFormat(viper.GetString("download.wiki.format"))
+		if err != nil {
+			return true, err
+		}
+		if err := format.Execute(w, fws); err != nil {
+			return true, err
+		}
+	case viper.GetBool("download.wiki.dry-run"):
+		if err := renderWikiTable(w, fws); err != nil {
+			return true, err
+		}
+		var total uint64
+		for _, fw := range fws {
+			total += uint64(fw.FileSize)
+		}
+		fmt.Fprintf(w, "\nWould download %d file(s) (%s)\n", len(fws), humanize.IBytes(total))
+	default:
+		return false, nil
+	}
+	return true, nil
+}
+
+// renderWikiTable prints fws as a table sized to the terminal (when w is one)
+func renderWikiTable(w io.Writer, fws []download.WikiFirmware) error {
+	conf := &download.WikiTableConfig{NoTrunc: viper.GetBool("download.wiki.no-trunc")}
+	if f, ok := w.(*os.File); ok && term.IsTerminal(int(f.Fd())) {
+		if width, _, err := term.GetSize(int(f.Fd())); err == nil {
+			conf.Width = width
+		}
+	}
+	return download.RenderWikiTable(w, fws, conf)
+}
+
+// extractWikiPatterns fetches the remote zip entries matching conf.Patterns and prints what was
+// fetched to w (unless the manifest is going to stdout as JSON)
+func extractWikiPatterns(w io.Writer, zr *zip.Reader, conf *remotezip.Config) (*remotezip.Manifest, error) {
+	m, err := remotezip.Extract(zr, conf)
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract files matching pattern(s) %q: %w", conf.Patterns, err)
+	}
+	if viper.GetString("download.wiki.manifest") != "-" {
+		fmt.Fprint(w, m)
+	}
+	return m, nil
+}
+
+// writeWikiManifest writes the --pattern manifests as JSON to the --manifest file ('-' for w)
+func writeWikiManifest(w io.Writer, manifests []*remotezip.Manifest) error {
+	path := viper.GetString("download.wiki.manifest")
+	if len(path) == 0 || manifests == nil {
+		return nil
+	}
+	dat, err := json.MarshalIndent(manifests, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal manifest: %v", err)
+	}
+	if path == "-" {
+		_, err = fmt.Fprintln(w, string(dat))
+		return err
+	}
+	if err := os.WriteFile(path, dat, 0660); err != nil {
+		return fmt.Errorf("failed to write manifest: %v", err)
+	}
+	log.Infof("Wrote manifest to %s", path)
+	return nil
+}
+
+// isWikiSQLite reports whether the --db path is a SQLite database (rather than the --json metadata database)
+func isWikiSQLite(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".db", ".sqlite", ".sqlite3":
+		return true
+	}
+	return false
+}
+
+// recordWikiScrape merges fws into the SQLite --db (if one was given)
+func recordWikiScrape(path string, fws []download.WikiFirmware) error {
+	if !isWikiSQLite(path) {
+		return nil
+	}
+	wdb, err := db.OpenWikiDB(path)
+	if err != nil {
+		return err
+	}
+	defer wdb.Close()
+	run, err := wdb.Merge(fws, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+	log.WithFields(log.Fields{
+		"firmwares": run.Firmwares,
+		"new":       run.New,
+	}).Infof("Recorded scrape in %s", path)
+	return nil
+}
+
+// printWikiHistory prints the firmwares recorded in the SQLite database at path
+func printWikiHistory(w io.Writer, path, device, build, since string) error {
+	if !isWikiSQLite(path) {
+		return fmt.Errorf("--history requires a SQLite --db (i.e. wiki.db)")
+	}
+	if _, err := os.Stat(path); err != nil {
+		return fmt.Errorf("failed to open wiki database: %v", err)
+	}
+	q := db.WikiQuery{Device: device, Build: build}
+	if len(since) > 0 {
+		t, err := time.Parse("2006-01-02", since)
+		if err != nil {
+			return fmt.Errorf("invalid --since date '%s' (expected YYYY-MM-DD): %v", since, err)
+		}
+		q.ReleasedSince = t
+	}
+	wdb, err := db.OpenWikiDB(path)
+	if err != nil {
+		return err
+	}
+	defer wdb.Close()
+	fws, err := wdb.Query(q)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "BUILD\tVERSION\tDEVICES\tRELEASED\tFIRST SEEN\tLAST SEEN\tURL")
+	for _, fw := range fws {
+		var devices []string
+		for _, d := range fw.Devices {
+			devices = append(devices, d.Name)
+		}
+		released := "-"
+		if !fw.ReleaseDate.IsZero() {
+			released = fw.ReleaseDate.Format("2006-01-02")
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", fw.Build, fw.Version, strings.Join(devices, ", "), released,
+			fw.FirstSeen.Local().Format("2006-01-02 15:04"), fw.LastSeen.Local().Format("2006-01-02 15:04"), fw.URL)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,105 @@
+/*
+Copyright © 2018-2023 blacktop
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package download
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/apex/log"
+	"github.com/blacktop/ipsw/internal/download"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func init() {
+	wikiCmd.AddCommand(wikiDumpCmd)
+
+	wikiDumpCmd.Flags().StringSlice("family", []string{}, fmt.Sprintf("Product families to dump (%s)", strings.Join(download.WikiFamilies, ", ")))
+	wikiDumpCmd.Flags().Bool("ota", false, "Dump OTAs instead of IPSWs")
+	wikiDumpCmd.Flags().Bool("beta", false, "Dump beta IPSWs/OTAs")
+	wikiDumpCmd.Flags().String("sort", "newest", "Sort order (newest, oldest, none)")
+	wikiDumpCmd.Flags().StringP("output", "o", "wiki_firmwares.json", "Path to write JSON dump to")
+	wikiDumpCmd.MarkFlagFilename("output", "json")
+	wikiDumpCmd.RegisterFlagCompletionFunc("family", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return download.WikiFamilies, cobra.ShellCompDirectiveNoFileComp
+	})
+	viper.BindPFlag("download.wiki.dump.family", wikiDumpCmd.Flags().Lookup("family"))
+	viper.BindPFlag("download.wiki.dump.ota", wikiDumpCmd.Flags().Lookup("ota"))
+	viper.BindPFlag("download.wiki.dump.beta", wikiDumpCmd.Flags().Lookup("beta"))
+	viper.BindPFlag("download.wiki.dump.sort", wikiDumpCmd.Flags().Lookup("sort"))
+	viper.BindPFlag("download.wiki.dump.output", wikiDumpCmd.Flags().Lookup("output"))
+}
+
+// wikiDumpCmd represents the wiki dump command
+var wikiDumpCmd = &cobra.Command{
+	Use:           "dump",
+	Short:         "Dump all parsed theiphonewiki.com firmware tables to a single JSON file",
+	Args:          cobra.NoArgs,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		if viper.GetBool("verbose") {
+			log.SetLevel(log.DebugLevel)
+		}
+
+		// settings
+		dl, err := ResolveDownloadConfig(cmd)
+		if err != nil {
+			return err
+		}
+		// flags
+		output := viper.GetString("download.wiki.dump.output")
+
+		dump, err := download.DumpWikiWithConfig(&download.WikiDumpConfig{
+			Families:  viper.GetStringSlice("download.wiki.dump.family"),
+			OTA:       viper.GetBool("download.wiki.dump.ota"),
+			Beta:      viper.GetBool("download.wiki.dump.beta"),
+			SortOrder: download.WikiSortOrder(viper.GetString("download.wiki.dump.sort")),
+		}, dl)
+		if err != nil {
+			return fmt.Errorf("failed dumping theiphonewiki.com: %v", err)
+		}
+
+		dat, err := json.MarshalIndent(dump, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal wiki dump: %v", err)
+		}
+		if err := os.MkdirAll(filepath.Dir(filepath.Clean(output)), 0750); err != nil {
+			return fmt.Errorf("failed to create output directory: %v", err)
+		}
+		if err := os.WriteFile(output, dat, 0660); err != nil {
+			return fmt.Errorf("failed to write wiki dump: %v", err)
+		}
+
+		log.WithFields(log.Fields{
+			"pages":     len(dump.Pages),
+			"firmwares": len(dump.Firmwares),
+		}).Infof("Created %s", output)
+
+		return nil
+	},
+}
@@ -0,0 +1,40 @@
+/*
+Copyright © 2018-2023 blacktop
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package download
+
+import (
+	"github.com/blacktop/ipsw/internal/download"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	wikiCmd.AddCommand(wikiFormatHelpCmd)
+}
+
+// wikiFormatHelpCmd is the help topic for the wiki --format templates
+var wikiFormatHelpCmd = &cobra.Command{
+	Use:   "format",
+	Short: "Fields and functions available to the --format template",
+	Long: "The --format flag prints each matching firmware with a Go text/template (https://pkg.go.dev/text/template).\n" +
+		"A newline is added after each firmware's output (unless it already ends with one) and \\n/\\t are expanded.\n\n" +
+		download.WikiFormatHelp(),
+}
@@ -0,0 +1,81 @@
+/*
+Copyright © 2018-2023 blacktop
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package download
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/apex/log"
+	"github.com/blacktop/ipsw/internal/download"
+)
+
+// openWikiSession opens the download session for fws saved to dests; path defaults to download.SessionFileName
+// in destPath and single file downloads don't get a session unless path is given
+func openWikiSession(path, destPath string, fws []download.WikiFirmware, dests []string) (*download.Session, error) {
+	if len(path) == 0 {
+		if len(fws) < 2 {
+			return nil, nil
+		}
+		path = filepath.Join(destPath, download.SessionFileName)
+	}
+	files := make([]download.SessionEntry, len(fws))
+	for i, fw := range fws {
+		files[i] = download.SessionEntry{URL: fw.URL, Dest: dests[i], Sha1: fw.Sha1Hash}
+	}
+	sess, resumed, err := download.OpenSession(path, files)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save download session: %v", err)
+	}
+	if resumed {
+		log.Infof("Resuming download session %s", path)
+	}
+	return sess, nil
+}
+
+// resumeWikiSession downloads the files the session saved at path didn't finish (without querying the wiki)
+func resumeWikiSession(path string, newDownload func(destName string) (*download.Download, error), conf *download.WikiDownloadConfig) error {
+	sess, err := download.LoadSession(path)
+	if err != nil {
+		return fmt.Errorf("failed to load download session: %v", err)
+	}
+	log.Infof("Resuming download session %s", path)
+	for i, e := range sess.Files {
+		if sess.Completed(e.URL, e.Dest) {
+			log.Debugf("Skipping %s (already downloaded)", e.Dest)
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(e.Dest), 0755); err != nil {
+			return fmt.Errorf("failed to create directory: %v", err)
+		}
+		log.WithField("state", e.State).Infof("Getting (%d/%d) %s", i+1, len(sess.Files), filepath.Base(e.Dest))
+		downloader, err := newDownload(e.Dest)
+		if err != nil {
+			return err
+		}
+		if err := downloadWikiFirmware(download.WikiFirmware{URL: e.URL, Sha1Hash: e.Sha1}, e.Dest, downloader, conf, sess); err != nil {
+			return err
+		}
+	}
+	return nil
+}
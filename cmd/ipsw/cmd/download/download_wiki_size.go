@@ -0,0 +1,156 @@
+/*
+Copyright © 2018-2023 blacktop
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package download
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"text/tabwriter"
+
+	"github.com/AlecAivazis/survey/v2"
+	"github.com/apex/log"
+	"github.com/blacktop/ipsw/internal/download"
+	"github.com/blacktop/ipsw/internal/utils"
+	"github.com/dustin/go-humanize"
+)
+
+var (
+	// wikiContentLength returns the Content-Length of a HEAD request for url
+	wikiContentLength = func(client *http.Client, url string) (int64, error) {
+		resp, err := client.Head(url)
+		if err != nil {
+			return 0, err
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return 0, fmt.Errorf("HEAD %s: %s", url, resp.Status)
+		}
+		return resp.ContentLength, nil
+	}
+	wikiFreeDiskSpace = utils.FreeDiskSpace
+)
+
+// wikiDownloadEstimate is the size of a multi-firmware download
+type wikiDownloadEstimate struct {
+	Sizes   []int64 // per firmware (0 if unknown)
+	Total   int64
+	Unknown int // how many firmwares have an unknown size
+}
+
+// estimateWikiDownload sums the wiki's FileSize of fws, asking contentLength for the ones the wiki doesn't list
+func estimateWikiDownload(fws []download.WikiFirmware, contentLength func(string) (int64, error)) wikiDownloadEstimate {
+	est := wikiDownloadEstimate{Sizes: make([]int64, len(fws))}
+	for i, fw := range fws {
+		size := int64(fw.FileSize)
+		if size <= 0 {
+			var err error
+			if size, err = contentLength(fw.URL); err != nil || size <= 0 {
+				log.WithError(err).Debugf("failed to get the size of %s", fw.URL)
+				size = 0
+			}
+		}
+		if size == 0 {
+			est.Unknown++
+		}
+		est.Sizes[i] = size
+		est.Total += size
+	}
+	return est
+}
+
+// printWikiDownloadEstimate prints the size of each firmware, the total and the free space for dir;
+// it warns and returns false if the known sizes alone don't fit
+func printWikiDownloadEstimate(w io.Writer, fws []download.WikiFirmware, est wikiDownloadEstimate, dir string) bool {
+	if len(dir) == 0 {
+		dir = "."
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "FILE\tSIZE")
+	for i, fw := range fws {
+		size := "?"
+		if est.Sizes[i] > 0 {
+			size = humanize.Bytes(uint64(est.Sizes[i]))
+		}
+		fmt.Fprintf(tw, "%s\t%s\n", path.Base(fw.URL), size)
+	}
+	tw.Flush()
+
+	total := humanize.Bytes(uint64(est.Total))
+	if est.Unknown > 0 {
+		total += fmt.Sprintf(" (+ %d of unknown size)", est.Unknown)
+	}
+	fmt.Fprintf(w, "\nTotal: %s\n", total)
+
+	free, err := freeDiskSpace(dir)
+	if err != nil {
+		log.WithError(err).Warnf("failed to get the free disk space for %s", dir)
+		return true
+	}
+	fmt.Fprintf(w, "Free:  %s (%s)\n", humanize.Bytes(free), dir)
+	if uint64(est.Total) > free {
+		log.Warnf("Not enough free disk space in %s (need %s, have %s)", dir, humanize.Bytes(uint64(est.Total)), humanize.Bytes(free))
+		return false
+	}
+	return true
+}
+
+// freeDiskSpace returns the free disk space for dir or its closest existing parent (as it is created on download)
+func freeDiskSpace(dir string) (uint64, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return 0, err
+	}
+	for {
+		if _, err := os.Stat(dir); err == nil || !errors.Is(err, os.ErrNotExist) || filepath.Dir(dir) == dir {
+			break
+		}
+		dir = filepath.Dir(dir)
+	}
+	return wikiFreeDiskSpace(dir)
+}
+
+// confirmWikiDownload prints the download size estimate of fws and asks whether to download them
+func confirmWikiDownload(w io.Writer, fws []download.WikiFirmware, kind, dir string, dl *download.DownloadConfig) (bool, error) {
+	client, err := dl.NewClient()
+	if err != nil {
+		return false, err
+	}
+	est := estimateWikiDownload(fws, func(url string) (int64, error) {
+		return wikiContentLength(client, url)
+	})
+	msg := "Continue?"
+	if !printWikiDownloadEstimate(w, fws, est, dir) {
+		msg = "Continue anyway?"
+	}
+
+	cont := false
+	prompt := &survey.Confirm{
+		Message: fmt.Sprintf("You are about to download %d %s files (%s). %s", len(fws), kind, humanize.Bytes(uint64(est.Total)), msg),
+	}
+	survey.AskOne(prompt, &cont)
+	return cont, nil
+}
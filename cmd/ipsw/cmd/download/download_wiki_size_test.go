@@ -0,0 +1,73 @@
+package download
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/blacktop/ipsw/internal/download"
+)
+
+func TestEstimateWikiDownload(t *testing.T) {
+	fws := []download.WikiFirmware{
+		{URL: "https://updates.cdn-apple.com/a/iPhone15,2_17.0_21A329_Restore.ipsw", FileSize: 7_000_000_000},
+		{URL: "https://updates.cdn-apple.com/b/iPhone15,3_17.0_21A329_Restore.ipsw"}, // filled in with HEAD
+		{URL: "https://updates.cdn-apple.com/c/iPhone14,2_17.0_21A329_Restore.ipsw"}, // unknown
+	}
+	var heads []string
+	est := estimateWikiDownload(fws, func(url string) (int64, error) {
+		heads = append(heads, url)
+		if strings.Contains(url, "/b/") {
+			return 6_500_000_000, nil
+		}
+		return 0, fmt.Errorf("HEAD %s: 404 Not Found", url)
+	})
+	if want := []int64{7_000_000_000, 6_500_000_000, 0}; !reflect.DeepEqual(est.Sizes, want) {
+		t.Errorf("Sizes = %v, want %v", est.Sizes, want)
+	}
+	if est.Total != 13_500_000_000 || est.Unknown != 1 {
+		t.Errorf("Total = %d, Unknown = %d, want 13500000000, 1", est.Total, est.Unknown)
+	}
+	// firmwares the wiki lists a size for aren't HEADed
+	if want := []string{fws[1].URL, fws[2].URL}; !reflect.DeepEqual(heads, want) {
+		t.Errorf("HEAD requests = %v, want %v", heads, want)
+	}
+
+	defer func(f func(string) (uint64, error)) { wikiFreeDiskSpace = f }(wikiFreeDiskSpace)
+	var statted string
+	for _, tt := range []struct {
+		free   uint64
+		enough bool
+	}{
+		{20_000_000_000, true},
+		{10_000_000_000, false},
+	} {
+		wikiFreeDiskSpace = func(path string) (uint64, error) {
+			statted = path
+			return tt.free, nil
+		}
+		var buf bytes.Buffer
+		tmp := t.TempDir()
+		dir := filepath.Join(tmp, "not", "created", "yet")
+		if enough := printWikiDownloadEstimate(&buf, fws, est, dir); enough != tt.enough {
+			t.Errorf("printWikiDownloadEstimate(free=%d) = %t, want %t", tt.free, enough, tt.enough)
+		}
+		if statted != tmp {
+			t.Errorf("free space checked for %s, want the closest existing parent of %s", statted, dir)
+		}
+		out := buf.String()
+		for _, want := range []string{
+			"iPhone15,2_17.0_21A329_Restore.ipsw  7.0 GB\n",
+			"iPhone15,3_17.0_21A329_Restore.ipsw  6.5 GB\n",
+			"iPhone14,2_17.0_21A329_Restore.ipsw  ?\n",
+			"Total: 14 GB (+ 1 of unknown size)\n",
+		} {
+			if !strings.Contains(out, want) {
+				t.Errorf("printWikiDownloadEstimate() output =\n%s\nwant it to contain %q", out, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,331 @@
+package download
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/blacktop/ipsw/internal/download"
+	"github.com/blacktop/ipsw/pkg/tss"
+	"github.com/spf13/pflag"
+)
+
+var wikiTestFirmwares = []download.WikiFirmware{
+	{
+		Version:  "17.0",
+		Build:    "21A329",
+		Devices:  []string{"iPhone15,2"},
+		URL:      "https://updates.cdn-apple.com/2023FallFCS/fullrestores/042-54861/iPhone15,2_17.0_21A329_Restore.ipsw",
+		FileSize: 7149483421,
+	},
+	{
+		Version:  "17.0.1",
+		Build:    "21A340",
+		Devices:  []string{"iPhone15,2", "iPhone15,3"},
+		URL:      "https://updates.cdn-apple.com/2023FallFCS/fullrestores/042-62345/iPhone15,2_17.0.1_21A340_Restore.ipsw",
+		FileSize: 7150000000,
+	},
+	{
+		Version: "17.0",
+		Build:   "21A329",
+		Devices: []string{"iPhone14,7"},
+		URL:     "https://updates.cdn-apple.com/2023FallFCS/fullrestores/042-54862/iPhone14,7_17.0_21A329_Restore.ipsw",
+	},
+}
+
+func mockWikiScrape(t *testing.T) *download.WikiConfig {
+	t.Helper()
+	var got download.WikiConfig
+	origIPSWs, origOTAs := getWikiIPSWs, getWikiOTAs
+	mock := func(cfg *download.WikiConfig, dl *download.DownloadConfig) ([]download.WikiFirmware, error) {
+		got = *cfg
+		return wikiTestFirmwares, nil
+	}
+	getWikiIPSWs, getWikiOTAs = mock, mock
+	t.Cleanup(func() { getWikiIPSWs, getWikiOTAs = origIPSWs, origOTAs })
+	return &got
+}
+
+func runWikiCmd(t *testing.T, args ...string) (string, error) {
+	t.Helper()
+	for _, name := range []string{"ipsw", "ota", "json", "print-json", "urls", "only-url", "dry-run", "table", "group-by", "db", "history", "since", "sort", "no-trunc", "device", "version", "build", "confirm", "keys", "component", "check-signed", "format"} {
+		f := wikiCmd.Flags().Lookup(name)
+		if f == nil {
+			f = DownloadCmd.PersistentFlags().Lookup(name)
+		}
+		if sv, ok := f.Value.(pflag.SliceValue); ok {
+			sv.Replace(nil)
+		} else {
+			f.Value.Set(f.DefValue)
+		}
+		f.Changed = false
+	}
+	var out bytes.Buffer
+	DownloadCmd.SetOut(&out)
+	DownloadCmd.SetArgs(append([]string{"wiki"}, args...))
+	t.Cleanup(func() {
+		DownloadCmd.SetOut(nil)
+		DownloadCmd.SetArgs(nil)
+	})
+	err := DownloadCmd.Execute()
+	return out.String(), err
+}
+
+func TestWikiCmdURLs(t *testing.T) {
+	mockWikiScrape(t)
+	for _, kind := range []string{"--ipsw", "--ota"} {
+		out, err := runWikiCmd(t, kind, "--device", "iPhone15,2", "--urls")
+		if err != nil {
+			t.Fatalf("wiki %s --urls error = %v", kind, err)
+		}
+		want := wikiTestFirmwares[0].URL + "\n" + wikiTestFirmwares[1].URL + "\n"
+		if out != want {
+			t.Errorf("wiki %s --urls stdout = %q, want %q", kind, out, want)
+		}
+	}
+	if _, err := runWikiCmd(t, "--ipsw", "--device", "iPhone15,2", "--build", "99Z999", "--urls"); err == nil {
+		t.Error("expected error when --urls matches nothing")
+	}
+}
+
+func TestWikiCmdOnlyURL(t *testing.T) {
+	mockWikiScrape(t)
+	out, err := runWikiCmd(t, "--ipsw", "--device", "iPhone15,2", "--build", "21A340", "--only-url")
+	if err != nil {
+		t.Fatalf("wiki --only-url error = %v", err)
+	}
+	if want := wikiTestFirmwares[1].URL + "\n"; out != want {
+		t.Errorf("wiki --only-url stdout = %q, want %q", out, want)
+	}
+
+	out, err = runWikiCmd(t, "--ipsw", "--device", "iPhone15,2", "--build", "99Z999", "--only-url")
+	if err == nil {
+		t.Error("expected error when --only-url matches nothing")
+	}
+	if out != "" {
+		t.Errorf("wiki --only-url with no matches stdout = %q, want nothing", out)
+	}
+
+	// it is an alias of --urls
+	if _, err := runWikiCmd(t, "--ipsw", "--device", "iPhone15,2", "--only-url", "--print-json"); err == nil {
+		t.Error("expected error when combining --only-url and --print-json")
+	}
+}
+
+func TestWikiCmdHistory(t *testing.T) {
+	mockWikiScrape(t)
+	path := filepath.Join(t.TempDir(), "wiki.db")
+	for i := 0; i < 2; i++ {
+		if _, err := runWikiCmd(t, "--ipsw", "--device", "iPhone15,2", "--db", path, "--urls"); err != nil {
+			t.Fatalf("wiki --db error = %v", err)
+		}
+	}
+	out, err := runWikiCmd(t, "--history", "--db", path, "--device", "iPhone14,7")
+	if err != nil {
+		t.Fatalf("wiki --history error = %v", err)
+	}
+	if lines := strings.Split(strings.TrimSpace(out), "\n"); len(lines) != 2 || !strings.Contains(lines[1], "21A329") {
+		t.Errorf("wiki --history output:\n%s", out)
+	}
+	if _, err := runWikiCmd(t, "--history", "--db", filepath.Join(t.TempDir(), "wiki_db.json")); err == nil {
+		t.Error("expected error for --history without a SQLite --db")
+	}
+}
+
+func TestWikiCmdJSON(t *testing.T) {
+	cfg := mockWikiScrape(t)
+	out, err := runWikiCmd(t, "--ipsw", "--device", "iPhone14,7", "--sort", "newest", "--print-json")
+	if err != nil {
+		t.Fatalf("wiki --print-json error = %v", err)
+	}
+	var got []download.WikiFirmware
+	if err := json.Unmarshal([]byte(out), &got); err != nil {
+		t.Fatalf("wiki --print-json output is not JSON: %v\n%s", err, out)
+	}
+	if want := wikiTestFirmwares[2:]; !reflect.DeepEqual(got, want) {
+		t.Errorf("wiki --print-json = %+v, want %+v", got, want)
+	}
+	if cfg.SortOrder != download.WikiSortNewest || cfg.Device != "iPhone14,7" {
+		t.Errorf("scrape config = %+v", cfg)
+	}
+
+	out, err = runWikiCmd(t, "--ipsw", "--device", "iPhone9,9", "--print-json")
+	if err != nil {
+		t.Fatalf("wiki --print-json error = %v", err)
+	}
+	if strings.TrimSpace(out) != "[]" {
+		t.Errorf("wiki --print-json with no matches = %q, want []", out)
+	}
+}
+
+func TestWikiCmdGroupBy(t *testing.T) {
+	mockWikiScrape(t)
+	out, err := runWikiCmd(t, "--ipsw", "--device", "iPhone15,2", "--print-json", "--group-by", "version,device")
+	if err != nil {
+		t.Fatalf("wiki --group-by error = %v", err)
+	}
+	var got map[string]map[string][]download.WikiFirmware
+	if err := json.Unmarshal([]byte(out), &got); err != nil {
+		t.Fatalf("wiki --group-by output is not grouped JSON: %v\n%s", err, out)
+	}
+	if len(got) != 2 || len(got["17.0"]["iPhone15,2"]) != 1 || len(got["17.0.1"]["iPhone15,3"]) != 1 {
+		t.Errorf("wiki --group-by version,device = %v", got)
+	}
+
+	if _, err := runWikiCmd(t, "--ipsw", "--device", "iPhone15,2", "--urls", "--group-by", "device"); err == nil {
+		t.Error("expected error for --group-by without --print-json")
+	}
+}
+
+func TestWikiCmdDryRun(t *testing.T) {
+	mockWikiScrape(t)
+	out, err := runWikiCmd(t, "--ipsw", "--device", "iPhone15,2", "--dry-run")
+	if err != nil {
+		t.Fatalf("wiki --dry-run error = %v", err)
+	}
+	for _, want := range []string{"DEVICE", "21A329", "21A340", "Would download 2 file(s) (13 GiB)"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("wiki --dry-run output missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestWikiCmdTable(t *testing.T) {
+	mockWikiScrape(t)
+	out, err := runWikiCmd(t, "--ipsw", "--device", "iPhone15,2", "--table")
+	if err != nil {
+		t.Fatalf("wiki --table error = %v", err)
+	}
+	if !strings.Contains(out, "| Version |") || !strings.Contains(out, "+---") {
+		t.Errorf("wiki --table output is not a bordered table:\n%s", out)
+	}
+}
+
+func TestWikiCmdCheckSigned(t *testing.T) {
+	mockWikiScrape(t)
+	orig := checkSigning
+	t.Cleanup(func() { checkSigning = orig })
+	checkSigning = func(ctx context.Context, fws []download.WikiFirmware, conf *tss.SigningConfig) error {
+		signed := true
+		fws[0].Signed = &signed
+		return nil
+	}
+
+	out, err := runWikiCmd(t, "--ipsw", "--device", "iPhone15,2", "--table", "--check-signed")
+	if err != nil {
+		t.Fatalf("wiki --table --check-signed error = %v", err)
+	}
+	if !strings.Contains(out, "| Signed |") || !strings.Contains(out, "| yes ") {
+		t.Errorf("wiki --table --check-signed is missing the signed column:\n%s", out)
+	}
+
+	if _, err := runWikiCmd(t, "--ipsw", "--device", "iPhone15,2", "--urls", "--check-signed"); err == nil {
+		t.Error("expected error for --check-signed without --print-json or --table")
+	}
+}
+
+func TestWikiCmdFormat(t *testing.T) {
+	mockWikiScrape(t)
+	out, err := runWikiCmd(t, "--ipsw", "--device", "iPhone15,2", "--format", `{{.Build}}\t{{join .Devices ","}}`)
+	if err != nil {
+		t.Fatalf("wiki --format error = %v", err)
+	}
+	if want := "21A329\tiPhone15,2\n21A340\tiPhone15,2,iPhone15,3\n"; out != want {
+		t.Errorf("wiki --format stdout = %q, want %q", out, want)
+	}
+
+	// a bad template fails before the wiki is queried
+	var queried bool
+	origIPSWs := getWikiIPSWs
+	getWikiIPSWs = func(cfg *download.WikiConfig, dl *download.DownloadConfig) ([]download.WikiFirmware, error) {
+		queried = true
+		return wikiTestFirmwares, nil
+	}
+	t.Cleanup(func() { getWikiIPSWs = origIPSWs })
+	if _, err := runWikiCmd(t, "--ipsw", "--device", "iPhone15,2", "--format", "{{.Build"); err == nil {
+		t.Error("expected error for an unparsable --format")
+	}
+	if queried {
+		t.Error("wiki was queried with an unparsable --format")
+	}
+}
+
+func TestWikiCmdListModesExclusive(t *testing.T) {
+	mockWikiScrape(t)
+	if _, err := runWikiCmd(t, "--ipsw", "--device", "iPhone15,2", "--urls", "--print-json"); err == nil {
+		t.Error("expected error when combining --urls and --print-json")
+	}
+}
+
+func TestWikiCmdJSONMetadata(t *testing.T) {
+	// --json still stores metadata in the local JSON database (printing is --print-json)
+	mockWikiScrape(t)
+	if _, err := runWikiCmd(t, "--ipsw", "--device", "iPhone15,2", "--json", "--db", filepath.Join(t.TempDir(), "wiki.db")); err == nil || !strings.Contains(err.Error(), "--json requires a JSON --db") {
+		t.Errorf("wiki --json with a SQLite --db error = %v, want the JSON database error", err)
+	}
+	if _, err := runWikiCmd(t, "--ipsw", "--device", "iPhone15,2", "--json", "--print-json"); err == nil {
+		t.Error("expected error when combining --json and --print-json")
+	}
+}
+
+func TestSplitWikiWatchDevices(t *testing.T) {
+	got := splitWikiWatchDevices("iPhone16,1, iPhone16,2,iPad13,18,")
+	if want := []string{"iPhone16,1", "iPhone16,2", "iPad13,18"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("splitWikiWatchDevices() = %v, want %v", got, want)
+	}
+}
+
+func TestWikiCmdComponent(t *testing.T) {
+	orig := getWikiFirmwareKeys
+	t.Cleanup(func() { getWikiFirmwareKeys = orig })
+	getWikiFirmwareKeys = func(cfg *download.WikiConfig, dl *download.DownloadConfig) ([]download.WikiFWKeys, error) {
+		return []download.WikiFWKeys{
+			{Device: "iPhone15,3", Build: "21A329", IBootIV: "11", IBootKey: "22"},
+			{Device: "iPhone15,2", Build: "21A329", IBoot: "iBoot.d73.RELEASE.im4p", IBootIV: "aa", IBootKey: "bb", LLBIV: "Not Encrypted", LLBKey: "Not Encrypted"},
+		}, nil
+	}
+
+	out, err := runWikiCmd(t, "--keys", "--device", "iPhone15,2", "--build", "21A329", "--component", "iBoot")
+	if err != nil {
+		t.Fatalf("wiki --component error = %v", err)
+	}
+	if want := "IV:  aa\nKey: bb\n"; out != want {
+		t.Errorf("wiki --component stdout = %q, want %q", out, want)
+	}
+
+	out, err = runWikiCmd(t, "--keys", "--device", "iPhone15,2", "--build", "21A329", "--component", "ibot", "--print-json")
+	if err != nil {
+		t.Fatalf("wiki --component --print-json error = %v", err)
+	}
+	if want := `{"component":"IBoot","type":"ibot","file_name":"iBoot.d73.RELEASE.im4p","iv":"aa","key":"bb","encrypted":true}` + "\n"; out != want {
+		t.Errorf("wiki --component --print-json stdout = %q, want %q", out, want)
+	}
+
+	if out, err = runWikiCmd(t, "--keys", "--device", "iPhone15,2", "--build", "21A329", "--component", "LLB"); err != nil || !strings.Contains(out, "not encrypted") {
+		t.Errorf("wiki --component LLB = %q, %v", out, err)
+	}
+	if _, err := runWikiCmd(t, "--keys", "--device", "iPhone15,2", "--build", "21A329", "--component", "iBEC"); err == nil {
+		t.Error("expected error for a component without keys")
+	}
+	if _, err := runWikiCmd(t, "--keys", "--device", "iPhone15,2", "--build", "21A329", "--component", "modem"); err == nil {
+		t.Error("expected error for an unknown component")
+	}
+	if _, err := runWikiCmd(t, "--keys", "--device", "iPhone15,2", "--build", "21A340", "--component", "iBoot"); !errors.Is(err, download.ErrWikiNotFound) {
+		t.Errorf("wiki --component for a build without keys error = %v, want ErrWikiNotFound", err)
+	}
+	if _, err := runWikiCmd(t, "--keys", "--device", "iPhone15,2", "--component", "iBoot"); err == nil {
+		t.Error("expected error for --component without --build")
+	}
+}
+
+func TestWikiCmdUnknownDevice(t *testing.T) {
+	// the real scrape fails on the device before querying the wiki
+	if _, err := runWikiCmd(t, "--ipsw", "--device", "Bogus9,9", "--urls"); !errors.Is(err, download.ErrWikiUnknownDevice) {
+		t.Errorf("wiki --device Bogus9,9 error = %v, want ErrWikiUnknownDevice", err)
+	}
+}
@@ -0,0 +1,151 @@
+/*
+Copyright © 2018-2023 blacktop
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package download
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/blacktop/ipsw/internal/download"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func init() {
+	wikiCmd.AddCommand(wikiWatchCmd)
+
+	wikiWatchCmd.Flags().Bool("ota", false, "Watch the OTA pages instead of the IPSW pages")
+	wikiWatchCmd.Flags().Bool("beta", false, "Watch the beta pages")
+	wikiWatchCmd.Flags().Duration("interval", 30*time.Minute, "How often to check the wiki")
+	wikiWatchCmd.Flags().String("webhook", "", "URL to POST new firmwares to (as JSON)")
+	wikiWatchCmd.Flags().Int("retries", 5, "How many times to retry a failed webhook POST")
+	wikiWatchCmd.Flags().String("state", "", "Path to the watch state file (default is $HOME/.config/ipsw/wiki_watch.json)")
+	viper.BindPFlag("download.wiki.watch.ota", wikiWatchCmd.Flags().Lookup("ota"))
+	viper.BindPFlag("download.wiki.watch.beta", wikiWatchCmd.Flags().Lookup("beta"))
+	viper.BindPFlag("download.wiki.watch.interval", wikiWatchCmd.Flags().Lookup("interval"))
+	viper.BindPFlag("download.wiki.watch.webhook", wikiWatchCmd.Flags().Lookup("webhook"))
+	viper.BindPFlag("download.wiki.watch.retries", wikiWatchCmd.Flags().Lookup("retries"))
+	viper.BindPFlag("download.wiki.watch.state", wikiWatchCmd.Flags().Lookup("state"))
+}
+
+// wikiWatchCmd represents the wiki watch command
+var wikiWatchCmd = &cobra.Command{
+	Use:   "watch",
+	Short: "Watch theiphonewiki.com for new firmwares and notify a webhook",
+	Example: `  # Check for new iPhone16,1 IPSWs every 30 minutes and POST them to a webhook
+  ❯ ipsw download wiki watch --device iPhone16,1 --interval 30m --webhook https://example.com/hook
+
+  # Watch several devices (comma separated) for new beta OTAs
+  ❯ ipsw download wiki watch --device iPhone16,1,iPhone16,2 --ota --beta`,
+	Args:          cobra.NoArgs,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		if viper.GetBool("verbose") {
+			log.SetLevel(log.DebugLevel)
+		}
+
+		viper.BindPFlag("download.device", cmd.Flags().Lookup("device"))
+
+		dl, err := ResolveDownloadConfig(cmd)
+		if err != nil {
+			return err
+		}
+
+		devices := splitWikiWatchDevices(viper.GetString("download.device"))
+		if len(devices) == 0 {
+			return fmt.Errorf("must specify at least one --device")
+		}
+
+		statePath := viper.GetString("download.wiki.watch.state")
+		if len(statePath) == 0 {
+			indexPath, err := wikiIndexPath()
+			if err != nil {
+				return err
+			}
+			statePath = filepath.Join(filepath.Dir(indexPath), "wiki_watch.json")
+		}
+
+		watcher, err := download.NewWikiWatcher(download.WikiWatchConfig{
+			Devices:        devices,
+			OTA:            viper.GetBool("download.wiki.watch.ota"),
+			Beta:           viper.GetBool("download.wiki.watch.beta"),
+			Interval:       viper.GetDuration("download.wiki.watch.interval"),
+			Webhook:        viper.GetString("download.wiki.watch.webhook"),
+			StatePath:      statePath,
+			WebhookRetries: viper.GetInt("download.wiki.watch.retries"),
+			Download:       dl,
+		})
+		if err != nil {
+			return err
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		log.Infof("Watching theiphonewiki.com every %s (Ctrl+C to stop)", viper.GetDuration("download.wiki.watch.interval"))
+		if err := watcher.Run(ctx); err != nil {
+			return err
+		}
+		log.Info("Stopped watching")
+		return nil
+	},
+}
+
+// splitWikiWatchDevices splits a comma separated list of product types (which contain commas themselves)
+func splitWikiWatchDevices(s string) []string {
+	var devices []string
+	parts := strings.Split(s, ",")
+	for i := 0; i < len(parts); i++ {
+		part := strings.TrimSpace(parts[i])
+		if len(part) == 0 {
+			continue
+		}
+		// "iPhone16,1" is split into "iPhone16" and "1"
+		if i+1 < len(parts) && isAllDigits(strings.TrimSpace(parts[i+1])) {
+			part += "," + strings.TrimSpace(parts[i+1])
+			i++
+		}
+		devices = append(devices, part)
+	}
+	return devices
+}
+
+func isAllDigits(s string) bool {
+	if len(s) == 0 {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -113,7 +113,10 @@ var xcodeCmd = &cobra.Command{
 
 			if dl.Authentication == "" {
 				log.Infof("Downloading %s...", dl.Name)
-				downloader := download.NewDownload(proxy, insecure, skipAll, resumeAll, restartAll, false, viper.GetBool("verbose"))
+				downloader, err := download.NewDownload(proxy, insecure, skipAll, resumeAll, restartAll, false, viper.GetBool("verbose"), viper.GetDuration("timeout"))
+				if err != nil {
+					return err
+				}
 				downloader.URL = dl.Source
 				downloader.DestName = path.Base(dl.Source)
 				if err := downloader.Do(); err != nil {
@@ -179,7 +182,10 @@ var xcodeCmd = &cobra.Command{
 		if err != nil {
 			return err
 		}
-		downloader := download.NewDownload(proxy, insecure, skipAll, resumeAll, restartAll, false, viper.GetBool("verbose"))
+		downloader, err := download.NewDownload(proxy, insecure, skipAll, resumeAll, restartAll, false, viper.GetBool("verbose"), viper.GetDuration("timeout"))
+		if err != nil {
+			return err
+		}
 		downloader.URL = download.XcodeDlURL + "/" + choice
 		downloader.Sha1 = sha1
 		downloader.DestName = choice
@@ -45,6 +45,11 @@ func init() {
 	DisassCmd.Flags().Uint64P("count", "c", 0, "Number of instructions to disassemble")
 	DisassCmd.Flags().BoolP("demangle", "d", false, "Demangle symbol names")
 	DisassCmd.Flags().BoolP("json", "j", false, "Output as JSON")
+	DisassCmd.Flags().Bool("groups", false, "Include each instruction's control-flow groups (jump/call/ret/...) in the --json output")
+	DisassCmd.Flags().Bool("simplify", false, "Rewrite common idioms to their pseudo-instructions (i.e. movz/movk => mov #imm)")
+	DisassCmd.Flags().Bool("mem-only", false, "Only print the instructions that access memory (loads/stores) or compute an address with adrp")
+	DisassCmd.Flags().Bool("no-wrap", false, "Do NOT wrap long lines at the terminal's width")
+	DisassCmd.Flags().Bool("relative", false, "Print addresses (and branch targets within the function) as offsets from the function start")
 	DisassCmd.Flags().BoolP("quiet", "q", false, "Do NOT markup analysis (Faster)")
 	DisassCmd.Flags().String("input", "", "Input function JSON file")
 	DisassCmd.Flags().String("cache", "", "Path to .a2s addr to sym cache file (speeds up analysis)")
@@ -55,6 +60,11 @@ func init() {
 	viper.BindPFlag("dyld.disass.count", DisassCmd.Flags().Lookup("count"))
 	viper.BindPFlag("dyld.disass.demangle", DisassCmd.Flags().Lookup("demangle"))
 	viper.BindPFlag("dyld.disass.json", DisassCmd.Flags().Lookup("json"))
+	viper.BindPFlag("dyld.disass.groups", DisassCmd.Flags().Lookup("groups"))
+	viper.BindPFlag("dyld.disass.simplify", DisassCmd.Flags().Lookup("simplify"))
+	viper.BindPFlag("dyld.disass.mem-only", DisassCmd.Flags().Lookup("mem-only"))
+	viper.BindPFlag("dyld.disass.no-wrap", DisassCmd.Flags().Lookup("no-wrap"))
+	viper.BindPFlag("dyld.disass.relative", DisassCmd.Flags().Lookup("relative"))
 	viper.BindPFlag("dyld.disass.quiet", DisassCmd.Flags().Lookup("quiet"))
 	viper.BindPFlag("dyld.disass.color", DisassCmd.Flags().Lookup("color"))
 	viper.BindPFlag("dyld.disass.input", DisassCmd.Flags().Lookup("input"))
@@ -90,11 +100,22 @@ var DisassCmd = &cobra.Command{
 
 		demangleFlag := viper.GetBool("dyld.disass.demangle")
 		asJSON := viper.GetBool("dyld.disass.json")
+		withGroups := viper.GetBool("dyld.disass.groups")
+		simplify := viper.GetBool("dyld.disass.simplify")
+		memOnly := viper.GetBool("dyld.disass.mem-only")
+		noWrap := viper.GetBool("dyld.disass.no-wrap")
+		relative := viper.GetBool("dyld.disass.relative")
 		quiet := viper.GetBool("dyld.disass.quiet")
 
 		funcFile := viper.GetString("dyld.disass.input")
 		cacheFile := viper.GetString("dyld.disass.cache")
 
+		if withGroups && !asJSON {
+			return fmt.Errorf("--groups requires --json")
+		}
+		if memOnly && asJSON {
+			return fmt.Errorf("--mem-only can NOT be used with --json")
+		}
 		if len(symbolName) > 0 && startAddr != 0 {
 			return fmt.Errorf("you can only use --symbol OR --vaddr (not both)")
 		} else if len(funcFile) > 0 && (len(symbolName) > 0 || startAddr != 0 || len(imageName) > 0) {
@@ -188,6 +209,11 @@ var DisassCmd = &cobra.Command{
 						StartAddress: fn.StartAddr,
 						Middle:       0,
 						AsJSON:       asJSON,
+						Groups:       withGroups,
+						Simplify:     simplify,
+						MemOnly:      memOnly,
+						NoWrap:       noWrap,
+						Relative:     relative,
 						Demangle:     demangleFlag,
 						Quite:        quiet,
 						Color:        viper.GetBool("color"),
@@ -221,7 +247,9 @@ var DisassCmd = &cobra.Command{
 					//***************
 					//* DISASSEMBLE *
 					//***************
-					disass.Disassemble(engine)
+					if err := disass.Disassemble(engine); err != nil {
+						log.Warn(err.Error())
+					}
 				}
 
 				return nil
@@ -284,6 +312,11 @@ var DisassCmd = &cobra.Command{
 					StartAddress: fn.Start,
 					Middle:       0,
 					AsJSON:       asJSON,
+					Groups:       withGroups,
+					Simplify:     simplify,
+					MemOnly:      memOnly,
+					NoWrap:       noWrap,
+					Relative:     relative,
 					Demangle:     demangleFlag,
 					Quite:        quiet,
 					Color:        viper.GetBool("color"),
@@ -321,7 +354,9 @@ var DisassCmd = &cobra.Command{
 				//***************
 				//* DISASSEMBLE *
 				//***************
-				disass.Disassemble(engine)
+				if err := disass.Disassemble(engine); err != nil {
+					log.Warn(err.Error())
+				}
 			}
 		} else {
 			/*
@@ -393,6 +428,11 @@ var DisassCmd = &cobra.Command{
 				StartAddress: startAddr,
 				Middle:       middleAddr,
 				AsJSON:       asJSON,
+				Groups:       withGroups,
+				Simplify:     simplify,
+				MemOnly:      memOnly,
+				NoWrap:       noWrap,
+				Relative:     relative,
 				Demangle:     demangleFlag,
 				Quite:        quiet,
 				Color:        viper.GetBool("color"),
@@ -423,7 +463,9 @@ var DisassCmd = &cobra.Command{
 			//***************
 			//* DISASSEMBLE *
 			//***************
-			disass.Disassemble(engine)
+			if err := disass.Disassemble(engine); err != nil {
+				log.Warn(err.Error())
+			}
 		}
 
 		return nil
@@ -128,6 +128,7 @@ var extractCmd = &cobra.Command{
 			DriverKit: viper.GetBool("extract.driverkit"),
 			Proxy:     viper.GetString("extract.proxy"),
 			Insecure:  viper.GetBool("extract.insecure"),
+			Timeout:   viper.GetDuration("timeout"),
 			DMGs:      false,
 			DmgType:   viper.GetString("extract.dmg"),
 			Flatten:   viper.GetBool("extract.flat"),
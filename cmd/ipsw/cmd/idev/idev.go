@@ -22,6 +22,7 @@ THE SOFTWARE.
 package idev
 
 import (
+	"github.com/blacktop/ipsw/pkg/usb"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
@@ -40,6 +41,7 @@ var IDevCmd = &cobra.Command{
 		viper.BindPFlag("color", cmd.Flags().Lookup("color"))
 		viper.BindPFlag("verbose", cmd.Flags().Lookup("verbose"))
 		viper.BindPFlag("diff-tool", cmd.Flags().Lookup("diff-tool"))
+		usb.Timeout = viper.GetDuration("timeout")
 	},
 	Run: func(cmd *cobra.Command, args []string) {
 		cmd.Help()
@@ -27,19 +27,26 @@ import (
 	"encoding/json"
 	"fmt"
 	"image/png"
+	"io"
 	"net/url"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/apex/log"
+	"github.com/blacktop/ipsw/internal/output"
 	"github.com/blacktop/ipsw/internal/utils"
+	"github.com/blacktop/ipsw/pkg/tss"
+	"github.com/blacktop/ipsw/pkg/usb"
+	"github.com/blacktop/ipsw/pkg/usb/lockdownd"
 	"github.com/blacktop/ipsw/pkg/usb/mount"
 	"github.com/boombuler/barcode"
 	"github.com/boombuler/barcode/qr"
 	"github.com/fatih/color"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+	"golang.org/x/term"
 )
 
 func init() {
@@ -52,8 +59,17 @@ func init() {
 	nonceCmd.Flags().String("url", "", "QR code URL")
 	nonceCmd.Flags().StringP("mail", "m", "", "QR mailto address")
 	nonceCmd.Flags().StringP("subject", "s", "Device Nonce Info", "QR mailto subject")
-	nonceCmd.Flags().StringP("output", "o", "", "Folder to write QR code PNG to")
+	nonceCmd.Flags().StringP("output", "o", "", "Folder to write QR code PNG to (use '-' to write the PNG to stdout)")
+	nonceCmd.Flags().String("capture", "", "Folder to write the QR code PNG and a JSON sidecar to (named by ECID)")
+	nonceCmd.Flags().Bool("full", false, "Include everything a signing (TSS) request needs in the --json (product type, board/chip, build, etc)")
+	nonceCmd.Flags().Bool("refresh", false, "Re-query the device info cached for --full (i.e. after a software update)")
+	nonceCmd.Flags().BoolP("all", "a", false, "Query every connected device (with --capture, or --qr-code --output to write each device's QR code to <output>/<udid>/)")
+	nonceCmd.Flags().Bool("open", false, "Open the --qr-code image on macOS if the terminal can't display it")
 	nonceCmd.MarkFlagDirname("output")
+	nonceCmd.MarkFlagDirname("capture")
+	for _, flag := range []string{"qr-code", "readable", "json", "output"} {
+		nonceCmd.MarkFlagsMutuallyExclusive("capture", flag)
+	}
 }
 
 // nonceCmd represents the nonce command
@@ -79,11 +95,64 @@ var nonceCmd = &cobra.Command{
 		email, _ := cmd.Flags().GetString("mail")
 		emailSubject, _ := cmd.Flags().GetString("subject")
 		output, _ := cmd.Flags().GetString("output")
+		capture, _ := cmd.Flags().GetString("capture")
+		full, _ := cmd.Flags().GetBool("full")
+		refresh, _ := cmd.Flags().GetBool("refresh")
+		openImage, _ := cmd.Flags().GetBool("open")
+		all, _ := cmd.Flags().GetBool("all")
 		// Validate flags
-		if asQrCode && readable {
+		if full && !asJSON {
+			return fmt.Errorf("--full requires --json")
+		} else if refresh && !full {
+			return fmt.Errorf("--refresh requires --full")
+		} else if openImage && !asQrCode {
+			return fmt.Errorf("--open requires --qr-code")
+		} else if asQrCode && readable {
 			return fmt.Errorf("cannot specify both --qr-code and --readable")
 		} else if len(qrURL) > 0 && len(email) > 0 {
 			return fmt.Errorf("cannot specify both --url and --mail")
+		} else if all && len(udid) > 0 {
+			return fmt.Errorf("cannot specify both --all and --udid")
+		} else if all && len(capture) == 0 && (!asQrCode || len(output) == 0 || output == "-") {
+			return fmt.Errorf("--all requires --capture or --qr-code with an --output folder")
+		}
+
+		if all {
+			udids, err := connectedUDIDs()
+			if err != nil {
+				return err
+			}
+			for _, udid := range udids {
+				cli, err := mount.NewClient(udid)
+				if err != nil {
+					return fmt.Errorf("failed to connect to mobile_image_mounter on %s: %w", udid, err)
+				}
+				nonce, personalID, err := deviceNonce(cli)
+				cli.Close()
+				if err != nil {
+					return fmt.Errorf("%s: %w", udid, err)
+				}
+				qrCode, err := nonceQRCode(personalID, nonce, qrURL, email, emailSubject)
+				if err != nil {
+					return err
+				}
+				sidecar, err := nonceJSON(personalID, nonce)
+				if err != nil {
+					return err
+				}
+				if len(capture) > 0 {
+					if personalID == nil {
+						return fmt.Errorf("--capture requires the personalization identifiers of %s (to name the files by ECID)", udid)
+					}
+					err = writeNonceCapture(capture, personalID, qrCode, sidecar)
+				} else {
+					err = writeDeviceNonceQRCode(output, udid, qrCode, sidecar, time.Now())
+				}
+				if err != nil {
+					return err
+				}
+			}
+			return nil
 		}
 
 		if len(udid) == 0 {
@@ -92,6 +161,14 @@ var nonceCmd = &cobra.Command{
 				return fmt.Errorf("failed to pick USB connected devices: %w", err)
 			}
 			udid = dev.UniqueDeviceID
+		} else {
+			udids, err := connectedUDIDs()
+			if err != nil {
+				return err
+			}
+			if udid, err = matchUDID(udid, udids); err != nil {
+				return err
+			}
 		}
 
 		cli, err := mount.NewClient(udid)
@@ -100,103 +177,94 @@ var nonceCmd = &cobra.Command{
 		}
 		defer cli.Close()
 
-		nonce, err := cli.Nonce("DeveloperDiskImage")
-		if err != nil {
-			return fmt.Errorf("failed to get nonce: %w", err)
+		if full {
+			cacheDir, err := deviceInfoCacheDir()
+			if err != nil {
+				return err
+			}
+			var ld *lockdownd.Client
+			defer func() {
+				if ld != nil {
+					ld.Close()
+				}
+			}()
+			di, err := tss.GetDeviceInfo(&tss.DeviceInfoConfig{
+				UDID: udid,
+				Lockdown: func() (tss.LockdownClient, error) {
+					var err error
+					ld, err = lockdownd.NewClient(udid)
+					return ld, err
+				},
+				Mounter:  cli,
+				CacheDir: cacheDir,
+				Refresh:  refresh,
+			})
+			if err != nil {
+				return err
+			}
+			out, err := json.MarshalIndent(di, "", "  ")
+			if err != nil {
+				return fmt.Errorf("failed to marshal JSON: %w", err)
+			}
+			fmt.Println(string(out))
+			return nil
 		}
 
-		personalID, err := cli.PersonalizationIdentifiers("")
+		nonce, personalID, err := deviceNonce(cli)
 		if err != nil {
-			log.Errorf("failed to get personalization identifiers: %v ('personalization' might not be supported on this device)", err)
+			return err
 		}
 
-		if asQrCode {
-			// Create the barcode
-			qrCodeStr := fmt.Sprintf("ApBoardID=%d,ApChipID=%d,ApECID=%d,ApNonce=%s", personalID["BoardId"], personalID["ChipID"], personalID["UniqueChipID"], nonce)
-			if len(email) > 0 {
-				qrCodeStr = fmt.Sprintf("mailto:%s?subject=%s&body=%s", email, emailSubject, qrCodeStr)
-			} else if len(qrURL) > 0 {
-				u, err := url.Parse(fmt.Sprintf("%s?ApBoardID=%d&ApChipID=%d&ApECID=%d&ApNonce=%s", qrURL, personalID["BoardId"], personalID["ChipID"], personalID["UniqueChipID"], nonce))
-				if err != nil {
-					return fmt.Errorf("failed to parse URL: %w", err)
-				}
-				qrCodeStr = u.String()
+		if len(capture) > 0 {
+			if personalID == nil {
+				return fmt.Errorf("--capture requires the device's personalization identifiers (to name the files by ECID)")
 			}
-			qrCode, err := qr.Encode(qrCodeStr, qr.M, qr.Auto)
+			qrCode, err := nonceQRCode(personalID, nonce, qrURL, email, emailSubject)
 			if err != nil {
-				return fmt.Errorf("failed to encode nonce as QR code: %w", err)
+				return err
 			}
-			// Scale the barcode to 512x512 pixels
-			qrCode, err = barcode.Scale(qrCode, 512, 512)
+			out, err := nonceJSON(personalID, nonce)
 			if err != nil {
-				return fmt.Errorf("failed to scale QR code: %w", err)
+				return err
 			}
+			return writeNonceCapture(capture, personalID, qrCode, out)
+		}
 
-			var dat bytes.Buffer
-			buf := bufio.NewWriter(&dat)
-			if err := png.Encode(buf, qrCode); err != nil {
-				return fmt.Errorf("failed to encode QR code as PNG: %w", err)
+		if asQrCode {
+			dat, err := nonceQRCode(personalID, nonce, qrURL, email, emailSubject)
+			if err != nil {
+				return err
 			}
-			buf.Flush()
 
-			if len(output) > 0 {
+			if output == "-" {
+				if term.IsTerminal(int(os.Stdout.Fd())) {
+					return fmt.Errorf("refusing to write PNG data to a terminal (pipe or redirect stdout)")
+				}
+				// NOTE: logs go to stderr so stdout only contains the PNG
+				_, err := os.Stdout.Write(dat)
+				return err
+			} else if len(output) > 0 {
 				if err := os.MkdirAll(output, 0750); err != nil {
 					return fmt.Errorf("failed to create output folder: %w", err)
 				}
 				fname := filepath.Join(output, fmt.Sprintf("nonce_qr_code_%s.png", time.Now().Format("02Jan2006_150405")))
 				log.Infof("Writing QR code to %s", fname)
-				return os.WriteFile(fname, dat.Bytes(), 0644)
+				return os.WriteFile(fname, dat, 0644)
 			}
 
 			log.Warn("Displaying QR code in terminal (supported in iTerm2, otherwise supply --output flag)")
 			println()
-			return utils.DisplayImageInTerminal(bytes.NewReader(dat.Bytes()), dat.Len(), qrcSize, qrcSize)
+			_, err = utils.DisplayImageInTerminal(bytes.NewReader(dat), len(dat), qrcSize, qrcSize, openImage)
+			return err
 		}
 
 		if readable {
-			if personalID != nil {
-				fmt.Printf("%s %d\n", color.New(color.Faint, color.FgHiBlue).Sprintf("ApBoardID: "), personalID["BoardId"])
-				fmt.Printf("%s %d\n", color.New(color.Faint, color.FgHiBlue).Sprintf("ApChipID:  "), personalID["ChipID"])
-				fmt.Printf("%s %d\n", color.New(color.Faint, color.FgHiBlue).Sprintf("ApECID:    "), personalID["UniqueChipID"])
-			}
-			fmt.Println(color.New(color.Faint, color.FgHiBlue).Sprintf("Nonce:"))
-			var out string
-			for i, c := range nonce {
-				if i > 0 && i%4 == 0 && i%24 != 0 {
-					out += color.New(color.Faint).Sprint("-")
-				} else if i > 0 && i%24 == 0 {
-					out += "\n"
-				}
-				out += color.New(color.Bold).Sprintf("%c", c)
-			}
-			fmt.Println(out)
+			printReadableNonce(cmd.OutOrStdout(), personalID, nonce)
 		} else {
 			if asJSON {
-				var out []byte
-				if personalID == nil {
-					out, err = json.MarshalIndent(&struct {
-						ApNonce string `json:"nonce,omitempty"`
-					}{
-						ApNonce: nonce,
-					}, "", "  ")
-					if err != nil {
-						return fmt.Errorf("failed to marshal JSON: %w", err)
-					}
-				} else {
-					out, err = json.MarshalIndent(&struct {
-						ApBoardID int    `json:"board_id,omitempty"`
-						ApChipID  int    `json:"chip_id,omitempty"`
-						ApECID    int    `json:"ecid,omitempty"`
-						ApNonce   string `json:"nonce,omitempty"`
-					}{
-						ApBoardID: personalID["BoardId"].(int),
-						ApChipID:  personalID["ChipID"].(int),
-						ApECID:    personalID["UniqueChipID"].(int),
-						ApNonce:   nonce,
-					}, "", "  ")
-					if err != nil {
-						return fmt.Errorf("failed to marshal JSON: %w", err)
-					}
+				out, err := nonceJSON(personalID, nonce)
+				if err != nil {
+					return err
 				}
 				fmt.Println(string(out))
 			} else {
@@ -207,3 +275,204 @@ var nonceCmd = &cobra.Command{
 		return nil
 	},
 }
+
+var (
+	styleNonceKey = output.Style{color.Faint, color.FgHiBlue}
+	styleNonceSep = output.Style{color.Faint}
+	styleNonce    = output.Style{color.Bold}
+)
+
+// printReadableNonce prints the personalization identifiers and the nonce split into groups of 4 (24 per line);
+// plain output prints the nonce unsplit on one line
+func printReadableNonce(wr io.Writer, personalID map[string]any, nonce string) {
+	w := output.NewWriter(wr)
+	if personalID != nil {
+		w.Printf("%s %d\n", w.Sprint(styleNonceKey, "ApBoardID: "), personalID["BoardId"])
+		w.Printf("%s %d\n", w.Sprint(styleNonceKey, "ApChipID:  "), personalID["ChipID"])
+		w.Printf("%s %d\n", w.Sprint(styleNonceKey, "ApECID:    "), personalID["UniqueChipID"])
+	}
+	if w.Plain() {
+		w.Printf("Nonce:      %s\n", nonce)
+		return
+	}
+	w.Println(w.Sprint(styleNonceKey, "Nonce:"))
+	var out strings.Builder
+	for i, c := range nonce {
+		if i > 0 && i%4 == 0 && i%24 != 0 {
+			out.WriteString(w.Sprint(styleNonceSep, "-"))
+		} else if i > 0 && i%24 == 0 {
+			out.WriteString("\n")
+		}
+		out.WriteString(w.Sprintf(styleNonce, "%c", c))
+	}
+	w.Println(out.String())
+}
+
+// nonceQRCode returns a PNG QR code of the nonce info (as a mailto: or URL if email or qrURL are set)
+func nonceQRCode(personalID map[string]any, nonce, qrURL, email, emailSubject string) ([]byte, error) {
+	// Create the barcode
+	qrCodeStr := fmt.Sprintf("ApBoardID=%d,ApChipID=%d,ApECID=%d,ApNonce=%s", personalID["BoardId"], personalID["ChipID"], personalID["UniqueChipID"], nonce)
+	if len(email) > 0 {
+		qrCodeStr = fmt.Sprintf("mailto:%s?subject=%s&body=%s", email, emailSubject, qrCodeStr)
+	} else if len(qrURL) > 0 {
+		u, err := url.Parse(fmt.Sprintf("%s?ApBoardID=%d&ApChipID=%d&ApECID=%d&ApNonce=%s", qrURL, personalID["BoardId"], personalID["ChipID"], personalID["UniqueChipID"], nonce))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse URL: %w", err)
+		}
+		qrCodeStr = u.String()
+	}
+	qrCode, err := qr.Encode(qrCodeStr, qr.M, qr.Auto)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode nonce as QR code: %w", err)
+	}
+	// Scale the barcode to 512x512 pixels
+	qrCode, err = barcode.Scale(qrCode, 512, 512)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scale QR code: %w", err)
+	}
+
+	var dat bytes.Buffer
+	buf := bufio.NewWriter(&dat)
+	if err := png.Encode(buf, qrCode); err != nil {
+		return nil, fmt.Errorf("failed to encode QR code as PNG: %w", err)
+	}
+	buf.Flush()
+
+	return dat.Bytes(), nil
+}
+
+// nonceJSON returns the nonce info as indented JSON
+func nonceJSON(personalID map[string]any, nonce string) ([]byte, error) {
+	var out []byte
+	var err error
+	if personalID == nil {
+		out, err = json.MarshalIndent(&struct {
+			ApNonce string `json:"nonce,omitempty"`
+		}{
+			ApNonce: nonce,
+		}, "", "  ")
+	} else {
+		out, err = json.MarshalIndent(&struct {
+			ApBoardID int    `json:"board_id,omitempty"`
+			ApChipID  int    `json:"chip_id,omitempty"`
+			ApECID    int    `json:"ecid,omitempty"`
+			ApNonce   string `json:"nonce,omitempty"`
+		}{
+			ApBoardID: personalID["BoardId"].(int),
+			ApChipID:  personalID["ChipID"].(int),
+			ApECID:    personalID["UniqueChipID"].(int),
+			ApNonce:   nonce,
+		}, "", "  ")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal JSON: %w", err)
+	}
+	return out, nil
+}
+
+// connectedUDIDs returns the UDIDs of every connected device
+func connectedUDIDs() ([]string, error) {
+	conn, err := usb.NewConn()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to usbmuxd: %w", err)
+	}
+	defer conn.Close()
+	devices, err := conn.ListDevices()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list devices: %w", err)
+	}
+	if len(devices) == 0 {
+		return nil, fmt.Errorf("no devices found")
+	}
+	udids := make([]string, 0, len(devices))
+	for _, device := range devices {
+		udids = append(udids, device.SerialNumber)
+	}
+	return udids, nil
+}
+
+// matchUDID returns the connected UDID that --udid selects: the one equal to it or else the only one containing it
+// (case-insensitively) so a unique part of a long UDID is enough
+func matchUDID(udid string, udids []string) (string, error) {
+	var matches []string
+	for _, u := range udids {
+		if strings.EqualFold(u, udid) {
+			return u, nil
+		}
+		if strings.Contains(strings.ToLower(u), strings.ToLower(udid)) {
+			matches = append(matches, u)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("no connected device's UDID matches '%s'", udid)
+	case 1:
+		log.Debugf("Using device %s", matches[0])
+		return matches[0], nil
+	default:
+		return "", fmt.Errorf("'%s' matches several connected devices (%s); use more of the UDID", udid, strings.Join(matches, ", "))
+	}
+}
+
+// deviceNonce returns the device's DeveloperDiskImage nonce and its personalization identifiers
+// (nil if the device doesn't support personalization)
+func deviceNonce(cli *mount.Client) (string, map[string]any, error) {
+	nonce, err := cli.Nonce("DeveloperDiskImage")
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to get nonce: %w", err)
+	}
+	personalID, err := cli.PersonalizationIdentifiers("")
+	if err != nil {
+		log.Errorf("failed to get personalization identifiers: %v ('personalization' might not be supported on this device)", err)
+	}
+	return nonce, personalID, nil
+}
+
+// deviceInfoCacheDir returns the folder the static device info for --full is cached in (next to the config file)
+func deviceInfoCacheDir() (string, error) {
+	if len(viper.ConfigFileUsed()) > 0 {
+		return filepath.Join(filepath.Dir(viper.ConfigFileUsed()), "devices"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(home, ".config", "ipsw", "devices"), nil
+}
+
+// writeNonceCapture writes the QR code PNG and the JSON sidecar to dir as nonce_<ECID>.png and nonce_<ECID>.json
+// (so re-capturing a device replaces its previous capture)
+func writeNonceCapture(dir string, personalID map[string]any, qrCode, sidecar []byte) error {
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return fmt.Errorf("failed to create capture folder: %w", err)
+	}
+	base := filepath.Join(dir, fmt.Sprintf("nonce_%d", personalID["UniqueChipID"]))
+	log.Infof("Writing QR code to %s.png", base)
+	if err := os.WriteFile(base+".png", qrCode, 0644); err != nil {
+		return fmt.Errorf("failed to write QR code: %w", err)
+	}
+	log.Infof("Writing nonce info to %s.json", base)
+	if err := os.WriteFile(base+".json", append(sidecar, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write nonce info: %w", err)
+	}
+	return nil
+}
+
+// writeDeviceNonceQRCode writes the QR code PNG and the JSON sidecar to dir/<udid>/ as nonce_qr_code_<time>.png/.json
+// (so collecting the nonces of several devices doesn't mix up or overwrite their QR codes)
+func writeDeviceNonceQRCode(dir, udid string, qrCode, sidecar []byte, now time.Time) error {
+	devDir := filepath.Join(dir, udid)
+	if err := os.MkdirAll(devDir, 0750); err != nil {
+		return fmt.Errorf("failed to create output folder: %w", err)
+	}
+	base := filepath.Join(devDir, fmt.Sprintf("nonce_qr_code_%s", now.Format("02Jan2006_150405")))
+	log.Infof("Writing QR code to %s.png", base)
+	if err := os.WriteFile(base+".png", qrCode, 0644); err != nil {
+		return fmt.Errorf("failed to write QR code: %w", err)
+	}
+	log.Infof("Writing nonce info to %s.json", base)
+	if err := os.WriteFile(base+".json", append(sidecar, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write nonce info: %w", err)
+	}
+	return nil
+}
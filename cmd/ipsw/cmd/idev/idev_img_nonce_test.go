@@ -0,0 +1,151 @@
+package idev
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/blacktop/ipsw/internal/output"
+)
+
+func TestPrintReadableNonce(t *testing.T) {
+	personalID := map[string]any{"BoardId": 12, "ChipID": 33040, "UniqueChipID": 1234567890}
+	nonce := "0123456789abcdef0123456789abcdef01234567"
+
+	for _, tt := range []struct {
+		name  string
+		plain bool
+		want  string
+	}{
+		{"readable", false, "ApBoardID:  12\nApChipID:   33040\nApECID:     1234567890\nNonce:\n" +
+			"0123-4567-89ab-cdef-0123-4567\n89ab-cdef-0123-4567\n"},
+		{"plain", true, "ApBoardID:  12\nApChipID:   33040\nApECID:     1234567890\nNonce:      " + nonce + "\n"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			output.Configure(true, tt.plain)
+			defer output.Configure(false, false)
+			var buf bytes.Buffer
+			printReadableNonce(&buf, personalID, nonce)
+			if got := buf.String(); got != tt.want {
+				t.Errorf("printReadableNonce() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteNonceCapture(t *testing.T) {
+	personalID := map[string]any{"BoardId": 12, "ChipID": 33040, "UniqueChipID": 1234567890}
+	nonce := "0123456789abcdef0123456789abcdef01234567"
+	qrCode, err := nonceQRCode(personalID, nonce, "", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sidecar, err := nonceJSON(personalID, nonce)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := filepath.Join(t.TempDir(), "captures")
+	// capturing the same device twice overwrites the same pair of files
+	for i := 0; i < 2; i++ {
+		if err := writeNonceCapture(dir, personalID, qrCode, sidecar); err != nil {
+			t.Fatalf("writeNonceCapture() error = %v", err)
+		}
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	if want := []string{"nonce_1234567890.json", "nonce_1234567890.png"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("capture files = %v, want %v", names, want)
+	}
+
+	png, _ := os.ReadFile(filepath.Join(dir, "nonce_1234567890.png"))
+	if !bytes.HasPrefix(png, []byte("\x89PNG")) {
+		t.Error("nonce_1234567890.png is not a PNG")
+	}
+	var info struct {
+		ECID  int    `json:"ecid"`
+		Nonce string `json:"nonce"`
+	}
+	data, _ := os.ReadFile(filepath.Join(dir, "nonce_1234567890.json"))
+	if err := json.Unmarshal(data, &info); err != nil || info.ECID != 1234567890 || info.Nonce != nonce {
+		t.Errorf("nonce_1234567890.json = %s (err %v)", data, err)
+	}
+}
+
+func TestWriteDeviceNonceQRCode(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2023, time.September, 18, 10, 0, 0, 0, time.UTC)
+	// two devices captured in the same second don't collide
+	for i, udid := range []string{"00008110-000A1B2C3D4E5F60", "00008120-000112233445566E"} {
+		personalID := map[string]any{"BoardId": 12, "ChipID": 33040, "UniqueChipID": 1234567890 + i}
+		nonce := "0123456789abcdef0123456789abcdef0123456" + strconv.Itoa(i)
+		qrCode, err := nonceQRCode(personalID, nonce, "", "", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		sidecar, err := nonceJSON(personalID, nonce)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := writeDeviceNonceQRCode(dir, udid, qrCode, sidecar, now); err != nil {
+			t.Fatalf("writeDeviceNonceQRCode(%s) error = %v", udid, err)
+		}
+	}
+
+	var files []string
+	filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			rel, _ := filepath.Rel(dir, path)
+			files = append(files, filepath.ToSlash(rel))
+		}
+		return err
+	})
+	want := []string{
+		"00008110-000A1B2C3D4E5F60/nonce_qr_code_18Sep2023_100000.json",
+		"00008110-000A1B2C3D4E5F60/nonce_qr_code_18Sep2023_100000.png",
+		"00008120-000112233445566E/nonce_qr_code_18Sep2023_100000.json",
+		"00008120-000112233445566E/nonce_qr_code_18Sep2023_100000.png",
+	}
+	if !reflect.DeepEqual(files, want) {
+		t.Errorf("output files = %v, want %v", files, want)
+	}
+
+	var info struct {
+		ECID int `json:"ecid"`
+	}
+	data, _ := os.ReadFile(filepath.Join(dir, "00008120-000112233445566E", "nonce_qr_code_18Sep2023_100000.json"))
+	if err := json.Unmarshal(data, &info); err != nil || info.ECID != 1234567891 {
+		t.Errorf("sidecar = %s (err %v), want the second device's ECID", data, err)
+	}
+}
+
+func TestMatchUDID(t *testing.T) {
+	udids := []string{"00008110-000A1B2C3D4E5F60", "00008120-000112233445566E", "00008120-0001122334455670"}
+	for _, tt := range []struct {
+		udid    string
+		want    string
+		wantErr bool
+	}{
+		{udid: "00008120-000112233445566E", want: "00008120-000112233445566E"},
+		{udid: "00008110", want: "00008110-000A1B2C3D4E5F60"},
+		{udid: "566e", want: "00008120-000112233445566E"}, // a unique substring, any case
+		{udid: "00008120", wantErr: true},                 // ambiguous
+		{udid: "deadbeef", wantErr: true},
+	} {
+		got, err := matchUDID(tt.udid, udids)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("matchUDID(%s) = %s, %v, want %s (error %v)", tt.udid, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+/*
+Copyright © 2018-2023 blacktop
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package idev
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/apex/log"
+	"github.com/blacktop/ipsw/internal/download"
+	"github.com/blacktop/ipsw/internal/utils"
+	"github.com/blacktop/ipsw/pkg/tss"
+	"github.com/blacktop/ipsw/pkg/usb/lockdownd"
+	"github.com/blacktop/ipsw/pkg/usb/mount"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func init() {
+	ShshCmd.AddCommand(idevShshSaveCmd)
+
+	idevShshSaveCmd.Flags().StringP("output", "o", ".", "Folder to write the blob to")
+	idevShshSaveCmd.Flags().StringP("build", "b", "", "Build to save a blob for (defaults to the device's current build)")
+	idevShshSaveCmd.Flags().Bool("verify", false, "Re-parse the saved blob")
+	idevShshSaveCmd.Flags().String("proxy", "", "HTTP/HTTPS proxy")
+	idevShshSaveCmd.Flags().Bool("insecure", false, "do not verify ssl certs")
+	idevShshSaveCmd.MarkFlagDirname("output")
+
+	viper.BindPFlag("idev.shsh.save.output", idevShshSaveCmd.Flags().Lookup("output"))
+	viper.BindPFlag("idev.shsh.save.build", idevShshSaveCmd.Flags().Lookup("build"))
+	viper.BindPFlag("idev.shsh.save.verify", idevShshSaveCmd.Flags().Lookup("verify"))
+	viper.BindPFlag("idev.shsh.save.proxy", idevShshSaveCmd.Flags().Lookup("proxy"))
+	viper.BindPFlag("idev.shsh.save.insecure", idevShshSaveCmd.Flags().Lookup("insecure"))
+}
+
+// idevShshSaveCmd represents the save command
+var idevShshSaveCmd = &cobra.Command{
+	Use:   "save",
+	Short: "Save the device's SHSH blob for a signed build",
+	Long: `Save the device's SHSH blob (ApImg4Ticket) for its current build (or --build) while Apple still signs it.
+
+The ticket is bound to the device's boot ApNonce (from lockdownd, NOT the image mounter's
+personalization nonce) and the blob is written to <ECID>_<product type>_<build>_<apnonce>.shsh2
+
+NOTE: the blob has no generator, so it can only be used while the device boots with the same
+ApNonce (setting the nonce from a generator is not supported as it needs nvram access)`,
+	Example: `  # Save a blob for the device's current build
+  ❯ ipsw idev shsh save --output blobs/ --verify`,
+	Args:          cobra.NoArgs,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		if viper.GetBool("verbose") {
+			log.SetLevel(log.DebugLevel)
+		}
+		color.NoColor = !viper.GetBool("color")
+
+		udid, _ := cmd.Flags().GetString("udid")
+		if len(udid) == 0 {
+			dev, err := utils.PickDevice()
+			if err != nil {
+				return fmt.Errorf("failed to pick USB connected devices: %w", err)
+			}
+			udid = dev.UniqueDeviceID
+		}
+
+		ld, err := lockdownd.NewClient(udid)
+		if err != nil {
+			return fmt.Errorf("failed to connect to lockdownd: %w", err)
+		}
+		defer ld.Close()
+		values, err := ld.GetValues()
+		if err != nil {
+			return fmt.Errorf("failed to get device values: %w", err)
+		}
+		if len(values.ApNonce) == 0 {
+			return fmt.Errorf("failed to get the device's ApNonce")
+		}
+
+		cli, err := mount.NewClient(udid)
+		if err != nil {
+			return fmt.Errorf("failed to connect to mobile_image_mounter: %w", err)
+		}
+		defer cli.Close()
+		cacheDir, err := deviceInfoCacheDir()
+		if err != nil {
+			return err
+		}
+		di, err := tss.GetDeviceInfo(&tss.DeviceInfoConfig{
+			UDID:     udid,
+			Lockdown: func() (tss.LockdownClient, error) { return ld, nil },
+			Mounter:  cli,
+			CacheDir: cacheDir,
+		})
+		if err != nil {
+			return err
+		}
+
+		fname, err := tss.SaveBlob(context.Background(), &tss.SaveConfig{
+			Device:   di,
+			ApNonce:  values.ApNonce,
+			SepNonce: values.SEPNonce,
+			Build:    viper.GetString("idev.shsh.save.build"),
+			Download: &download.DownloadConfig{
+				Proxy:    viper.GetString("idev.shsh.save.proxy"),
+				Insecure: viper.GetBool("idev.shsh.save.insecure"),
+				Timeout:  viper.GetDuration("timeout"),
+			},
+			Output: viper.GetString("idev.shsh.save.output"),
+		})
+		if errors.Is(err, tss.ErrNotSigned) {
+			return fmt.Errorf("%w (Apple no longer signs it, so there is no blob to save)", err)
+		} else if err != nil {
+			return err
+		}
+		log.Infof("Saved SHSH blob to %s", fname)
+
+		if viper.GetBool("idev.shsh.save.verify") {
+			if _, err := tss.VerifyBlob(fname); err != nil {
+				return fmt.Errorf("failed to verify saved blob: %w", err)
+			}
+			log.Info("Verified SHSH blob")
+		}
+
+		return nil
+	},
+}
@@ -104,7 +104,7 @@ var SyslogCmd = &cobra.Command{
 		color.NoColor = !viper.GetBool("color")
 
 		udid, _ := cmd.Flags().GetString("udid")
-		timeout, _ := cmd.Flags().GetDuration("timeout")
+		timeout, _ := cmd.Flags().GetUint64("timeout")
 
 		if len(udid) == 0 {
 			dev, err := utils.PickDevice()
@@ -118,7 +118,7 @@ var SyslogCmd = &cobra.Command{
 		var ctx context.Context
 		var cancel context.CancelFunc
 		if timeout > 0 {
-			ctx, cancel = context.WithTimeout(context.Background(), timeout)
+			ctx, cancel = context.WithTimeout(context.Background(), time.Duration(timeout)*time.Second)
 		} else {
 			ctx, cancel = context.WithCancel(context.Background())
 		}
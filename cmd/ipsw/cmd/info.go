@@ -78,6 +78,7 @@ var infoCmd = &cobra.Command{
 			zr, err := download.NewRemoteZipReader(args[0], &download.RemoteConfig{
 				Proxy:    viper.GetString("info.proxy"),
 				Insecure: viper.GetBool("info.insecure"),
+				Timeout:  viper.GetDuration("timeout"),
 			})
 			if err != nil {
 				return fmt.Errorf("failed to create new remote zip reader: %w", err)
@@ -0,0 +1,140 @@
+/*
+Copyright © 2018-2023 blacktop
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package kernel
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/apex/log"
+	"github.com/blacktop/go-macho"
+	dlcmd "github.com/blacktop/ipsw/cmd/ipsw/cmd/download"
+	"github.com/blacktop/ipsw/internal/commands/img4"
+	"github.com/blacktop/ipsw/internal/download"
+	"github.com/blacktop/ipsw/pkg/kernelcache"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// kernelDecryptThen are the commands --then can run on the decrypted kernelcache
+var kernelDecryptThen = []string{"version"}
+
+// getWikiFirmwareKeys fetches the wiki keys (swapped out in tests)
+var getWikiFirmwareKeys = download.GetWikiFirmwareKeysWithConfig
+
+func init() {
+	KernelcacheCmd.AddCommand(kernelDecryptCmd)
+	kernelDecryptCmd.Flags().StringP("device", "d", "", "Device the kernelcache is for (i.e. iPhone12,1)")
+	kernelDecryptCmd.Flags().StringP("build", "b", "", "Build the kernelcache is from (i.e. 19H12)")
+	kernelDecryptCmd.Flags().StringP("output", "o", "", "Output file (default is <kernelcache>.dec)")
+	kernelDecryptCmd.Flags().String("then", "", fmt.Sprintf("Run a command on the decrypted kernelcache (%s)", strings.Join(kernelDecryptThen, ", ")))
+	dlcmd.AddDownloadConfigFlags(kernelDecryptCmd.Flags())
+	kernelDecryptCmd.MarkFlagRequired("device")
+	kernelDecryptCmd.MarkFlagRequired("build")
+	kernelDecryptCmd.MarkZshCompPositionalArgumentFile(1, "kernelcache*")
+	viper.BindPFlag("kernel.decrypt.device", kernelDecryptCmd.Flags().Lookup("device"))
+	viper.BindPFlag("kernel.decrypt.build", kernelDecryptCmd.Flags().Lookup("build"))
+	viper.BindPFlag("kernel.decrypt.output", kernelDecryptCmd.Flags().Lookup("output"))
+	viper.BindPFlag("kernel.decrypt.then", kernelDecryptCmd.Flags().Lookup("then"))
+}
+
+// kernelDecryptCmd represents the decrypt command
+var kernelDecryptCmd = &cobra.Command{
+	Use:   "decrypt <kernelcache.im4p>",
+	Short: "Decrypt and decompress a kernelcache with its keys from theapplewiki.com",
+	Example: `  # Decrypt an iOS 15.7 iPhone 11 kernelcache and print its version
+  ❯ ipsw kernel decrypt kernelcache.release.iphone12 --device iPhone12,1 --build 19H12 --then version`,
+	Args:          cobra.ExactArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		if viper.GetBool("verbose") {
+			log.SetLevel(log.DebugLevel)
+		}
+
+		then := viper.GetString("kernel.decrypt.then")
+		if len(then) > 0 && !slices.Contains(kernelDecryptThen, then) {
+			return fmt.Errorf("unsupported --then '%s' (expected one of: %s)", then, strings.Join(kernelDecryptThen, ", "))
+		}
+
+		kcpath := filepath.Clean(args[0])
+		if _, err := os.Stat(kcpath); os.IsNotExist(err) {
+			return fmt.Errorf("file %s does not exist", kcpath)
+		}
+
+		dl, err := dlcmd.ResolveDownloadConfig(cmd)
+		if err != nil {
+			return err
+		}
+
+		output, err := decryptKernelcache(kcpath, viper.GetString("kernel.decrypt.output"),
+			viper.GetString("kernel.decrypt.device"), viper.GetString("kernel.decrypt.build"), dl)
+		if err != nil {
+			return err
+		}
+
+		switch then {
+		case "version":
+			m, err := macho.Open(output)
+			if err != nil {
+				return fmt.Errorf("failed to open decrypted kernelcache: %v", err)
+			}
+			defer m.Close()
+			kv, err := kernelcache.GetVersion(m)
+			if err != nil {
+				return err
+			}
+			fmt.Println(kv)
+		}
+
+		return nil
+	},
+}
+
+// decryptKernelcache decrypts and decompresses the kernelcache im4p at path with the wiki keys for device and build
+func decryptKernelcache(path, output, device, build string, dl *download.DownloadConfig) (string, error) {
+	log.WithFields(log.Fields{"device": device, "build": build}).Info("Fetching kernelcache keys from theapplewiki.com")
+	keys, err := getWikiFirmwareKeys(&download.WikiConfig{Device: device, Build: build}, dl)
+	if err != nil {
+		return "", fmt.Errorf("failed to get firmware keys: %w", err)
+	}
+	for _, k := range keys {
+		if !strings.EqualFold(k.Device, device) || !strings.EqualFold(k.Build, build) {
+			continue
+		}
+		out, err := img4.DecryptComponentWithWikiKeys(path, output, "Kernelcache", &k)
+		if err != nil {
+			if errors.Is(err, download.ErrWikiKBAGOnly) {
+				return "", fmt.Errorf("%w; decrypt the KBAG on a device (i.e. with a bootrom exploit) and use 'ipsw img4 dec --iv-key'", err)
+			}
+			return "", fmt.Errorf("failed to decrypt %s: %w", path, err)
+		}
+		return out, nil
+	}
+	return "", fmt.Errorf("%w: no firmware keys on the wiki for %s %s (keys are rarely published for modern devices)",
+		download.ErrWikiNotFound, device, build)
+}
@@ -0,0 +1,128 @@
+package kernel
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/asn1"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/blacktop/ipsw/internal/download"
+)
+
+const (
+	testIV  = "0123456789abcdef0123456789abcdef"
+	testKey = "fedcba9876543210fedcba9876543210fedcba9876543210fedcba9876543210"
+)
+
+// testMachO is the start of a 64-bit arm64 Mach-O header (padded to the AES block size)
+var testMachO = append([]byte{0xcf, 0xfa, 0xed, 0xfe, 0x0c, 0x00, 0x00, 0x01}, bytes.Repeat([]byte{0x41}, 24)...)
+
+// writeEncryptedKernelcache writes an im4p with testMachO encrypted with testIV/testKey
+func writeEncryptedKernelcache(t *testing.T) string {
+	t.Helper()
+	iv, _ := hex.DecodeString(testIV)
+	key, _ := hex.DecodeString(testKey)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc := make([]byte, len(testMachO))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(enc, testMachO)
+	dat, err := asn1.Marshal(struct {
+		Name        string `asn1:"ia5"`
+		Type        string `asn1:"ia5"`
+		Description string
+		Data        []byte
+	}{"IM4P", "krnl", "test", enc})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "kernelcache.release.iphone12")
+	if err := os.WriteFile(path, dat, 0660); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func mockWikiKeys(t *testing.T, keys []download.WikiFWKeys, err error) *download.WikiConfig {
+	t.Helper()
+	var got download.WikiConfig
+	orig := getWikiFirmwareKeys
+	getWikiFirmwareKeys = func(cfg *download.WikiConfig, dl *download.DownloadConfig) ([]download.WikiFWKeys, error) {
+		got = *cfg
+		return keys, err
+	}
+	t.Cleanup(func() { getWikiFirmwareKeys = orig })
+	return &got
+}
+
+func TestDecryptKernelcache(t *testing.T) {
+	path := writeEncryptedKernelcache(t)
+
+	cfg := mockWikiKeys(t, []download.WikiFWKeys{
+		{Device: "iPhone12,3", Build: "19H12", Kernelcache: "kernelcache.release.iphone12", KernelcacheIV: strings.Repeat("00", 16), KernelcacheKey: strings.Repeat("00", 32)},
+		{Device: "iPhone12,1", Build: "19H12", Kernelcache: "kernelcache.release.iphone12", KernelcacheIV: testIV, KernelcacheKey: testKey},
+	}, nil)
+	output := filepath.Join(t.TempDir(), "kernelcache.dec")
+	out, err := decryptKernelcache(path, output, "iPhone12,1", "19H12", nil)
+	if err != nil {
+		t.Fatalf("decryptKernelcache() error = %v", err)
+	}
+	if cfg.Device != "iPhone12,1" || cfg.Build != "19H12" {
+		t.Errorf("keys were fetched for %s %s", cfg.Device, cfg.Build)
+	}
+	if got, _ := os.ReadFile(out); out != output || !bytes.Equal(got, testMachO) {
+		t.Errorf("decrypted kernelcache %s = %x, want %x", out, got, testMachO)
+	}
+
+	// the file name doesn't have to say it is a kernelcache
+	kc := filepath.Join(filepath.Dir(path), "kc.im4p")
+	if err := os.Rename(path, kc); err != nil {
+		t.Fatal(err)
+	}
+	out, err = decryptKernelcache(kc, "", "iPhone12,1", "19H12", nil)
+	if err != nil {
+		t.Fatalf("decryptKernelcache(kc.im4p) error = %v", err)
+	}
+	if got, _ := os.ReadFile(out); !bytes.Equal(got, testMachO) {
+		t.Errorf("decrypted kc.im4p %s = %x, want %x", out, got, testMachO)
+	}
+}
+
+func TestDecryptKernelcacheNoKeys(t *testing.T) {
+	path := writeEncryptedKernelcache(t)
+
+	// modern devices: the wiki only has the KBAG
+	mockWikiKeys(t, []download.WikiFWKeys{
+		{Device: "iPhone15,2", Build: "21A329", Kernelcache: "kernelcache.release.iphone15", KernelcacheKBAG: strings.Repeat("ab", 48)},
+	}, nil)
+	_, err := decryptKernelcache(path, "", "iPhone15,2", "21A329", nil)
+	if !errors.Is(err, download.ErrWikiKBAGOnly) || !strings.Contains(err.Error(), "img4 dec --iv-key") {
+		t.Errorf("decryptKernelcache(KBAG only) error = %v", err)
+	}
+
+	// no keys page for the build
+	mockWikiKeys(t, nil, nil)
+	if _, err := decryptKernelcache(path, "", "iPhone12,1", "19H12", nil); !errors.Is(err, download.ErrWikiNotFound) {
+		t.Errorf("decryptKernelcache(no keys) error = %v, want ErrWikiNotFound", err)
+	}
+
+	// wrong keys don't decrypt to a Mach-O
+	mockWikiKeys(t, []download.WikiFWKeys{
+		{Device: "iPhone12,1", Build: "19H12", KernelcacheIV: testIV, KernelcacheKey: strings.Repeat("00", 32)},
+	}, nil)
+	if _, err := decryptKernelcache(path, "", "iPhone12,1", "19H12", nil); err == nil || !strings.Contains(err.Error(), "not a Mach-O") {
+		t.Errorf("decryptKernelcache(wrong keys) error = %v", err)
+	}
+
+	mockWikiKeys(t, nil, download.ErrWikiNetwork)
+	if _, err := decryptKernelcache(path, "", "iPhone12,1", "19H12", nil); !errors.Is(err, download.ErrWikiNetwork) {
+		t.Errorf("decryptKernelcache(offline) error = %v, want ErrWikiNetwork", err)
+	}
+}
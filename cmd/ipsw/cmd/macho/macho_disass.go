@@ -40,6 +40,7 @@ import (
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+	"golang.org/x/term"
 )
 
 func init() {
@@ -52,12 +53,19 @@ func init() {
 	machoDisassCmd.Flags().Uint64P("count", "c", 0, "Number of instructions to disassemble")
 	machoDisassCmd.Flags().BoolP("demangle", "d", false, "Demangle symbol names")
 	machoDisassCmd.Flags().BoolP("json", "j", false, "Output as JSON")
+	machoDisassCmd.Flags().Bool("groups", false, "Include each instruction's control-flow groups (jump/call/ret/...) in the --json output")
+	machoDisassCmd.Flags().Bool("simplify", false, "Rewrite common idioms to their pseudo-instructions (i.e. movz/movk => mov #imm)")
+	machoDisassCmd.Flags().Bool("mem-only", false, "Only print the instructions that access memory (loads/stores) or compute an address with adrp")
+	machoDisassCmd.Flags().Bool("no-wrap", false, "Do NOT wrap long lines at the terminal's width")
+	machoDisassCmd.Flags().Bool("relative", false, "Print addresses (and branch targets within the function) as offsets from the function start")
 	machoDisassCmd.Flags().BoolP("quiet", "q", false, "Do NOT markup analysis (Faster)")
 	// machoDisassCmd.Flags().StringP("input", "i", "", "Input function JSON file")
 	machoDisassCmd.Flags().StringP("fileset-entry", "t", "", "Which fileset entry to analyze")
 	machoDisassCmd.Flags().BoolP("all-fileset-entries", "z", false, "Parse all fileset entries")
 	machoDisassCmd.Flags().StringP("section", "x", "", "Disassemble an entire segment/section (i.e. __TEXT_EXEC.__text)")
 	machoDisassCmd.Flags().String("cache", "", "Path to .a2s addr to sym cache file (speeds up analysis)")
+	machoDisassCmd.Flags().StringArray("also", []string{}, "Additional MachO(s) to resolve cross-image branch targets with (i.e. other kexts)")
+	machoDisassCmd.Flags().Bool("lines", false, "Annotate instructions with their source file:line (from embedded DWARF or a <MACHO>.dSYM)")
 
 	viper.BindPFlag("macho.disass.arch", machoDisassCmd.Flags().Lookup("arch"))
 	viper.BindPFlag("macho.disass.symbol", machoDisassCmd.Flags().Lookup("symbol"))
@@ -66,12 +74,19 @@ func init() {
 	viper.BindPFlag("macho.disass.count", machoDisassCmd.Flags().Lookup("count"))
 	viper.BindPFlag("macho.disass.demangle", machoDisassCmd.Flags().Lookup("demangle"))
 	viper.BindPFlag("macho.disass.json", machoDisassCmd.Flags().Lookup("json"))
+	viper.BindPFlag("macho.disass.groups", machoDisassCmd.Flags().Lookup("groups"))
+	viper.BindPFlag("macho.disass.simplify", machoDisassCmd.Flags().Lookup("simplify"))
+	viper.BindPFlag("macho.disass.mem-only", machoDisassCmd.Flags().Lookup("mem-only"))
+	viper.BindPFlag("macho.disass.no-wrap", machoDisassCmd.Flags().Lookup("no-wrap"))
+	viper.BindPFlag("macho.disass.relative", machoDisassCmd.Flags().Lookup("relative"))
 	viper.BindPFlag("macho.disass.quiet", machoDisassCmd.Flags().Lookup("quiet"))
 	// viper.BindPFlag("macho.disass.input", machoDisassCmd.Flags().Lookup("input"))
 	viper.BindPFlag("macho.disass.fileset-entry", machoDisassCmd.Flags().Lookup("fileset-entry"))
 	viper.BindPFlag("macho.disass.all-fileset-entries", machoDisassCmd.Flags().Lookup("all-fileset-entries"))
 	viper.BindPFlag("macho.disass.section", machoDisassCmd.Flags().Lookup("section"))
 	viper.BindPFlag("macho.disass.cache", machoDisassCmd.Flags().Lookup("cache"))
+	viper.BindPFlag("macho.disass.also", machoDisassCmd.Flags().Lookup("also"))
+	viper.BindPFlag("macho.disass.lines", machoDisassCmd.Flags().Lookup("lines"))
 
 	machoDisassCmd.MarkZshCompPositionalArgumentFile(1)
 }
@@ -106,7 +121,13 @@ var machoDisassCmd = &cobra.Command{
 
 		demangleFlag := viper.GetBool("macho.disass.demangle")
 		asJSON := viper.GetBool("macho.disass.json")
+		withGroups := viper.GetBool("macho.disass.groups")
+		simplify := viper.GetBool("macho.disass.simplify")
+		memOnly := viper.GetBool("macho.disass.mem-only")
+		noWrap := viper.GetBool("macho.disass.no-wrap")
+		relative := viper.GetBool("macho.disass.relative")
 		quiet := viper.GetBool("macho.disass.quiet")
+		showLines := viper.GetBool("macho.disass.lines")
 
 		// funcFile := viper.GetString("macho.disass.input")
 		filesetEntry := viper.GetString("macho.disass.fileset-entry")
@@ -123,6 +144,12 @@ var machoDisassCmd = &cobra.Command{
 		} else if startAddr != 0 && startOff != 0 {
 			return fmt.Errorf("you can only use --vaddr OR --off (not both)")
 		}
+		if withGroups && !asJSON {
+			return fmt.Errorf("--groups requires --json")
+		}
+		if memOnly && asJSON {
+			return fmt.Errorf("--mem-only can NOT be used with --json")
+		}
 		if len(filesetEntry) > 0 && viper.GetBool("macho.disass.all-fileset-entries") {
 			return fmt.Errorf("you can only use --fileset-entry OR --all-fileset-entries (not both)")
 		} else if viper.GetBool("macho.disass.all-fileset-entries") && len(segmentSection) == 0 {
@@ -209,7 +236,28 @@ var machoDisassCmd = &cobra.Command{
 
 		symbolMap = make(map[uint64]string)
 
+		var also disass.SymbolIndex
+		if paths := viper.GetStringSlice("macho.disass.also"); len(paths) > 0 {
+			also = disass.NewSymbolIndex()
+			for _, path := range paths {
+				n, err := loadAlsoSymbols(also, filepath.Clean(path), selectedArch)
+				if err != nil {
+					return fmt.Errorf("failed to load symbols from %s: %v", path, err)
+				}
+				log.WithField("symbols", n).Debugf("Loaded symbols from %s", path)
+			}
+		}
+
+		// show progress on stderr while sweeping whole binaries into a file/pipe
+		var progress *disass.Progress
+		if allFuncs && len(segmentSection) == 0 && term.IsTerminal(int(os.Stderr.Fd())) && !term.IsTerminal(int(os.Stdout.Fd())) {
+			progress = disass.NewProgress(os.Stderr)
+		}
+
 		if err := ctrlc.Default.Run(context.Background(), func() error {
+			if progress != nil {
+				defer progress.Done()
+			}
 			for _, m := range ms {
 				if startAddr == 0 && startOff != 0 {
 					if startAddr, err = m.GetVMAddress(startOff); err != nil {
@@ -217,6 +265,13 @@ var machoDisassCmd = &cobra.Command{
 					}
 				}
 
+				var lines *disass.LineTable
+				if showLines && !asJSON {
+					if lines, err = loadLineTable(m, machoPath, selectedArch); err != nil {
+						log.Warnf("not showing source lines: %v", err)
+					}
+				}
+
 				if !quiet {
 					if len(cacheFile) == 0 {
 						cacheFile = machoPath + ".a2s"
@@ -256,10 +311,17 @@ var machoDisassCmd = &cobra.Command{
 				}
 
 				if allFuncs && len(segmentSection) == 0 {
-					for _, fn := range m.GetFunctions() {
+					fns := m.GetFunctions()
+					if progress != nil {
+						progress.Discovered(len(fns))
+					}
+					for _, fn := range fns {
 						data, err := m.GetFunctionData(fn)
 						if err != nil {
 							log.Errorf("failed to get data for function: %v", err)
+							if progress != nil {
+								progress.Processed(0)
+							}
 							continue
 						}
 
@@ -268,9 +330,16 @@ var machoDisassCmd = &cobra.Command{
 							StartAddress: fn.StartAddr,
 							Middle:       0,
 							AsJSON:       asJSON,
+							Groups:       withGroups,
+							Simplify:     simplify,
+							MemOnly:      memOnly,
+							NoWrap:       noWrap,
+							Relative:     relative,
 							Demangle:     demangleFlag,
 							Quite:        quiet,
 							Color:        viper.GetBool("color"),
+							Symbols:      also,
+							Lines:        lines,
 						})
 
 						//***********************
@@ -292,7 +361,12 @@ var machoDisassCmd = &cobra.Command{
 						//***************
 						//* DISASSEMBLE *
 						//***************
-						disass.Disassemble(engine)
+						if err := disass.Disassemble(engine); err != nil {
+							log.Warn(err.Error())
+						}
+						if progress != nil {
+							progress.Processed(uint64(len(data)))
+						}
 					}
 				} else {
 					if len(symbolName) > 0 {
@@ -366,9 +440,16 @@ var machoDisassCmd = &cobra.Command{
 						StartAddress: startAddr,
 						Middle:       middleAddr,
 						AsJSON:       asJSON,
+						Groups:       withGroups,
+						Simplify:     simplify,
+						MemOnly:      memOnly,
+						NoWrap:       noWrap,
+						Relative:     relative,
 						Demangle:     demangleFlag,
 						Quite:        quiet,
 						Color:        viper.GetBool("color"),
+						Symbols:      also,
+						Lines:        lines,
 					})
 
 					//***********************
@@ -388,7 +469,9 @@ var machoDisassCmd = &cobra.Command{
 					//***************
 					//* DISASSEMBLE *
 					//***************
-					disass.Disassemble(engine)
+					if err := disass.Disassemble(engine); err != nil {
+						log.Warn(err.Error())
+					}
 				}
 			}
 			return nil
@@ -407,3 +490,76 @@ var machoDisassCmd = &cobra.Command{
 		return nil
 	},
 }
+
+// loadAlsoSymbols adds the symbols of the (arm64 slice of the) MachO at path to idx
+func loadAlsoSymbols(idx disass.SymbolIndex, path, arch string) (int, error) {
+	if ok, err := magic.IsMachO(path); !ok {
+		return 0, err
+	}
+
+	fat, err := macho.OpenFat(path)
+	if err == nil {
+		defer fat.Close()
+		for _, a := range fat.Arches {
+			sub := strings.ToLower(a.SubCPU.String(a.CPU))
+			if strings.Contains(sub, "arm64") && (len(arch) == 0 || strings.Contains(sub, strings.ToLower(arch))) {
+				return idx.AddImage(a.File)
+			}
+		}
+		return 0, fmt.Errorf("no arm64 slice found")
+	} else if err != macho.ErrNotFat {
+		return 0, err
+	}
+
+	m, err := macho.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer m.Close()
+
+	return idx.AddImage(m)
+}
+
+// loadLineTable loads the DWARF line info of m (or of the <path>.dSYM next to it)
+func loadLineTable(m *macho.File, path, arch string) (*disass.LineTable, error) {
+	if dw, err := m.DWARF(); err == nil {
+		if lines, err := disass.NewLineTable(dw); err == nil {
+			return lines, nil
+		}
+	}
+
+	dsym := filepath.Join(path+".dSYM", "Contents", "Resources", "DWARF", filepath.Base(path))
+	if _, err := os.Stat(dsym); err != nil {
+		return nil, fmt.Errorf("no DWARF line info in %s and no dSYM found at %s", filepath.Base(path), dsym)
+	}
+
+	fat, err := macho.OpenFat(dsym)
+	if err == nil {
+		defer fat.Close()
+		for _, a := range fat.Arches {
+			sub := strings.ToLower(a.SubCPU.String(a.CPU))
+			if strings.Contains(sub, "arm64") && (len(arch) == 0 || strings.Contains(sub, strings.ToLower(arch))) {
+				dw, err := a.File.DWARF()
+				if err != nil {
+					return nil, fmt.Errorf("failed to parse DWARF in %s: %v", dsym, err)
+				}
+				return disass.NewLineTable(dw)
+			}
+		}
+		return nil, fmt.Errorf("no arm64 slice found in %s", dsym)
+	} else if err != macho.ErrNotFat {
+		return nil, err
+	}
+
+	dm, err := macho.Open(dsym)
+	if err != nil {
+		return nil, err
+	}
+	defer dm.Close()
+
+	dw, err := dm.DWARF()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse DWARF in %s: %v", dsym, err)
+	}
+	return disass.NewLineTable(dw)
+}
@@ -84,6 +84,7 @@ var pongoCmd = &cobra.Command{
 			zr, err := download.NewRemoteZipReader(args[0], &download.RemoteConfig{
 				Proxy:    viper.GetString("pongo.proxy"),
 				Insecure: viper.GetBool("pongo.insecure"),
+				Timeout:  viper.GetDuration("timeout"),
 			})
 			if err != nil {
 				return fmt.Errorf("unable to download remote zip: %v", err)
@@ -39,6 +39,7 @@ import (
 	"github.com/blacktop/ipsw/cmd/ipsw/cmd/macho"
 	"github.com/blacktop/ipsw/cmd/ipsw/cmd/ota"
 	"github.com/blacktop/ipsw/cmd/ipsw/cmd/ssh"
+	"github.com/blacktop/ipsw/internal/output"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
@@ -83,11 +84,15 @@ func init() {
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.config/ipsw/config.yaml)")
 	rootCmd.PersistentFlags().BoolVarP(&Verbose, "verbose", "V", false, "verbose output")
 	rootCmd.PersistentFlags().BoolVar(&Color, "color", false, "colorize output")
+	rootCmd.PersistentFlags().Bool("plain", false, "plain output: no colors or decorations (for log ingestion)")
 	rootCmd.PersistentFlags().String("diff-tool", "", "git diff tool (for --diff commands)")
+	rootCmd.PersistentFlags().Duration("timeout", 0, "timeout for each network request/device connection (0 is no timeout)")
 	rootCmd.PersistentFlags().MarkHidden("diff-tool")
-	viper.BindPFlag("verbose", rootCmd.Flags().Lookup("verbose"))
-	viper.BindPFlag("color", rootCmd.Flags().Lookup("color"))
-	viper.BindPFlag("diff-tool", rootCmd.Flags().Lookup("diff-tool"))
+	viper.BindPFlag("verbose", rootCmd.PersistentFlags().Lookup("verbose"))
+	viper.BindPFlag("color", rootCmd.PersistentFlags().Lookup("color"))
+	viper.BindPFlag("plain", rootCmd.PersistentFlags().Lookup("plain"))
+	viper.BindPFlag("diff-tool", rootCmd.PersistentFlags().Lookup("diff-tool"))
+	viper.BindPFlag("timeout", rootCmd.PersistentFlags().Lookup("timeout"))
 	viper.BindEnv("color", "CLICOLOR")
 	// Add subcommand groups
 	rootCmd.AddCommand(appstore.AppstoreCmd)
@@ -128,4 +133,10 @@ func initConfig() {
 	if err := viper.ReadInConfig(); err == nil {
 		fmt.Fprintln(os.Stderr, "Using config file:", viper.ConfigFileUsed())
 	}
+
+	// --plain wins over --color (and CLICOLOR) for every command
+	if viper.GetBool("plain") {
+		viper.Set("color", false)
+	}
+	output.Configure(viper.GetBool("color"), viper.GetBool("plain"))
 }
@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/blacktop/ipsw/internal/output"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func TestRootPlainFlag(t *testing.T) {
+	var plain, color bool
+	sub := &cobra.Command{
+		Use: "plain-test",
+		Run: func(cmd *cobra.Command, args []string) {
+			plain = viper.GetBool("plain")
+			color = viper.GetBool("color")
+		},
+	}
+	rootCmd.AddCommand(sub)
+	t.Cleanup(func() {
+		rootCmd.RemoveCommand(sub)
+		rootCmd.SetArgs(nil)
+		output.Configure(false, false)
+	})
+
+	t.Setenv("HOME", t.TempDir())
+	rootCmd.SetArgs([]string{"plain-test", "--color", "--plain"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if !plain || !output.IsPlain() {
+		t.Errorf("--plain was not applied: viper plain = %t, output.IsPlain() = %t", plain, output.IsPlain())
+	}
+	if color {
+		t.Error("--plain should win over --color")
+	}
+}
@@ -73,6 +73,7 @@ var updateCmd = &cobra.Command{
 
 		proxy, _ := cmd.Flags().GetString("proxy")
 		insecure, _ := cmd.Flags().GetBool("insecure")
+		timeout, _ := cmd.Flags().GetDuration("timeout")
 		// confirm, _ := cmd.Flags().GetBool("yes")
 		replace, _ := cmd.Flags().GetBool("replace")
 
@@ -179,7 +180,10 @@ var updateCmd = &cobra.Command{
 			}
 		}
 
-		downloader := download.NewDownload(proxy, insecure, false, false, false, false, Verbose)
+		downloader, err := download.NewDownload(proxy, insecure, false, false, false, false, Verbose, timeout)
+		if err != nil {
+			return err
+		}
 		fname := strings.Replace(path.Base(asset.DownloadURL), ",", "_", -1)
 		fname = filepath.Join(destPath, fname)
 		if _, err := os.Stat(fname); os.IsNotExist(err) {
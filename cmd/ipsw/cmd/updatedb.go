@@ -61,6 +61,7 @@ var updateDBCmd = &cobra.Command{
 		urlList, _ := cmd.Flags().GetString("urls")
 		remoteURL, _ := cmd.Flags().GetString("remote")
 		dbPath, _ := cmd.Flags().GetString("db")
+		timeout, _ := cmd.Flags().GetDuration("timeout")
 
 		mut := "Creating"
 		if _, err := os.Stat(dbPath); err == nil {
@@ -96,7 +97,7 @@ var updateDBCmd = &cobra.Command{
 					log.WithError(err).Fatal("failed to read line from URL list file")
 				}
 
-				zr, err := download.NewRemoteZipReader(url, &download.RemoteConfig{})
+				zr, err := download.NewRemoteZipReader(url, &download.RemoteConfig{Timeout: timeout})
 				if err != nil {
 					log.Error("failed to create remote zip reader")
 					continue
@@ -110,7 +111,7 @@ var updateDBCmd = &cobra.Command{
 				}
 			}
 		} else if len(remoteURL) > 0 {
-			zr, err := download.NewRemoteZipReader(remoteURL, &download.RemoteConfig{})
+			zr, err := download.NewRemoteZipReader(remoteURL, &download.RemoteConfig{Timeout: timeout})
 			if err != nil {
 				log.WithError(err).Fatal("failed to create remote zip reader")
 			}
@@ -158,7 +159,7 @@ var updateDBCmd = &cobra.Command{
 				log.WithError(err).Fatal("failed to create itunes API")
 			}
 			for _, build := range itunes.GetBuilds() {
-				zr, err := download.NewRemoteZipReader(build.URL, &download.RemoteConfig{})
+				zr, err := download.NewRemoteZipReader(build.URL, &download.RemoteConfig{Timeout: timeout})
 				if err != nil {
 					log.WithError(err).Fatal("failed to create remote zip reader")
 				}
@@ -31,6 +31,9 @@ func init() {
 	rootCmd.AddCommand(startCmd)
 
 	startCmd.Flags().BoolP("debug", "d", false, "Debug mode")
+	startCmd.Flags().String("host", "", "Host/IP address to listen on (overrides the config)")
+	startCmd.Flags().Int("port", 0, "Port to listen on (overrides the config)")
+	startCmd.Flags().Duration("wiki-cache-ttl", 0, "How long to cache scraped wiki results (default 1h)")
 	viper.BindPFlag("start.debug", startCmd.Flags().Lookup("debug"))
 }
 
@@ -39,6 +42,19 @@ var startCmd = &cobra.Command{
 	Use:   "start",
 	Short: "Start the ipswd daemon",
 	RunE: func(cmd *cobra.Command, args []string) error {
+		// only flags that were set override the config file/env vars
+		if cmd.Flags().Changed("host") {
+			host, _ := cmd.Flags().GetString("host")
+			viper.Set("daemon.host", host)
+		}
+		if cmd.Flags().Changed("port") {
+			port, _ := cmd.Flags().GetInt("port")
+			viper.Set("daemon.port", port)
+		}
+		if cmd.Flags().Changed("wiki-cache-ttl") {
+			ttl, _ := cmd.Flags().GetDuration("wiki-cache-ttl")
+			viper.Set("daemon.wiki_cache_ttl", ttl)
+		}
 		return daemon.NewDaemon().Start()
 	},
 }
@@ -12,6 +12,7 @@ import (
 	"regexp"
 	"runtime"
 	"strings"
+	"time"
 
 	"github.com/apex/log"
 	"github.com/blacktop/go-macho"
@@ -41,6 +42,8 @@ type Config struct {
 	Proxy string `json:"proxy,omitempty"`
 	// don't verify the certificate chain
 	Insecure bool `json:"insecure,omitempty"`
+	// timeout for each remote request (0 means no timeout)
+	Timeout time.Duration `json:"timeout,omitempty"`
 	// search the DMGs for files
 	DMGs bool `json:"dmgs,omitempty"`
 	// type of DMG to extract
@@ -76,9 +79,10 @@ func getRemoteFolder(c *Config) (*info.Info, *zip.Reader, string, error) {
 	zr, err := download.NewRemoteZipReader(c.URL, &download.RemoteConfig{
 		Proxy:    c.Proxy,
 		Insecure: c.Insecure,
+		Timeout:  c.Timeout,
 	})
 	if err != nil {
-		return nil, nil, "", fmt.Errorf("unable to download remote zip: %v", err)
+		return nil, nil, "", fmt.Errorf("unable to download remote zip: %w", err)
 	}
 	i, err := info.ParseZipFiles(zr.File)
 	if err != nil {
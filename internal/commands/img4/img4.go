@@ -4,13 +4,20 @@ import (
 	"bytes"
 	"crypto/aes"
 	"crypto/cipher"
+	"encoding/binary"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/apex/log"
+	"github.com/blacktop/go-macho/types"
+	"github.com/blacktop/ipsw/internal/download"
 	"github.com/blacktop/ipsw/internal/utils"
 	"github.com/blacktop/ipsw/pkg/img4"
+	"github.com/blacktop/ipsw/pkg/kernelcache"
 	"github.com/blacktop/ipsw/pkg/lzfse"
 	"github.com/pkg/errors"
 )
@@ -29,24 +36,10 @@ func DecryptPayload(path, output string, iv, key []byte) error {
 		return errors.Wrap(err, "unabled to parse Im4p")
 	}
 
-	block, err := aes.NewCipher(key)
-	if err != nil {
-		return fmt.Errorf("failed to create AES cipher: %v", err)
+	if i.Data, err = decryptData(i.Data, iv, key); err != nil {
+		return err
 	}
 
-	if len(i.Data) < aes.BlockSize {
-		return fmt.Errorf("im4p data too short")
-	}
-
-	// CBC mode always works in whole blocks.
-	if (len(i.Data) % aes.BlockSize) != 0 {
-		return fmt.Errorf("im4p data is not a multiple of the block size")
-	}
-
-	mode := cipher.NewCBCDecrypter(block, iv)
-
-	mode.CryptBlocks(i.Data, i.Data)
-
 	if len(output) == 0 {
 		output = path + ".dec"
 	}
@@ -73,3 +66,121 @@ func DecryptPayload(path, output string, iv, key []byte) error {
 
 	return nil
 }
+
+// DecryptWithWikiKeys decrypts (unless the wiki lists it as "Not Encrypted") and decompresses the im4p at path
+// with the wiki keys for the component its file name names and writes the plain payload to output (path + ".dec" if empty)
+func DecryptWithWikiKeys(path, output string, keys *download.WikiFWKeys) (string, error) {
+	ck, err := keys.ComponentKeys(strings.TrimSuffix(filepath.Base(path), ".im4p"))
+	if err != nil {
+		return "", err
+	}
+	return decryptWithWikiKeys(path, output, keys, ck)
+}
+
+// DecryptComponentWithWikiKeys is DecryptWithWikiKeys with the keys of component (i.e. Kernelcache or iBoot),
+// so the im4p can have any file name
+func DecryptComponentWithWikiKeys(path, output, component string, keys *download.WikiFWKeys) (string, error) {
+	ck, err := keys.Component(component)
+	if err != nil {
+		return "", err
+	}
+	return decryptWithWikiKeys(path, output, keys, ck)
+}
+
+func decryptWithWikiKeys(path, output string, keys *download.WikiFWKeys, ck *download.WikiComponentKeys) (string, error) {
+	if err := checkWikiFileName(path, ck.FileName); err != nil {
+		return "", fmt.Errorf("%v: refusing to use the keys for %s %s", err, keys.Device, keys.Build)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("unabled to open file %s: %v", path, err)
+	}
+	defer f.Close()
+
+	i, err := img4.ParseIm4p(f)
+	if err != nil {
+		return "", fmt.Errorf("unabled to parse Im4p: %v", err)
+	}
+	if len(i.Type) > 0 && !strings.EqualFold(i.Type, ck.Type) {
+		return "", fmt.Errorf("%s is a '%s' im4p but the %s keys are for a '%s'", path, i.Type, ck.Component, ck.Type)
+	}
+
+	data := i.Data
+	if ck.Encrypted {
+		iv, err := hex.DecodeString(ck.IV)
+		if err != nil {
+			return "", fmt.Errorf("failed to decode %sIV from the wiki: %v", ck.Component, err)
+		}
+		key, err := hex.DecodeString(ck.Key)
+		if err != nil {
+			return "", fmt.Errorf("failed to decode %sKey from the wiki: %v", ck.Component, err)
+		}
+		if data, err = decryptData(data, iv, key); err != nil {
+			return "", err
+		}
+	} else {
+		utils.Indent(log.Info, 2)(fmt.Sprintf("%s is not encrypted (skipping decryption)", ck.Component))
+	}
+
+	if len(data) >= 4 && (bytes.HasPrefix(data, []byte("bvx2")) || bytes.HasPrefix(data, []byte("comp"))) {
+		if data, err = kernelcache.DecompressData(&kernelcache.CompressedCache{
+			Magic: data[:4],
+			Size:  len(data),
+			Data:  data,
+		}); err != nil {
+			return "", fmt.Errorf("failed to decompress %s: %v", path, err)
+		}
+	}
+
+	if ck.Component == "Kernelcache" {
+		if len(data) < 4 || (binary.LittleEndian.Uint32(data) != uint32(types.Magic64) && binary.BigEndian.Uint32(data) != uint32(types.MagicFat)) {
+			return "", fmt.Errorf("decrypted kernelcache is not a Mach-O: the keys for %s %s do not match %s (wrong --device/--build?)",
+				keys.Device, keys.Build, path)
+		}
+	}
+
+	if len(output) == 0 {
+		output = path + ".dec"
+	}
+	utils.Indent(log.Info, 2)(fmt.Sprintf("Decrypting file to %s", output))
+	if err := os.WriteFile(output, data, 0660); err != nil {
+		return "", fmt.Errorf("failed to write file %s: %v", output, err)
+	}
+
+	return output, nil
+}
+
+// checkWikiFileName refuses a file whose full name (i.e. kernelcache.release.iphone13) differs from the one listed on the
+// wiki (i.e. kernelcache.release.iphone14); short names like kernelcache.im4p can't be checked
+func checkWikiFileName(path, listed string) error {
+	name := strings.TrimSuffix(filepath.Base(path), ".im4p")
+	listed = strings.TrimSuffix(listed, ".im4p")
+	if len(listed) == 0 || strings.Count(name, ".") < 2 || strings.Count(name, ".") != strings.Count(listed, ".") {
+		return nil
+	}
+	if !strings.EqualFold(name, listed) {
+		return fmt.Errorf("%s does not match %s listed on the wiki", filepath.Base(path), listed)
+	}
+	return nil
+}
+
+func decryptData(data, iv, key []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create AES cipher: %v", err)
+	}
+	if len(iv) != aes.BlockSize {
+		return nil, fmt.Errorf("invalid AES iv length %d", len(iv))
+	}
+	if len(data) < aes.BlockSize {
+		return nil, fmt.Errorf("im4p data too short")
+	}
+	// CBC mode always works in whole blocks.
+	if (len(data) % aes.BlockSize) != 0 {
+		return nil, fmt.Errorf("im4p data is not a multiple of the block size")
+	}
+	out := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(out, data)
+	return out, nil
+}
@@ -0,0 +1,125 @@
+package img4
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/asn1"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/blacktop/ipsw/internal/download"
+)
+
+const (
+	testIV  = "0123456789abcdef0123456789abcdef"
+	testKey = "fedcba9876543210fedcba9876543210fedcba9876543210fedcba9876543210"
+)
+
+// testMachO is the start of a 64-bit arm64 Mach-O header (padded to the AES block size)
+var testMachO = append([]byte{0xcf, 0xfa, 0xed, 0xfe, 0x0c, 0x00, 0x00, 0x01}, bytes.Repeat([]byte{0x41}, 24)...)
+
+func writeIm4p(t *testing.T, name, typ string, data []byte) string {
+	t.Helper()
+	dat, err := asn1.Marshal(struct {
+		Name        string `asn1:"ia5"`
+		Type        string `asn1:"ia5"`
+		Description string
+		Data        []byte
+	}{"IM4P", typ, "test", data})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, dat, 0660); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func encrypt(t *testing.T, data []byte) []byte {
+	t.Helper()
+	iv, _ := hex.DecodeString(testIV)
+	key, _ := hex.DecodeString(testKey)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := make([]byte, len(data))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(out, data)
+	return out
+}
+
+func TestDecryptWithWikiKeys(t *testing.T) {
+	keys := &download.WikiFWKeys{
+		Device:         "iPhone14,5",
+		Build:          "19A346",
+		Kernelcache:    "kernelcache.release.iphone14",
+		KernelcacheIV:  testIV,
+		KernelcacheKey: testKey,
+		IBoot:          "iBoot.d17.RELEASE.im4p",
+		IBootIV:        "Not Encrypted",
+		IBootKey:       "Not Encrypted",
+	}
+
+	path := writeIm4p(t, "kernelcache.im4p", "krnl", encrypt(t, testMachO))
+	out, err := DecryptWithWikiKeys(path, "", keys)
+	if err != nil {
+		t.Fatalf("DecryptWithWikiKeys() error = %v", err)
+	}
+	if got, _ := os.ReadFile(out); !bytes.Equal(got, testMachO) {
+		t.Errorf("decrypted kernelcache = %x, want %x", got, testMachO)
+	}
+
+	// a kernelcache whose file name doesn't say so
+	path = writeIm4p(t, "kc.im4p", "krnl", encrypt(t, testMachO))
+	if _, err := DecryptWithWikiKeys(path, "", keys); err == nil {
+		t.Error("DecryptWithWikiKeys(kc.im4p) expected an unsupported component error")
+	}
+	out, err = DecryptComponentWithWikiKeys(path, "", "Kernelcache", keys)
+	if err != nil {
+		t.Fatalf("DecryptComponentWithWikiKeys(kc.im4p) error = %v", err)
+	}
+	if got, _ := os.ReadFile(out); !bytes.Equal(got, testMachO) {
+		t.Errorf("decrypted kc.im4p = %x, want %x", got, testMachO)
+	}
+	if _, err := DecryptComponentWithWikiKeys(path, "", "iBoot", keys); err == nil {
+		t.Error("DecryptComponentWithWikiKeys(kc.im4p, iBoot) expected an im4p type error")
+	}
+
+	path = writeIm4p(t, "iBoot.d17.RELEASE.im4p", "ibot", []byte("plain iBoot"))
+	out, err = DecryptWithWikiKeys(path, filepath.Join(t.TempDir(), "iboot.bin"), keys)
+	if err != nil {
+		t.Fatalf("DecryptWithWikiKeys(not encrypted) error = %v", err)
+	}
+	if got, _ := os.ReadFile(out); string(got) != "plain iBoot" {
+		t.Errorf("not encrypted iBoot = %q", got)
+	}
+
+	// keys for another build decrypt to garbage
+	wrong := *keys
+	wrong.Build = "19A341"
+	wrong.KernelcacheKey = strings.Repeat("00", 32)
+	path = writeIm4p(t, "kernelcache.im4p", "krnl", encrypt(t, testMachO))
+	if _, err := DecryptWithWikiKeys(path, "", &wrong); err == nil || !strings.Contains(err.Error(), "wrong --device/--build") {
+		t.Errorf("DecryptWithWikiKeys(wrong keys) error = %v", err)
+	}
+
+	path = writeIm4p(t, "kernelcache.release.iphone13", "krnl", encrypt(t, testMachO))
+	if _, err := DecryptWithWikiKeys(path, "", keys); err == nil {
+		t.Error("expected error for a kernelcache from another device")
+	}
+
+	path = writeIm4p(t, "kernelcache.im4p", "ibot", encrypt(t, testMachO))
+	if _, err := DecryptWithWikiKeys(path, "", keys); err == nil {
+		t.Error("expected error for an im4p type that doesn't match the component")
+	}
+
+	path = writeIm4p(t, "sep-firmware.d17.RELEASE.im4p", "sepi", encrypt(t, testMachO))
+	if _, err := DecryptWithWikiKeys(path, "", keys); err == nil {
+		t.Error("expected error for a component without keys on the wiki")
+	}
+}
@@ -6,17 +6,30 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	env "github.com/caarlos0/env/v8"
 	"github.com/spf13/viper"
 )
 
 type daemon struct {
-	Host    string `json:"host" env:"DAEMON_HOST" envDefault:"localhost"`
+	Host    string `json:"host" env:"DAEMON_HOST"` // every interface unless set
 	Port    int    `json:"port" env:"DAEMON_PORT" envDefault:"3993"`
 	Socket  string `json:"socket" env:"DAEMON_SOCKET"`
 	Debug   bool   `json:"debug" env:"DAEMON_DEBUG"`
 	LogFile string `json:"logfile" env:"DAEMON_LOGFILE"`
+	// WikiCacheTTL is how long the /wiki routes cache scraped results
+	WikiCacheTTL time.Duration `json:"wiki_cache_ttl" mapstructure:"wiki_cache_ttl" env:"DAEMON_WIKI_CACHE_TTL" envDefault:"1h"`
+}
+
+// download is the network config of the daemon's scrapers (the same download keys as the ipsw config)
+type download struct {
+	Proxy     string        `json:"proxy" env:"DOWNLOAD_PROXY"`
+	Insecure  bool          `json:"insecure" env:"DOWNLOAD_INSECURE"`
+	CABundle  string        `json:"ca-bundle" mapstructure:"ca-bundle" env:"DOWNLOAD_CA_BUNDLE"`
+	RateLimit float64       `json:"rate-limit" mapstructure:"rate-limit" env:"DOWNLOAD_RATE_LIMIT"`
+	Retries   int           `json:"retries" env:"DOWNLOAD_RETRIES"`
+	Timeout   time.Duration `json:"timeout" env:"DOWNLOAD_TIMEOUT"`
 }
 
 type database struct {
@@ -32,6 +45,7 @@ type database struct {
 // Config is the configuration struct
 type Config struct {
 	Daemon   daemon   `json:"daemon"`
+	Download download `json:"download"`
 	Database database `json:"database"`
 }
 
@@ -44,18 +58,18 @@ func (c *Config) verify() error {
 		if os.Getenv("IPSW_IN_SNAP") == "1" {
 			c.Daemon.Socket = "/var/snap/ipswd/common/ipsw.sock"
 		} else {
-			c.Daemon.Host = "localhost"
-			c.Daemon.Port = 3993
+			c.Daemon.Port = 3993 // on every interface (a host is only bound when one is set)
 		}
 	} else if c.Daemon.Host != "" && c.Daemon.Socket != "" {
 		return fmt.Errorf("config: host and socket cannot be set at the same time")
 	} else if c.Daemon.Host != "" && c.Daemon.Port == 0 {
 		return fmt.Errorf("config: port must be set if host is set")
-	} else if c.Daemon.Host == "" && c.Daemon.Port != 0 {
-		c.Daemon.Host = "localhost"
 	} else if strings.HasPrefix(c.Daemon.Socket, "~/") {
 		c.Daemon.Socket = filepath.Join(home, c.Daemon.Socket[2:]) // TODO: is this bad practice?
 	}
+	if c.Download.RateLimit < 0 || c.Download.Retries < 0 || c.Download.Timeout < 0 {
+		return fmt.Errorf("config: download rate-limit, retries and timeout must be >= 0")
+	}
 
 	return nil
 }
@@ -0,0 +1,30 @@
+package config
+
+import (
+	"net"
+	"strconv"
+	"testing"
+)
+
+func TestVerifyDaemonAddr(t *testing.T) {
+	t.Setenv("IPSW_IN_SNAP", "")
+	for _, tt := range []struct {
+		name string
+		in   daemon
+		want string
+	}{
+		{"default", daemon{}, ":3993"},
+		{"port only", daemon{Port: 3993}, ":3993"}, // i.e. config.example.yml in the daemon image
+		{"host", daemon{Host: "127.0.0.1", Port: 8080}, "127.0.0.1:8080"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			c := Config{Daemon: tt.in}
+			if err := c.verify(); err != nil {
+				t.Fatalf("verify() error = %v", err)
+			}
+			if got := net.JoinHostPort(c.Daemon.Host, strconv.Itoa(c.Daemon.Port)); got != tt.want {
+				t.Errorf("daemon address = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -4,6 +4,7 @@ package daemon
 import (
 	"github.com/blacktop/ipsw/api/server"
 	"github.com/blacktop/ipsw/internal/config"
+	"github.com/blacktop/ipsw/internal/download"
 	"github.com/gin-gonic/gin"
 )
 
@@ -36,11 +37,20 @@ func (d *daemon) Start() (err error) {
 		gin.SetMode(gin.ReleaseMode)
 	}
 	d.server = server.NewServer(&server.Config{
-		Host:    d.conf.Daemon.Host,
-		Port:    d.conf.Daemon.Port,
-		Socket:  d.conf.Daemon.Socket,
-		Debug:   d.conf.Daemon.Debug,
-		LogFile: d.conf.Daemon.LogFile,
+		Host:         d.conf.Daemon.Host,
+		Port:         d.conf.Daemon.Port,
+		Socket:       d.conf.Daemon.Socket,
+		Debug:        d.conf.Daemon.Debug,
+		LogFile:      d.conf.Daemon.LogFile,
+		WikiCacheTTL: d.conf.Daemon.WikiCacheTTL,
+		Download: &download.DownloadConfig{
+			Proxy:     d.conf.Download.Proxy,
+			Insecure:  d.conf.Download.Insecure,
+			CABundle:  d.conf.Download.CABundle,
+			RateLimit: d.conf.Download.RateLimit,
+			Retries:   d.conf.Download.Retries,
+			Timeout:   d.conf.Download.Timeout,
+		},
 	})
 	return d.server.Start()
 }
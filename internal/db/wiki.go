@@ -0,0 +1,132 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/blacktop/ipsw/internal/download"
+	"github.com/blacktop/ipsw/internal/models"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// WikiDB accumulates theapplewiki.com scrapes in a SQLite database so firmwares can be
+// queried over time (i.e. when a build was first listed).
+type WikiDB struct {
+	db *gorm.DB
+}
+
+// WikiQuery selects firmwares from a WikiDB; zero fields match every firmware.
+type WikiQuery struct {
+	Device        string
+	Build         string
+	ReleasedSince time.Time
+}
+
+// OpenWikiDB opens (or creates) the SQLite database at path and migrates its schema.
+func OpenWikiDB(path string) (*WikiDB, error) {
+	db, err := gorm.Open(sqlite.Open(path), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open wiki database %s: %w", path, err)
+	}
+	if err := db.AutoMigrate(&models.WikiScrapeRun{}, &models.WikiDevice{}, &models.WikiFirmware{}); err != nil {
+		return nil, fmt.Errorf("failed to migrate wiki database %s: %w", path, err)
+	}
+	return &WikiDB{db: db}, nil
+}
+
+// Merge records a scrape taken at time at: firmwares are upserted on (build, url), keeping
+// when they were first seen and updating when they were last seen.
+func (w *WikiDB) Merge(fws []download.WikiFirmware, at time.Time) (*models.WikiScrapeRun, error) {
+	run := &models.WikiScrapeRun{StartedAt: at, Firmwares: len(fws)}
+	err := w.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(run).Error; err != nil {
+			return err
+		}
+		for _, fw := range fws {
+			var m models.WikiFirmware
+			res := tx.Where("build = ? AND url = ?", fw.Build, fw.URL).Limit(1).Find(&m)
+			if res.Error != nil {
+				return res.Error
+			}
+			if res.RowsAffected == 0 {
+				m = models.WikiFirmware{Build: fw.Build, URL: fw.URL, FirstSeen: at, FirstRunID: run.ID}
+				run.New++
+			}
+			m.Version = fw.Version
+			m.Product = fw.Product
+			m.OS = fw.OS
+			m.Sha1Hash = fw.Sha1Hash
+			m.FileSize = int64(fw.FileSize)
+			m.ReleaseDate = fw.ReleaseDate
+			m.LastSeen = at
+			m.LastRunID = run.ID
+			if err := tx.Omit("Devices").Save(&m).Error; err != nil {
+				return err
+			}
+			devs, err := wikiDevices(tx, fw.Devices)
+			if err != nil {
+				return err
+			}
+			if len(devs) > 0 {
+				if err := tx.Model(&m).Omit("Devices.*").Association("Devices").Append(devs); err != nil {
+					return err
+				}
+			}
+		}
+		return tx.Save(run).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to merge scrape into wiki database: %w", err)
+	}
+	return run, nil
+}
+
+// wikiDevices returns the device rows for names (creating the missing ones)
+func wikiDevices(tx *gorm.DB, names []string) ([]models.WikiDevice, error) {
+	var devs []models.WikiDevice
+	for _, name := range names {
+		if name = strings.TrimSpace(name); len(name) == 0 {
+			continue
+		}
+		var d models.WikiDevice
+		if err := tx.Where(models.WikiDevice{Name: name}).FirstOrCreate(&d).Error; err != nil {
+			return nil, err
+		}
+		devs = append(devs, d)
+	}
+	return devs, nil
+}
+
+// Query returns the firmwares matching q (oldest release first).
+func (w *WikiDB) Query(q WikiQuery) ([]models.WikiFirmware, error) {
+	tx := w.db.Preload("Devices").Order("release_date, build, url")
+	if len(q.Build) > 0 {
+		tx = tx.Where("build = ? COLLATE NOCASE", q.Build)
+	}
+	if len(q.Device) > 0 {
+		tx = tx.Where("id IN (?)", w.db.Table("firmware_devices").
+			Select("firmware_devices.wiki_firmware_id").
+			Joins("JOIN devices ON devices.id = firmware_devices.wiki_device_id").
+			Where("devices.name = ? COLLATE NOCASE", q.Device))
+	}
+	if !q.ReleasedSince.IsZero() {
+		tx = tx.Where("release_date >= ?", q.ReleasedSince)
+	}
+	var fws []models.WikiFirmware
+	if err := tx.Find(&fws).Error; err != nil {
+		return nil, fmt.Errorf("failed to query wiki database: %w", err)
+	}
+	return fws, nil
+}
+
+// Close closes the database.
+func (w *WikiDB) Close() error {
+	db, err := w.db.DB()
+	if err != nil {
+		return err
+	}
+	return db.Close()
+}
@@ -0,0 +1,91 @@
+package db
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/blacktop/ipsw/internal/download"
+	"github.com/blacktop/ipsw/internal/models"
+)
+
+func deviceNames(fw models.WikiFirmware) []string {
+	var names []string
+	for _, d := range fw.Devices {
+		names = append(names, d.Name)
+	}
+	return names
+}
+
+func TestWikiDBMerge(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "wiki.db")
+	wdb, err := OpenWikiDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { wdb.Close() }()
+
+	day1 := time.Date(2023, 9, 18, 12, 0, 0, 0, time.UTC)
+	day2 := day1.Add(24 * time.Hour)
+	released := time.Date(2023, 9, 18, 0, 0, 0, 0, time.UTC)
+
+	run, err := wdb.Merge([]download.WikiFirmware{
+		{Version: "17.0", Build: "21A329", Devices: []string{"iPhone15,2"}, URL: "https://example.com/a.ipsw", ReleaseDate: released},
+		{Version: "16.6", Build: "20G75", Devices: []string{"iPhone15,2"}, URL: "https://example.com/b.ipsw", ReleaseDate: released.AddDate(0, -2, 0)},
+	}, day1)
+	if err != nil {
+		t.Fatalf("Merge() error = %v", err)
+	}
+	if run.Firmwares != 2 || run.New != 2 {
+		t.Errorf("first run = %+v, want 2 firmwares, 2 new", run)
+	}
+
+	// the same firmware again (now listed for another device and with a corrected version) plus a new one
+	run, err = wdb.Merge([]download.WikiFirmware{
+		{Version: "17.0.0", Build: "21A329", Devices: []string{"iPhone15,2", "iPhone15,3"}, URL: "https://example.com/a.ipsw", ReleaseDate: released},
+		{Version: "17.0.1", Build: "21A340", Devices: []string{"iPhone15,3"}, URL: "https://example.com/c.ipsw", ReleaseDate: released.AddDate(0, 0, 3)},
+	}, day2)
+	if err != nil {
+		t.Fatalf("Merge() error = %v", err)
+	}
+	if run.Firmwares != 2 || run.New != 1 {
+		t.Errorf("second run = %+v, want 2 firmwares, 1 new", run)
+	}
+
+	fws, err := wdb.Query(WikiQuery{Build: "21a329"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fws) != 1 {
+		t.Fatalf("Query(build) returned %d firmwares, want 1 (upserted)", len(fws))
+	}
+	fw := fws[0]
+	if fw.Version != "17.0.0" {
+		t.Errorf("Version = %q, want the latest scrape's 17.0.0", fw.Version)
+	}
+	if !fw.FirstSeen.Equal(day1) || !fw.LastSeen.Equal(day2) || fw.FirstRunID == fw.LastRunID {
+		t.Errorf("first/last seen = %v (run %d) / %v (run %d), want %v / %v", fw.FirstSeen, fw.FirstRunID, fw.LastSeen, fw.LastRunID, day1, day2)
+	}
+	if got := deviceNames(fw); len(got) != 2 {
+		t.Errorf("Devices = %v, want iPhone15,2 and iPhone15,3", got)
+	}
+
+	if fws, err = wdb.Query(WikiQuery{Device: "iphone15,3"}); err != nil || len(fws) != 2 {
+		t.Errorf("Query(device) = %d firmwares (err %v), want 2", len(fws), err)
+	}
+	if fws, err = wdb.Query(WikiQuery{Device: "iPhone15,2", ReleasedSince: released}); err != nil || len(fws) != 1 || fws[0].Build != "21A329" {
+		t.Errorf("Query(device, since) = %+v (err %v), want 21A329", fws, err)
+	}
+	if fws, err = wdb.Query(WikiQuery{}); err != nil || len(fws) != 3 || fws[0].Build != "20G75" {
+		t.Errorf("Query() = %+v (err %v), want 3 firmwares oldest first", fws, err)
+	}
+
+	// reopening migrates an existing database without losing data
+	wdb.Close()
+	if wdb, err = OpenWikiDB(path); err != nil {
+		t.Fatal(err)
+	}
+	if fws, err = wdb.Query(WikiQuery{}); err != nil || len(fws) != 3 {
+		t.Errorf("Query() after reopen = %d firmwares (err %v), want 3", len(fws), err)
+	}
+}
@@ -0,0 +1,94 @@
+package demangle
+
+import (
+	"container/list"
+	"sync"
+)
+
+// filterCacheSize is the maximum number of names memoized by CachedFilter.
+const filterCacheSize = 10_000
+
+type cacheKey struct {
+	name    string
+	options string
+}
+
+type cacheEntry struct {
+	key cacheKey
+	val string
+}
+
+// lruCache is a size-bounded, concurrency-safe least-recently-used cache.
+type lruCache struct {
+	mu    sync.Mutex
+	max   int
+	ll    *list.List
+	items map[cacheKey]*list.Element
+}
+
+func newLRUCache(max int) *lruCache {
+	return &lruCache{
+		max:   max,
+		ll:    list.New(),
+		items: make(map[cacheKey]*list.Element),
+	}
+}
+
+func (c *lruCache) get(key cacheKey) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.items[key]; ok {
+		c.ll.MoveToFront(e)
+		return e.Value.(*cacheEntry).val, true
+	}
+	return "", false
+}
+
+func (c *lruCache) add(key cacheKey, val string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.items[key]; ok {
+		c.ll.MoveToFront(e)
+		e.Value.(*cacheEntry).val = val
+		return
+	}
+	c.items[key] = c.ll.PushFront(&cacheEntry{key: key, val: val})
+	for c.ll.Len() > c.max {
+		oldest := c.ll.Back()
+		c.ll.Remove(oldest)
+		delete(c.items, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+func (c *lruCache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ll.Len()
+}
+
+var filterCache = newLRUCache(filterCacheSize)
+
+// CachedFilter is like Filter, but memoizes its results in a bounded LRU cache.
+// It is safe for concurrent use and is meant for callers (like the disassemblers)
+// that demangle the same symbols over and over.
+func CachedFilter(name string, options ...Option) string {
+	key := cacheKey{name: name}
+	if len(options) > 0 {
+		opts := make([]byte, len(options))
+		for i, o := range options {
+			opts[i] = byte(o)
+		}
+		key.options = string(opts)
+	}
+	if val, ok := filterCache.get(key); ok {
+		return val
+	}
+	val := Filter(name, options...)
+	filterCache.add(key, val)
+	return val
+}
+
+// CachedDo is like Do, but uses CachedFilter.
+func CachedDo(name string, verbose, llvmStyle bool) string {
+	return do(name, verbose, llvmStyle, CachedFilter)
+}
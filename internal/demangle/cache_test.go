@@ -0,0 +1,97 @@
+package demangle
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+var repeatedSymbols = []string{
+	"__ZN9IOService14registerServiceEj",
+	"__ZN12IOUserClient19clientHasPrivilegeEPvPKc",
+	"__ZNK8OSObject9getMetaClassEv",
+	"__ZN8OSString11withCStringEPKc",
+	"__ZN12OSDictionary9setObjectEPKcPK15OSMetaClassBase",
+	"__ZNSt3__112basic_stringIcNS_11char_traitsIcEENS_9allocatorIcEEE6appendEPKc",
+	"_memcpy",
+}
+
+func TestCachedFilterMatchesFilter(t *testing.T) {
+	for _, sym := range repeatedSymbols {
+		for _, opts := range [][]Option{nil, {NoParams}, {LLVMStyle}} {
+			want := Filter(sym[1:], opts...)
+			// twice so the second call is served from the cache
+			for i := 0; i < 2; i++ {
+				if got := CachedFilter(sym[1:], opts...); got != want {
+					t.Errorf("CachedFilter(%q, %v) = %q, want %q", sym, opts, got, want)
+				}
+			}
+		}
+		if got, want := CachedDo(sym, false, false), Do(sym, false, false); got != want {
+			t.Errorf("CachedDo(%q) = %q, want %q", sym, got, want)
+		}
+	}
+}
+
+func TestLRUCacheEviction(t *testing.T) {
+	c := newLRUCache(2)
+	c.add(cacheKey{name: "a"}, "A")
+	c.add(cacheKey{name: "b"}, "B")
+	c.get(cacheKey{name: "a"}) // mark "a" as recently used
+	c.add(cacheKey{name: "c"}, "C")
+	if _, ok := c.get(cacheKey{name: "b"}); ok {
+		t.Error("expected least recently used entry 'b' to be evicted")
+	}
+	if v, ok := c.get(cacheKey{name: "a"}); !ok || v != "A" {
+		t.Errorf("expected 'a' to still be cached, got %q (%t)", v, ok)
+	}
+	if n := c.len(); n != 2 {
+		t.Errorf("cache len = %d, want 2", n)
+	}
+}
+
+// run with -race
+func TestCachedFilterConcurrent(t *testing.T) {
+	var wg sync.WaitGroup
+	for g := 0; g < 16; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				sym := repeatedSymbols[(g+i)%len(repeatedSymbols)]
+				if i%10 == 0 {
+					sym = fmt.Sprintf("%s_%d_%d", sym, g, i) // force some evictions/inserts
+				}
+				CachedDo(sym, false, false)
+			}
+		}(g)
+	}
+	wg.Wait()
+	if n := filterCache.len(); n > filterCacheSize {
+		t.Errorf("cache grew past its bound: %d > %d", n, filterCacheSize)
+	}
+}
+
+func benchmarkSymbols() []string {
+	syms := make([]string, 0, 10_000)
+	for i := 0; i < cap(syms); i++ {
+		syms = append(syms, repeatedSymbols[i%len(repeatedSymbols)])
+	}
+	return syms
+}
+
+func BenchmarkDo(b *testing.B) {
+	syms := benchmarkSymbols()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		Do(syms[i%len(syms)], false, false)
+	}
+}
+
+func BenchmarkCachedDo(b *testing.B) {
+	syms := benchmarkSymbols()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		CachedDo(syms[i%len(syms)], false, false)
+	}
+}
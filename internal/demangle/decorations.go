@@ -0,0 +1,41 @@
+package demangle
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	// coldRE matches hot/cold split functions (i.e. "__ZN2os3logEv.cold.1")
+	coldRE = regexp.MustCompile(`^(.+)\.cold(?:\.\d+)?$`)
+	// blockRE matches block invocation functions (i.e. "___56-[Foo bar]_block_invoke_2")
+	blockRE = regexp.MustCompile(`^___(.+)_block_invoke(?:_(\d+))?$`)
+	// outlinedRE matches machine outlined functions (i.e. "_OUTLINED_FUNCTION_12")
+	outlinedRE = regexp.MustCompile(`^_?(OUTLINED_FUNCTION_\d+)$`)
+)
+
+// doDecorated demangles a symbol with one of Clang's decorations (block invocations, outlined functions and
+// .cold suffixes) by demangling the symbol it decorates with demangle and re-attaching a readable suffix
+func doDecorated(name string, demangle func(string) string) (string, bool) {
+	if m := coldRE.FindStringSubmatch(name); m != nil {
+		return demangle(m[1]) + " [cold path]", true
+	}
+	if m := blockRE.FindStringSubmatch(name); m != nil {
+		inner := m[1]
+		if strings.HasPrefix(inner, "Z") { // C++ (the block's enclosing function keeps its _Z)
+			inner = demangle("__" + inner)
+		} else { // Objective-C methods are prefixed with their length
+			inner = strings.TrimLeft(inner, "0123456789")
+		}
+		num := m[2]
+		if len(num) == 0 {
+			num = "1"
+		}
+		return fmt.Sprintf("%s [block #%s]", inner, num), true
+	}
+	if m := outlinedRE.FindStringSubmatch(name); m != nil {
+		return m[1] + " [outlined]", true
+	}
+	return "", false
+}
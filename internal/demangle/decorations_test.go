@@ -0,0 +1,32 @@
+package demangle
+
+import "testing"
+
+func TestDoDecorated(t *testing.T) {
+	for _, tt := range []struct {
+		sym  string
+		want string
+	}{
+		{"___56-[NSURLSession dataTaskWithRequest:completionHandler:]_block_invoke", "-[NSURLSession dataTaskWithRequest:completionHandler:] [block #1]"},
+		{"___56-[NSURLSession dataTaskWithRequest:completionHandler:]_block_invoke_2", "-[NSURLSession dataTaskWithRequest:completionHandler:] [block #2]"},
+		{"___39+[NSBundle(NSBundleAdditions) allBundles]_block_invoke_3", "+[NSBundle(NSBundleAdditions) allBundles] [block #3]"},
+		{"___ZN7WebCore13IDBConnectionD2Ev_block_invoke", "WebCore::IDBConnection::~IDBConnection() [block #1]"},
+		{"___dispatch_once_f_block_invoke_2", "dispatch_once_f [block #2]"},
+		{"_OUTLINED_FUNCTION_12", "OUTLINED_FUNCTION_12 [outlined]"},
+		{"OUTLINED_FUNCTION_0", "OUTLINED_FUNCTION_0 [outlined]"},
+		{"__ZN3xpc6bundle7resolveEv.cold.1", "xpc::bundle::resolve() [cold path]"},
+		{"_os_unfair_lock_lock.cold.2", "_os_unfair_lock_lock [cold path]"},
+		{"___56-[NSURLSession dataTaskWithRequest:completionHandler:]_block_invoke_2.cold.1", "-[NSURLSession dataTaskWithRequest:completionHandler:] [block #2] [cold path]"},
+		// undecorated symbols are unchanged
+		{"__ZN9IOService15registerServiceEj", "IOService::registerService(unsigned int)"},
+		{"_memcpy", "_memcpy"},
+		{"__block_literal_global", "__block_literal_global"},
+	} {
+		if got := Do(tt.sym, false, false); got != tt.want {
+			t.Errorf("Do(%q) = %q, want %q", tt.sym, got, tt.want)
+		}
+		if got := CachedDo(tt.sym, false, false); got != tt.want {
+			t.Errorf("CachedDo(%q) = %q, want %q", tt.sym, got, tt.want)
+		}
+	}
+}
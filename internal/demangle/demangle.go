@@ -45,6 +45,10 @@ const (
 
 // Do demangle a string just as the GNU c++filt program does.
 func Do(name string, verbose, llvmStyle bool) string {
+	return do(name, verbose, llvmStyle, Filter)
+}
+
+func do(name string, verbose, llvmStyle bool, filter func(string, ...Option) string) string {
 	var deStr string
 	var options []Option
 
@@ -60,6 +64,12 @@ func Do(name string, verbose, llvmStyle bool) string {
 		return name
 	}
 
+	if deStr, ok := doDecorated(name, func(inner string) string {
+		return do(inner, verbose, llvmStyle, filter)
+	}); ok {
+		return deStr
+	}
+
 	skip := 0
 	if name[0] == '.' || name[0] == '$' {
 		skip++
@@ -67,7 +77,7 @@ func Do(name string, verbose, llvmStyle bool) string {
 	if name[skip] == '_' {
 		skip++
 	}
-	result := Filter(name[skip:], options...)
+	result := filter(name[skip:], options...)
 	if result == name[skip:] {
 		deStr += name
 	} else {
@@ -787,7 +787,7 @@ func (as *AppStore) Download(bundleID, output string) error {
 func (as *AppStore) download(url string) (string, error) {
 
 	// proxy, insecure are null because we override the client below
-	downloader := NewDownload(
+	downloader, err := NewDownload(
 		as.config.Proxy,
 		as.config.Insecure,
 		as.config.SkipAll,
@@ -795,7 +795,11 @@ func (as *AppStore) download(url string) (string, error) {
 		as.config.RestartAll,
 		false,
 		as.config.Verbose,
+		0,
 	)
+	if err != nil {
+		return "", err
+	}
 	// use authenticated client
 	downloader.client = as.Client
 
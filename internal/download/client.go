@@ -0,0 +1,229 @@
+package download
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/apex/log"
+	"golang.org/x/time/rate"
+)
+
+// RetryPolicy controls how an HTTPClient retries failed requests
+type RetryPolicy struct {
+	MaxRetries int           // number of retries after the first attempt
+	Backoff    time.Duration // delay before the first retry (doubled after every attempt)
+	MaxBackoff time.Duration // upper bound on the delay (0 means no limit)
+	// ShouldRetry decides if a request should be retried (defaults to network errors, 429 and 5xx)
+	ShouldRetry func(*http.Response, error) bool
+}
+
+// HTTPClientOptions are the options for NewHTTPClient (the zero value matches a plain http.Client)
+type HTTPClientOptions struct {
+	Proxy         string
+	Insecure      bool
+	CABundle      string        // path to a PEM file of extra root CAs
+	Timeout       time.Duration // total request timeout (0 means no timeout)
+	HeaderTimeout time.Duration // response header timeout, so slow bodies aren't cut off (0 means no timeout)
+	RetryPolicy   *RetryPolicy  // nil disables retries
+	RateLimit     float64       // max requests per second (0 means unlimited)
+	Limiter       *rate.Limiter // shared rate limiter (takes precedence over RateLimit, so clients can share a budget)
+	UserAgent     string        // User-Agent for requests that don't set their own
+	MinTLS        uint16        // minimum TLS version (i.e. tls.VersionTLS12; 0 means Go's default)
+}
+
+// NewHTTPClient returns an *http.Client whose transport layers the requested retry,
+// rate-limit and User-Agent behavior on top of a proxy aware transport
+func NewHTTPClient(opts HTTPClientOptions) (*http.Client, error) {
+	tr, err := NewTransport(opts.Proxy, opts.Insecure)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(opts.CABundle) > 0 {
+		pool, err := loadCABundle(opts.CABundle)
+		if err != nil {
+			return nil, err
+		}
+		tr.TLSClientConfig.RootCAs = pool
+	}
+	if opts.MinTLS > 0 {
+		tr.TLSClientConfig.MinVersion = opts.MinTLS
+	}
+	tr.ResponseHeaderTimeout = opts.HeaderTimeout
+
+	var rt http.RoundTripper = tr
+	if len(opts.UserAgent) > 0 {
+		rt = &userAgentTransport{next: rt, userAgent: opts.UserAgent}
+	}
+	if opts.Limiter != nil {
+		rt = &rateLimitTransport{next: rt, limiter: opts.Limiter}
+	} else if opts.RateLimit > 0 {
+		rt = &rateLimitTransport{next: rt, limiter: rate.NewLimiter(rate.Limit(opts.RateLimit), 1)}
+	}
+	if opts.RetryPolicy != nil && opts.RetryPolicy.MaxRetries > 0 {
+		rt = &retryTransport{next: rt, policy: *opts.RetryPolicy}
+	}
+
+	return &http.Client{
+		Transport: rt,
+		Timeout:   opts.Timeout,
+	}, nil
+}
+
+// TLSVersions are the versions accepted by ParseTLSVersion
+var TLSVersions = []string{"1.0", "1.1", "1.2", "1.3"}
+
+// ParseTLSVersion parses a TLS version (i.e. 1.2) into its crypto/tls constant ("" is 0, Go's default)
+func ParseTLSVersion(v string) (uint16, error) {
+	switch strings.TrimPrefix(strings.ToLower(v), "tls") {
+	case "":
+		return 0, nil
+	case "1.0", "10":
+		return tls.VersionTLS10, nil
+	case "1.1", "11":
+		return tls.VersionTLS11, nil
+	case "1.2", "12":
+		return tls.VersionTLS12, nil
+	case "1.3", "13":
+		return tls.VersionTLS13, nil
+	default:
+		return 0, fmt.Errorf("invalid TLS version '%s' (expected one of: %s)", v, strings.Join(TLSVersions, ", "))
+	}
+}
+
+func loadCABundle(path string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA bundle: %w", err)
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in CA bundle %s", path)
+	}
+	return pool, nil
+}
+
+type userAgentTransport struct {
+	next      http.RoundTripper
+	userAgent string
+}
+
+func (t *userAgentTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if len(req.Header.Get("User-Agent")) > 0 {
+		return t.next.RoundTrip(req)
+	}
+	req = req.Clone(req.Context())
+	req.Header.Set("User-Agent", t.userAgent)
+	return t.next.RoundTrip(req)
+}
+
+type rateLimitTransport struct {
+	next    http.RoundTripper
+	limiter *rate.Limiter
+}
+
+func (t *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.limiter.Wait(req.Context()); err != nil {
+		return nil, err
+	}
+	return t.next.RoundTrip(req)
+}
+
+type retryCounterKey struct{}
+
+// withRetryCounter returns a ctx whose requests add the times they are retried (by a retryTransport) to n
+func withRetryCounter(ctx context.Context, n *atomic.Int64) context.Context {
+	return context.WithValue(ctx, retryCounterKey{}, n)
+}
+
+type retryTransport struct {
+	next   http.RoundTripper
+	policy RetryPolicy
+}
+
+func defaultShouldRetry(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	shouldRetry := t.policy.ShouldRetry
+	if shouldRetry == nil {
+		shouldRetry = defaultShouldRetry
+	}
+
+	backoff := t.policy.Backoff
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 && req.Body != nil {
+			if req.GetBody == nil {
+				return nil, errors.New("cannot retry request with a non-rewindable body")
+			}
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+
+		resp, err := t.next.RoundTrip(req)
+		if attempt >= t.policy.MaxRetries || !shouldRetry(resp, err) {
+			return resp, err
+		}
+
+		wait := backoff
+		if resp != nil {
+			if ra := retryAfter(resp); ra > 0 {
+				wait = ra
+			}
+			resp.Body.Close()
+		}
+		if t.policy.MaxBackoff > 0 && wait > t.policy.MaxBackoff {
+			wait = t.policy.MaxBackoff
+		}
+		log.WithFields(log.Fields{
+			"url":     req.URL.String(),
+			"attempt": attempt + 1,
+			"wait":    wait,
+		}).Debug("retrying request")
+		if n, ok := req.Context().Value(retryCounterKey{}).(*atomic.Int64); ok {
+			n.Add(1)
+		}
+
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(wait):
+		}
+		backoff *= 2
+	}
+}
+
+// retryAfter returns the delay requested by a Retry-After header (in seconds or as an HTTP date)
+func retryAfter(resp *http.Response) time.Duration {
+	ra := resp.Header.Get("Retry-After")
+	if len(ra) == 0 {
+		return 0
+	}
+	if secs, err := strconv.Atoi(ra); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(ra); err == nil {
+		return time.Until(t)
+	}
+	return 0
+}
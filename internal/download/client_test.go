@@ -0,0 +1,278 @@
+package download
+
+import (
+	"crypto/tls"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestNewHTTPClientDefaults(t *testing.T) {
+	var ua string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ua = r.Header.Get("User-Agent")
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer ts.Close()
+
+	client, err := NewHTTPClient(HTTPClientOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if client.Timeout != 0 {
+		t.Errorf("Timeout = %v, want 0", client.Timeout)
+	}
+	resp, err := client.Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusInternalServerError {
+		t.Errorf("StatusCode = %d, want %d (no retries by default)", resp.StatusCode, http.StatusInternalServerError)
+	}
+	if ua != "Go-http-client/1.1" {
+		t.Errorf("User-Agent = %q, want the Go default", ua)
+	}
+}
+
+func TestNewHTTPClientUserAgent(t *testing.T) {
+	var ua []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ua = append(ua, r.Header.Get("User-Agent"))
+	}))
+	defer ts.Close()
+
+	client, err := NewHTTPClient(HTTPClientOptions{UserAgent: "ipsw-test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Get(ts.URL); err != nil {
+		t.Fatal(err)
+	}
+	req, _ := http.NewRequest("GET", ts.URL, nil)
+	req.Header.Set("User-Agent", "custom")
+	if _, err := client.Do(req); err != nil {
+		t.Fatal(err)
+	}
+	if len(ua) != 2 || ua[0] != "ipsw-test" || ua[1] != "custom" {
+		t.Errorf("User-Agents = %v, want [ipsw-test custom]", ua)
+	}
+}
+
+func TestNewHTTPClientRetry(t *testing.T) {
+	var hits atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if hits.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	client, err := NewHTTPClient(HTTPClientOptions{
+		RetryPolicy: &RetryPolicy{MaxRetries: 3, Backoff: time.Millisecond},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || hits.Load() != 3 {
+		t.Errorf("got status %d after %d attempts, want 200 after 3", resp.StatusCode, hits.Load())
+	}
+
+	hits.Store(-10)
+	resp, err = client.Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable || hits.Load() != -6 {
+		t.Errorf("got status %d after %d attempts, want 503 after 4", resp.StatusCode, hits.Load()+10)
+	}
+}
+
+func TestNewHTTPClientRateLimit(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	client, err := NewHTTPClient(HTTPClientOptions{RateLimit: 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		resp, err := client.Get(ts.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	// burst of 1 then 4 more at 50ms intervals
+	if elapsed := time.Since(start); elapsed < 190*time.Millisecond {
+		t.Errorf("5 requests at 20/s took %v, want >= 200ms", elapsed)
+	}
+}
+
+func TestNewHTTPClientTimeout(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer ts.Close()
+
+	client, err := NewHTTPClient(HTTPClientOptions{Timeout: 20 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Get(ts.URL); err == nil {
+		t.Fatal("expected timeout error")
+	}
+}
+
+func TestNewHTTPClientHeaderTimeout(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow-headers" {
+			time.Sleep(200 * time.Millisecond)
+			return
+		}
+		// the headers are sent right away and the body takes longer than the timeout
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		time.Sleep(100 * time.Millisecond)
+		w.Write([]byte("body"))
+	}))
+	defer ts.Close()
+
+	client, err := NewHTTPClient(HTTPClientOptions{HeaderTimeout: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Get(ts.URL + "/slow-headers"); err == nil {
+		t.Fatal("expected a header timeout error")
+	}
+	resp, err := client.Get(ts.URL + "/slow-body")
+	if err != nil {
+		t.Fatalf("slow body error = %v, want the header timeout not to bound the body", err)
+	}
+	defer resp.Body.Close()
+	if body, err := io.ReadAll(resp.Body); err != nil || string(body) != "body" {
+		t.Errorf("slow body = %q, %v", body, err)
+	}
+}
+
+func TestNewHTTPClientCABundle(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	client, err := NewHTTPClient(HTTPClientOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Get(ts.URL); err == nil {
+		t.Fatal("expected certificate error without CA bundle")
+	}
+
+	bundle := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(bundle, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw}), 0644); err != nil {
+		t.Fatal(err)
+	}
+	client, err = NewHTTPClient(HTTPClientOptions{CABundle: bundle})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.Get(ts.URL)
+	if err != nil {
+		t.Fatalf("GET with CA bundle failed: %v", err)
+	}
+	resp.Body.Close()
+
+	if _, err := NewHTTPClient(HTTPClientOptions{CABundle: filepath.Join(t.TempDir(), "missing.pem")}); err == nil {
+		t.Error("expected error for missing CA bundle")
+	}
+}
+
+func TestNewHTTPClientMinTLS(t *testing.T) {
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	ts.TLS = &tls.Config{MaxVersion: tls.VersionTLS12}
+	ts.StartTLS()
+	defer ts.Close()
+
+	get := func(conf *DownloadConfig) error {
+		client, err := conf.NewClient()
+		if err != nil {
+			t.Fatal(err)
+		}
+		client.Transport.(*http.Transport).TLSClientConfig.InsecureSkipVerify = true
+		resp, err := client.Get(ts.URL)
+		if err != nil {
+			return err
+		}
+		return resp.Body.Close()
+	}
+
+	if err := get(&DownloadConfig{MinTLS: tls.VersionTLS12}); err != nil {
+		t.Fatalf("GET with MinTLS 1.2 failed: %v", err)
+	}
+	if err := get(&DownloadConfig{MinTLS: tls.VersionTLS13}); err == nil {
+		t.Fatal("expected handshake error with MinTLS 1.3 against a TLS 1.2 server")
+	}
+
+	// a WikiConfig.MinTLS raises the DownloadConfig's without changing it
+	dl := &DownloadConfig{MinTLS: tls.VersionTLS12}
+	if err := get(dl.withMinTLS(tls.VersionTLS13)); err == nil {
+		t.Error("expected handshake error with the WikiConfig's MinTLS 1.3")
+	}
+	if dl.MinTLS != tls.VersionTLS12 {
+		t.Errorf("withMinTLS changed the config's MinTLS to %x", dl.MinTLS)
+	}
+	if got := (&DownloadConfig{MinTLS: tls.VersionTLS13}).withMinTLS(tls.VersionTLS12).MinTLS; got != tls.VersionTLS13 {
+		t.Errorf("withMinTLS lowered MinTLS to %x", got)
+	}
+	if got := (*DownloadConfig)(nil).withMinTLS(tls.VersionTLS13); got == nil || got.MinTLS != tls.VersionTLS13 {
+		t.Errorf("nil.withMinTLS() = %+v, want MinTLS 1.3", got)
+	}
+}
+
+func TestParseTLSVersion(t *testing.T) {
+	for in, want := range map[string]uint16{"": 0, "1.2": tls.VersionTLS12, "TLS1.3": tls.VersionTLS13, "tls12": tls.VersionTLS12, "1.0": tls.VersionTLS10} {
+		if got, err := ParseTLSVersion(in); err != nil || got != want {
+			t.Errorf("ParseTLSVersion(%q) = %x, %v; want %x", in, got, err, want)
+		}
+	}
+	if _, err := ParseTLSVersion("1.4"); err == nil {
+		t.Error("ParseTLSVersion(1.4) expected error")
+	}
+}
+
+func TestDownloadConfigSharedRateLimit(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	// every client of a config draws from the same budget
+	conf := &DownloadConfig{RateLimit: 20}
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		client, err := conf.withMinTLS(tls.VersionTLS12).NewClient()
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := client.Get(ts.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	if elapsed := time.Since(start); elapsed < 190*time.Millisecond {
+		t.Errorf("5 requests from 5 clients at 20/s took %v, want >= 200ms", elapsed)
+	}
+}
@@ -0,0 +1,105 @@
+package download
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+const (
+	// DefaultCacheTTL is how long cached metadata (i.e. the wiki versions for completion) is fresh
+	DefaultCacheTTL = 15 * time.Minute
+
+	downloadRetryBackoff    = time.Second
+	downloadRetryMaxBackoff = 30 * time.Second
+)
+
+// DownloadConfig is the network configuration shared by the download functions; the CLI resolves
+// it once from the config file, the environment and the flags (in increasing precedence)
+type DownloadConfig struct {
+	Proxy     string
+	CABundle  string // path to a PEM file of extra root CAs
+	Insecure  bool
+	CacheDir  string        // folder for cached metadata ("" disables caching)
+	CacheTTL  time.Duration // how long cached metadata is fresh (0 means DefaultCacheTTL)
+	RateLimit float64       // max requests per second (0 means unlimited)
+	Retries   int           // retries for network errors, 429s and 5xxs (with exponential backoff)
+	MinTLS    uint16        // minimum TLS version (i.e. tls.VersionTLS12; 0 means Go's default)
+	Timeout   time.Duration // per request, so a long crawl isn't bounded in total (0 means no timeout)
+
+	limiter *rate.Limiter // shared by every client of the config (so RateLimit is a total)
+}
+
+// limiterMu guards the lazy creation of the DownloadConfig limiters
+var limiterMu sync.Mutex
+
+// rateLimiter returns the config's shared limiter (nil if RateLimit is unlimited)
+func (c *DownloadConfig) rateLimiter() *rate.Limiter {
+	if c == nil || c.RateLimit <= 0 {
+		return nil
+	}
+	limiterMu.Lock()
+	defer limiterMu.Unlock()
+	if c.limiter == nil {
+		c.limiter = rate.NewLimiter(rate.Limit(c.RateLimit), 1)
+	}
+	return c.limiter
+}
+
+// legacyDownloadConfig is the config for the functions that still take proxy/insecure positionally
+func legacyDownloadConfig(proxy string, insecure bool) *DownloadConfig {
+	return &DownloadConfig{Proxy: proxy, Insecure: insecure}
+}
+
+// withMinTLS returns the config with its MinTLS raised to at least v (as a copy, so c is left as is)
+func (c *DownloadConfig) withMinTLS(v uint16) *DownloadConfig {
+	if v == 0 || (c != nil && c.MinTLS >= v) {
+		return c
+	}
+	var conf DownloadConfig
+	if c != nil {
+		c.rateLimiter() // created before the copy so both share it
+		conf = *c
+	}
+	conf.MinTLS = v
+	return &conf
+}
+
+// ClientOptions returns the HTTPClientOptions for the config (a nil config is the zero config)
+func (c *DownloadConfig) ClientOptions() HTTPClientOptions {
+	if c == nil {
+		return HTTPClientOptions{}
+	}
+	opts := HTTPClientOptions{
+		Proxy:     c.Proxy,
+		Insecure:  c.Insecure,
+		CABundle:  c.CABundle,
+		RateLimit: c.RateLimit,
+		Limiter:   c.rateLimiter(),
+		MinTLS:    c.MinTLS,
+		Timeout:   c.Timeout,
+	}
+	if c.Retries > 0 {
+		opts.RetryPolicy = &RetryPolicy{
+			MaxRetries: c.Retries,
+			Backoff:    downloadRetryBackoff,
+			MaxBackoff: downloadRetryMaxBackoff,
+		}
+	}
+	return opts
+}
+
+// NewClient returns an *http.Client for the config
+func (c *DownloadConfig) NewClient() (*http.Client, error) {
+	return NewHTTPClient(c.ClientOptions())
+}
+
+// CacheFreshness returns how long cached metadata is fresh
+func (c *DownloadConfig) CacheFreshness() time.Duration {
+	if c == nil || c.CacheTTL <= 0 {
+		return DefaultCacheTTL
+	}
+	return c.CacheTTL
+}
@@ -1182,7 +1182,7 @@ func (dp *DevPortal) DownloadPrompt(downloadType, folder string) error {
 func (dp *DevPortal) Download(url, folder string) error {
 
 	// proxy, insecure are null because we override the client below
-	downloader := NewDownload(
+	downloader, err := NewDownload(
 		dp.config.Proxy,
 		dp.config.Insecure,
 		dp.config.SkipAll,
@@ -1190,7 +1190,11 @@ func (dp *DevPortal) Download(url, folder string) error {
 		dp.config.RestartAll,
 		false,
 		dp.config.Verbose,
+		0,
 	)
+	if err != nil {
+		return err
+	}
 	// use authenticated client
 	downloader.client = dp.Client
 
@@ -1244,7 +1248,7 @@ func (dp *DevPortal) DownloadADC(adcURL string) error {
 	}
 
 	// proxy, insecure are null because we override the client below
-	downloader := NewDownload(
+	downloader, err := NewDownload(
 		dp.config.Proxy,
 		dp.config.Insecure,
 		dp.config.SkipAll,
@@ -1252,7 +1256,11 @@ func (dp *DevPortal) DownloadADC(adcURL string) error {
 		dp.config.RestartAll,
 		false,
 		dp.config.Verbose,
+		0,
 	)
+	if err != nil {
+		return err
+	}
 	downloader.Headers = make(map[string]string)
 	// use authenticated client
 	downloader.client = dp.Client
@@ -1,16 +1,12 @@
 package download
 
 import (
-	"bytes"
-	"crypto/sha1"
-	"crypto/tls"
-	"encoding/hex"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptrace"
-	"net/url"
 	"os"
 	"strings"
 	"syscall"
@@ -21,9 +17,6 @@ import (
 	"github.com/apex/log"
 	"github.com/blacktop/ipsw/internal/utils"
 	"github.com/pkg/errors"
-	"github.com/vbauerster/mpb/v7"
-	"github.com/vbauerster/mpb/v7/decor"
-	"golang.org/x/net/http/httpproxy"
 )
 
 // Download is a downloader object
@@ -32,6 +25,8 @@ type Download struct {
 	Sha1     string
 	DestName string
 	Headers  map[string]string
+	// Progress reports the download progress (defaults to a terminal progress bar)
+	Progress utils.ProgressReporter
 
 	size         int64
 	bytesResumed int64
@@ -63,8 +58,23 @@ type geoQuery struct {
 	As          string `json:"as,omitempty"`
 }
 
-// NewDownload creates a new downloader
-func NewDownload(proxy string, insecure, skipAll, resumeAll, restartAll, ignoreSha1, verbose bool) *Download {
+// StatusError is returned by Download.Do when the server responds with an unexpected HTTP status
+type StatusError struct {
+	StatusCode int
+	Status     string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("server return status: %s", e.Status)
+}
+
+// NewDownload creates a new downloader; timeout bounds the wait for the server to respond to each request
+// but not the transfer itself (which can take hours for an IPSW), 0 means no timeout
+func NewDownload(proxy string, insecure, skipAll, resumeAll, restartAll, ignoreSha1, verbose bool, timeout time.Duration) (*Download, error) {
+	client, err := NewHTTPClient(HTTPClientOptions{Proxy: proxy, Insecure: insecure, HeaderTimeout: timeout})
+	if err != nil {
+		return nil, err
+	}
 	return &Download{
 		// URL:     url,
 		// Sha1:    sha1,
@@ -74,44 +84,13 @@ func NewDownload(proxy string, insecure, skipAll, resumeAll, restartAll, ignoreS
 		restartAll: restartAll,
 		ignoreSha1: ignoreSha1,
 		verbose:    verbose,
-		client: &http.Client{
-			Transport: &http.Transport{
-				Proxy:           GetProxy(proxy),
-				TLSClientConfig: &tls.Config{InsecureSkipVerify: insecure},
-				// MaxConnsPerHost:   50,
-				ForceAttemptHTTP2: true,
-			},
-		},
-	}
-}
-
-// GetProxy takes either an input string or read the enviornment and returns a proxy function
-func GetProxy(proxy string) func(*http.Request) (*url.URL, error) {
-	if len(proxy) > 0 {
-		proxyURL, err := url.Parse(proxy)
-		if err != nil {
-			log.WithError(err).Error("bad proxy url")
-		}
-		log.Debugf("proxy set to: %s", proxyURL)
-
-		return http.ProxyURL(proxyURL)
-	}
-
-	conf := httpproxy.FromEnvironment()
-	if len(conf.HTTPProxy) > 0 || len(conf.HTTPSProxy) > 0 {
-		log.WithFields(log.Fields{
-			"http_proxy":  conf.HTTPProxy,
-			"https_proxy": conf.HTTPSProxy,
-			"no_proxy":    conf.NoProxy,
-		}).Debugf("proxy info from environment")
-	}
-
-	return http.ProxyFromEnvironment
+		client:     client,
+	}, nil
 }
 
-func (d *Download) getHEAD() error {
+func (d *Download) getHEAD(ctx context.Context) error {
 
-	req, err := http.NewRequest("HEAD", d.URL, nil)
+	req, err := http.NewRequestWithContext(ctx, "HEAD", d.URL, nil)
 	if err != nil {
 		return errors.Wrap(err, "cannot create http request")
 	}
@@ -140,10 +119,15 @@ func (d *Download) getHEAD() error {
 // write as it downloads and not load the whole file into memory. We pass an io.TeeReader
 // into Copy() to report progress on the download.
 func (d *Download) Do() error {
+	return d.DoContext(context.Background())
+}
 
-	d.getHEAD()
+// DoContext is Do with a context that cancels the download
+func (d *Download) DoContext(ctx context.Context) error {
 
-	req, err := http.NewRequest("GET", d.URL, nil)
+	d.getHEAD(ctx)
+
+	req, err := http.NewRequestWithContext(ctx, "GET", d.URL, nil)
 	if err != nil {
 		return fmt.Errorf("failed to create http GET request: %v", err)
 	}
@@ -231,14 +215,14 @@ func (d *Download) Do() error {
 		if errors.Is(err, syscall.ECONNRESET) {
 			utils.Indent(log.Error, 2)(fmt.Sprintf("CONNECTION RESET: %v", err))
 			utils.Indent(log.Warn, 3)("trying again...")
-			return d.Do()
+			return d.DoContext(ctx)
 		}
 		return fmt.Errorf("failed to download file: %v", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
-		return fmt.Errorf("server return status: %s", resp.Status)
+		return &StatusError{StatusCode: resp.StatusCode, Status: resp.Status}
 	}
 
 	// Apple likes to return 200 OK even when the file is not found/or is not available
@@ -288,61 +272,34 @@ func (d *Download) Do() error {
 		}
 	}
 
-	var p *mpb.Progress
-	var reader io.ReadCloser
+	var progress utils.ProgressReporter = utils.NopProgress{}
+	var reader io.Reader = resp.Body
 
 	if d.size > 0 {
-		p = mpb.New(
-			mpb.WithWidth(60),
-			mpb.WithRefreshRate(180*time.Millisecond),
-		)
-
-		var bar *mpb.Bar
-
-		bar = p.Add(d.size,
-			mpb.NewBarFiller(mpb.BarStyle().Lbound("[").Filler("=").Tip(">").Padding("-").Rbound("|")),
-			mpb.PrependDecorators(
-				decor.CountersKibiByte("\t% .2f / % .2f"),
-			),
-			mpb.AppendDecorators(
-				decor.OnComplete(decor.AverageETA(decor.ET_STYLE_GO), "✅ "),
-				decor.Name(" ] "),
-				decor.AverageSpeed(decor.UnitKiB, "% .2f"),
-			),
-		)
-
-		if d.resume {
-			bar = p.Add(d.size,
-				mpb.NewBarFiller(mpb.BarStyle().Lbound("[").Filler("=").Tip(">").Padding("-").Rbound("|")),
-				mpb.PrependDecorators(
-					decor.CountersKibiByte("\t% .2f / % .2f"),
-				),
-				mpb.AppendDecorators(
-					decor.OnComplete(decor.EwmaETA(decor.ET_STYLE_GO, float64(d.size)/2048), "✅ "),
-					decor.Name(" ] "),
-					decor.EwmaSpeed(decor.UnitKiB, "% .2f", (float64(d.size)/2048)),
-				),
-			)
-			// bar.SetCurrent(d.bytesResumed)
-			bar.SetRefill(d.bytesResumed)
-			bar.IncrInt64(d.bytesResumed)
+		if d.Progress != nil {
+			progress = d.Progress
+			progress.Start(d.size)
+			if d.resume {
+				progress.Add(d.bytesResumed)
+			}
+		} else {
+			var resumed int64
+			if d.resume {
+				resumed = d.bytesResumed
+			}
+			progress = utils.NewTerminalProgress(os.Stdout, resumed)
+			progress.Start(d.size)
 		}
-
 		// create proxy reader
-		reader = bar.ProxyReader(resp.Body)
-	} else {
-		reader = resp.Body
+		reader = utils.ProgressReader(resp.Body, progress)
 	}
-	defer reader.Close()
 
 	if d.resume {
 		if _, err := io.Copy(dest, reader); err != nil {
 			return fmt.Errorf("failed to copy body reader data: %v", err)
 		}
 
-		if d.size > 0 {
-			p.Wait()
-		}
+		progress.Finish()
 
 		// close file
 		dest.Sync()
@@ -362,33 +319,40 @@ func (d *Download) Do() error {
 	} else {
 		tee := io.TeeReader(reader, dest)
 
-		h := sha1.New()
-		if _, err := io.Copy(h, tee); err != nil {
-			return err
-		}
+		if len(d.Sha1) > 0 && !d.ignoreSha1 {
+			results, err := utils.VerifyChecksums(tee, map[string]string{"sha1": d.Sha1})
+			if err != nil {
+				return err
+			}
 
-		if d.size > 0 {
-			p.Wait()
-		}
+			progress.Finish()
 
-		// close file
-		dest.Sync()
-		dest.Close()
+			// close file
+			dest.Sync()
+			dest.Close()
 
-		if len(d.Sha1) > 0 && !d.ignoreSha1 {
 			utils.Indent(log.Info, 2)("verifying sha1sum...")
-			checksum, _ := hex.DecodeString(d.Sha1)
-
-			if !bytes.Equal(h.Sum(nil), checksum) {
+			if !results.OK() {
 				utils.Indent(log.WithFields(log.Fields{
-					"expected": d.Sha1,
-					"actual":   fmt.Sprintf("%x", h.Sum(nil)),
+					"expected": results["sha1"].Expected,
+					"actual":   results["sha1"].Actual,
 				}).Error, 3)("❌ BAD CHECKSUM")
 				// fileLock.Unlock()
-				if err := os.Remove(d.DestName); err != nil {
+				if err := os.Remove(d.DestName + ".download"); err != nil {
 					return fmt.Errorf("cannot remove downloaded file with checksum mismatch: %v", err)
 				}
+				return fmt.Errorf("bad download: %s sha1 hash is incorrect", d.DestName)
+			}
+		} else {
+			if _, err := io.Copy(io.Discard, tee); err != nil {
+				return err
 			}
+
+			progress.Finish()
+
+			// close file
+			dest.Sync()
+			dest.Close()
 		}
 	}
 
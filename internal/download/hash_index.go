@@ -0,0 +1,106 @@
+package download
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/apex/log"
+)
+
+// HashIndexEntry is where a verified download was saved
+type HashIndexEntry struct {
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+}
+
+// HashIndex maps the SHA1 of verified downloads to where they were saved, so that firmwares
+// already downloaded to another folder aren't downloaded again
+type HashIndex struct {
+	path    string
+	mu      sync.Mutex
+	entries map[string]HashIndexEntry
+}
+
+// OpenHashIndex loads the JSON index at path; a missing or corrupt index is not an error
+// (it is rebuilt as files are downloaded)
+func OpenHashIndex(path string) *HashIndex {
+	idx := &HashIndex{path: path, entries: make(map[string]HashIndexEntry)}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.WithError(err).Warnf("failed to read download index %s (starting a new one)", path)
+		}
+		return idx
+	}
+	if err := json.Unmarshal(data, &idx.entries); err != nil {
+		log.WithError(err).Warnf("download index %s is corrupt (starting a new one)", path)
+		idx.entries = make(map[string]HashIndexEntry)
+	}
+	return idx
+}
+
+// Lookup returns the indexed path of the file with sha1 if it still exists with the recorded size;
+// stale entries are dropped
+func (idx *HashIndex) Lookup(sha1 string) (string, bool) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	key := strings.ToLower(sha1)
+	e, ok := idx.entries[key]
+	if !ok {
+		return "", false
+	}
+	if fi, err := os.Stat(e.Path); err != nil || !fi.Mode().IsRegular() || fi.Size() != e.Size {
+		delete(idx.entries, key)
+		return "", false
+	}
+	return e.Path, true
+}
+
+// Add records that the file at path has sha1 and saves the index
+func (idx *HashIndex) Add(sha1, path string) error {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.entries[strings.ToLower(sha1)] = HashIndexEntry{Path: path, Size: fi.Size()}
+	return idx.save()
+}
+
+// save writes the index atomically (so an interrupted write can't corrupt it)
+func (idx *HashIndex) save() error {
+	return writeJSONAtomic(idx.path, idx.entries)
+}
+
+// linkOrCopy hardlinks src to dst, falling back to a copy (i.e. across filesystems)
+func linkOrCopy(src, dst string) error {
+	if err := os.Link(src, dst); err == nil {
+		return nil
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	return out.Close()
+}
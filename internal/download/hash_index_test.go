@@ -0,0 +1,102 @@
+package download
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/blacktop/ipsw/internal/utils"
+)
+
+func TestDownloadWikiFirmwareIndex(t *testing.T) {
+	const body = "IPSW"
+	sum := sha1.Sum([]byte(body))
+
+	var fetches atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			fetches.Add(1)
+		}
+		w.Write([]byte(body))
+	}))
+	defer srv.Close()
+
+	indexPath := filepath.Join(t.TempDir(), "wiki_index.json")
+	fw := WikiFirmware{Build: "21A329", URL: srv.URL + "/iPhone15,2_17.0_21A329_Restore.ipsw", Sha1Hash: hex.EncodeToString(sum[:])}
+
+	run := func(dest string, link bool) *WikiDownloadResult {
+		t.Helper()
+		d, err := NewDownload("", false, false, false, false, false, false, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		d.Progress = utils.NopProgress{}
+		res, err := DownloadWikiFirmware(fw, dest, d, &WikiDownloadConfig{Index: OpenHashIndex(indexPath), Link: link})
+		if err != nil {
+			t.Fatalf("DownloadWikiFirmware() error = %v", err)
+		}
+		return res
+	}
+
+	first := filepath.Join(t.TempDir(), "first.ipsw")
+	if res := run(first, false); len(res.Existing) > 0 || fetches.Load() != 1 {
+		t.Fatalf("first run = %+v (%d fetches), want a download", res, fetches.Load())
+	}
+
+	// second run into another folder: nothing is fetched
+	second := filepath.Join(t.TempDir(), "second.ipsw")
+	res := run(second, false)
+	if fetches.Load() != 1 {
+		t.Errorf("second run fetched the firmware again")
+	}
+	if abs, _ := filepath.Abs(first); res.Existing != abs {
+		t.Errorf("second run = %+v, want the existing %s", res, abs)
+	}
+	if _, err := os.Stat(second); !os.IsNotExist(err) {
+		t.Errorf("second run without --link should not create %s", second)
+	}
+
+	// --link puts the existing copy at the destination
+	if res := run(second, true); res.Path != second || fetches.Load() != 1 {
+		t.Errorf("linked run = %+v (%d fetches)", res, fetches.Load())
+	}
+	if got, _ := os.ReadFile(second); string(got) != body {
+		t.Errorf("linked file = %q, want %q", got, body)
+	}
+
+	// stale entries (size changed) are re-downloaded
+	if err := os.WriteFile(first, []byte("truncated"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	os.Remove(second)
+	if res := run(second, false); len(res.Existing) > 0 || fetches.Load() != 2 {
+		t.Errorf("stale run = %+v (%d fetches), want a download", res, fetches.Load())
+	}
+}
+
+func TestOpenHashIndexCorrupt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "wiki_index.json")
+	if err := os.WriteFile(path, []byte("{not json"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	idx := OpenHashIndex(path)
+	if _, ok := idx.Lookup("da39a3ee5e6b4b0d3255bfef95601890afd80709"); ok {
+		t.Error("corrupt index returned an entry")
+	}
+
+	file := filepath.Join(t.TempDir(), "fw.ipsw")
+	if err := os.WriteFile(file, []byte("IPSW"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := idx.Add("DA39A3EE5E6B4B0D3255BFEF95601890AFD80709", file); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	if got, ok := OpenHashIndex(path).Lookup("da39a3ee5e6b4b0d3255bfef95601890afd80709"); !ok || got != file {
+		t.Errorf("rebuilt index Lookup() = %s, %v", got, ok)
+	}
+}
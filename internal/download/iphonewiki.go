@@ -8,17 +8,20 @@ import "C"
 import (
 	"bufio"
 	"container/list"
-	"crypto/tls"
+	"context"
 	"encoding/json"
 	"fmt"
 	"github.com/apex/log"
+	"github.com/blacktop/ipsw/internal/ffi"
 	"github.com/blacktop/ipsw/internal/sm"
 	"github.com/blacktop/ipsw/internal/utils"
 	"github.com/blacktop/ipsw/pkg/info"
+	"github.com/dustin/go-humanize"
 	semver "github.com/hashicorp/go-version"
 	"io"
-	"net/http"
+	"os"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -89,20 +92,144 @@ func (q *Queue) Pop() string {
 }
 
 type WikiFirmware struct {
-	Version             string    `json:"version,omitempty"`
-	VersionExtra        string    `json:"version_extra,omitempty"`
-	PrerequisiteVersion string    `json:"prerequisite_version,omitempty"`
-	Build               string    `json:"build,omitempty"`
-	PrerequisiteBuild   string    `json:"prerequisite_build,omitempty"`
-	Product             string    `json:"product,omitempty"`
-	BoardID             string    `json:"board_id,omitempty"`
-	Devices             []string  `json:"keys,omitempty"`
-	Baseband            string    `json:"baseband,omitempty"`
-	ReleaseDate         time.Time `json:"release_date,omitempty"`
-	URL                 string    `json:"url,omitempty"`
-	Sha1Hash            string    `json:"sha1,omitempty"`
-	FileSize            int       `json:"file_size,omitempty"`
-	Documentation       []string  `json:"doc,omitempty"`
+	Version             string             `json:"version,omitempty"`
+	VersionExtra        string             `json:"version_extra,omitempty"`
+	ReportedVersion     string             `json:"reported_version,omitempty"` // the version the device reports (if the wiki lists one that differs from Version)
+	PrerequisiteVersion string             `json:"prerequisite_version,omitempty"`
+	Build               string             `json:"build,omitempty"`
+	Builds              []string           `json:"builds,omitempty"`        // every build when the row lists one per device (Build is the first)
+	DeviceBuilds        map[string]string  `json:"device_builds,omitempty"` // device -> build when Builds lines up with Devices
+	PrerequisiteBuild   string             `json:"prerequisite_build,omitempty"`
+	Product             string             `json:"product,omitempty"`
+	BoardID             string             `json:"board_id,omitempty"`
+	Devices             []string           `json:"keys,omitempty"`
+	DeviceNames         []string           `json:"device_names,omitempty"` // marketing names of Devices (see ResolveDeviceNames)
+	Baseband            string             `json:"baseband,omitempty"`
+	ReleaseDate         time.Time          `json:"release_date,omitempty"`
+	URL                 string             `json:"url,omitempty"`
+	URLs                []WikiFirmwareURL  `json:"urls,omitempty"`
+	Sha1Hash            string             `json:"sha1,omitempty"`
+	FileSize            int                `json:"file_size,omitempty"`
+	Documentation       []string           `json:"doc,omitempty"`
+	Notes               []string           `json:"notes,omitempty"` // footnotes (<ref>s) on the row (i.e. "Only available in China")
+	Status              WikiFirmwareStatus `json:"status,omitempty"`
+	OS                  string             `json:"os,omitempty"`
+	Expiration          time.Time          `json:"expiration,omitempty"`       // when the beta expires (zero if not listed)
+	MinHostVersion      string             `json:"min_host_version,omitempty"` // minimum iTunes/Finder version needed to restore (older IPSW pages)
+	Signed              *bool              `json:"signed,omitempty"`           // whether Apple still signs the build (nil if not checked)
+}
+
+// WikiFirmwareURL is one of the download URLs listed for a firmware and its variant label (i.e. "China")
+type WikiFirmwareURL struct {
+	URL     string `json:"url"`
+	Variant string `json:"variant,omitempty"`
+}
+
+// WikiFirmwareStatus is whether a firmware is still live or was pulled/re-released by Apple
+type WikiFirmwareStatus string
+
+const (
+	WikiStatusReleased   WikiFirmwareStatus = "released"
+	WikiStatusPulled     WikiFirmwareStatus = "pulled"
+	WikiStatusReReleased WikiFirmwareStatus = "rereleased"
+)
+
+func (s WikiFirmwareStatus) rank() int {
+	switch s {
+	case WikiStatusPulled:
+		return 1
+	case WikiStatusReReleased:
+		return 2
+	default:
+		return 0
+	}
+}
+
+// BuildFor returns the firmware's build for device (rows can list a different build per device)
+func (fw WikiFirmware) BuildFor(device string) string {
+	for dev, build := range fw.DeviceBuilds {
+		if strings.EqualFold(dev, device) {
+			return build
+		}
+	}
+	return fw.Build
+}
+
+// correlateBuilds maps each device to its build when the Build cell lists one per device (in Keys order)
+func (fw *WikiFirmware) correlateBuilds() {
+	if len(fw.Builds) < 2 || len(fw.Builds) != len(fw.Devices) {
+		return
+	}
+	fw.DeviceBuilds = make(map[string]string, len(fw.Devices))
+	for i, dev := range fw.Devices {
+		fw.DeviceBuilds[dev] = fw.Builds[i]
+	}
+}
+
+// Checksums returns the hashes listed on the wiki for the firmware (algorithm -> hex digest)
+func (fw WikiFirmware) Checksums() map[string]string {
+	sums := make(map[string]string)
+	if len(fw.Sha1Hash) > 0 {
+		sums["sha1"] = fw.Sha1Hash
+	}
+	return sums
+}
+
+// Verify checks a downloaded copy of the firmware against the hashes listed on the wiki
+func (fw WikiFirmware) Verify(path string) (utils.ChecksumResults, error) {
+	sums := fw.Checksums()
+	if len(sums) == 0 {
+		return nil, fmt.Errorf("no checksums listed on the wiki for %s", fw.URL)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return utils.VerifyChecksums(f, sums)
+}
+
+// Downloaded returns true if path already holds the firmware: it exists and matches the wiki's
+// hashes (when the wiki doesn't list any, existing is enough)
+func (fw WikiFirmware) Downloaded(path string) (bool, error) {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	if len(fw.Checksums()) == 0 {
+		return true, nil
+	}
+	results, err := fw.Verify(path)
+	if err != nil {
+		return false, err
+	}
+	return results.OK(), nil
+}
+
+// ResolveDeviceNames sets DeviceNames to the marketing names of the firmware's Devices (i.e. "iPhone15,2" ->
+// "iPhone 14 Pro") using the ipsw DB; devices sharing a name are listed once and unknown devices as is
+func (fw *WikiFirmware) ResolveDeviceNames() error {
+	db, err := info.GetIpswDB()
+	if err != nil {
+		return err
+	}
+	fw.DeviceNames = resolveWikiDeviceNames(fw.Devices, db)
+	return nil
+}
+
+func resolveWikiDeviceNames(devices []string, db *info.Devices) []string {
+	var names []string
+	for _, dev := range devices {
+		name, err := db.GetNameForDevice(dev)
+		if err != nil {
+			name = dev
+		}
+		if !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	return names
 }
 
 type wikiSection struct {
@@ -137,6 +264,13 @@ type wikiText struct {
 	Text string `json:"*,omitempty"`
 }
 
+// wikiLangLink is a link to the page's version on a localized wiki
+type wikiLangLink struct {
+	Lang  string `json:"lang,omitempty"`
+	URL   string `json:"url,omitempty"`
+	Title string `json:"*,omitempty"`
+}
+
 type wikiParseData struct {
 	Title         string         `json:"title,omitempty"`
 	DisplayTitle  string         `json:"displaytitle,omitempty"`
@@ -145,7 +279,7 @@ type wikiParseData struct {
 	Redirects     []string       `json:"redirects,omitempty"`
 	Sections      []wikiSection  `json:"sections,omitempty"`
 	Links         []wikiLink     `json:"links,omitempty"`
-	LangLinks     []string       `json:"langlinks,omitempty"`
+	LangLinks     []wikiLangLink `json:"langlinks,omitempty"`
 	Categories    []wikiCategory `json:"categories,omitempty"`
 	Templates     []wikiTemplate `json:"templates,omitempty"`
 	ExternalLinks []string       `json:"externallinks,omitempty"`
@@ -154,147 +288,7 @@ type wikiParseData struct {
 
 type wikiParseResults struct {
 	Parse wikiParseData `json:"parse"`
-}
-
-type wikiFWKeys struct {
-	Version            string
-	Build              string
-	Device             string
-	Codename           string
-	Baseband           string
-	DownloadURL        string
-	RootFS             string
-	RootFSKey          string
-	UpdateRamdisk      string
-	UpdateRamdiskIV    string
-	RestoreRamdisk     string
-	RestoreRamdiskIV   string
-	AppleLogo          string
-	AppleLogoIV        string
-	BatteryCharging0   string
-	BatteryCharging0IV string
-	BatteryCharging1   string
-	BatteryCharging1IV string
-	BatteryFull        string
-	BatteryFullIV      string
-	BatteryLow0        string
-	BatteryLow0IV      string
-	BatteryLow1        string
-	BatteryLow1IV      string
-	DeviceTree         string
-	DeviceTreeIV       string
-	GlyphPlugin        string
-	GlyphPluginIV      string
-	IBEC               string
-	IBECIV             string
-	IBECKey            string
-	IBoot              string
-	IBootIV            string
-	IBootKey           string
-	IBSS               string
-	IBSSIV             string
-	IBSSKey            string
-	Kernelcache        string
-	KernelcacheIV      string
-	LLB                string
-	LLBIV              string
-	LLBKey             string
-	RecoveryMode       string
-	RecoveryModeIV     string
-	SEPFirmware        string
-	SEPFirmwareIV      string
-	SEPFirmwareKey     string
-	SEPFirmwareKBAG    string
-}
-
-func getWikiPage(page string, proxy string, insecure bool) (*wikiParseResults, error) {
-	client := &http.Client{
-		Transport: &http.Transport{
-			Proxy:           GetProxy(proxy),
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: insecure},
-		},
-	}
-
-	req, err := http.NewRequest("GET", iphoneWikiApiURL, nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
-	}
-
-	q := req.URL.Query()
-	q.Add("format", "json")
-	q.Add("action", "parse")
-	q.Add("page", page)
-	q.Add("redirects", "true")
-	req.URL.RawQuery = q.Encode()
-
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get response: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("failed to get response: %s", resp.Status)
-	}
-
-	data, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
-	}
-
-	// parse the response
-	var parseResp wikiParseResults
-	if err := json.Unmarshal(data, &parseResp); err != nil {
-		return nil, fmt.Errorf("failed to parse response: %w", err)
-	}
-
-	return &parseResp, nil
-}
-
-func getWikiTable(page string, proxy string, insecure bool) (*wikiParseResults, error) {
-	client := &http.Client{
-		Transport: &http.Transport{
-			Proxy:           GetProxy(proxy),
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: insecure},
-		},
-	}
-
-	req, err := http.NewRequest("GET", iphoneWikiApiURL, nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
-	}
-
-	q := req.URL.Query()
-	q.Add("action", "parse")
-	q.Add("page", page)
-	q.Add("prop", "wikitext")
-	// q.Add("section", "5")
-	q.Add("redirects", "true")
-	q.Add("format", "json")
-	req.URL.RawQuery = q.Encode()
-
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get response: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("failed to get response: %s", resp.Status)
-	}
-
-	data, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
-	}
-
-	// parse the response
-	var parseResp wikiParseResults
-	if err := json.Unmarshal(data, &parseResp); err != nil {
-		return nil, fmt.Errorf("failed to parse response: %w", err)
-	}
-
-	return &parseResp, nil
+	Error *wikiAPIError `json:"error,omitempty"`
 }
 
 func getRowOrColInc(line string) (rinc int, cinc int, field string, err error) {
@@ -358,10 +352,326 @@ func getVersionParts(input string) (version, extra string, err error) {
 	return
 }
 
+var (
+	wikiStrikeRE     = regexp.MustCompile(`(?i)</?(s|del|strike)>`)
+	wikiStatusNoteRE = regexp.MustCompile(`(?i)\s*\((?:pulled|re-?released)[^)]*\)`)
+	wikiReReleasedRE = regexp.MustCompile(`(?i)\bre-?released\b`)
+	wikiPulledRE     = regexp.MustCompile(`(?i)\bpulled\b`)
+	// wikiBoardRE matches internal board names (i.e. "D83AP" or "J317xAP")
+	wikiBoardRE = regexp.MustCompile(`^[A-Z]{1,3}\d{1,4}[a-z]?AP$`)
+)
+
+// parseWikiStatus strips strikethrough markup and "(pulled)"/"(re-released)" notes from a
+// Version/Build cell and returns the status they annotate
+func parseWikiStatus(cell string) (string, WikiFirmwareStatus) {
+	status := WikiStatusReleased
+	switch {
+	case wikiReReleasedRE.MatchString(cell):
+		status = WikiStatusReReleased
+	case wikiStrikeRE.MatchString(cell), wikiPulledRE.MatchString(cell):
+		status = WikiStatusPulled
+	}
+	cell = wikiStrikeRE.ReplaceAllString(cell, "")
+	cell = wikiStatusNoteRE.ReplaceAllString(cell, "")
+	return strings.TrimSpace(cell), status
+}
+
+var (
+	wikiExpirationRefRE = regexp.MustCompile(`(?is)<ref[^>/]*>([^<]*expir[^<]*)</ref>`)
+	wikiDateTemplateRE  = regexp.MustCompile(`\{\{date\|(\d{4})\|(\d{1,2})\|(\d{1,2})\}\}`)
+	wikiDateLayouts     = []string{"January 2, 2006", "Jan 2, 2006", "2 January 2006", "2 Jan 2006", "2006-01-02", "2006/01/02"}
+	wikiDateTextRE      = regexp.MustCompile(`[A-Z][a-z]+\.? \d{1,2}, \d{4}|\d{1,2} [A-Z][a-z]+ \d{4}|\d{4}[-/]\d{2}[-/]\d{2}`)
+)
+
+// parseWikiDate parses the first date in a cell: either a {{date|2024|01|19}} template or plain text (i.e. "January 19, 2024")
+func parseWikiDate(cell string) (time.Time, bool) {
+	if m := wikiDateTemplateRE.FindStringSubmatch(cell); m != nil {
+		y, _ := strconv.Atoi(m[1])
+		mon, _ := strconv.Atoi(m[2])
+		d, _ := strconv.Atoi(m[3])
+		return time.Date(y, time.Month(mon), d, 0, 0, 0, 0, time.UTC), true
+	}
+	if m := wikiDateTextRE.FindString(cell); len(m) > 0 {
+		m = strings.Replace(m, ".", "", 1)
+		for _, layout := range wikiDateLayouts {
+			if t, err := time.Parse(layout, m); err == nil {
+				return t, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+// parseWikiExpiration strips expiration footnotes (i.e. "<ref>Expires on {{date|2024|01|19}}</ref>")
+// from a Version/Build cell and returns the date they list
+func parseWikiExpiration(cell string) (string, time.Time) {
+	var expires time.Time
+	for _, m := range wikiExpirationRefRE.FindAllStringSubmatch(cell, -1) {
+		if t, ok := parseWikiDate(m[1]); ok && expires.IsZero() {
+			expires = t
+		}
+	}
+	if expires.IsZero() {
+		return cell, expires
+	}
+	return strings.TrimSpace(wikiExpirationRefRE.ReplaceAllString(cell, "")), expires
+}
+
+var (
+	wikiRefRE            = regexp.MustCompile(`(?is)<ref[^>]*/>|<ref[^>/]*>.*?</ref>`)
+	wikiMinHostVersionRE = regexp.MustCompile(`\d+(?:\.\d+)*`)
+)
+
+var (
+	wikiRefNoteRE  = regexp.MustCompile(`(?is)<ref([^>]*?)/>|<ref([^>/]*)>(.*?)</ref>`)
+	wikiRefNameRE  = regexp.MustCompile(`(?i)name\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s"'/>]+))`)
+	wikiRefOpenRE  = regexp.MustCompile(`(?i)<ref[^>/]*>`)
+	wikiRefCloseRE = regexp.MustCompile(`(?i)</ref>`)
+	wikiLinkRE     = regexp.MustCompile(`\[\[(?:[^|\]]*\|)?([^\]]*)\]\]`)
+	wikiExtLinkRE  = regexp.MustCompile(`\[(https?://[^\s\]]+)(?:\s+([^\]]*))?\]`)
+	wikiTagRE      = regexp.MustCompile(`<[^>]+>`)
+	wikiQuotesRE   = regexp.MustCompile(`'{2,}`) // ''italic'' and '''bold'''
+)
+
+// wikiOpenRef returns true if line has a <ref> that is closed on a later line
+func wikiOpenRef(line string) bool {
+	return len(wikiRefOpenRE.FindAllString(line, -1)) > len(wikiRefCloseRE.FindAllString(line, -1))
+}
+
+// splitWikiInlineCells splits a table line holding several cells (the "! a !! b" header and "| a || b" data
+// shorthand) into one line per cell; separators inside links and templates are left alone
+func splitWikiInlineCells(line string) []string {
+	var sep, prefix string
+	switch {
+	case strings.HasPrefix(line, "|-"), strings.HasPrefix(line, "|}"):
+		return []string{line}
+	case strings.HasPrefix(line, "!"):
+		sep, prefix = "!!", "! "
+	case strings.HasPrefix(line, "|"):
+		sep, prefix = "||", "| "
+	default:
+		return []string{line}
+	}
+
+	var cells []string
+	depth, start := 0, 0
+	for i := 1; i < len(line)-1; i++ {
+		switch pair := line[i : i+2]; {
+		case pair == "[[" || pair == "{{":
+			depth++
+			i++
+		case pair == "]]" || pair == "}}":
+			depth = max(depth-1, 0)
+			i++
+		case depth == 0 && (pair == sep || pair == "||"): // header cells may be separated with || too
+			cells = append(cells, line[start:i])
+			start = i + 2
+			i++
+		}
+	}
+	if cells == nil {
+		return []string{line}
+	}
+	cells = append(cells, line[start:])
+
+	for i, cell := range cells {
+		if i == 0 {
+			cells[i] = strings.TrimSpace(cell)
+		} else {
+			cells[i] = prefix + strings.TrimSpace(cell)
+		}
+	}
+	return cells
+}
+
+// parseWikiNotes returns the text of the footnotes in a cell with its wiki markup removed; named footnotes
+// are added to named so later reuses (i.e. <ref name="cn" />) resolve to their text
+func parseWikiNotes(cell string, named map[string]string) []string {
+	var notes []string
+	for _, m := range wikiRefNoteRE.FindAllStringSubmatch(cell, -1) {
+		attrs, note := m[1]+m[2], cleanWikiNote(m[3])
+		var name string
+		if n := wikiRefNameRE.FindStringSubmatch(attrs); n != nil {
+			name = n[1] + n[2] + n[3]
+		}
+		switch {
+		case len(note) > 0:
+			if len(name) > 0 {
+				named[name] = note
+			}
+		case len(name) > 0:
+			note = named[name]
+		}
+		if len(note) > 0 {
+			notes = utils.UniqueAppend(notes, note)
+		}
+	}
+	return notes
+}
+
+// cleanWikiNote turns a footnote's wikitext into plain text (i.e. "[[China]] only" is "China only")
+func cleanWikiNote(note string) string {
+	note = wikiDateTemplateRE.ReplaceAllStringFunc(note, func(m string) string {
+		if t, ok := parseWikiDate(m); ok {
+			return t.Format("2006-01-02")
+		}
+		return m
+	})
+	note = wikiLinkRE.ReplaceAllString(note, "$1")
+	note = wikiExtLinkRE.ReplaceAllStringFunc(note, func(m string) string {
+		sm := wikiExtLinkRE.FindStringSubmatch(m)
+		if len(sm[2]) > 0 {
+			return sm[2]
+		}
+		return sm[1]
+	})
+	note = wikiQuotesRE.ReplaceAllString(wikiTagRE.ReplaceAllString(note, " "), "")
+	return strings.Join(strings.Fields(note), " ")
+}
+
+// parseWikiMinHostVersion returns the version in a minimum iTunes/Finder version cell
+// (i.e. "[[iTunes]] 10.5<ref>...</ref>" is "10.5"); it returns "" for {{n/a}}
+func parseWikiMinHostVersion(cell string) string {
+	return wikiMinHostVersionRE.FindString(wikiRefRE.ReplaceAllString(cell, ""))
+}
+
+// parseWikiReportedVersion returns the version in a Reported/Marketing Version cell
+// (i.e. "16.4.1 (a)<ref>...</ref>" is "16.4.1 (a)"); it returns "" for {{n/a}}
+func parseWikiReportedVersion(cell string) string {
+	cell = strings.TrimSpace(wikiRefRE.ReplaceAllString(cell, ""))
+	if strings.EqualFold(cell, "{{n/a}}") {
+		return ""
+	}
+	return cell
+}
+
+// parseWikiBuilds returns the builds in a Build cell; rows that ship a different build per device list
+// them one per line (i.e. "20A362<br/>20A371", in the order of the Keys column)
+func parseWikiBuilds(cell string) []string {
+	var builds []string
+	for _, part := range wikiBreakRE.Split(wikiRefRE.ReplaceAllString(cell, ""), -1) {
+		part, _, _ = strings.Cut(part, "<") // any other markup
+		if part = strings.TrimSpace(part); len(part) > 0 {
+			builds = append(builds, part)
+		}
+	}
+	return builds
+}
+
+// wikiBlockSize is the size of the "blocks" some old OTA pages list file sizes in
+const wikiBlockSize = 4096
+
+var wikiBlocksRE = regexp.MustCompile(`(?i)^(\d+)\s*blocks?$`)
+
+// parseWikiFileSize returns the bytes in a File Size cell: plain byte counts (i.e. "1,234,567"),
+// "N blocks" (of 4096 bytes) and sizes with units (i.e. "1.2 GB" or "512 bytes"); ok is false if it isn't a size
+func parseWikiFileSize(cell string) (int, bool) {
+	cell = strings.TrimSpace(strings.ReplaceAll(wikiRefRE.ReplaceAllString(cell, ""), ",", ""))
+	if n, err := strconv.Atoi(cell); err == nil {
+		return n, true
+	}
+	if m := wikiBlocksRE.FindStringSubmatch(cell); m != nil {
+		if n, err := strconv.Atoi(m[1]); err == nil {
+			return n * wikiBlockSize, true
+		}
+	}
+	if n, err := humanize.ParseBytes(strings.TrimSuffix(strings.TrimSuffix(cell, "bytes"), "byte")); err == nil {
+		return int(n), true
+	}
+	return 0, false
+}
+
+var (
+	wikiCodeTagRE = regexp.MustCompile(`(?i)</?code>`)
+	wikiSHA1RE    = regexp.MustCompile(`^[0-9a-f]{40}$`)
+)
+
+// parseWikiSHA1 returns the lowercase hex SHA-1 in a cell (i.e. "<code>DA39A3EE 5E6B4B0D ...</code>");
+// it returns "" (with a warning) if the cell isn't a SHA-1 and "" for empty and {{n/a}} cells
+func parseWikiSHA1(cell string) string {
+	cell = wikiRefRE.ReplaceAllString(wikiCodeTagRE.ReplaceAllString(cell, ""), "")
+	sha := strings.ToLower(strings.Join(strings.Fields(cell), ""))
+	if len(sha) == 0 || strings.EqualFold(sha, "{{n/a}}") {
+		return ""
+	}
+	if !wikiSHA1RE.MatchString(sha) {
+		log.Warnf("ignoring invalid wiki SHA-1 %q (not 40 hex characters)", cell)
+		return ""
+	}
+	return sha
+}
+
+var (
+	wikiBreakRE    = regexp.MustCompile(`(?i)<br\s*/?>`)
+	wikiDocLinkRE  = regexp.MustCompile(`\[\[(?i:media|file):([^|\]]+)(?:\|([^\]]*))?\]\]|\[(https?://[^\s\]]+)(?:\s+([^\]]*))?\]|(https?://[^\s<\]|]+\.pdf)`)
+	wikiFilePrefix = strings.TrimSuffix(iphoneWikiApiURL, "api.php") + "wiki/Special:FilePath/"
+)
+
+// parseWikiDocumentation normalizes a Documentation cell into "URL [label]" entries; it handles
+// [url label] links, bare PDF URLs and [[Media:...]]/[[File:...]] links
+func parseWikiDocumentation(cell string) []string {
+	var docs []string
+	for _, part := range wikiBreakRE.Split(cell, -1) {
+		part = strings.TrimSpace(part)
+		if len(part) == 0 || strings.EqualFold(part, "{{n/a}}") {
+			continue
+		}
+		matches := wikiDocLinkRE.FindAllStringSubmatch(part, -1)
+		if len(matches) == 0 {
+			docs = append(docs, part)
+			continue
+		}
+		for _, m := range matches {
+			var url, label string
+			switch {
+			case len(m[1]) > 0: // [[Media:file|label]]
+				url = wikiFilePrefix + strings.ReplaceAll(strings.TrimSpace(m[1]), " ", "_")
+				label = m[2]
+			case len(m[3]) > 0: // [url label]
+				url, label = m[3], m[4]
+			default: // bare URL
+				url = m[5]
+			}
+			if label = strings.TrimSpace(label); len(label) > 0 {
+				docs = append(docs, url+" "+label)
+			} else {
+				docs = append(docs, url)
+			}
+		}
+	}
+	return docs
+}
+
+var (
+	wikiURLRE         = regexp.MustCompile(`\[(https?://[^\s\]]+)(?:\s+([^\]]*))?\]|(https?://[^\s<\]|]+)`)
+	wikiURLFileNameRE = regexp.MustCompile(`(?i)\.(ipsw|zip|dmg|pkg)$`)
+)
+
+// parseWikiURLs parses a Download URL cell (one or more [url label] links) into URLs tagged
+// with their variant label; filename labels are not considered variants
+func parseWikiURLs(cell string) []WikiFirmwareURL {
+	var urls []WikiFirmwareURL
+	for _, part := range wikiBreakRE.Split(cell, -1) {
+		for _, m := range wikiURLRE.FindAllStringSubmatch(part, -1) {
+			u := WikiFirmwareURL{URL: m[1]}
+			if len(u.URL) == 0 {
+				u.URL = m[3]
+			}
+			label := strings.TrimSpace(m[2])
+			if len(label) > 0 && !wikiURLFileNameRE.MatchString(label) && !strings.HasSuffix(u.URL, "/"+label) {
+				u.Variant = label
+			}
+			urls = append(urls, u)
+		}
+	}
+	return urls
+}
+
 // parse wikitable
 func parseWikiTable(text string) ([]WikiFirmware, error) {
 	var deviceID, boardID, productName string
 	var results []WikiFirmware
+	namedNotes := make(map[string]string) // named footnotes (<ref name="...">) of the page
 
 	fieldCount := 0
 	headerCount := 0
@@ -371,7 +681,8 @@ func parseWikiTable(text string) ([]WikiFirmware, error) {
 
 	db, err := info.GetIpswDB()
 	if err != nil {
-		log.Fatalf("failed to get ipsw db: %v", err)
+		log.WithError(err).Warn("device names in wiki tables will not be resolved to product types")
+		db = nil
 	}
 
 	machine := sm.Machine{
@@ -437,24 +748,48 @@ func parseWikiTable(text string) ([]WikiFirmware, error) {
 	}
 
 	parseItem := func(i int) error {
+		for _, note := range parseWikiNotes(header2Values[index2Header[i]].Peek(), namedNotes) {
+			ipsw.Notes = utils.UniqueAppend(ipsw.Notes, note)
+		}
 		switch v := index2Header[i]; v {
-		case "Product Version", "Version":
-			version := header2Values[v].Pop()
-			num, extra, err := getVersionParts(version)
+		case "Product Version", "Version", "Real Version", "Actual Version":
+			version, expires := parseWikiExpiration(header2Values[v].Pop())
+			if !expires.IsZero() {
+				ipsw.Expiration = expires
+			}
+			version, status := parseWikiStatus(version)
+			if status.rank() > ipsw.Status.rank() {
+				ipsw.Status = status
+			}
+			num, extra, err := getVersionParts(strings.TrimSpace(wikiRefRE.ReplaceAllString(version, "")))
 			if err == nil {
 				ipsw.Version = num
 				ipsw.VersionExtra = extra
 			}
+		case "Reported Version", "Marketing Version", "Displayed Version":
+			ipsw.ReportedVersion = parseWikiReportedVersion(header2Values[v].Pop())
 		case "Prerequisite Version":
 			ipsw.PrerequisiteVersion = strings.Replace(header2Values[v].Pop(), "{{n/a}}", "", -1)
 		case "Prerequisite Build":
 			ipsw.PrerequisiteBuild = strings.Replace(header2Values[v].Pop(), "{{n/a}}", "", -1)
 		case "Build":
-			build := header2Values[v].Pop()
-			build, _, _ = strings.Cut(build, "<")
-			ipsw.Build = build
+			build, expires := parseWikiExpiration(header2Values[v].Pop())
+			if !expires.IsZero() {
+				ipsw.Expiration = expires
+			}
+			build, status := parseWikiStatus(build)
+			if status.rank() > ipsw.Status.rank() {
+				ipsw.Status = status
+			}
+			ipsw.Build = ""
+			if builds := parseWikiBuilds(build); len(builds) > 0 {
+				ipsw.Build = builds[0]
+				if len(builds) > 1 {
+					ipsw.Builds = builds
+				}
+			}
 		case "Keys":
-			keys := header2Values[v].Pop()
+			keys := wikiRefRE.ReplaceAllString(header2Values[v].Pop(), "")
 			if keys == "" {
 				if deviceID != "" {
 					ipsw.Devices = append(ipsw.Devices, deviceID)
@@ -470,7 +805,10 @@ func parseWikiTable(text string) ([]WikiFirmware, error) {
 					part = strings.TrimSpace(part)
 					part = strings.Trim(part, "[]")
 					if _, dev, ok := strings.Cut(part, "|"); ok {
-						ipsw.Devices = utils.UniqueAppend(ipsw.Devices, dev)
+						if db != nil {
+							dev = db.CanonicalProductType(dev)
+						}
+						ipsw.Devices = utils.UniqueAppendFunc(ipsw.Devices, dev, strings.ToLower)
 					}
 				}
 			}
@@ -487,38 +825,35 @@ func parseWikiTable(text string) ([]WikiFirmware, error) {
 					ipsw.ReleaseDate = date
 				}
 			}
+		case "Expiration", "Expiration Date", "Expires", "Beta Expiration":
+			if date, ok := parseWikiDate(header2Values[v].Pop()); ok {
+				ipsw.Expiration = date
+			}
+		case "Minimum iTunes Version", "Required iTunes Version", "iTunes Version", "Minimum iTunes", "Minimum Finder Version", "Minimum iTunes/Finder Version":
+			ipsw.MinHostVersion = parseWikiMinHostVersion(header2Values[v].Pop())
 		case "Download URL", "IPSW Download URL", "OTA Download URL":
 			url := header2Values[v].Pop()
-			url = strings.Trim(url, "[]")
-			parts := strings.Split(url, " ")
-			if len(parts) > 1 {
-				url = parts[0]
+			if urls := parseWikiURLs(url); len(urls) > 0 {
+				ipsw.URLs = urls
+				ipsw.URL = urls[0].URL
+			} else {
+				url = strings.Trim(url, "[]")
+				parts := strings.Split(url, " ")
+				if len(parts) > 1 {
+					url = parts[0]
+				}
+				ipsw.URL = url
 			}
-			ipsw.URL = url
-		case "SHA1 Hash":
-			sha := header2Values[v].Pop()
-			sha = strings.TrimPrefix(sha, "<code>")
-			sha = strings.TrimSuffix(sha, "</code>")
-			ipsw.Sha1Hash = sha
+		case "SHA1 Hash", "SHA-1 Hash", "SHA1", "SHA-1":
+			ipsw.Sha1Hash = parseWikiSHA1(header2Values[v].Pop())
 		case "File Size":
-			fstr := header2Values[v].Pop()
-			fs, err := strconv.Atoi(strings.Replace(fstr, ",", "", -1))
-			if err == nil {
+			if fs, ok := parseWikiFileSize(header2Values[v].Pop()); ok {
 				ipsw.FileSize = fs
 			}
 		case "Release Notes":
 			fallthrough
 		case "Documentation":
-			doc := header2Values[v].Pop()
-			if strings.Contains(doc, "<br") {
-				doc = strings.ReplaceAll(doc, "]<br/>[", "\n")
-				doc = strings.ReplaceAll(doc, "]<br />[", "\n")
-				doc = strings.Trim(doc, "[]")
-				parts := strings.Split(doc, "\n")
-				ipsw.Documentation = append(ipsw.Documentation, parts...)
-			} else {
-				ipsw.Documentation = append(ipsw.Documentation, doc)
-			}
+			ipsw.Documentation = append(ipsw.Documentation, parseWikiDocumentation(header2Values[v].Pop())...)
 		default:
 			header2Values[v].Pop() // pop into the ether
 		}
@@ -528,13 +863,21 @@ func parseWikiTable(text string) ([]WikiFirmware, error) {
 		if len(ipsw.BoardID) == 0 && len(boardID) > 0 {
 			ipsw.BoardID = boardID
 		}
+		if len(ipsw.Status) == 0 {
+			ipsw.Status = WikiStatusReleased
+		}
+		if len(ipsw.ReportedVersion) > 0 && ipsw.ReportedVersion == strings.TrimSpace(ipsw.Version+" "+ipsw.VersionExtra) {
+			ipsw.ReportedVersion = "" // the page doesn't distinguish them
+		}
 		if len(ipsw.Devices) == 0 {
 			if len(deviceID) > 0 {
 				ipsw.Devices = append(ipsw.Devices, deviceID)
 			} else {
-				if len(productName) > 0 {
-					if prod, _, err := db.GetDeviceForName(productName); err == nil {
-						ipsw.Devices = utils.UniqueAppend(ipsw.Devices, prod)
+				if len(productName) > 0 && db != nil {
+					if prods, err := db.GetDevicesForName(productName); err == nil {
+						for _, prod := range prods {
+							ipsw.Devices = utils.UniqueAppend(ipsw.Devices, prod)
+						}
 					}
 				}
 			}
@@ -544,11 +887,25 @@ func parseWikiTable(text string) ([]WikiFirmware, error) {
 
 	scanner := bufio.NewScanner(strings.NewReader(text))
 
-	for scanner.Scan() {
-		line := scanner.Text()
+	lineNum := 0
+	var cells []string // the other cells of a line with several (i.e. "| 16.0 || 20A362")
+	for len(cells) > 0 || scanner.Scan() {
+		var line string
+		if len(cells) > 0 {
+			line, cells = cells[0], cells[1:]
+		} else {
+			line = scanner.Text()
+			lineNum++
+			for wikiOpenRef(line) && scanner.Scan() { // a footnote spanning lines
+				line += " " + scanner.Text()
+				lineNum++
+			}
+			cells = splitWikiInlineCells(line)
+			line, cells = cells[0], cells[1:]
+		}
 		if strings.HasPrefix(line, "===") { /* subtitle */
 			if machine.Current() != "title" && machine.Current() != "subtitle" {
-				return nil, fmt.Errorf("subtitle: invalid state '%s'", machine.Current())
+				return nil, &WikiParseError{Line: lineNum, Msg: fmt.Sprintf("subtitle: invalid state '%s'", machine.Current())}
 			}
 			deviceID = strings.Trim(strings.TrimSpace(line), "=[] ")
 			bID, dID, ok := strings.Cut(deviceID, "|")
@@ -556,11 +913,25 @@ func parseWikiTable(text string) ([]WikiFirmware, error) {
 				deviceID = dID
 				boardID = bID
 			}
+			if db != nil {
+				if wikiBoardRE.MatchString(deviceID) { // board-only subtitle (i.e. "=== [[D83AP]] ===")
+					if prod, err := db.GetProductForModel(deviceID); err == nil {
+						if len(boardID) == 0 {
+							boardID = deviceID
+						}
+						deviceID = prod
+					} else {
+						log.Warnf("wiki subtitle board '%s' is not in the ipsw device db (keeping it as the device)", deviceID)
+					}
+				} else {
+					deviceID = db.CanonicalProductType(deviceID)
+				}
+			}
 			// log.Info(deviceID)
 			continue
 		} else if strings.HasPrefix(line, "==") { /* title */
 			if machine.Current() != "title" {
-				return nil, fmt.Errorf("title: invalid state '%s'", machine.Current())
+				return nil, &WikiParseError{Line: lineNum, Msg: fmt.Sprintf("title: invalid state '%s'", machine.Current())}
 			}
 			productName = strings.Trim(strings.TrimSpace(line), "=[] ")
 			bID, dID, ok := strings.Cut(productName, "|")
@@ -572,7 +943,7 @@ func parseWikiTable(text string) ([]WikiFirmware, error) {
 			continue
 		} else if strings.HasPrefix(line, "{|") { /* table start */
 			if machine.Current() != "title" {
-				return nil, fmt.Errorf("table start: invalid state '%s'", machine.Current())
+				return nil, &WikiParseError{Line: lineNum, Msg: fmt.Sprintf("table start: invalid state '%s'", machine.Current())}
 			}
 			machine.Transition("start")
 			fieldCount = 0
@@ -582,15 +953,17 @@ func parseWikiTable(text string) ([]WikiFirmware, error) {
 			continue
 		} else if strings.HasPrefix(line, "|}") { /* table end */
 			if machine.Current() != "process_item" {
-				return nil, fmt.Errorf("table end: invalid state '%s'", machine.Current())
+				return nil, &WikiParseError{Line: lineNum, Msg: fmt.Sprintf("table end: invalid state '%s'", machine.Current())}
 			}
 			machine.Transition("stop")
 			for i := 0; i < headerCount; i++ {
 				parseItem(i)
 			}
+			ipsw.correlateBuilds()
 			if ipsw.URL != "" {
 				results = append(results, ipsw)
 			}
+			ipsw = WikiFirmware{}
 			machine.Transition("done")
 			deviceID = ""
 			boardID = ""
@@ -607,6 +980,7 @@ func parseWikiTable(text string) ([]WikiFirmware, error) {
 				for i := 0; i < headerCount; i++ {
 					parseItem(i)
 				}
+				ipsw.correlateBuilds()
 				if ipsw.URL != "" {
 					results = append(results, ipsw)
 				}
@@ -617,14 +991,14 @@ func parseWikiTable(text string) ([]WikiFirmware, error) {
 			continue
 		} else if strings.HasPrefix(line, "!") { /* header values */
 			if machine.Current() != "header" && machine.Current() != "subheader" {
-				return nil, fmt.Errorf("parsing header: invalid state '%s'", machine.Current())
+				return nil, &WikiParseError{Line: lineNum, Msg: fmt.Sprintf("parsing header: invalid state '%s'", machine.Current())}
 			}
 			if machine.Current() == "header" {
 				line = strings.TrimPrefix(line, "! ")
 				if strings.Contains(line, "rowspan") {
 					_, _, field, err := getRowOrColInc(line)
 					if err != nil {
-						return nil, fmt.Errorf("failed to parse colspan|rowspan: %s", err)
+						return nil, &WikiParseError{Line: lineNum, Msg: "failed to parse colspan|rowspan", Err: err}
 					}
 					index2Header[headerCount] = field
 					header2Values[field] = NewQueue(100)
@@ -632,7 +1006,7 @@ func parseWikiTable(text string) ([]WikiFirmware, error) {
 				} else if strings.Contains(line, "colspan") {
 					_, colInc, field, err := getRowOrColInc(line)
 					if err != nil {
-						return nil, fmt.Errorf("failed to parse colspan|rowspan: %s", err)
+						return nil, &WikiParseError{Line: lineNum, Msg: "failed to parse colspan|rowspan", Err: err}
 					}
 					header2Values[field] = NewQueue(100)
 					for i := 0; i < colInc; i++ {
@@ -666,7 +1040,7 @@ func parseWikiTable(text string) ([]WikiFirmware, error) {
 				machine.Transition("process_item") // skip missing subheader
 			}
 			if machine.Current() != "process_item" {
-				return nil, fmt.Errorf("parsing items: invalid state '%s'", machine.Current())
+				return nil, &WikiParseError{Line: lineNum, Msg: fmt.Sprintf("parsing items: invalid state '%s'", machine.Current())}
 			}
 
 			for fieldCount < len(index2Header)-1 && header2Values[index2Header[fieldCount]].Len() > 0 {
@@ -682,7 +1056,7 @@ func parseWikiTable(text string) ([]WikiFirmware, error) {
 			if strings.Contains(line, "colspan") || strings.Contains(line, "rowspan") {
 				rowInc, colInc, field, err := getRowOrColInc(line)
 				if err != nil {
-					return nil, fmt.Errorf("failed to parse colspan|rowspan: %s", err)
+					return nil, &WikiParseError{Line: lineNum, Msg: "failed to parse colspan|rowspan", Err: err}
 				}
 				if colInc > 0 && rowInc > 0 {
 					for i := 0; i < colInc; i++ {
@@ -718,9 +1092,30 @@ type WikiConfig struct {
 	IPSW    bool
 	OTA     bool
 	Beta    bool
+	// OS restricts the results to one OS lineage (ios, ipados, tvos, watchos, macos or bridgeos)
+	OS string
+	// SortOrder orders the combined results (newest, oldest or none/empty for wiki-table order)
+	SortOrder WikiSortOrder
+	// Workers is how many firmware pages are fetched at a time (0 or 1 fetches them one by one)
+	Workers int
+	// ReportWriter receives a JSON WikiCrawlReport of the crawl when GetIPSWs/GetOTAs return (optional)
+	ReportWriter io.Writer `json:"-"`
+	// MinTLS is the minimum TLS version of the wiki requests (i.e. tls.VersionTLS12; 0 keeps the DownloadConfig's)
+	MinTLS uint16
+	// IncludeLangLinks also parses the localized versions of the firmware pages (their langlinks), adding the
+	// firmwares only they list (i.e. regional builds)
+	IncludeLangLinks bool
+
+	skipMissing bool // pages that don't exist (red links) are warned about instead of failing the crawl
 }
 
-func CreateWikiFilter(cfg *WikiConfig) string {
+// getIpswDB loads the device DB that CreateWikiFilter maps devices to wiki pages with (swapped out in tests)
+var getIpswDB = info.GetIpswDB
+
+// CreateWikiFilter returns the prefix of the wiki pages (i.e. "Firmware/Apple Watch/7.x") that list the firmwares
+// of cfg's device and version (all the devices' pages if cfg.Device is empty); it returns an ErrWikiUnknownDevice
+// error if the device isn't known and an error if the device DB can't be read or cfg.Version isn't a version
+func CreateWikiFilter(cfg *WikiConfig) (string, error) {
 	var page string
 	var device string
 	var major string
@@ -741,28 +1136,26 @@ func CreateWikiFilter(cfg *WikiConfig) string {
 		}
 	}
 
-	db, err := info.GetIpswDB()
-	if err != nil {
-		log.Fatalf("failed to get ipsw db: %v", err)
-	}
-
-	dev, err := db.LookupDevice(cfg.Device)
-	if err != nil {
-		log.Fatalf("failed to lookup device '%s': %v", cfg.Device, err)
-	}
-
-	switch {
-	case strings.HasPrefix(dev.Name, "iPhone"):
-		device = iphone
-	case strings.HasPrefix(dev.Name, "iPad"):
-		device = ipad
+	if len(cfg.Device) > 0 {
+		db, err := getIpswDB()
+		if err != nil {
+			return "", fmt.Errorf("failed to get ipsw db: %w", err)
+		}
+		prod := db.CanonicalProductType(cfg.Device)
+		dev, err := db.LookupDevice(prod)
+		if err != nil {
+			return "", fmt.Errorf("%w %s: %v", ErrWikiUnknownDevice, cfg.Device, err)
+		}
+		if device = wikiFamily(prod, dev); len(device) == 0 {
+			return "", fmt.Errorf("%w %s: %s isn't an iPhone, iPad, iPod touch, Apple TV, Apple Watch, HomePod or Mac", ErrWikiUnknownDevice, cfg.Device, dev.Name)
+		}
 	}
 
 	if len(cfg.Version) > 0 {
 		if cfg.IPSW {
 			ver, err := semver.NewVersion(cfg.Version)
 			if err != nil {
-				log.Fatalf("failed to convert version '%s' into semver object", cfg.Version)
+				return "", fmt.Errorf("invalid wiki version '%s': %w", cfg.Version, err)
 			}
 			major = fmt.Sprintf("%s.x", strconv.Itoa(ver.Segments()[0]))
 		} else {
@@ -770,276 +1163,146 @@ func CreateWikiFilter(cfg *WikiConfig) string {
 		}
 	}
 
+	if len(device) == 0 {
+		return page + "/", nil
+	}
+
 	if len(major) > 0 {
-		return fmt.Sprintf("%s/%s/%s", page, device, major)
+		return fmt.Sprintf("%s/%s/%s", page, device, major), nil
 	}
 
-	return fmt.Sprintf("%s/%s", page, device)
+	return fmt.Sprintf("%s/%s", page, device), nil
 }
 
 //export c_internal_download_iphonewiki_GetWikiIPSWs
 func c_internal_download_iphonewiki_GetWikiIPSWs(configJson *C.char, configJsonLen C.int, proxy *C.char, proxyLen C.int, insecure C.char,
-	outputJson **C.char, outputJsonLen *C.int, err **C.char, errLen *C.uint) C.char {
+	outputJson **C.char, outputJsonLen *C.int, err **C.char, errLen *C.uint) (status C.char) {
+	defer ffi.Recover("c_internal_download_iphonewiki_GetWikiIPSWs", func(perr error) {
+		outError := perr.Error()
+		*err = C.CString(outError)
+		*errLen = C.uint(len(outError))
+		status = C.char(ffi.InternalPanic)
+	})
 	var wikiConfig WikiConfig
 	jsonErr := json.Unmarshal([]byte(C.GoStringN(configJson, configJsonLen)), &wikiConfig)
 	if jsonErr != nil {
 		outError := fmt.Sprintf("c_getWikiIPSWs: Deser failed with %w", jsonErr)
 		*err = C.CString(outError)
 		*errLen = C.uint(len(outError))
-		return C.char(0)
+		return C.char(ffi.Failure)
 	}
 	fw, wfwErr := GetWikiIPSWs(&wikiConfig, C.GoStringN(proxy, proxyLen), bool(insecure == 1))
 	if wfwErr != nil {
 		outError := fmt.Sprintf("c_getWikiIPSWs: GetWikiIPSWs failed with %w", wfwErr)
 		*err = C.CString(outError)
 		*errLen = C.uint(len(outError))
-		return C.char(0)
+		return C.char(ffi.Failure)
 	}
 	fret, jsonErr := json.Marshal(fw)
 	if jsonErr != nil {
 		outError := fmt.Sprintf("c_getWikiIPSWs: failed to create request: %w", jsonErr)
 		*err = C.CString(outError)
 		*errLen = C.uint(len(outError))
-		return C.char(0)
+		return C.char(ffi.Failure)
 	}
 	cs := C.CString(string(fret))
 	*outputJson = cs
 	*outputJsonLen = C.int(C.strlen(cs))
-	return C.char(1)
+	return C.char(ffi.Success)
 }
 
 // GetWikiIPSWs queries theiphonewiki.com for IPSWs
 func GetWikiIPSWs(cfg *WikiConfig, proxy string, insecure bool) ([]WikiFirmware, error) {
-	var ipsws []WikiFirmware
-
-	filter := CreateWikiFilter(cfg)
-
-	client := &http.Client{
-		Transport: &http.Transport{
-			Proxy:           GetProxy(proxy),
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: insecure},
-		},
-	}
+	return GetWikiIPSWsWithConfig(cfg, legacyDownloadConfig(proxy, insecure))
+}
 
-	req, err := http.NewRequest("GET", iphoneWikiApiURL, nil)
+// GetWikiIPSWsWithConfig queries theiphonewiki.com for IPSWs using the network settings in dl
+func GetWikiIPSWsWithConfig(cfg *WikiConfig, dl *DownloadConfig) ([]WikiFirmware, error) {
+	c, err := NewWikiClient(dl.withMinTLS(cfg.MinTLS))
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+		return nil, err
 	}
+	return c.GetIPSWs(cfg)
+}
 
-	q := req.URL.Query()
-	q.Add("format", "json")
-	q.Add("action", "parse")
-	q.Add("page", ipswPage)
-	q.Add("prop", "links")
-	q.Add("redirects", "true")
-	req.URL.RawQuery = q.Encode()
+// GetIPSWs queries the wiki for IPSWs
+func (c *WikiClient) GetIPSWs(cfg *WikiConfig) ([]WikiFirmware, error) {
+	if err := cfg.SortOrder.validate(); err != nil {
+		return nil, err
+	}
+	if err := validateWikiOS(cfg.OS); err != nil {
+		return nil, err
+	}
 
-	resp, err := client.Do(req)
+	filter, err := CreateWikiFilter(cfg)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get response: %w", err)
+		return nil, fmt.Errorf("failed to create wiki page filter: %w", err)
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("failed to get response: %s", resp.Status)
-	}
+	report := newWikiCrawlReport("ipsw", filter)
+	ctx := report.context(context.Background())
 
-	data, err := io.ReadAll(resp.Body)
+	parseResp, err := c.getWikiLinks(ctx, ipswPage)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
+		return nil, report.finish(cfg.ReportWriter, nil, err)
 	}
 
-	// parse the response
-	var parseResp wikiParseResults
-	if err := json.Unmarshal(data, &parseResp); err != nil {
-		return nil, fmt.Errorf("failed to parse response: %w", err)
+	ipsws, err := crawlWikiPages(ctx, parseResp.Parse.Links, filter, ".ipsw", cfg, c, report)
+	if err != nil {
+		return nil, report.finish(cfg.ReportWriter, nil, err)
 	}
 
-	for _, link := range parseResp.Parse.Links {
-		if strings.HasPrefix(link.Link, filter) {
-
-			if strings.HasSuffix(link.Link, "iPod") { // skip weird info page
-				continue
-			}
-
-			log.Debugf("Parsing wiki page: '%s'", link.Link)
-
-			wpage, err := getWikiPage(link.Link, proxy, insecure)
-			if err != nil {
-				return nil, fmt.Errorf("failed to parse page %s: %w", link.Link, err)
-			}
-
-			if utils.StrSliceContains(wpage.Parse.ExternalLinks, ".ipsw") {
-				wtable, err := getWikiTable(link.Link, proxy, insecure)
-				if err != nil {
-					return nil, fmt.Errorf("failed to parse wikitable for %s: %w", link.Link, err)
-				}
-				// parse the wikitable
-				tableIPSWs, err := parseWikiTable(wtable.Parse.WikiText.Text)
-				if err != nil {
-					return nil, fmt.Errorf("failed to parse wikitable: %w", err)
-				}
-
-				ipsws = append(ipsws, tableIPSWs...)
-			}
-		}
-	}
+	SortWikiFirmwares(ipsws, cfg.SortOrder)
 
-	return ipsws, nil
+	return ipsws, report.finish(cfg.ReportWriter, ipsws, nil)
 }
 
 // GetWikiOTAs queries theiphonewiki.com for OTAs
 func GetWikiOTAs(cfg *WikiConfig, proxy string, insecure bool) ([]WikiFirmware, error) {
-	var otas []WikiFirmware
-
-	filter := CreateWikiFilter(cfg)
-
-	client := &http.Client{
-		Transport: &http.Transport{
-			Proxy:           GetProxy(proxy),
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: insecure},
-		},
-	}
+	return GetWikiOTAsWithConfig(cfg, legacyDownloadConfig(proxy, insecure))
+}
 
-	req, err := http.NewRequest("GET", iphoneWikiApiURL, nil)
+// GetWikiOTAsWithConfig queries theiphonewiki.com for OTAs using the network settings in dl
+func GetWikiOTAsWithConfig(cfg *WikiConfig, dl *DownloadConfig) ([]WikiFirmware, error) {
+	c, err := NewWikiClient(dl.withMinTLS(cfg.MinTLS))
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+		return nil, err
 	}
+	return c.GetOTAs(cfg)
+}
 
-	q := req.URL.Query()
-	q.Add("format", "json")
-	q.Add("action", "parse")
-	if cfg.Beta {
-		q.Add("page", otaBetaPage)
-	} else {
-		q.Add("page", otaPage)
-	}
-	q.Add("prop", "links")
-	q.Add("redirects", "true")
-	req.URL.RawQuery = q.Encode()
-
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get response: %w", err)
+// GetOTAs queries the wiki for OTAs
+func (c *WikiClient) GetOTAs(cfg *WikiConfig) ([]WikiFirmware, error) {
+	if err := cfg.SortOrder.validate(); err != nil {
+		return nil, err
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("failed to get response: %s", resp.Status)
+	if err := validateWikiOS(cfg.OS); err != nil {
+		return nil, err
 	}
 
-	data, err := io.ReadAll(resp.Body)
+	filter, err := CreateWikiFilter(cfg)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
+		return nil, fmt.Errorf("failed to create wiki page filter: %w", err)
 	}
 
-	// parse the response
-	var parseResp wikiParseResults
-	if err := json.Unmarshal(data, &parseResp); err != nil {
-		return nil, fmt.Errorf("failed to parse response: %w", err)
-	}
-
-	for _, link := range parseResp.Parse.Links {
-		if strings.HasPrefix(link.Link, filter) {
-
-			log.Debugf("Parsing wiki page: '%s'", link.Link)
-
-			if strings.HasSuffix(link.Link, "iPod") { // skip weird info page
-				continue
-			}
+	report := newWikiCrawlReport("ota", filter)
+	ctx := report.context(context.Background())
 
-			wpage, err := getWikiPage(link.Link, proxy, insecure)
-			if err != nil {
-				return nil, fmt.Errorf("failed to parse page %s: %w", link.Link, err)
-			}
-
-			if utils.StrSliceContains(wpage.Parse.ExternalLinks, ".zip") {
-				wtable, err := getWikiTable(link.Link, proxy, insecure)
-				if err != nil {
-					return nil, fmt.Errorf("failed to parse wikitable for %s: %w", link.Link, err)
-				}
-				// parse the wikitable
-				tableOTAs, err := parseWikiTable(wtable.Parse.WikiText.Text)
-				if err != nil {
-					return nil, fmt.Errorf("failed to parse wikitable: %w", err)
-				}
-
-				otas = append(otas, tableOTAs...)
-			}
-		}
-	}
-
-	return otas, nil
-}
-
-func GetWikiFirmwareKeys(proxy string, insecure bool) ([]WikiFirmware, error) {
-	var otas []WikiFirmware
-
-	client := &http.Client{
-		Transport: &http.Transport{
-			Proxy:           GetProxy(proxy),
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: insecure},
-		},
-	}
-
-	req, err := http.NewRequest("GET", iphoneWikiApiURL, nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+	page := otaPage
+	if cfg.Beta {
+		page = otaBetaPage
 	}
-
-	q := req.URL.Query()
-	q.Add("format", "json")
-	q.Add("action", "parse")
-	q.Add("page", "OTA Updates")
-	q.Add("prop", "links")
-	q.Add("redirects", "true")
-	req.URL.RawQuery = q.Encode()
-
-	resp, err := client.Do(req)
+	parseResp, err := c.getWikiLinks(ctx, page)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get response: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("failed to get response: %s", resp.Status)
+		return nil, report.finish(cfg.ReportWriter, nil, err)
 	}
 
-	data, err := io.ReadAll(resp.Body)
+	otas, err := crawlWikiPages(ctx, parseResp.Parse.Links, filter, ".zip", cfg, c, report)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
+		return nil, report.finish(cfg.ReportWriter, nil, err)
 	}
 
-	// parse the response
-	var parseResp wikiParseResults
-	if err := json.Unmarshal(data, &parseResp); err != nil {
-		return nil, fmt.Errorf("failed to parse response: %w", err)
-	}
-
-	for _, link := range parseResp.Parse.Links {
-		// if strings.HasPrefix(link.Link, "OTA Updates/") {
-		if strings.HasPrefix(link.Link, "OTA Updates/iPhone/15") {
-
-			wpage, err := getWikiPage(link.Link, proxy, insecure)
-			if err != nil {
-				return nil, fmt.Errorf("failed to parse page %s: %w", link.Link, err)
-			}
-
-			if utils.StrSliceContains(wpage.Parse.ExternalLinks, ".zip") {
-				wtable, err := getWikiTable(link.Link, proxy, insecure)
-				if err != nil {
-					return nil, fmt.Errorf("failed to parse wikitable for %s: %w", link.Link, err)
-				}
-				// parse the wikitable
-				tableIPSWs, err := parseWikiTable(wtable.Parse.WikiText.Text)
-				if err != nil {
-					return nil, fmt.Errorf("failed to parse wikitable: %w", err)
-				}
-				fmt.Println(tableIPSWs)
-				// otas = append(otas, tableIPSWs...)
-			}
-		}
-	}
+	SortWikiFirmwares(otas, cfg.SortOrder)
 
-	return otas, nil
+	return otas, report.finish(cfg.ReportWriter, otas, nil)
 }
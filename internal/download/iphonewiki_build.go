@@ -0,0 +1,59 @@
+package download
+
+import (
+	"path"
+	"regexp"
+	"strings"
+)
+
+// wikiBuildTrainRE matches a build (prefix) that includes its train letter (i.e. 20B or 20B110) and so
+// pins the major version of the firmwares it can match
+var wikiBuildTrainRE = regexp.MustCompile(`^\d+[A-Za-z]`)
+
+// MatchesBuild reports whether the firmware's build for device (see BuildFor) starts with build (case-insensitive);
+// without a device any of the builds the firmware lists can match, and every firmware matches an empty build
+func (fw WikiFirmware) MatchesBuild(device, build string) bool {
+	build = strings.ToUpper(build)
+	if len(device) > 0 {
+		return strings.HasPrefix(strings.ToUpper(fw.BuildFor(device)), build)
+	}
+	if strings.HasPrefix(strings.ToUpper(fw.Build), build) {
+		return true
+	}
+	for _, b := range fw.Builds {
+		if strings.HasPrefix(strings.ToUpper(b), build) {
+			return true
+		}
+	}
+	return false
+}
+
+// filterWikiBuild drops the firmwares whose build (for cfg.Device) doesn't match cfg.Build (exactly or as a prefix, i.e. 20B)
+func (cfg *WikiConfig) filterWikiBuild(fws []WikiFirmware) []WikiFirmware {
+	if len(cfg.Build) == 0 {
+		return fws
+	}
+	var out []WikiFirmware
+	for _, fw := range fws {
+		if fw.MatchesBuild(cfg.Device, cfg.Build) {
+			out = append(out, fw)
+		}
+	}
+	return out
+}
+
+// buildPinsPage returns true if the firmwares matching cfg.Build are all on one page of each device family:
+// the wiki has a page per major version (i.e. Firmware/iPhone/16.x) and a build with its train letter belongs
+// to a single major version, so once a family's page has a match its other pages can't have one
+func (cfg *WikiConfig) buildPinsPage() bool {
+	return wikiBuildTrainRE.MatchString(cfg.Build)
+}
+
+// wikiPageFamily returns the device family part of a firmware page (i.e. Firmware/iPhone of Firmware/iPhone/16.x);
+// a page that isn't split by major version is its own family
+func wikiPageFamily(page string) string {
+	if strings.HasSuffix(page, ".x") {
+		return path.Dir(page)
+	}
+	return page
+}
@@ -0,0 +1,110 @@
+package download
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+// WikiClient queries the wiki's MediaWiki API (the wiki functions use one built from their DownloadConfig)
+type WikiClient struct {
+	BaseURL string // the api.php endpoint (i.e. https://theapplewiki.com/api.php)
+	Client  *http.Client
+}
+
+// NewWikiClient returns a WikiClient for theapplewiki.com using the network settings in dl
+func NewWikiClient(dl *DownloadConfig) (*WikiClient, error) {
+	client, err := dl.NewClient()
+	if err != nil {
+		return nil, err
+	}
+	return &WikiClient{BaseURL: iphoneWikiApiURL, Client: client}, nil
+}
+
+// parse queries the API's parse action for page
+func (c *WikiClient) parse(ctx context.Context, page string, params url.Values) (*wikiParseResults, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", c.BaseURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	q := req.URL.Query()
+	q.Add("format", "json")
+	q.Add("action", "parse")
+	q.Add("page", page)
+	for k, vs := range params {
+		for _, v := range vs {
+			q.Add(k, v)
+		}
+	}
+	q.Add("redirects", "true")
+	req.URL.RawQuery = q.Encode()
+
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to get response: %w", ErrWikiNetwork, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, wikiStatusError(resp)
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to read response: %w", ErrWikiNetwork, err)
+	}
+
+	// parse the response
+	var parseResp wikiParseResults
+	if err := json.Unmarshal(data, &parseResp); err != nil {
+		return nil, &WikiParseError{Msg: "failed to parse response", Err: err}
+	}
+	if parseResp.Error != nil {
+		return nil, parseResp.Error.toError()
+	}
+
+	return &parseResp, nil
+}
+
+// getWikiPage returns the parsed page (its links and external links)
+func (c *WikiClient) getWikiPage(ctx context.Context, page string) (*wikiParseResults, error) {
+	return c.parse(ctx, page, nil)
+}
+
+// getWikiTable returns the page's wikitext
+func (c *WikiClient) getWikiTable(ctx context.Context, page string) (*wikiParseResults, error) {
+	return c.parse(ctx, page, url.Values{"prop": {"wikitext"}})
+}
+
+// getWikiLinks returns the page's internal links
+func (c *WikiClient) getWikiLinks(ctx context.Context, page string) (*wikiParseResults, error) {
+	return c.parse(ctx, page, url.Values{"prop": {"links"}})
+}
+
+// wikiLangAPI returns the api.php endpoint of the localized wiki ll links to: base on the link's host
+// (a var so tests can serve the localized pages)
+var wikiLangAPI = func(base string, ll wikiLangLink) (string, error) {
+	u, err := url.Parse(ll.URL)
+	if err != nil || len(u.Host) == 0 {
+		return "", fmt.Errorf("invalid %s langlink URL '%s'", ll.Lang, ll.URL)
+	}
+	api, err := url.Parse(base)
+	if err != nil {
+		return "", fmt.Errorf("invalid wiki API URL '%s': %w", base, err)
+	}
+	api.Scheme, api.Host = u.Scheme, u.Host
+	return api.String(), nil
+}
+
+// langClient returns a client for the localized wiki ll links to (sharing c's HTTP client)
+func (c *WikiClient) langClient(ll wikiLangLink) (*WikiClient, error) {
+	api, err := wikiLangAPI(c.BaseURL, ll)
+	if err != nil {
+		return nil, err
+	}
+	return &WikiClient{BaseURL: api, Client: c.Client}, nil
+}
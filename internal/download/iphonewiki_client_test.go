@@ -0,0 +1,449 @@
+package download
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/blacktop/ipsw/pkg/info"
+)
+
+// newWikiTestServer replays the recorded API responses in testdata/wiki_api (named after the page
+// and prop) and records the requests it served; pages without a recording are missing titles
+func newWikiTestServer(t *testing.T) (*WikiClient, func() []string) {
+	t.Helper()
+	return newWikiTestServerDir(t, "wiki_api")
+}
+
+// newWikiTestServerDir is newWikiTestServer replaying the recordings in testdata/dir
+func newWikiTestServerDir(t *testing.T, dir string) (*WikiClient, func() []string) {
+	t.Helper()
+	var (
+		mu       sync.Mutex
+		requests []string
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("action") != "parse" || q.Get("format") != "json" {
+			http.Error(w, "unexpected query "+r.URL.RawQuery, http.StatusBadRequest)
+			return
+		}
+		name := strings.NewReplacer("/", "_", " ", "_").Replace(q.Get("page"))
+		if prop := q.Get("prop"); len(prop) > 0 {
+			name += "." + prop
+		}
+		mu.Lock()
+		requests = append(requests, name)
+		mu.Unlock()
+
+		data, err := os.ReadFile(filepath.Join("testdata", dir, name+".json"))
+		if err != nil {
+			w.Write([]byte(`{"error":{"code":"missingtitle","info":"The page you specified doesn't exist."}}`))
+			return
+		}
+		w.Write(data)
+	}))
+	t.Cleanup(ts.Close)
+	return &WikiClient{BaseURL: ts.URL, Client: ts.Client()}, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return slices.Clone(requests)
+	}
+}
+
+func TestWikiClientGetIPSWs(t *testing.T) {
+	c, requests := newWikiTestServer(t)
+
+	fws, err := c.GetIPSWs(&WikiConfig{IPSW: true, Device: "iPhone15,2", SortOrder: WikiSortNewest})
+	if err != nil {
+		t.Fatalf("GetIPSWs() error = %v", err)
+	}
+	var got []string
+	for _, fw := range fws {
+		got = append(got, fw.Build+"/"+strings.Join(fw.Devices, ","))
+	}
+	if want := []string{"21A329/iPhone15,2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("GetIPSWs() = %v, want %v", got, want)
+	}
+	// only the device family's pages are fetched, and only the ones with .ipsw external links have their wikitext fetched
+	want := []string{
+		"Firmware.links",
+		"Firmware_iPhone_17.x", "Firmware_iPhone_17.x.wikitext",
+		"Firmware_iPhone_16.x",
+	}
+	if got := requests(); !reflect.DeepEqual(got, want) {
+		t.Errorf("requests = %v, want %v", got, want)
+	}
+}
+
+func TestWikiClientGetIPSWsVersion(t *testing.T) {
+	c, requests := newWikiTestServer(t)
+
+	fws, err := c.GetIPSWs(&WikiConfig{IPSW: true, Device: "iPad13,18", Version: "17.0"})
+	if err != nil {
+		t.Fatalf("GetIPSWs() error = %v", err)
+	}
+	if len(fws) != 1 || fws[0].Build != "21A329" || fws[0].Devices[0] != "iPad13,18" {
+		t.Errorf("GetIPSWs() = %+v, want iPad13,18 21A329", fws)
+	}
+	if want := []string{"Firmware.links", "Firmware_iPad_17.x", "Firmware_iPad_17.x.wikitext"}; !reflect.DeepEqual(requests(), want) {
+		t.Errorf("requests = %v, want %v", requests(), want)
+	}
+}
+
+func TestWikiClientGetIPSWsBuild(t *testing.T) {
+	tests := []struct {
+		build    string
+		want     []string
+		requests []string
+	}{
+		// a build with its train letter is on one page per family: the later iPhone pages aren't fetched
+		{"21a329", []string{"21A329"}, []string{"Firmware.links", "Firmware_iPhone_17.x", "Firmware_iPhone_17.x.wikitext"}},
+		{"21A", []string{"21A329"}, []string{"Firmware.links", "Firmware_iPhone_17.x", "Firmware_iPhone_17.x.wikitext"}},
+		{"20B", nil, []string{"Firmware.links", "Firmware_iPhone_17.x", "Firmware_iPhone_17.x.wikitext", "Firmware_iPhone_16.x"}},
+		// a bare major version can be on any page
+		{"2", []string{"21A329"}, []string{"Firmware.links", "Firmware_iPhone_17.x", "Firmware_iPhone_17.x.wikitext", "Firmware_iPhone_16.x"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.build, func(t *testing.T) {
+			c, requests := newWikiTestServer(t)
+			fws, err := c.GetIPSWs(&WikiConfig{IPSW: true, Device: "iPhone15,2", Build: tt.build})
+			if err != nil {
+				t.Fatalf("GetIPSWs() error = %v", err)
+			}
+			var got []string
+			for _, fw := range fws {
+				got = append(got, fw.Build)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetIPSWs() = %v, want %v", got, tt.want)
+			}
+			if got := requests(); !reflect.DeepEqual(got, tt.requests) {
+				t.Errorf("requests = %v, want %v", got, tt.requests)
+			}
+		})
+	}
+}
+
+func TestWikiClientGetIPSWsLegacy(t *testing.T) {
+	for _, tt := range []struct {
+		cfg    WikiConfig
+		filter string
+	}{
+		{WikiConfig{IPSW: true, Device: "iPod1,1"}, "Firmware/iPod touch"},
+		{WikiConfig{IPSW: true, Device: "ipod1,1", Version: "1.1"}, "Firmware/iPod touch/1.x"},
+		{WikiConfig{IPSW: true, Device: "iPhone1,1", Version: "1.0"}, "Firmware/iPhone/1.x"},
+		{WikiConfig{IPSW: true, Device: "iPad1,1", Version: "3.2"}, "Firmware/iPad/3.x"},
+	} {
+		if got, err := CreateWikiFilter(&tt.cfg); err != nil || got != tt.filter {
+			t.Errorf("CreateWikiFilter(%s %s) = %s, %v, want %s", tt.cfg.Device, tt.cfg.Version, got, err, tt.filter)
+		}
+	}
+
+	c, requests := newWikiTestServer(t)
+	fws, err := c.GetIPSWs(&WikiConfig{IPSW: true, Device: "iPod1,1", Version: "1.1"})
+	if err != nil {
+		t.Fatalf("GetIPSWs() error = %v", err)
+	}
+	if len(fws) != 1 || fws[0].Version != "1.1" || fws[0].Build != "3A101a" || !reflect.DeepEqual(fws[0].Devices, []string{"iPod1,1"}) {
+		t.Errorf("GetIPSWs() = %+v, want iPod1,1 1.1 3A101a", fws)
+	}
+	if want := []string{"Firmware.links", "Firmware_iPod_touch_1.x", "Firmware_iPod_touch_1.x.wikitext"}; !reflect.DeepEqual(requests(), want) {
+		t.Errorf("requests = %v, want %v", requests(), want)
+	}
+}
+
+func TestWikiClientGetIPSWsLangLinks(t *testing.T) {
+	c, requests := newWikiTestServer(t)
+	lang := wikiLangAPI
+	t.Cleanup(func() { wikiLangAPI = lang })
+	wikiLangAPI = func(string, wikiLangLink) (string, error) { return c.BaseURL, nil }
+
+	fws, err := c.GetIPSWs(&WikiConfig{IPSW: true, Device: "iPhone15,2", SortOrder: WikiSortOldest, IncludeLangLinks: true})
+	if err != nil {
+		t.Fatalf("GetIPSWs() error = %v", err)
+	}
+	var got []string
+	for _, fw := range fws {
+		got = append(got, fw.Build)
+	}
+	// the localized page's copy of 21A329 is dropped
+	if want := []string{"21A329", "21A331"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("GetIPSWs() = %v, want %v", got, want)
+	}
+	if !slices.Contains(requests(), "固件_iPhone_17.x.wikitext") {
+		t.Errorf("requests = %v, want the zh page's wikitext", requests())
+	}
+
+	c, requests = newWikiTestServer(t)
+	if _, err := c.GetIPSWs(&WikiConfig{IPSW: true, Device: "iPhone15,2"}); err != nil {
+		t.Fatalf("GetIPSWs() error = %v", err)
+	}
+	if slices.Contains(requests(), "固件_iPhone_17.x.wikitext") {
+		t.Errorf("requests = %v, want no localized pages without IncludeLangLinks", requests())
+	}
+}
+
+func TestWikiLangAPI(t *testing.T) {
+	got, err := wikiLangAPI("https://theapplewiki.com/api.php", wikiLangLink{Lang: "zh", URL: "https://zh.theapplewiki.com/wiki/x"})
+	if err != nil || got != "https://zh.theapplewiki.com/api.php" {
+		t.Errorf("wikiLangAPI() = %q, %v, want https://zh.theapplewiki.com/api.php", got, err)
+	}
+	if _, err := wikiLangAPI("https://theapplewiki.com/api.php", wikiLangLink{Lang: "zh", URL: "x"}); err == nil {
+		t.Error("wikiLangAPI() error = nil for a link without a host")
+	}
+}
+
+func TestWikiClientGetIPSWsFamilies(t *testing.T) {
+	for _, tt := range []struct {
+		cfg    WikiConfig
+		filter string
+	}{
+		{WikiConfig{IPSW: true, Device: "iPhone14,2", Version: "16.1"}, "Firmware/iPhone/16.x"},
+		{WikiConfig{IPSW: true, Device: "iPad13,18", Version: "17.0"}, "Firmware/iPad/17.x"},
+		{WikiConfig{IPSW: true, Device: "iPad13,1", Version: "17.0"}, "Firmware/iPad Air/17.x"},
+		{WikiConfig{IPSW: true, Device: "iPad13,8", Version: "17.0"}, "Firmware/iPad Pro/17.x"},
+		{WikiConfig{IPSW: true, Device: "iPad14,1", Version: "17.0"}, "Firmware/iPad mini/17.x"},
+		{WikiConfig{IPSW: true, Device: "Watch6,1", Version: "7.0"}, "Firmware/Apple Watch/7.x"},
+		{WikiConfig{IPSW: true, Device: "AppleTV11,1", Version: "17.0"}, "Firmware/Apple TV/17.x"},
+		{WikiConfig{IPSW: true, Device: "AudioAccessory5,1", Version: "17.0"}, "Firmware/HomePod/17.x"},
+		{WikiConfig{IPSW: true, Device: "Mac14,2", Version: "14.0"}, "Firmware/Mac/14.x"},
+		{WikiConfig{IPSW: true, Device: "iBridge2,1"}, "Firmware/iBridge"},
+		{WikiConfig{OTA: true, Device: "Watch6,1", Version: "7.0"}, "OTA Updates/Apple Watch/7.0"},
+		{WikiConfig{IPSW: true, Version: "17.0"}, "Firmware/"},
+	} {
+		if got, err := CreateWikiFilter(&tt.cfg); err != nil || got != tt.filter {
+			t.Errorf("CreateWikiFilter(%s %s) = %s, %v, want %s", tt.cfg.Device, tt.cfg.Version, got, err, tt.filter)
+		}
+	}
+
+	c, requests := newWikiTestServer(t)
+	fws, err := c.GetIPSWs(&WikiConfig{IPSW: true, Device: "Watch6,1", Version: "7.0"})
+	if err != nil {
+		t.Fatalf("GetIPSWs() error = %v", err)
+	}
+	if len(fws) != 1 || fws[0].Build != "18R382" || fws[0].Devices[0] != "Watch6,1" || fws[0].OS != WikiOSwatchOS {
+		t.Errorf("GetIPSWs() = %+v, want Watch6,1 7.0 18R382", fws)
+	}
+	if want := []string{"Firmware.links", "Firmware_Apple_Watch_7.x", "Firmware_Apple_Watch_7.x.wikitext"}; !reflect.DeepEqual(requests(), want) {
+		t.Errorf("requests = %v, want %v", requests(), want)
+	}
+
+	// devices without wiki firmware pages are errors (before anything is fetched)
+	for _, device := range []string{"RealityDevice14,1", "Bogus9,9"} {
+		if filter, err := CreateWikiFilter(&WikiConfig{IPSW: true, Device: device}); !errors.Is(err, ErrWikiUnknownDevice) {
+			t.Errorf("CreateWikiFilter(%s) = %s, %v, want an ErrWikiUnknownDevice error", device, filter, err)
+		}
+	}
+	c, requests = newWikiTestServer(t)
+	if _, err := c.GetOTAs(&WikiConfig{OTA: true, Device: "RealityDevice14,1"}); !errors.Is(err, ErrWikiUnknownDevice) || len(requests()) > 0 {
+		t.Errorf("GetOTAs(RealityDevice14,1) error = %v (requests %v), want an ErrWikiUnknownDevice error", err, requests())
+	}
+
+	// without the device DB a device can't be mapped to its pages, which is an error (not every family's firmwares)
+	dbErr := errors.New("corrupt device DB")
+	orig := getIpswDB
+	getIpswDB = func(...info.DBOption) (*info.Devices, error) { return nil, dbErr }
+	defer func() { getIpswDB = orig }()
+	if filter, err := CreateWikiFilter(&WikiConfig{IPSW: true, Device: "iPhone15,2", Version: "17.0"}); !errors.Is(err, dbErr) {
+		t.Errorf("CreateWikiFilter() with a broken device DB = %q, %v, want the DB error", filter, err)
+	}
+	c, requests = newWikiTestServer(t)
+	if _, err := c.GetIPSWs(&WikiConfig{IPSW: true, Device: "iPhone15,2"}); !errors.Is(err, dbErr) || len(requests()) > 0 {
+		t.Errorf("GetIPSWs() with a broken device DB error = %v (requests %v), want the DB error", err, requests())
+	}
+}
+
+func TestWikiClientErrors(t *testing.T) {
+	// a page that doesn't exist
+	c, _ := newWikiTestServer(t)
+	if _, err := c.GetOTAs(&WikiConfig{OTA: true, Device: "iPhone15,2"}); !errors.Is(err, ErrWikiNotFound) {
+		t.Errorf("GetOTAs() error = %v, want ErrWikiNotFound", err)
+	}
+	if _, err := c.GetFirmware("iPhone15,2", "20G75"); !errors.Is(err, ErrWikiNotFound) {
+		t.Errorf("GetFirmware() error = %v, want ErrWikiNotFound", err)
+	}
+	fw, err := c.GetFirmware("iPhone15,2", "21A329")
+	if err != nil || fw.Version != "17.0" {
+		t.Errorf("GetFirmware() = %+v, %v; want 17.0", fw, err)
+	}
+
+	// a version that isn't one is an error before anything is fetched
+	vc, requests := newWikiTestServer(t)
+	if fws, err := vc.GetIPSWs(&WikiConfig{IPSW: true, Device: "iPhone15,2", Version: "seventeen"}); err == nil || fws != nil || len(requests()) > 0 {
+		t.Errorf("GetIPSWs(seventeen) = %v, %v (requests %v), want an error", fws, err, requests())
+	}
+
+	for status, want := range map[int]error{
+		http.StatusServiceUnavailable:  ErrWikiRateLimited,
+		http.StatusInternalServerError: ErrWikiNetwork,
+	} {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(status)
+		}))
+		c := &WikiClient{BaseURL: ts.URL, Client: ts.Client()}
+		if _, err := c.GetIPSWs(&WikiConfig{IPSW: true, Device: "iPhone15,2"}); !errors.Is(err, want) {
+			t.Errorf("GetIPSWs() with a %d = %v, want %v", status, err, want)
+		}
+		ts.Close()
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<html>`))
+	}))
+	defer ts.Close()
+	c = &WikiClient{BaseURL: ts.URL, Client: ts.Client()}
+	if _, err := c.GetIPSWs(&WikiConfig{IPSW: true, Device: "iPhone15,2"}); !errors.Is(err, ErrWikiParse) {
+		t.Errorf("GetIPSWs() with a bad response = %v, want ErrWikiParse", err)
+	}
+}
+
+func TestWikiClientTimeout(t *testing.T) {
+	hung := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-hung:
+		case <-r.Context().Done():
+		}
+	}))
+	defer ts.Close()
+	defer close(hung)
+
+	c, err := NewWikiClient(&DownloadConfig{Timeout: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.BaseURL = ts.URL
+
+	start := time.Now()
+	_, err = c.GetIPSWs(&WikiConfig{IPSW: true, Device: "iPhone15,2"})
+	if !errors.Is(err, ErrWikiNetwork) {
+		t.Fatalf("GetIPSWs() error = %v, want ErrWikiNetwork", err)
+	}
+	var terr interface{ Timeout() bool }
+	if !errors.As(err, &terr) || !terr.Timeout() {
+		t.Errorf("GetIPSWs() error = %v, want a timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("GetIPSWs() took %v with a 50ms timeout", elapsed)
+	}
+}
+
+// flakyTransport fails the first request with a 503
+type flakyTransport struct {
+	next   http.RoundTripper
+	failed atomic.Bool
+}
+
+func (t *flakyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !t.failed.Swap(true) {
+		return &http.Response{StatusCode: http.StatusServiceUnavailable, Body: http.NoBody, Request: req}, nil
+	}
+	return t.next.RoundTrip(req)
+}
+
+func TestWikiClientReport(t *testing.T) {
+	c, _ := newWikiTestServer(t)
+	c.Client = &http.Client{Transport: &retryTransport{
+		next:   &flakyTransport{next: c.Client.Transport},
+		policy: RetryPolicy{MaxRetries: 1, Backoff: time.Millisecond},
+	}}
+
+	var buf bytes.Buffer
+	fws, err := c.GetIPSWs(&WikiConfig{IPSW: true, Device: "iPhone15,2", ReportWriter: &buf})
+	if err != nil {
+		t.Fatalf("GetIPSWs() error = %v", err)
+	}
+	var report WikiCrawlReport
+	if err := json.Unmarshal(buf.Bytes(), &report); err != nil {
+		t.Fatalf("report isn't JSON: %v\n%s", err, buf.String())
+	}
+	if report.Kind != "ipsw" || report.Filter != "Firmware/iPhone" || report.Firmwares != len(fws) || report.Retries != 1 ||
+		report.PagesDiscovered != 2 || report.PagesFetched != 2 || report.PagesParsed != 1 || report.Errors != 0 || len(report.Error) > 0 {
+		t.Errorf("report = %+v, want 2 iPhone pages found and fetched, 1 parsed, 1 retry and no errors", report)
+	}
+	want := []WikiPageReport{
+		{Page: "Firmware/iPhone/17.x", Fetched: true, Parsed: true, Firmwares: report.Pages[0].Firmwares, RevisionID: 4242},
+		{Page: "Firmware/iPhone/16.x", Fetched: true}, // no .ipsw links
+	}
+	if !reflect.DeepEqual(report.Pages, want) || report.Pages[0].Firmwares == 0 {
+		t.Errorf("report pages = %+v, want %+v", report.Pages, want)
+	}
+
+	// the report is written when the crawl fails too
+	buf.Reset()
+	c, _ = newWikiTestServer(t)
+	if _, err := c.GetOTAs(&WikiConfig{OTA: true, Device: "iPhone15,2", ReportWriter: &buf}); err == nil {
+		t.Fatal("GetOTAs() of a missing page succeeded")
+	}
+	report = WikiCrawlReport{}
+	if err := json.Unmarshal(buf.Bytes(), &report); err != nil || report.Kind != "ota" || report.Errors != 1 || len(report.Error) == 0 {
+		t.Errorf("failed crawl report = %+v, %v; want 1 error", report, err)
+	}
+}
+
+// pageTransport fails the requests for fail and holds the requests for hold until they are canceled
+type pageTransport struct {
+	next       http.RoundTripper
+	fail, hold string
+}
+
+func (t *pageTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	switch req.URL.Query().Get("page") {
+	case t.fail:
+		return nil, errors.New("connection reset")
+	case t.hold:
+		<-req.Context().Done()
+		return nil, req.Context().Err()
+	}
+	return t.next.RoundTrip(req)
+}
+
+func TestWikiClientReportCanceled(t *testing.T) {
+	c, _ := newWikiTestServer(t)
+	c.Client = &http.Client{Transport: &pageTransport{next: c.Client.Transport, fail: "Firmware/iPhone/17.x", hold: "Firmware/iPhone/16.x"}}
+
+	var buf bytes.Buffer
+	if _, err := c.GetIPSWs(&WikiConfig{IPSW: true, Device: "iPhone15,2", Workers: 2, ReportWriter: &buf}); err == nil {
+		t.Fatal("GetIPSWs() with a failing page succeeded")
+	}
+	var report WikiCrawlReport
+	if err := json.Unmarshal(buf.Bytes(), &report); err != nil {
+		t.Fatalf("report isn't JSON: %v\n%s", err, buf.String())
+	}
+	// the page canceled by the failure isn't an error of its own
+	if report.Errors != 1 || len(report.Pages) != 2 || len(report.Pages[0].Error) == 0 ||
+		!report.Pages[1].Canceled || len(report.Pages[1].Error) > 0 {
+		t.Errorf("report = %+v, want 1 error and the other page canceled", report)
+	}
+}
+
+func TestWikiClientLatestOTADelta(t *testing.T) {
+	c, _ := newWikiTestServerDir(t, "wiki_api_ota")
+
+	// 17.0.3 is newer but not for this device, and 17.1 is a delta from 17.0.2
+	ota, err := c.LatestOTADelta("iPhone15,2", "21A329")
+	if err != nil {
+		t.Fatalf("LatestOTADelta() error = %v", err)
+	}
+	if ota.Build != "21A350" || ota.Version != "17.0.2" || ota.PrerequisiteBuild != "21A329" {
+		t.Errorf("LatestOTADelta() = %s (%s) from %s, want 17.0.2 (21A350) from 21A329", ota.Version, ota.Build, ota.PrerequisiteBuild)
+	}
+	if ota, err := c.LatestOTADelta("iPhone15,2", "21A350"); err != nil || ota.Build != "21B74" {
+		t.Errorf("LatestOTADelta(21A350) = %v, %v, want 21B74", ota, err)
+	}
+	if _, err := c.LatestOTADelta("iPhone15,2", "21B74"); !errors.Is(err, ErrWikiNotFound) {
+		t.Errorf("LatestOTADelta(21B74) error = %v, want ErrWikiNotFound", err)
+	}
+}
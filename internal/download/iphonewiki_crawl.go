@@ -0,0 +1,241 @@
+package download
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/apex/log"
+	"golang.org/x/sync/errgroup"
+)
+
+// crawlWikiPages parses the firmware tables of the links under filter whose pages link to a wantExt file
+// (.ipsw or .zip); cfg.Workers pages are fetched at a time (retries are the client's RetryPolicy) and the
+// results keep the links' order. Only the firmwares matching cfg.Build are kept and, when it pins a major
+// version, the pages of a device family that haven't been fetched yet are skipped once one of them has a
+// match (see buildPinsPage). The outcome of every page is recorded in report.
+func crawlWikiPages(ctx context.Context, links []wikiLink, filter, wantExt string, cfg *WikiConfig, client *WikiClient, report *WikiCrawlReport) ([]WikiFirmware, error) {
+	results, err := crawlWikiPageResults(ctx, links, filter, wantExt, cfg, client, report)
+	if err != nil {
+		return nil, err
+	}
+	var fws []WikiFirmware
+	for _, r := range results {
+		fws = append(fws, r...)
+	}
+	return fws, nil
+}
+
+// crawlWikiPageResults is crawlWikiPages returning the firmwares of each page crawled (results[i] are the
+// firmwares of report.Pages[i])
+func crawlWikiPageResults(ctx context.Context, links []wikiLink, filter, wantExt string, cfg *WikiConfig, client *WikiClient, report *WikiCrawlReport) ([][]WikiFirmware, error) {
+	var pages []string
+	for _, link := range links {
+		if !strings.HasPrefix(link.Link, filter) {
+			continue
+		}
+		if strings.HasSuffix(link.Link, "iPod") || cfg.skipWikiPage(link.Link) { // skip weird info page (and other OS lineages)
+			continue
+		}
+		pages = append(pages, link.Link)
+	}
+	report.PagesDiscovered = len(pages)
+	if len(pages) == 0 {
+		var warning string
+		if parent, available := wikiAvailablePages(links, filter); len(available) > 0 {
+			warning = fmt.Sprintf("No wiki pages match '%s' (the pages under '%s' are: %s)", filter, parent, strings.Join(available, ", "))
+		} else {
+			warning = fmt.Sprintf("No wiki pages match '%s'", filter)
+		}
+		log.Warn(warning)
+		report.Warnings = append(report.Warnings, warning)
+		return nil, nil
+	}
+
+	results := make([][]WikiFirmware, len(pages))
+	report.Pages = make([]WikiPageReport, len(pages))
+
+	var (
+		mu    sync.Mutex
+		found = make(map[string]bool) // device families (i.e. Firmware/iPhone) with a page matching cfg.Build
+	)
+	pinned := cfg.buildPinsPage()
+
+	g, ctx := errgroup.WithContext(ctx)
+	g.SetLimit(max(cfg.Workers, 1))
+	for i, page := range pages {
+		i, page := i, page
+		report.Pages[i].Page = page
+		g.Go(func() error {
+			family := wikiPageFamily(page)
+			if pinned {
+				mu.Lock()
+				skip := found[family]
+				mu.Unlock()
+				if skip {
+					log.Debugf("Skipping wiki page '%s': build %s was found on another %s page", page, cfg.Build, family)
+					return nil
+				}
+			}
+			fws, err := crawlWikiPage(ctx, page, wantExt, cfg.IncludeLangLinks, client, &report.Pages[i])
+			if err != nil && cfg.skipMissing && errors.Is(err, ErrWikiNotFound) { // a red link
+				warning := fmt.Sprintf("skipping wiki page '%s': %v", page, err)
+				log.Warn(warning)
+				report.Pages[i].Warnings = append(report.Pages[i].Warnings, warning)
+				return nil
+			}
+			if err != nil {
+				if errors.Is(err, context.Canceled) && ctx.Err() != nil {
+					// stopped because another page failed (or the crawl was canceled), not an error of its own
+					report.Pages[i].Canceled = true
+					return err
+				}
+				report.Pages[i].Error = err.Error()
+				return err
+			}
+			results[i] = cfg.filterWikiBuild(cfg.filterWikiOS(page, fws))
+			if pinned && len(results[i]) > 0 {
+				mu.Lock()
+				found[family] = true
+				mu.Unlock()
+			}
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// crawlWikiPage parses the firmware table of page if it links to a wantExt file (recording what it did in report);
+// with langLinks the firmwares only listed by the page's localized versions are added
+func crawlWikiPage(ctx context.Context, page, wantExt string, langLinks bool, client *WikiClient, report *WikiPageReport) ([]WikiFirmware, error) {
+	log.Debugf("Parsing wiki page: '%s'", page)
+
+	report.Fetched = true
+	wpage, err := client.getWikiPage(ctx, page)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse page %s: %w", page, err)
+	}
+	if !wikiLinksFirmware(wpage.Parse.ExternalLinks, wantExt) {
+		return nil, nil
+	}
+
+	wtable, err := client.getWikiTable(ctx, page)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse wikitable for %s: %w", page, err)
+	}
+	report.RevisionID = wtable.Parse.RevID
+	// parse the wikitable
+	fws, err := parseWikiTable(wtable.Parse.WikiText.Text)
+	if err != nil {
+		var perr *WikiParseError
+		if errors.As(err, &perr) {
+			perr.Page = page
+		}
+		return nil, fmt.Errorf("failed to parse wikitable: %w", err)
+	}
+	// rows linking another kind of file (i.e. an IPSW listed on an OTA page) belong to the other crawl
+	fws = slices.DeleteFunc(fws, func(fw WikiFirmware) bool {
+		return !wikiFirmwareLink(fw.URL, wantExt)
+	})
+	if langLinks {
+		fws = append(fws, crawlWikiLangLinks(ctx, wpage.Parse.LangLinks, wantExt, fws, client, report)...)
+	}
+	report.Parsed = true
+	report.Firmwares = len(fws)
+	if len(fws) == 0 {
+		report.Warnings = append(report.Warnings, fmt.Sprintf("no firmwares with a %s URL in the page's tables", wantExt))
+	}
+	return fws, nil
+}
+
+// crawlWikiLangLinks returns the firmwares of the localized pages links that aren't in fws (matched on their
+// download URL); a localized page that fails is only warned about
+func crawlWikiLangLinks(ctx context.Context, links []wikiLangLink, wantExt string, fws []WikiFirmware, client *WikiClient, report *WikiPageReport) []WikiFirmware {
+	seen := make(map[string]bool)
+	for _, fw := range fws {
+		seen[fw.URL] = true
+	}
+
+	var extra []WikiFirmware
+	for _, ll := range links {
+		lfws, err := crawlWikiLangLink(ctx, ll, client)
+		if err != nil {
+			warning := fmt.Sprintf("skipping the %s version of the page (%s): %v", ll.Lang, ll.Title, err)
+			log.Warn(warning)
+			report.Warnings = append(report.Warnings, warning)
+			continue
+		}
+		for _, fw := range lfws {
+			if wikiFirmwareLink(fw.URL, wantExt) && !seen[fw.URL] {
+				seen[fw.URL] = true
+				extra = append(extra, fw)
+			}
+		}
+	}
+	return extra
+}
+
+// crawlWikiLangLink parses the firmware table of the localized page ll links to
+func crawlWikiLangLink(ctx context.Context, ll wikiLangLink, client *WikiClient) ([]WikiFirmware, error) {
+	log.Debugf("Parsing %s wiki page: '%s'", ll.Lang, ll.Title)
+
+	lc, err := client.langClient(ll)
+	if err != nil {
+		return nil, err
+	}
+	wtable, err := lc.getWikiTable(ctx, ll.Title)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse wikitable for %s: %w", ll.Title, err)
+	}
+	fws, err := parseWikiTable(wtable.Parse.WikiText.Text)
+	if err != nil {
+		var perr *WikiParseError
+		if errors.As(err, &perr) {
+			perr.Page = ll.Title
+		}
+		return nil, fmt.Errorf("failed to parse wikitable: %w", err)
+	}
+	return fws, nil
+}
+
+// wikiFirmwareLink reports whether link downloads an ext file (i.e. ".ipsw"): ext must end the link's path so a
+// link that only mentions it (i.e. a support article about .ipsw files) doesn't count
+func wikiFirmwareLink(link, ext string) bool {
+	u, err := url.Parse(link)
+	if err != nil || len(u.Host) == 0 {
+		return false
+	}
+	return strings.HasSuffix(strings.ToLower(u.Path), strings.ToLower(ext))
+}
+
+// wikiLinksFirmware reports whether any of a page's external links downloads an ext file
+func wikiLinksFirmware(links []string, ext string) bool {
+	return slices.ContainsFunc(links, func(link string) bool {
+		return wikiFirmwareLink(link, ext)
+	})
+}
+
+// wikiAvailablePages returns the parent of filter (i.e. Firmware/iPhone/ for Firmware/iPhone/16.x) and the
+// suffixes of the links under it, so an empty result can say which pages (i.e. versions) do exist
+func wikiAvailablePages(links []wikiLink, filter string) (string, []string) {
+	parent := strings.TrimSuffix(filter, "/")
+	if i := strings.LastIndex(parent, "/"); i >= 0 {
+		parent = parent[:i+1]
+	} else {
+		parent += "/"
+	}
+	var available []string
+	for _, link := range links {
+		if suffix, ok := strings.CutPrefix(link.Link, parent); ok && len(suffix) > 0 && !slices.Contains(available, suffix) {
+			available = append(available, suffix)
+		}
+	}
+	return parent, available
+}
@@ -0,0 +1,163 @@
+package download
+
+import (
+	"context"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestCrawlWikiPages(t *testing.T) {
+	links := []wikiLink{
+		{Link: "Firmware/iPhone/17.x"},
+		{Link: "Firmware/iPhone/16.x"},
+		{Link: "Firmware/iPad/17.x"},
+		{Link: "Firmware/iPod"},
+		{Link: "Beta Firmware/iPhone/17.x"},
+	}
+
+	c, requests := newWikiTestServer(t)
+	fws, err := crawlWikiPages(context.Background(), links, "Firmware/", ".ipsw", &WikiConfig{Workers: 4}, c, newWikiCrawlReport("ipsw", "Firmware/"))
+	if err != nil {
+		t.Fatalf("crawlWikiPages() error = %v", err)
+	}
+	var got []string
+	for _, fw := range fws {
+		got = append(got, strings.Join(fw.Devices, ","))
+	}
+	if want := []string{"iPhone15,2", "iPad13,18"}; !reflect.DeepEqual(got, want) { // in link order
+		t.Errorf("crawlWikiPages() = %v, want %v", got, want)
+	}
+	reqs := requests()
+	slices.Sort(reqs)
+	want := []string{"Firmware_iPad_17.x", "Firmware_iPad_17.x.wikitext", "Firmware_iPhone_16.x", "Firmware_iPhone_17.x", "Firmware_iPhone_17.x.wikitext"}
+	if !reflect.DeepEqual(reqs, want) {
+		t.Errorf("requests = %v, want %v", reqs, want)
+	}
+
+	// the OTA path gates on .zip links (none of these pages have one)
+	c, requests = newWikiTestServer(t)
+	fws, err = crawlWikiPages(context.Background(), links, "Firmware/", ".zip", &WikiConfig{}, c, newWikiCrawlReport("ota", "Firmware/"))
+	if err != nil || len(fws) != 0 {
+		t.Errorf("crawlWikiPages(.zip) = %v, %v; want nothing", fws, err)
+	}
+	for _, r := range requests() {
+		if strings.HasSuffix(r, ".wikitext") {
+			t.Errorf("crawlWikiPages(.zip) fetched %s", r)
+		}
+	}
+
+	// a failed page fails the crawl
+	c, _ = newWikiTestServer(t)
+	if fws, err := crawlWikiPages(context.Background(), append(links, wikiLink{Link: "Firmware/iPhone/1.x"}), "Firmware/", ".ipsw", &WikiConfig{Workers: 2}, c, newWikiCrawlReport("ipsw", "Firmware/")); err == nil || fws != nil {
+		t.Errorf("crawlWikiPages() with a missing page = %v, %v; want only an error", fws, err)
+	}
+
+	// unless missing pages (red links) are skipped
+	c, _ = newWikiTestServer(t)
+	report := newWikiCrawlReport("ipsw", "Firmware/")
+	results, err := crawlWikiPageResults(context.Background(), append(links, wikiLink{Link: "Firmware/iPhone/1.x"}), "Firmware/", ".ipsw", &WikiConfig{skipMissing: true}, c, report)
+	if err != nil || len(results) != len(report.Pages) {
+		t.Fatalf("crawlWikiPageResults() with a skipped missing page = %v, %v", results, err)
+	}
+	if last := report.Pages[len(report.Pages)-1]; len(results[len(results)-1]) != 0 || len(last.Error) > 0 || len(last.Warnings) != 1 {
+		t.Errorf("missing page report = %+v, want a warning", last)
+	}
+}
+
+func TestWikiAvailablePages(t *testing.T) {
+	links := []wikiLink{
+		{Link: "Firmware/iPhone/17.x"},
+		{Link: "Firmware/iPhone/16.x"},
+		{Link: "Firmware/iPad/17.x"},
+		{Link: "Firmware/iPhone/17.x"},
+	}
+	for _, tt := range []struct {
+		filter string
+		parent string
+		want   []string
+	}{
+		{"Firmware/iPhone/15.x", "Firmware/iPhone/", []string{"17.x", "16.x"}},
+		{"Firmware/Apple Watch", "Firmware/", []string{"iPhone/17.x", "iPhone/16.x", "iPad/17.x"}},
+		{"OTA Updates/iPhone/17.x", "OTA Updates/iPhone/", nil},
+	} {
+		parent, got := wikiAvailablePages(links, tt.filter)
+		if parent != tt.parent || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("wikiAvailablePages(%s) = %s, %v; want %s, %v", tt.filter, parent, got, tt.parent, tt.want)
+		}
+	}
+
+	// no matching pages is an empty result (with the diagnostics logged), not an error
+	c, requests := newWikiTestServer(t)
+	fws, err := crawlWikiPages(context.Background(), links, "Firmware/iPhone/15.x", ".ipsw", &WikiConfig{}, c, newWikiCrawlReport("ipsw", "Firmware/iPhone/15.x"))
+	if err != nil || len(fws) != 0 || len(requests()) != 0 {
+		t.Errorf("crawlWikiPages(no matches) = %v, %v with requests %v", fws, err, requests())
+	}
+}
+
+func TestWikiLinksFirmware(t *testing.T) {
+	for _, tt := range []struct {
+		links []string
+		ext   string
+		want  bool
+	}{
+		{[]string{"https://updates.cdn-apple.com/2023FallFCS/fullrestores/042-43728/iPhone15,2_17.0_21A329_Restore.ipsw"}, ".ipsw", true},
+		{[]string{"http://appldnld.apple.com/ios10.0/031-64655-20160705-A371AD14/com_apple_MobileAsset_SoftwareUpdate/1a7b.zip"}, ".zip", true},
+		{[]string{"https://updates.cdn-apple.com/2023FallFCS/patches/a.ZIP?dl=1#top"}, ".zip", true},
+		// links that only mention the extension aren't downloads
+		{[]string{"https://support.apple.com/en-us/HT201442?file=.ipsw", "https://example.com/what-is-an-.ipsw-file"}, ".ipsw", false},
+		{[]string{"https://www.theiphonewiki.com/wiki/IPSW_File_Format#.ipsw"}, ".ipsw", false},
+		{[]string{"/wiki/Restore.ipsw"}, ".ipsw", false},
+		// an IPSW doc link on an OTA page doesn't make it an IPSW page
+		{[]string{"https://updates.cdn-apple.com/ota/a.zip", "https://support.apple.com/downloads/Restore.ipsw.html"}, ".ipsw", false},
+		{nil, ".zip", false},
+	} {
+		if got := wikiLinksFirmware(tt.links, tt.ext); got != tt.want {
+			t.Errorf("wikiLinksFirmware(%v, %s) = %t, want %t", tt.links, tt.ext, got, tt.want)
+		}
+	}
+}
+
+func TestFilterWikiBuild(t *testing.T) {
+	fws := []WikiFirmware{{Build: "20B82"}, {Build: "20B101"}, {Build: "20B110"}, {Build: "20C65"}}
+	var got []string
+	for _, fw := range (&WikiConfig{Build: "20b"}).filterWikiBuild(fws) {
+		got = append(got, fw.Build)
+	}
+	if want := []string{"20B82", "20B101", "20B110"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("filterWikiBuild(20b) = %v, want %v", got, want)
+	}
+	if got := (&WikiConfig{}).filterWikiBuild(fws); len(got) != len(fws) {
+		t.Errorf("filterWikiBuild() = %v, want every firmware", got)
+	}
+
+	// a row with a build per device matches the build of the device asked for (or of any device)
+	multi := WikiFirmware{Build: "20A362", Builds: []string{"20A362", "20A371"},
+		Devices: []string{"iPhone14,7", "iPhone14,8"}, DeviceBuilds: map[string]string{"iPhone14,7": "20A362", "iPhone14,8": "20A371"}}
+	for _, tt := range []struct {
+		device, build string
+		want          bool
+	}{
+		{"iPhone14,8", "20a371", true},
+		{"iPhone14,8", "20A362", false},
+		{"iPhone14,7", "20A362", true},
+		{"", "20A371", true},
+		{"", "20B", false},
+	} {
+		if got := multi.MatchesBuild(tt.device, tt.build); got != tt.want {
+			t.Errorf("MatchesBuild(%q, %q) = %t, want %t", tt.device, tt.build, got, tt.want)
+		}
+	}
+
+	for page, want := range map[string]string{
+		"Firmware/iPhone/16.x":        "Firmware/iPhone",
+		"Firmware/iPad Air/13.x":      "Firmware/iPad Air",
+		"Firmware/iPad":               "Firmware/iPad",
+		"OTA Updates/Apple Watch/9.x": "OTA Updates/Apple Watch",
+	} {
+		if got := wikiPageFamily(page); got != want {
+			t.Errorf("wikiPageFamily(%s) = %s, want %s", page, got, want)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package download
+
+import "sort"
+
+// DeviceCoverageDiff compares the union of devices supported by old and new and returns the
+// devices that only appear in new (newly supported) and those that only appear in old (dropped)
+func DeviceCoverageDiff(old, new []WikiFirmware) (newlySupported, dropped []string) {
+	oldDevs := wikiDeviceSet(old)
+	newDevs := wikiDeviceSet(new)
+
+	for dev := range newDevs {
+		if _, ok := oldDevs[dev]; !ok {
+			newlySupported = append(newlySupported, dev)
+		}
+	}
+	for dev := range oldDevs {
+		if _, ok := newDevs[dev]; !ok {
+			dropped = append(dropped, dev)
+		}
+	}
+
+	sort.Strings(newlySupported)
+	sort.Strings(dropped)
+
+	return newlySupported, dropped
+}
+
+func wikiDeviceSet(fws []WikiFirmware) map[string]struct{} {
+	devs := make(map[string]struct{})
+	for _, fw := range fws {
+		for _, dev := range fw.Devices {
+			if len(dev) > 0 {
+				devs[dev] = struct{}{}
+			}
+		}
+	}
+	return devs
+}
@@ -0,0 +1,116 @@
+package download
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/apex/log"
+)
+
+// ErrWikiVerify is returned by WikiFirmware.Download when the download doesn't match the wiki's size/hashes
+var ErrWikiVerify = errors.New("downloaded firmware does not match the wiki")
+
+type wikiDownloadConfig struct {
+	progress func(written, total int64)
+	timeout  time.Duration
+}
+
+// WikiDownloadOption is an option for WikiFirmware.Download
+type WikiDownloadOption func(*wikiDownloadConfig)
+
+// WithWikiDownloadProgress reports the bytes written so far (resumed bytes included) and the total
+// (0 if the server doesn't send a length) as the firmware downloads
+func WithWikiDownloadProgress(fn func(written, total int64)) WikiDownloadOption {
+	return func(c *wikiDownloadConfig) {
+		c.progress = fn
+	}
+}
+
+// WithWikiDownloadTimeout bounds the wait for the server to respond (but not the transfer itself)
+func WithWikiDownloadTimeout(timeout time.Duration) WikiDownloadOption {
+	return func(c *wikiDownloadConfig) {
+		c.timeout = timeout
+	}
+}
+
+// wikiProgress adapts a WithWikiDownloadProgress callback to a utils.ProgressReporter
+type wikiProgress struct {
+	fn             func(written, total int64)
+	written, total int64
+}
+
+func (p *wikiProgress) Start(total int64) { p.written, p.total = 0, max(total, 0) }
+func (p *wikiProgress) Add(n int64)       { p.written += n; p.fn(p.written, p.total) }
+func (p *wikiProgress) Finish()           {}
+
+// Download downloads the firmware's URL to dest (resuming a partial dest.download) and verifies it against the
+// wiki's file size and hashes, downloading it again once if it doesn't match; a dest that already matches isn't
+// downloaded again. Firmwares without a size or hash on the wiki are only downloaded.
+func (fw WikiFirmware) Download(ctx context.Context, dest, proxy string, insecure bool, opts ...WikiDownloadOption) error {
+	var conf wikiDownloadConfig
+	for _, opt := range opts {
+		opt(&conf)
+	}
+
+	if len(fw.URL) == 0 {
+		return fmt.Errorf("no download URL listed on the wiki for %s (%s)", fw.Version, fw.Build)
+	}
+	if err := fw.VerifyFile(dest); err == nil {
+		log.Debugf("%s already downloaded", dest)
+		return nil
+	}
+
+	var err error
+	for attempt := 0; attempt < 2; attempt++ {
+		if attempt > 0 {
+			log.WithError(err).Warnf("Downloading %s again", fw.URL)
+			if err := os.Remove(dest); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("failed to remove bad download: %w", err)
+			}
+		}
+		// the wiki's hashes are checked below (with the size) so the downloader doesn't check its sha1
+		d, derr := NewDownload(proxy, insecure, false, true, false, true, false, conf.timeout)
+		if derr != nil {
+			return derr
+		}
+		d.URL = fw.URL
+		d.DestName = dest
+		if conf.progress != nil {
+			d.Progress = &wikiProgress{fn: conf.progress}
+		}
+		if derr := d.DoContext(ctx); derr != nil {
+			return fmt.Errorf("failed to download %s: %w", fw.URL, derr)
+		}
+		if err = fw.VerifyFile(dest); err == nil || !errors.Is(err, ErrWikiVerify) {
+			return err
+		}
+	}
+	return err
+}
+
+// VerifyFile checks that path holds the firmware: its size and hashes (the ones the wiki lists) must match.
+// Mismatches are ErrWikiVerify errors
+func (fw WikiFirmware) VerifyFile(path string) error {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if fw.FileSize > 0 && fi.Size() != int64(fw.FileSize) {
+		return fmt.Errorf("%w: %s is %d bytes (expected %d)", ErrWikiVerify, path, fi.Size(), fw.FileSize)
+	}
+	if len(fw.Checksums()) == 0 {
+		return nil
+	}
+	results, err := fw.Verify(path)
+	if err != nil {
+		return err
+	}
+	if !results.OK() {
+		bad := results.Mismatches()[0]
+		return fmt.Errorf("%w: %s %s is %s (expected %s)", ErrWikiVerify, path, bad.Algorithm, bad.Actual, bad.Expected)
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package download
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWikiFirmwareDownload(t *testing.T) {
+	data := bytes.Repeat([]byte("ipsw"), 1024)
+	sum := sha1.Sum(data)
+
+	var gets, corrupt atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := data
+		if r.Method == http.MethodGet {
+			gets.Add(1)
+			if corrupt.Add(-1) >= 0 { // flip a byte of the next corrupt.Load() downloads
+				body = bytes.Clone(data)
+				body[100] ^= 0xff
+			}
+		}
+		http.ServeContent(w, r, "fw.ipsw", time.Time{}, bytes.NewReader(body))
+	}))
+	defer srv.Close()
+
+	fw := WikiFirmware{Version: "17.0", Build: "21A329", URL: srv.URL + "/fw.ipsw", Sha1Hash: hex.EncodeToString(sum[:]), FileSize: len(data)}
+	dest := filepath.Join(t.TempDir(), "fw.ipsw")
+
+	// a corrupt download is downloaded again once
+	corrupt.Store(1)
+	var written, total int64
+	err := fw.Download(context.Background(), dest, "", false, WithWikiDownloadProgress(func(w, t int64) { written, total = w, t }))
+	if err != nil {
+		t.Fatalf("Download() error = %v", err)
+	}
+	if got := gets.Load(); got != 2 {
+		t.Errorf("GET requests = %d, want 2", got)
+	}
+	if written != int64(len(data)) || total != int64(len(data)) {
+		t.Errorf("progress = %d/%d, want %d/%d", written, total, len(data), len(data))
+	}
+	if got, _ := os.ReadFile(dest); !bytes.Equal(got, data) {
+		t.Error("Download() wrote a corrupt file")
+	}
+
+	// an intact dest isn't downloaded again
+	if err := fw.Download(context.Background(), dest, "", false); err != nil || gets.Load() != 2 {
+		t.Errorf("Download(existing) = %v after %d GETs, want nil after 2", err, gets.Load())
+	}
+
+	// two corrupt downloads fail
+	os.Remove(dest)
+	corrupt.Store(2)
+	if err := fw.Download(context.Background(), dest, "", false); !errors.Is(err, ErrWikiVerify) {
+		t.Errorf("Download(corrupt) error = %v, want ErrWikiVerify", err)
+	}
+
+	// a size mismatch without a hash
+	fw.Sha1Hash, fw.FileSize = "", len(data)+1
+	if err := fw.VerifyFile(dest); !errors.Is(err, ErrWikiVerify) {
+		t.Errorf("VerifyFile(size) error = %v, want ErrWikiVerify", err)
+	}
+}
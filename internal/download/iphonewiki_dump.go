@@ -0,0 +1,151 @@
+package download
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// WikiFamilies are the product families that have their own firmware pages on the wiki
+var WikiFamilies = []string{appleTV, appleWatch, homePod, ibridge, ipad, iphone, ipodTouch, macOS}
+
+// WikiDumpConfig is the config for DumpWiki
+type WikiDumpConfig struct {
+	Families  []string // product families to dump (all WikiFamilies if empty)
+	OTA       bool     // dump OTA tables instead of IPSW tables
+	Beta      bool
+	SortOrder WikiSortOrder
+}
+
+// WikiDumpPage is a wiki page a dump was generated from
+type WikiDumpPage struct {
+	Title      string `json:"title"`
+	RevisionID int    `json:"revid"`
+	Count      int    `json:"count"`
+}
+
+// WikiDump is a self-contained export of the wiki firmware tables
+type WikiDump struct {
+	GeneratedAt time.Time      `json:"generated_at"`
+	Source      string         `json:"source"`
+	Index       string         `json:"index"`
+	Families    []string       `json:"families"`
+	Pages       []WikiDumpPage `json:"pages"`
+	Firmwares   []WikiFirmware `json:"firmwares"`
+}
+
+// DumpWiki parses every firmware table for the given product families
+func DumpWiki(cfg *WikiDumpConfig, proxy string, insecure bool) (*WikiDump, error) {
+	return DumpWikiWithConfig(cfg, legacyDownloadConfig(proxy, insecure))
+}
+
+// DumpWikiWithConfig is DumpWiki using the network settings in dl
+func DumpWikiWithConfig(cfg *WikiDumpConfig, dl *DownloadConfig) (*WikiDump, error) {
+	c, err := NewWikiClient(dl)
+	if err != nil {
+		return nil, err
+	}
+	return c.Dump(cfg)
+}
+
+// Dump parses every firmware table for the given product families
+func (c *WikiClient) Dump(cfg *WikiDumpConfig) (*WikiDump, error) {
+	if err := cfg.SortOrder.validate(); err != nil {
+		return nil, err
+	}
+
+	var families []string
+	for _, fam := range cfg.Families {
+		found := false
+		for _, wf := range WikiFamilies {
+			if strings.EqualFold(fam, wf) {
+				families = append(families, wf)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown wiki product family '%s' (expected one of: %s)", fam, strings.Join(WikiFamilies, ", "))
+		}
+	}
+	if len(families) == 0 {
+		families = WikiFamilies
+	}
+
+	index := ipswPage
+	fileExt := ".ipsw"
+	if cfg.OTA {
+		index = otaPage
+		fileExt = ".zip"
+	}
+	if cfg.Beta {
+		index = "Beta " + index
+	}
+
+	dump := &WikiDump{
+		GeneratedAt: time.Now().UTC(),
+		Source:      c.BaseURL,
+		Index:       index,
+		Families:    families,
+	}
+
+	kind := "ipsw"
+	if cfg.OTA {
+		kind = "ota"
+	}
+	report := newWikiCrawlReport(kind, index+"/")
+	ctx := report.context(context.Background())
+
+	idx, err := c.getWikiLinks(ctx, index)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get wiki index page %s: %w", index, err)
+	}
+	var links []wikiLink
+	for _, link := range idx.Parse.Links {
+		if strings.HasPrefix(link.Link, index+"/") && wikiLinkInFamilies(strings.TrimPrefix(link.Link, index+"/"), families) {
+			links = append(links, link)
+		}
+	}
+
+	// red links on the index page are skipped
+	results, err := crawlWikiPageResults(ctx, links, index+"/", fileExt, &WikiConfig{skipMissing: true}, c, report)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	for i, fws := range results {
+		if !report.Pages[i].Parsed {
+			continue
+		}
+		page := WikiDumpPage{Title: report.Pages[i].Page, RevisionID: report.Pages[i].RevisionID}
+		for _, fw := range fws {
+			if len(fw.URL) > 0 {
+				if seen[fw.URL] {
+					continue
+				}
+				seen[fw.URL] = true
+			}
+			dump.Firmwares = append(dump.Firmwares, fw)
+			page.Count++
+		}
+		dump.Pages = append(dump.Pages, page)
+	}
+
+	SortWikiFirmwares(dump.Firmwares, cfg.SortOrder)
+
+	return dump, nil
+}
+
+// wikiLinkInFamilies checks if a wiki sub-page (e.g. "iPad Air/17.x") belongs to one of the families
+func wikiLinkInFamilies(subpage string, families []string) bool {
+	fam, _, _ := strings.Cut(subpage, "/")
+	for _, f := range families {
+		// "iPad" also covers the "iPad Air", "iPad mini" and "iPad Pro" pages
+		if fam == f || strings.HasPrefix(fam, f+" ") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,46 @@
+package download
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestWikiClientDump(t *testing.T) {
+	c, requests := newWikiTestServer(t)
+
+	dump, err := c.Dump(&WikiDumpConfig{Families: []string{"iphone", "iPad"}, SortOrder: WikiSortNewest})
+	if err != nil {
+		t.Fatalf("Dump() error = %v", err)
+	}
+	if want := []string{iphone, ipad}; !reflect.DeepEqual(dump.Families, want) {
+		t.Errorf("Dump() families = %v, want %v", dump.Families, want)
+	}
+	// only the pages with firmware links are listed
+	wantPages := []WikiDumpPage{
+		{Title: "Firmware/iPhone/17.x", RevisionID: 4242, Count: 1},
+		{Title: "Firmware/iPad/17.x", Count: 1},
+	}
+	if !reflect.DeepEqual(dump.Pages, wantPages) {
+		t.Errorf("Dump() pages = %+v, want %+v", dump.Pages, wantPages)
+	}
+	var got []string
+	for _, fw := range dump.Firmwares {
+		got = append(got, fw.Build+"/"+fw.Devices[0])
+	}
+	if want := []string{"21A329/iPhone15,2", "21A329/iPad13,18"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Dump() firmwares = %v, want %v", got, want)
+	}
+	want := []string{
+		"Firmware.links",
+		"Firmware_iPhone_17.x", "Firmware_iPhone_17.x.wikitext",
+		"Firmware_iPhone_16.x",
+		"Firmware_iPad_17.x", "Firmware_iPad_17.x.wikitext",
+	}
+	if got := requests(); !reflect.DeepEqual(got, want) {
+		t.Errorf("requests = %v, want %v", got, want)
+	}
+
+	if _, err := c.Dump(&WikiDumpConfig{Families: []string{"Vision Pro"}}); err == nil {
+		t.Error("Dump() with an unknown family = nil error")
+	}
+}
@@ -0,0 +1,83 @@
+package download
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+var (
+	// ErrWikiNetwork is returned when a request to the wiki API fails to complete
+	ErrWikiNetwork = errors.New("wiki network error")
+	// ErrWikiNotFound is returned when the requested wiki page (or firmware) does not exist
+	ErrWikiNotFound = errors.New("wiki page not found")
+	// ErrWikiParse is returned (wrapped in a WikiParseError) when a wiki page's wikitext can't be parsed
+	ErrWikiParse = errors.New("wiki parse error")
+	// ErrWikiRateLimited is returned when the wiki API throttles our requests
+	ErrWikiRateLimited = errors.New("wiki rate limited")
+	// ErrWikiUnknownDevice is returned when a device isn't in the device DB or isn't in a family the wiki has
+	// firmware pages for
+	ErrWikiUnknownDevice = errors.New("no wiki firmware pages for device")
+	// ErrWikiKBAGOnly is returned when the wiki lists only a component's KBAG (its IV/key wrapped by the
+	// device's GID key), which is all there is for most modern devices
+	ErrWikiKBAGOnly = errors.New("no decrypted keys on the wiki")
+)
+
+// WikiParseError is returned when a wikitable fails to parse
+type WikiParseError struct {
+	Page string
+	Line int
+	Msg  string
+	Err  error
+}
+
+func (e *WikiParseError) Error() string {
+	msg := e.Msg
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	if e.Line > 0 {
+		msg = fmt.Sprintf("line %d: %s", e.Line, msg)
+	}
+	if len(e.Page) > 0 {
+		msg = fmt.Sprintf("page '%s': %s", e.Page, msg)
+	}
+	return fmt.Sprintf("%s: %s", ErrWikiParse, msg)
+}
+
+// Unwrap allows errors.Is(err, ErrWikiParse) as well as matching the underlying cause
+func (e *WikiParseError) Unwrap() []error {
+	if e.Err != nil {
+		return []error{ErrWikiParse, e.Err}
+	}
+	return []error{ErrWikiParse}
+}
+
+// wikiAPIError is the error object the MediaWiki API returns (with a 200 OK status)
+type wikiAPIError struct {
+	Code string `json:"code,omitempty"`
+	Info string `json:"info,omitempty"`
+}
+
+func (e *wikiAPIError) toError() error {
+	switch e.Code {
+	case "missingtitle", "invalidtitle", "nosuchpageid", "nosuchrevid":
+		return fmt.Errorf("%w: %s", ErrWikiNotFound, e.Info)
+	case "ratelimited", "maxlag":
+		return fmt.Errorf("%w: %s", ErrWikiRateLimited, e.Info)
+	default:
+		return fmt.Errorf("wiki API error '%s': %s", e.Code, e.Info)
+	}
+}
+
+// wikiStatusError converts a non-OK HTTP response from the wiki into a typed error
+func wikiStatusError(resp *http.Response) error {
+	switch resp.StatusCode {
+	case http.StatusNotFound, http.StatusGone:
+		return fmt.Errorf("%w: %s", ErrWikiNotFound, resp.Status)
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		return fmt.Errorf("%w: %s", ErrWikiRateLimited, resp.Status)
+	default:
+		return fmt.Errorf("%w: failed to get response: %s", ErrWikiNetwork, resp.Status)
+	}
+}
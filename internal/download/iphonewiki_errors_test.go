@@ -0,0 +1,60 @@
+package download
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestWikiAPIErrors(t *testing.T) {
+	for code, want := range map[string]error{
+		"missingtitle": ErrWikiNotFound,
+		"invalidtitle": ErrWikiNotFound,
+		"nosuchpageid": ErrWikiNotFound,
+		"nosuchrevid":  ErrWikiNotFound,
+		"ratelimited":  ErrWikiRateLimited,
+		"maxlag":       ErrWikiRateLimited,
+	} {
+		if err := (&wikiAPIError{Code: code, Info: "info"}).toError(); !errors.Is(err, want) {
+			t.Errorf("toError(%s) = %v, want %v", code, err, want)
+		}
+	}
+	for status, want := range map[int]error{
+		http.StatusNotFound:            ErrWikiNotFound,
+		http.StatusGone:                ErrWikiNotFound,
+		http.StatusTooManyRequests:     ErrWikiRateLimited,
+		http.StatusServiceUnavailable:  ErrWikiRateLimited,
+		http.StatusInternalServerError: ErrWikiNetwork,
+	} {
+		if err := wikiStatusError(&http.Response{StatusCode: status, Status: http.StatusText(status)}); !errors.Is(err, want) {
+			t.Errorf("wikiStatusError(%d) = %v, want %v", status, err, want)
+		}
+	}
+}
+
+func TestWikiClientTypedErrors(t *testing.T) {
+	c, _ := newWikiTestServerDir(t, "wiki_api_errors")
+
+	// a firmware table that doesn't parse is a WikiParseError naming the page and line
+	_, err := c.GetIPSWs(&WikiConfig{IPSW: true, Device: "iPhone15,2"})
+	var perr *WikiParseError
+	if !errors.Is(err, ErrWikiParse) || !errors.As(err, &perr) || perr.Page != "Firmware/iPhone/17.x" || perr.Line != 2 {
+		t.Errorf("GetIPSWs() error = %v, want an ErrWikiParse on line 2 of Firmware/iPhone/17.x", err)
+	}
+
+	// API error codes
+	if _, err := c.GetOTAs(&WikiConfig{OTA: true, Device: "iPhone15,2"}); !errors.Is(err, ErrWikiRateLimited) {
+		t.Errorf("GetOTAs() error = %v, want ErrWikiRateLimited", err)
+	}
+	_, err = c.GetOTAs(&WikiConfig{OTA: true, Beta: true, Device: "iPhone15,2"})
+	for _, typed := range []error{ErrWikiNotFound, ErrWikiRateLimited, ErrWikiNetwork, ErrWikiParse} {
+		if err == nil || errors.Is(err, typed) {
+			t.Errorf("GetOTAs(beta) error = %v, want an untyped API error", err)
+		}
+	}
+
+	// a missing page
+	if _, err := c.GetFirmware("iPhone15,2", "20G75"); !errors.Is(err, ErrWikiNotFound) {
+		t.Errorf("GetFirmware() error = %v, want ErrWikiNotFound", err)
+	}
+}
@@ -0,0 +1,132 @@
+package download
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"text/tabwriter"
+	"text/template"
+	"time"
+)
+
+// WikiFormat prints firmwares with a Go template evaluated per firmware (i.e. "{{.Build}}\t{{join .Devices \",\"}}")
+type WikiFormat struct {
+	tmpl *template.Template
+}
+
+// NewWikiFormat parses text as a Go template over the WikiFirmware fields (see WikiFormatHelp); the \n and \t
+// escapes outside of {{…}} actions are expanded (for shells that pass them through) and each firmware's output
+// ends with a newline
+func NewWikiFormat(text string) (*WikiFormat, error) {
+	text = expandWikiFormatEscapes(text)
+	tmpl, err := template.New("format").Option("missingkey=error").Funcs(wikiTemplateFuncs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse format template: %w", err)
+	}
+	return &WikiFormat{tmpl: tmpl}, nil
+}
+
+// expandWikiFormatEscapes expands the \n and \t escapes in the text of a template but not in its actions,
+// where they are already string literal escapes (i.e. {{"\n"}})
+func expandWikiFormatEscapes(text string) string {
+	escapes := strings.NewReplacer(`\n`, "\n", `\t`, "\t")
+	var sb strings.Builder
+	for {
+		start := strings.Index(text, "{{")
+		if start < 0 {
+			sb.WriteString(escapes.Replace(text))
+			return sb.String()
+		}
+		sb.WriteString(escapes.Replace(text[:start]))
+		text = text[start:]
+		// the action ends at the first }} that isn't in a quoted string (an unterminated one is left to the parser)
+		end := len(text)
+		var quote byte
+	scan:
+		for i := 2; i < len(text); i++ {
+			switch c := text[i]; {
+			case quote != 0 && quote != '`' && c == '\\':
+				i++ // skip the escaped character
+			case quote != 0:
+				if c == quote {
+					quote = 0
+				}
+			case c == '"' || c == '`' || c == '\'':
+				quote = c
+			case strings.HasPrefix(text[i:], "}}"):
+				end = i + 2
+				break scan
+			}
+		}
+		sb.WriteString(text[:end])
+		text = text[end:]
+	}
+}
+
+// Execute writes the template's output for each firmware in fws to w
+func (f *WikiFormat) Execute(w io.Writer, fws []WikiFirmware) error {
+	var buf bytes.Buffer
+	for _, fw := range fws {
+		buf.Reset()
+		if err := f.tmpl.Execute(&buf, fw); err != nil {
+			return fmt.Errorf("failed to execute format template for %s %s: %w", fw.Version, fw.Build, err)
+		}
+		if !bytes.HasSuffix(buf.Bytes(), []byte("\n")) {
+			buf.WriteByte('\n')
+		}
+		if _, err := w.Write(buf.Bytes()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WikiFormatHelp describes the fields (with their JSON keys) and the functions available to a WikiFormat template
+func WikiFormatHelp() string {
+	var buf bytes.Buffer
+	buf.WriteString("Fields (name, type and JSON key):\n")
+	tw := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	writeWikiFormatFields(tw, reflect.TypeOf(WikiFirmware{}), "  ")
+	tw.Flush()
+	buf.WriteString(`
+Functions:
+  json      JSON encodes a value (i.e. {{json .URLs}})
+  join      joins a list (i.e. {{join .Devices ","}})
+  first     the first item of a list or "" (i.e. {{first .Devices}})
+  lower     lowercases a string
+  upper     uppercases a string
+  index     a map value (i.e. {{index .DeviceBuilds "iPhone14,7"}})
+
+Examples:
+  --format '{{.Version}} ({{.Build}})\t{{join .Devices ","}}'
+  --format '{{range .URLs}}{{.Variant}}: {{.URL}}{{"\n"}}{{end}}'
+  --format '{{json .}}'
+`)
+	return buf.String()
+}
+
+// writeWikiFormatFields lists the exported fields of t (and of the structs nested in them, indented)
+func writeWikiFormatFields(w io.Writer, t reflect.Type, indent string) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		key, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if key == "-" {
+			continue
+		}
+		typ := strings.ReplaceAll(f.Type.String(), "download.", "")
+		fmt.Fprintf(w, "%s.%s\t%s\t%s\n", indent, f.Name, typ, key)
+
+		nested := f.Type
+		for nested.Kind() == reflect.Slice || nested.Kind() == reflect.Pointer {
+			nested = nested.Elem()
+		}
+		if nested.Kind() == reflect.Struct && nested != reflect.TypeOf(time.Time{}) {
+			writeWikiFormatFields(w, nested, indent+"  ")
+		}
+	}
+}
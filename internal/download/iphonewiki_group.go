@@ -0,0 +1,194 @@
+package download
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/blacktop/ipsw/internal/utils"
+	"github.com/blacktop/ipsw/pkg/info"
+)
+
+// GroupByDevice groups fws by device identifier; a firmware covering N devices appears (in order) under
+// each of them and firmwares without any devices are grouped under their product name
+func GroupByDevice(fws []WikiFirmware) map[string][]WikiFirmware {
+	groups := make(map[string][]WikiFirmware)
+	for _, fw := range fws {
+		devs := fw.Devices
+		if len(devs) == 0 && len(fw.Product) > 0 {
+			devs = []string{fw.Product}
+		}
+		seen := make(map[string]bool)
+		for _, dev := range devs {
+			dev = strings.TrimSpace(dev)
+			if len(dev) == 0 || seen[dev] {
+				continue
+			}
+			seen[dev] = true
+			groups[dev] = append(groups[dev], fw)
+		}
+	}
+	return groups
+}
+
+// WikiGroupKey is a field GroupWikiFirmwares can group by
+type WikiGroupKey string
+
+const (
+	WikiGroupDevice  WikiGroupKey = "device"  // canonical device identifier (i.e. iPhone14,5)
+	WikiGroupVersion WikiGroupKey = "version" // OS version (i.e. 17.0.1)
+)
+
+// WikiGroupKeys are the valid WikiGroupKey values
+var WikiGroupKeys = []string{string(WikiGroupDevice), string(WikiGroupVersion)}
+
+// ParseWikiGroupKeys validates the --group-by keys (i.e. "device", "version")
+func ParseWikiGroupKeys(keys []string) ([]WikiGroupKey, error) {
+	var by []WikiGroupKey
+	for _, key := range keys {
+		k := WikiGroupKey(strings.ToLower(strings.TrimSpace(key)))
+		switch k {
+		case WikiGroupDevice, WikiGroupVersion:
+		default:
+			return nil, fmt.Errorf("invalid group key '%s' (expected one of %s)", key, strings.Join(WikiGroupKeys, ", "))
+		}
+		if slices.Contains(by, k) {
+			return nil, fmt.Errorf("duplicate group key '%s'", key)
+		}
+		by = append(by, k)
+	}
+	return by, nil
+}
+
+// WikiGroup is one group of GroupWikiFirmwares results: nested Groups for all but the last key and Firmwares for the last
+type WikiGroup struct {
+	Key       string
+	Groups    WikiGroups
+	Firmwares []WikiFirmware
+}
+
+// WikiGroups are ordered groups; they marshal to a JSON object whose keys keep that order
+type WikiGroups []WikiGroup
+
+// Get returns the group with key (or nil)
+func (gs WikiGroups) Get(key string) *WikiGroup {
+	for i := range gs {
+		if gs[i].Key == key {
+			return &gs[i]
+		}
+	}
+	return nil
+}
+
+// MarshalJSON marshals the groups as an object of key -> nested groups (or firmwares)
+func (gs WikiGroups) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, g := range gs {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, err := json.Marshal(g.Key)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		var val []byte
+		if g.Groups != nil {
+			val, err = json.Marshal(g.Groups)
+		} else {
+			fws := g.Firmwares
+			if fws == nil {
+				fws = []WikiFirmware{}
+			}
+			val, err = json.Marshal(fws)
+		}
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(val)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// GroupWikiFirmwares nests fws by each key in turn (i.e. device then version); devices are canonicalized
+// with the ipsw DB so case variants share a group, devices are ordered naturally (iPhone9,1 before iPhone10,1)
+// and versions oldest first. A firmware covering N devices appears under each of them.
+func GroupWikiFirmwares(fws []WikiFirmware, by ...WikiGroupKey) WikiGroups {
+	if len(by) == 0 {
+		return nil
+	}
+	db, _ := info.GetIpswDB() // without the DB devices are grouped as listed
+	return groupWikiFirmwares(fws, by, db)
+}
+
+func groupWikiFirmwares(fws []WikiFirmware, by []WikiGroupKey, db *info.Devices) WikiGroups {
+	index := make(map[string]int)
+	var groups WikiGroups
+	for _, fw := range fws {
+		for _, key := range wikiGroupValues(fw, by[0], db) {
+			i, ok := index[key]
+			if !ok {
+				i = len(groups)
+				index[key] = i
+				groups = append(groups, WikiGroup{Key: key})
+			}
+			groups[i].Firmwares = append(groups[i].Firmwares, fw)
+		}
+	}
+
+	switch by[0] {
+	case WikiGroupDevice:
+		slices.SortStableFunc(groups, func(a, b WikiGroup) int { return compareBuilds(a.Key, b.Key) })
+	case WikiGroupVersion:
+		slices.SortStableFunc(groups, func(a, b WikiGroup) int {
+			if c := utils.Compare(a.Key, b.Key); c != 0 {
+				return c
+			}
+			return strings.Compare(a.Key, b.Key)
+		})
+	}
+
+	if len(by) > 1 {
+		for i := range groups {
+			groups[i].Groups = groupWikiFirmwares(groups[i].Firmwares, by[1:], db)
+			groups[i].Firmwares = nil
+		}
+	}
+	return groups
+}
+
+// wikiGroupValues returns the group(s) fw belongs to for key
+func wikiGroupValues(fw WikiFirmware, key WikiGroupKey, db *info.Devices) []string {
+	switch key {
+	case WikiGroupDevice:
+		devs := fw.Devices
+		if len(devs) == 0 && len(fw.Product) > 0 {
+			return []string{fw.Product}
+		}
+		var keys []string
+		for _, dev := range devs {
+			if dev = strings.TrimSpace(dev); len(dev) == 0 {
+				continue
+			}
+			if db != nil {
+				dev = db.CanonicalProductType(dev)
+			}
+			keys = utils.UniqueAppendFunc(keys, dev, strings.ToLower)
+		}
+		if len(keys) == 0 {
+			return []string{"unknown"}
+		}
+		return keys
+	case WikiGroupVersion:
+		if len(fw.Version) == 0 {
+			return []string{"unknown"}
+		}
+		return []string{fw.Version}
+	}
+	return nil
+}
@@ -0,0 +1,421 @@
+package download
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/apex/log"
+)
+
+// WikiFWKeys are the firmware keys for a single (device, build) from a wiki Keys: page
+type WikiFWKeys struct {
+	Version            string `json:"version,omitempty"`
+	Build              string `json:"build,omitempty"`
+	Device             string `json:"device,omitempty"`
+	Codename           string `json:"codename,omitempty"`
+	Baseband           string `json:"baseband,omitempty"`
+	DownloadURL        string `json:"download_url,omitempty"`
+	RootFS             string `json:"rootfs,omitempty"`
+	RootFSKey          string `json:"rootfs_key,omitempty"`
+	UpdateRamdisk      string `json:"update_ramdisk,omitempty"`
+	UpdateRamdiskIV    string `json:"update_ramdisk_iv,omitempty"`
+	RestoreRamdisk     string `json:"restore_ramdisk,omitempty"`
+	RestoreRamdiskIV   string `json:"restore_ramdisk_iv,omitempty"`
+	AppleLogo          string `json:"apple_logo,omitempty"`
+	AppleLogoIV        string `json:"apple_logo_iv,omitempty"`
+	BatteryCharging0   string `json:"battery_charging0,omitempty"`
+	BatteryCharging0IV string `json:"battery_charging0_iv,omitempty"`
+	BatteryCharging1   string `json:"battery_charging1,omitempty"`
+	BatteryCharging1IV string `json:"battery_charging1_iv,omitempty"`
+	BatteryFull        string `json:"battery_full,omitempty"`
+	BatteryFullIV      string `json:"battery_full_iv,omitempty"`
+	BatteryLow0        string `json:"battery_low0,omitempty"`
+	BatteryLow0IV      string `json:"battery_low0_iv,omitempty"`
+	BatteryLow1        string `json:"battery_low1,omitempty"`
+	BatteryLow1IV      string `json:"battery_low1_iv,omitempty"`
+	DeviceTree         string `json:"device_tree,omitempty"`
+	DeviceTreeIV       string `json:"device_tree_iv,omitempty"`
+	GlyphPlugin        string `json:"glyph_plugin,omitempty"`
+	GlyphPluginIV      string `json:"glyph_plugin_iv,omitempty"`
+	IBEC               string `json:"ibec,omitempty"`
+	IBECIV             string `json:"ibec_iv,omitempty"`
+	IBECKey            string `json:"ibec_key,omitempty"`
+	IBECKBAG           string `json:"ibec_kbag,omitempty"`
+	IBoot              string `json:"iboot,omitempty"`
+	IBootIV            string `json:"iboot_iv,omitempty"`
+	IBootKey           string `json:"iboot_key,omitempty"`
+	IBootKBAG          string `json:"iboot_kbag,omitempty"`
+	IBSS               string `json:"ibss,omitempty"`
+	IBSSIV             string `json:"ibss_iv,omitempty"`
+	IBSSKey            string `json:"ibss_key,omitempty"`
+	IBSSKBAG           string `json:"ibss_kbag,omitempty"`
+	Kernelcache        string `json:"kernelcache,omitempty"`
+	KernelcacheIV      string `json:"kernelcache_iv,omitempty"`
+	KernelcacheKey     string `json:"kernelcache_key,omitempty"`
+	KernelcacheKBAG    string `json:"kernelcache_kbag,omitempty"`
+	LLB                string `json:"llb,omitempty"`
+	LLBIV              string `json:"llb_iv,omitempty"`
+	LLBKey             string `json:"llb_key,omitempty"`
+	LLBKBAG            string `json:"llb_kbag,omitempty"`
+	RecoveryMode       string `json:"recovery_mode,omitempty"`
+	RecoveryModeIV     string `json:"recovery_mode_iv,omitempty"`
+	SEPFirmware        string `json:"sep_firmware,omitempty"`
+	SEPFirmwareIV      string `json:"sep_firmware_iv,omitempty"`
+	SEPFirmwareKey     string `json:"sep_firmware_key,omitempty"`
+	SEPFirmwareKBAG    string `json:"sep_firmware_kbag,omitempty"`
+}
+
+var (
+	wikiKeysTagRE  = regexp.MustCompile(`</?[a-zA-Z][^>]*>`)
+	wikiFileNameRE = regexp.MustCompile(`[^A-Za-z0-9,._-]+`)
+)
+
+// HasKeys returns true if any IV/Key/KBAG field is set
+func (k WikiFWKeys) HasKeys() bool {
+	v := reflect.ValueOf(k)
+	for i := 0; i < v.NumField(); i++ {
+		name := v.Type().Field(i).Name
+		if strings.HasSuffix(name, "IV") || strings.HasSuffix(name, "Key") || strings.HasSuffix(name, "KBAG") {
+			if len(v.Field(i).String()) > 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// SEPKBAG returns the decoded SEP firmware KBAG (the wrapped IV followed by the wrapped AES-128 or AES-256 key)
+func (k WikiFWKeys) SEPKBAG() ([]byte, error) {
+	val := strings.Join(strings.Fields(k.SEPFirmwareKBAG), "")
+	if len(val) == 0 {
+		return nil, fmt.Errorf("no SEP firmware KBAG on the wiki for %s %s", k.Device, k.Build)
+	}
+	val = strings.TrimPrefix(strings.ToLower(val), "0x")
+	kbag, err := hex.DecodeString(val)
+	if err != nil {
+		return nil, fmt.Errorf("malformed SEP firmware KBAG '%s' for %s %s: %v", k.SEPFirmwareKBAG, k.Device, k.Build, err)
+	}
+	switch len(kbag) {
+	case 16 + 16, 16 + 32:
+		return kbag, nil
+	default:
+		return nil, fmt.Errorf("malformed SEP firmware KBAG for %s %s: %d bytes (expected 32 or 48)", k.Device, k.Build, len(kbag))
+	}
+}
+
+// FileName returns the sanitized per-(device, build) JSON filename, e.g. iPhone14,5_19A346.keys.json
+func (k WikiFWKeys) FileName() string {
+	return k.fileName("keys.json")
+}
+
+// fileName returns the sanitized <device>_<build>.<ext> filename
+func (k WikiFWKeys) fileName(ext string) string {
+	sanitize := func(s string) string {
+		s = strings.Trim(wikiFileNameRE.ReplaceAllString(strings.TrimSpace(s), "_"), "._")
+		if len(s) == 0 {
+			return "unknown"
+		}
+		return s
+	}
+	return fmt.Sprintf("%s_%s.%s", sanitize(k.Device), sanitize(k.Build), ext)
+}
+
+// wikiKeysTemplates returns each (top-level) {{keys ...}} template on a Keys: page
+func wikiKeysTemplates(text string) []string {
+	var tmpls []string
+	lower := strings.ToLower(text)
+	for offset := 0; ; {
+		start := strings.Index(lower[offset:], "{{keys")
+		if start < 0 {
+			break
+		}
+		start += offset
+		end := len(text)
+		depth := 0
+	scan:
+		for i := start; i < len(text)-1; i++ {
+			switch text[i : i+2] {
+			case "{{":
+				depth++
+				i++
+			case "}}":
+				depth--
+				i++
+				if depth == 0 {
+					end = i + 1
+					break scan
+				}
+			}
+		}
+		tmpls = append(tmpls, text[start:end])
+		offset = end
+	}
+	return tmpls
+}
+
+// splitWikiParams splits a template body on the '|' that are not inside a nested template or link
+func splitWikiParams(body string) []string {
+	var params []string
+	depth, last := 0, 0
+	for i := 0; i < len(body); i++ {
+		switch {
+		case strings.HasPrefix(body[i:], "{{"), strings.HasPrefix(body[i:], "[["):
+			depth++
+			i++
+		case strings.HasPrefix(body[i:], "}}"), strings.HasPrefix(body[i:], "]]"):
+			depth--
+			i++
+		case body[i] == '|' && depth == 0:
+			params = append(params, body[last:i])
+			last = i + 1
+		}
+	}
+	return append(params, body[last:])
+}
+
+// ParseKeysTemplate parses a single raw {{keys|version=...|build=...|iboot=...}} template into its firmware keys;
+// parameter names are matched case-insensitively to the WikiFWKeys fields and <code> (or other) tags are stripped
+func ParseKeysTemplate(wikitext string) (WikiFWKeys, error) {
+	var keys WikiFWKeys
+
+	text := strings.TrimSpace(wikitext)
+	if !strings.HasPrefix(strings.ToLower(text), "{{keys") {
+		return keys, &WikiParseError{Msg: "not a {{keys}} template", Err: ErrWikiParse}
+	}
+	body := strings.TrimSuffix(text[len("{{keys"):], "}}")
+
+	v := reflect.ValueOf(&keys).Elem()
+	for _, param := range splitWikiParams(body) {
+		name, value, ok := strings.Cut(param, "=")
+		if !ok {
+			continue
+		}
+		name = strings.ReplaceAll(strings.TrimSpace(name), " ", "")
+		value = strings.TrimSpace(wikiKeysTagRE.ReplaceAllString(value, ""))
+		if len(value) == 0 {
+			continue
+		}
+		if f := v.FieldByNameFunc(func(field string) bool { return strings.EqualFold(field, name) }); f.IsValid() {
+			f.SetString(value)
+		}
+	}
+
+	return keys, nil
+}
+
+// WikiComponentKeys are the wiki keys for a single firmware component (i.e. the kernelcache)
+type WikiComponentKeys struct {
+	Component string `json:"component"`           // WikiFWKeys field prefix (i.e. Kernelcache)
+	Type      string `json:"type"`                // im4p type (i.e. krnl)
+	FileName  string `json:"file_name,omitempty"` // file name listed on the wiki
+	IV        string `json:"iv,omitempty"`
+	Key       string `json:"key,omitempty"`
+	Encrypted bool   `json:"encrypted"` // false when the wiki lists the component as "Not Encrypted"
+}
+
+var wikiKeyComponents = []struct {
+	re    *regexp.Regexp
+	field string
+	typ   string
+}{
+	{regexp.MustCompile(`(?i)^kernelcache`), "Kernelcache", "krnl"},
+	{regexp.MustCompile(`(?i)^iBoot\.`), "IBoot", "ibot"},
+	{regexp.MustCompile(`(?i)^iBEC\.`), "IBEC", "ibec"},
+	{regexp.MustCompile(`(?i)^iBSS\.`), "IBSS", "ibss"},
+	{regexp.MustCompile(`(?i)^LLB\.`), "LLB", "illb"},
+	{regexp.MustCompile(`(?i)^sep-firmware`), "SEPFirmware", "sepi"},
+}
+
+// ComponentKeys returns the IV/key for the component whose file name (i.e. kernelcache.release.iphone14 or
+// iBoot.d17.RELEASE.im4p) is name
+func (k WikiFWKeys) ComponentKeys(name string) (*WikiComponentKeys, error) {
+	base := filepath.Base(name)
+	for _, c := range wikiKeyComponents {
+		if c.re.MatchString(base) {
+			return k.componentKeys(c.field, c.typ)
+		}
+	}
+	return nil, fmt.Errorf("unsupported component '%s' (expected a kernelcache, iBoot, iBEC, iBSS, LLB or sep-firmware)", base)
+}
+
+// Component returns the IV/key for the component named name (i.e. iBoot, Kernelcache or SEPFirmware) or
+// its im4p type (i.e. ibot)
+func (k WikiFWKeys) Component(name string) (*WikiComponentKeys, error) {
+	var names []string
+	for _, c := range wikiKeyComponents {
+		if strings.EqualFold(name, c.field) || strings.EqualFold(name, c.typ) {
+			return k.componentKeys(c.field, c.typ)
+		}
+		names = append(names, c.field)
+	}
+	return nil, fmt.Errorf("unsupported component '%s' (expected one of: %s)", name, strings.Join(names, ", "))
+}
+
+func (k WikiFWKeys) componentKeys(field, typ string) (*WikiComponentKeys, error) {
+	v := reflect.ValueOf(k)
+	ck := &WikiComponentKeys{
+		Component: field,
+		Type:      typ,
+		FileName:  v.FieldByName(field).String(),
+		IV:        v.FieldByName(field + "IV").String(),
+		Key:       v.FieldByName(field + "Key").String(),
+	}
+	if strings.Contains(strings.ToLower(ck.IV+ck.Key), "not encrypted") {
+		return ck, nil
+	}
+	if len(ck.IV) == 0 || len(ck.Key) == 0 {
+		if kbag := v.FieldByName(field + "KBAG"); kbag.IsValid() && len(kbag.String()) > 0 {
+			return nil, fmt.Errorf("%w: the wiki only lists the %s KBAG for %s %s (it has to be unwrapped with the device's GID key)",
+				ErrWikiKBAGOnly, field, k.Device, k.Build)
+		}
+		return nil, fmt.Errorf("no %s IV/key on the wiki for %s %s", field, k.Device, k.Build)
+	}
+	ck.Encrypted = true
+	return ck, nil
+}
+
+// GetWikiFirmwareKeys queries theiphonewiki.com for the firmware keys matching cfg's Device, Version and Build
+func GetWikiFirmwareKeys(cfg *WikiConfig, proxy string, insecure bool) ([]WikiFWKeys, error) {
+	return GetWikiFirmwareKeysWithConfig(cfg, legacyDownloadConfig(proxy, insecure))
+}
+
+// GetWikiFirmwareKeysWithConfig is GetWikiFirmwareKeys using the network settings in dl
+func GetWikiFirmwareKeysWithConfig(cfg *WikiConfig, dl *DownloadConfig) ([]WikiFWKeys, error) {
+	c, err := NewWikiClient(dl.withMinTLS(cfg.MinTLS))
+	if err != nil {
+		return nil, err
+	}
+	return c.GetFirmwareKeys(cfg)
+}
+
+// GetFirmwareKeys queries the wiki for the firmware keys matching cfg's Device, Version and Build
+func (c *WikiClient) GetFirmwareKeys(cfg *WikiConfig) ([]WikiFWKeys, error) {
+	var keys []WikiFWKeys
+
+	index, err := c.getWikiPage(context.Background(), ipswKeysPage)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get %s page: %w", ipswKeysPage, err)
+	}
+
+	prefix := ipswKeysPage + "/"
+	if len(cfg.Version) > 0 {
+		major, _, _ := strings.Cut(cfg.Version, ".")
+		prefix += major + ".x"
+	}
+
+	for _, link := range index.Parse.Links {
+		if !strings.HasPrefix(link.Link, prefix) {
+			continue
+		}
+
+		log.Debugf("Parsing wiki page: '%s'", link.Link)
+
+		wpage, err := c.getWikiPage(context.Background(), link.Link)
+		if err != nil {
+			if errors.Is(err, ErrWikiNotFound) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to parse page %s: %w", link.Link, err)
+		}
+
+		for _, klink := range wpage.Parse.Links {
+			// e.g. "Keys:Sky 19A346 (iPhone14,5)"
+			if !strings.HasPrefix(klink.Link, "Keys:") {
+				continue
+			}
+			if len(cfg.Device) > 0 && !strings.Contains(strings.ToLower(klink.Link), strings.ToLower(cfg.Device)) {
+				continue
+			}
+			if len(cfg.Build) > 0 && !strings.Contains(klink.Link, " "+cfg.Build+" ") {
+				continue
+			}
+
+			wkeys, err := c.getWikiTable(context.Background(), klink.Link)
+			if err != nil {
+				if errors.Is(err, ErrWikiNotFound) { // red link (no keys page yet)
+					continue
+				}
+				return nil, fmt.Errorf("failed to get keys page %s: %w", klink.Link, err)
+			}
+			tmpls := wikiKeysTemplates(wkeys.Parse.WikiText.Text)
+			if len(tmpls) == 0 {
+				return nil, fmt.Errorf("failed to parse keys page: %w",
+					&WikiParseError{Page: klink.Link, Msg: "no {{keys}} template found", Err: ErrWikiParse})
+			}
+			for _, tmpl := range tmpls {
+				k, err := ParseKeysTemplate(tmpl)
+				if err != nil {
+					var perr *WikiParseError
+					if errors.As(err, &perr) {
+						perr.Page = klink.Link
+					}
+					return nil, fmt.Errorf("failed to parse keys page: %w", err)
+				}
+
+				if len(cfg.Version) > 0 && !strings.HasPrefix(k.Version, cfg.Version) {
+					continue
+				}
+				if len(cfg.Device) > 0 && !strings.EqualFold(k.Device, cfg.Device) {
+					continue
+				}
+				if len(cfg.Build) > 0 && !strings.EqualFold(k.Build, cfg.Build) {
+					continue
+				}
+
+				keys = append(keys, k)
+			}
+		}
+	}
+
+	return keys, nil
+}
+
+// WikiKeysSummary is the result of WriteWikiFWKeys
+type WikiKeysSummary struct {
+	Written int `json:"written"`
+	Skipped int `json:"skipped"`
+	Missing int `json:"missing"`
+}
+
+// WriteWikiFWKeys writes each key set in keys to its own <device>_<build>.keys.json file in dir;
+// existing files are skipped unless force is set and key sets without any keys are counted as missing
+func WriteWikiFWKeys(dir string, keys []WikiFWKeys, force bool) (*WikiKeysSummary, error) {
+	var summary WikiKeysSummary
+
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return nil, fmt.Errorf("failed to create output directory: %v", err)
+	}
+
+	for _, k := range keys {
+		if len(k.Device) == 0 || len(k.Build) == 0 || !k.HasKeys() {
+			summary.Missing++
+			continue
+		}
+
+		fname := filepath.Join(dir, k.FileName())
+		if _, err := os.Stat(fname); err == nil && !force {
+			log.Debugf("Skipping existing keys file %s", fname)
+			summary.Skipped++
+			continue
+		}
+
+		dat, err := json.MarshalIndent(k, "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal keys for %s %s: %v", k.Device, k.Build, err)
+		}
+		if err := os.WriteFile(fname, dat, 0660); err != nil {
+			return nil, fmt.Errorf("failed to write keys file %s: %v", fname, err)
+		}
+		summary.Written++
+	}
+
+	return &summary, nil
+}
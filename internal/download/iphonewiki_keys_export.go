@@ -0,0 +1,163 @@
+package download
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/apex/log"
+	"github.com/blacktop/go-plist"
+)
+
+// WikiKeyMaterialFormats are the formats supported by WriteWikiKeyMaterial
+var WikiKeyMaterialFormats = []string{"json", "plist"}
+
+// wikiComponentTags maps the WikiFWKeys component fields (the ones with an IV) to their im4p/TSS tag
+var wikiComponentTags = map[string]string{
+	"AppleLogo":        "logo",
+	"BatteryCharging0": "chg0",
+	"BatteryCharging1": "chg1",
+	"BatteryFull":      "batF",
+	"BatteryLow0":      "bat0",
+	"BatteryLow1":      "bat1",
+	"DeviceTree":       "dtre",
+	"GlyphPlugin":      "glyP",
+	"IBEC":             "ibec",
+	"IBoot":            "ibot",
+	"IBSS":             "ibss",
+	"Kernelcache":      "krnl",
+	"LLB":              "illb",
+	"RecoveryMode":     "recm",
+	"RestoreRamdisk":   "rdsk",
+	"SEPFirmware":      "sepi",
+	"UpdateRamdisk":    "rdsk",
+}
+
+// WikiKeyMaterial is the key material of a (device, build) grouped by component, in the shape img4/TSS tooling expects
+//
+//	{
+//	  "device": "iPhone14,5",
+//	  "build": "19A346",
+//	  "version": "15.0",
+//	  "components": [
+//	    {"component": "Kernelcache", "tag": "krnl", "file_name": "kernelcache.release.iphone14", "iv": "...", "key": "...", "encrypted": true},
+//	    {"component": "SEPFirmware", "tag": "sepi", "file_name": "sep-firmware.d17.RELEASE.im4p", "kbag": "...", "encrypted": true}
+//	  ]
+//	}
+//
+// NOTE: go-plist ignores a plist tag's name unless it has a comma (hence the trailing commas)
+type WikiKeyMaterial struct {
+	Device     string                     `json:"device" plist:"device,"`
+	Build      string                     `json:"build" plist:"build,"`
+	Version    string                     `json:"version,omitempty" plist:"version,omitempty"`
+	Components []WikiComponentKeyMaterial `json:"components" plist:"components,"`
+}
+
+// WikiComponentKeyMaterial is the IV/key or KBAG of a single component
+type WikiComponentKeyMaterial struct {
+	Component string `json:"component" plist:"component,"`                    // WikiFWKeys field prefix (i.e. Kernelcache)
+	Tag       string `json:"tag" plist:"tag,"`                                // im4p type (i.e. krnl)
+	FileName  string `json:"file_name,omitempty" plist:"file_name,omitempty"` // file name listed on the wiki
+	IV        string `json:"iv,omitempty" plist:"iv,omitempty"`
+	Key       string `json:"key,omitempty" plist:"key,omitempty"`
+	KBAG      string `json:"kbag,omitempty" plist:"kbag,omitempty"` // wrapped IV+key (to be unwrapped with the device's GID key)
+	Encrypted bool   `json:"encrypted" plist:"encrypted,"`          // false when the wiki lists the component as "Not Encrypted"
+}
+
+// KeyMaterial returns the IV/key or KBAG of each component that has any on the wiki (in WikiFWKeys field order)
+func (k WikiFWKeys) KeyMaterial() *WikiKeyMaterial {
+	km := &WikiKeyMaterial{Device: k.Device, Build: k.Build, Version: k.Version, Components: []WikiComponentKeyMaterial{}}
+
+	v := reflect.ValueOf(k)
+	value := func(name string) string {
+		if f := v.FieldByName(name); f.IsValid() {
+			return strings.Join(strings.Fields(f.String()), "")
+		}
+		return ""
+	}
+
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i).Name
+		tag, ok := wikiComponentTags[field]
+		if !ok {
+			continue
+		}
+		c := WikiComponentKeyMaterial{
+			Component: field,
+			Tag:       tag,
+			FileName:  strings.TrimSpace(v.Field(i).String()),
+			IV:        value(field + "IV"),
+			Key:       value(field + "Key"),
+			KBAG:      value(field + "KBAG"),
+		}
+		if len(c.IV)+len(c.Key)+len(c.KBAG) == 0 {
+			continue
+		}
+		if strings.Contains(strings.ToLower(c.IV+c.Key), "notencrypted") {
+			c.IV, c.Key = "", ""
+		} else {
+			c.Encrypted = true
+		}
+		km.Components = append(km.Components, c)
+	}
+
+	return km
+}
+
+// WriteWikiKeyMaterial writes the KeyMaterial of each key set in keys to its own <device>_<build>.tss.<format> file
+// in dir (format is json or plist); existing files are skipped unless force is set and key sets without any keys
+// are counted as missing
+func WriteWikiKeyMaterial(dir string, keys []WikiFWKeys, format string, force bool) (*WikiKeysSummary, error) {
+	var summary WikiKeysSummary
+
+	switch format {
+	case "json", "plist":
+	default:
+		return nil, fmt.Errorf("unsupported key material format '%s' (expected one of: %s)", format, strings.Join(WikiKeyMaterialFormats, ", "))
+	}
+
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return nil, fmt.Errorf("failed to create output directory: %v", err)
+	}
+
+	for _, k := range keys {
+		km := k.KeyMaterial()
+		if len(k.Device) == 0 || len(k.Build) == 0 || len(km.Components) == 0 {
+			summary.Missing++
+			continue
+		}
+
+		fname := filepath.Join(dir, k.fileName("tss."+format))
+		if _, err := os.Stat(fname); err == nil && !force {
+			log.Debugf("Skipping existing key material file %s", fname)
+			summary.Skipped++
+			continue
+		}
+
+		dat, err := km.Marshal(format)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal key material for %s %s: %v", k.Device, k.Build, err)
+		}
+		if err := os.WriteFile(fname, dat, 0660); err != nil {
+			return nil, fmt.Errorf("failed to write key material file %s: %v", fname, err)
+		}
+		summary.Written++
+	}
+
+	return &summary, nil
+}
+
+// Marshal returns the key material as indented JSON or an XML plist
+func (km *WikiKeyMaterial) Marshal(format string) ([]byte, error) {
+	switch format {
+	case "json":
+		return json.MarshalIndent(km, "", "  ")
+	case "plist":
+		return plist.MarshalIndent(km, plist.XMLFormat, "\t")
+	default:
+		return nil, fmt.Errorf("unsupported key material format '%s' (expected one of: %s)", format, strings.Join(WikiKeyMaterialFormats, ", "))
+	}
+}
@@ -0,0 +1,242 @@
+package download
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWikiFWKeysFileName(t *testing.T) {
+	tests := []struct {
+		keys WikiFWKeys
+		want string
+	}{
+		{WikiFWKeys{Device: "iPhone14,5", Build: "19A346"}, "iPhone14,5_19A346.keys.json"},
+		{WikiFWKeys{Device: " iPad13,1 ", Build: "18A373"}, "iPad13,1_18A373.keys.json"},
+		{WikiFWKeys{Device: "../../etc/passwd", Build: "1A/2 3"}, "etc_passwd_1A_2_3.keys.json"},
+		{WikiFWKeys{Build: "19A346"}, "unknown_19A346.keys.json"},
+	}
+	for _, tt := range tests {
+		if got := tt.keys.FileName(); got != tt.want {
+			t.Errorf("FileName(%q, %q) = %q, want %q", tt.keys.Device, tt.keys.Build, got, tt.want)
+		}
+	}
+}
+
+func TestParseKeysTemplate(t *testing.T) {
+	page := `Some intro text.
+{{keys
+ | Version             = 15.0
+ | Build               = 19A346
+ | Device              = iPhone14,5
+ | Codename            = Sky
+ | DownloadURL         = [https://updates.cdn-apple.com/iPhone14,5_15.0_19A346_Restore.ipsw iPhone14,5_15.0_19A346_Restore.ipsw]
+
+ | Kernelcache         = kernelcache.release.iphone14
+ | KernelcacheIV       = <code>0123456789abcdef0123456789abcdef</code>
+ | KernelcacheKey      = <code>fedcba9876543210fedcba9876543210fedcba9876543210fedcba9876543210</code>
+ | IBoot               = iBoot.d17.RELEASE.im4p
+ | IBootIV             = {{n/a|Not Encrypted}}
+ | SEPFirmwareKBAG     = 0011
+ | UnknownField        = ignored
+}}
+{{keys|version=15.0|build=19A346|device=iPhone14,2|iboot=iBoot.d63.RELEASE.im4p|ibootkey=<code>22</code>}}
+[[Category:Keys]]`
+
+	tmpls := wikiKeysTemplates(page)
+	if len(tmpls) != 2 {
+		t.Fatalf("wikiKeysTemplates() found %d templates, want 2", len(tmpls))
+	}
+
+	k, err := ParseKeysTemplate(tmpls[0])
+	if err != nil {
+		t.Fatalf("ParseKeysTemplate() error = %v", err)
+	}
+	if k.Version != "15.0" || k.Build != "19A346" || k.Device != "iPhone14,5" || k.Codename != "Sky" {
+		t.Errorf("ParseKeysTemplate() header fields = %+v", k)
+	}
+	if k.KernelcacheIV != "0123456789abcdef0123456789abcdef" {
+		t.Errorf("KernelcacheIV = %q", k.KernelcacheIV)
+	}
+	if k.IBootIV != "{{n/a|Not Encrypted}}" {
+		t.Errorf("IBootIV = %q, the nested template should be kept whole", k.IBootIV)
+	}
+	if k.SEPFirmwareKBAG != "0011" || !k.HasKeys() {
+		t.Errorf("SEPFirmwareKBAG = %q, HasKeys() = %t", k.SEPFirmwareKBAG, k.HasKeys())
+	}
+
+	k, err = ParseKeysTemplate(tmpls[1])
+	if err != nil || k.Device != "iPhone14,2" || k.IBoot != "iBoot.d63.RELEASE.im4p" || k.IBootKey != "22" {
+		t.Errorf("ParseKeysTemplate(inline) = %+v, %v", k, err)
+	}
+
+	if _, err := ParseKeysTemplate("no template here"); err == nil {
+		t.Error("expected error for text that isn't a keys template")
+	}
+}
+
+func TestWriteWikiFWKeys(t *testing.T) {
+	dir := t.TempDir()
+	keys := []WikiFWKeys{
+		{Device: "iPhone14,5", Build: "19A346", KernelcacheIV: "00"},
+		{Device: "iPhone14,2", Build: "19A346", IBootKey: "11"},
+		{Device: "iPhone14,3", Build: "19A346"}, // no keys on the page yet
+	}
+
+	summary, err := WriteWikiFWKeys(dir, keys, false)
+	if err != nil {
+		t.Fatalf("WriteWikiFWKeys() error = %v", err)
+	}
+	if *summary != (WikiKeysSummary{Written: 2, Missing: 1}) {
+		t.Errorf("first run summary = %+v", *summary)
+	}
+
+	fname := filepath.Join(dir, "iPhone14,5_19A346.keys.json")
+	if err := os.WriteFile(fname, []byte("edited"), 0660); err != nil {
+		t.Fatal(err)
+	}
+
+	summary, err = WriteWikiFWKeys(dir, keys, false)
+	if err != nil {
+		t.Fatalf("WriteWikiFWKeys() error = %v", err)
+	}
+	if *summary != (WikiKeysSummary{Skipped: 2, Missing: 1}) {
+		t.Errorf("second run summary = %+v", *summary)
+	}
+	if dat, _ := os.ReadFile(fname); string(dat) != "edited" {
+		t.Error("existing keys file was overwritten without force")
+	}
+
+	summary, err = WriteWikiFWKeys(dir, keys, true)
+	if err != nil {
+		t.Fatalf("WriteWikiFWKeys() error = %v", err)
+	}
+	if *summary != (WikiKeysSummary{Written: 2, Missing: 1}) {
+		t.Errorf("forced run summary = %+v", *summary)
+	}
+	if dat, _ := os.ReadFile(fname); string(dat) == "edited" {
+		t.Error("force should overwrite existing keys file")
+	}
+}
+
+func TestWikiFWKeysSEPKBAG(t *testing.T) {
+	kbag := "0123456789abcdef0123456789abcdef" + "fedcba9876543210fedcba9876543210fedcba9876543210fedcba9876543210"
+
+	k := WikiFWKeys{Device: "iPhone14,5", Build: "19A346", SEPFirmwareKBAG: kbag}
+	got, err := k.SEPKBAG()
+	if err != nil {
+		t.Fatalf("SEPKBAG() error = %v", err)
+	}
+	if len(got) != 48 || got[0] != 0x01 || got[47] != 0x10 {
+		t.Errorf("SEPKBAG() = %x", got)
+	}
+
+	parsed, err := ParseKeysTemplate("{{keys|device=iPhone14,5|build=19A346|SEPFirmwareKBAG=<code>" + strings.ToUpper(kbag[:64]) + "</code>}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := parsed.SEPKBAG(); err != nil || len(got) != 32 {
+		t.Errorf("SEPKBAG(AES-128) = %x, %v", got, err)
+	}
+
+	for _, bad := range []string{"", "Unknown", "0123", kbag + "00"} {
+		k.SEPFirmwareKBAG = bad
+		if _, err := k.SEPKBAG(); err == nil {
+			t.Errorf("SEPKBAG(%q) expected error", bad)
+		}
+	}
+}
+
+func TestWriteWikiKeyMaterial(t *testing.T) {
+	keys := []WikiFWKeys{{
+		Device:          "iPhone14,5",
+		Build:           "19A346",
+		Version:         "15.0",
+		RootFSKey:       "ff",
+		Kernelcache:     "kernelcache.release.iphone14",
+		KernelcacheIV:   "00",
+		KernelcacheKey:  "11",
+		DeviceTree:      "DeviceTree.d17ap.im4p",
+		DeviceTreeIV:    "Not Encrypted",
+		SEPFirmware:     "sep-firmware.d17.RELEASE.im4p",
+		SEPFirmwareKBAG: "0123 4567",
+		UpdateRamdisk:   "038-44135-124.dmg",
+		UpdateRamdiskIV: "22",
+	}, {
+		Device: "iPhone14,2", Build: "19A346", // no keys on the page yet
+	}}
+
+	dir := t.TempDir()
+	summary, err := WriteWikiKeyMaterial(dir, keys, "json", false)
+	if err != nil {
+		t.Fatalf("WriteWikiKeyMaterial() error = %v", err)
+	}
+	if *summary != (WikiKeysSummary{Written: 1, Missing: 1}) {
+		t.Errorf("summary = %+v", *summary)
+	}
+	got, err := os.ReadFile(filepath.Join(dir, "iPhone14,5_19A346.tss.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{
+  "device": "iPhone14,5",
+  "build": "19A346",
+  "version": "15.0",
+  "components": [
+    {
+      "component": "UpdateRamdisk",
+      "tag": "rdsk",
+      "file_name": "038-44135-124.dmg",
+      "iv": "22",
+      "encrypted": true
+    },
+    {
+      "component": "DeviceTree",
+      "tag": "dtre",
+      "file_name": "DeviceTree.d17ap.im4p",
+      "encrypted": false
+    },
+    {
+      "component": "Kernelcache",
+      "tag": "krnl",
+      "file_name": "kernelcache.release.iphone14",
+      "iv": "00",
+      "key": "11",
+      "encrypted": true
+    },
+    {
+      "component": "SEPFirmware",
+      "tag": "sepi",
+      "file_name": "sep-firmware.d17.RELEASE.im4p",
+      "kbag": "01234567",
+      "encrypted": true
+    }
+  ]
+}`
+	if string(got) != want {
+		t.Errorf("JSON key material =\n%s\nwant\n%s", got, want)
+	}
+
+	if _, err := WriteWikiKeyMaterial(dir, keys, "plist", false); err != nil {
+		t.Fatalf("WriteWikiKeyMaterial(plist) error = %v", err)
+	}
+	got, err = os.ReadFile(filepath.Join(dir, "iPhone14,5_19A346.tss.plist"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"<key>device</key>\n\t\t<string>iPhone14,5</string>",
+		"<key>component</key>\n\t\t\t\t<string>SEPFirmware</string>",
+		"<key>kbag</key>\n\t\t\t\t<string>01234567</string>",
+		"<key>tag</key>\n\t\t\t\t<string>sepi</string>",
+	} {
+		if !strings.Contains(string(got), want) {
+			t.Errorf("plist key material is missing %q:\n%s", want, got)
+		}
+	}
+
+	if _, err := WriteWikiKeyMaterial(dir, keys, "yaml", false); err == nil {
+		t.Error("WriteWikiKeyMaterial(yaml) expected error")
+	}
+}
@@ -0,0 +1,205 @@
+package download
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/blacktop/ipsw/pkg/info"
+)
+
+// wikiFamily returns the wiki page family (i.e. "iPad Air" or "Apple Watch") of product type prod; the iPads
+// are split by their DB name
+func wikiFamily(prod string, dev info.Device) string {
+	switch {
+	case strings.HasPrefix(prod, "iPhone"):
+		return iphone
+	case strings.HasPrefix(prod, "iPad"):
+		for _, family := range []string{ipadAir, ipadPro, ipadMini} {
+			if strings.HasPrefix(dev.Name, family) {
+				return family
+			}
+		}
+		return ipad
+	case strings.HasPrefix(prod, "iPod"):
+		return ipodTouch
+	case strings.HasPrefix(prod, "AppleTV"):
+		return appleTV
+	case strings.HasPrefix(prod, "Watch"):
+		return appleWatch
+	case strings.HasPrefix(prod, "AudioAccessory"):
+		return homePod
+	case strings.HasPrefix(prod, "Mac"), strings.HasPrefix(prod, "iMac"), strings.HasPrefix(prod, "ADP"):
+		return macOS
+	case strings.HasPrefix(prod, "iBridge"):
+		return ibridge
+	}
+	return ""
+}
+
+// wikiMajorForBuild returns the major OS version of build (i.e. "21A329" is iOS 17) for the wiki page family
+func wikiMajorForBuild(family, build string) (int, error) {
+	i := strings.IndexFunc(build, func(r rune) bool { return r < '0' || r > '9' })
+	if i <= 0 {
+		return 0, fmt.Errorf("invalid build '%s'", build)
+	}
+	train, err := strconv.Atoi(build[:i])
+	if err != nil {
+		return 0, fmt.Errorf("invalid build '%s': %v", build, err)
+	}
+
+	switch family {
+	case appleWatch: // watchOS 1 was 12x
+		if train < 12 {
+			return 0, fmt.Errorf("build '%s' is too old for an Apple Watch", build)
+		}
+		return train - 11, nil
+	case macOS: // macOS 11 was 20x
+		if train < 20 {
+			return 0, fmt.Errorf("build '%s' predates the macOS 11 firmware pages", build)
+		}
+		return train - 9, nil
+	case appleTV: // tvOS 9 was 13x (older Apple TV software doesn't follow the iOS trains)
+		if train < 13 {
+			return 0, fmt.Errorf("build '%s' predates the tvOS firmware pages", build)
+		}
+		return train - 4, nil
+	}
+
+	// iOS/iPadOS (and audioOS which follows them)
+	switch {
+	case train >= 9: // iOS 5 was 9x
+		return train - 4, nil
+	case train == 8:
+		return 4, nil
+	case train == 7:
+		return 3, nil
+	case train >= 5:
+		return 2, nil
+	default:
+		return 1, nil
+	}
+}
+
+// wikiFirmwarePage returns the IPSW page (i.e. "Firmware/iPhone/17.x") listing build for device
+func wikiFirmwarePage(device, build string) (string, error) {
+	db, err := info.GetIpswDB()
+	if err != nil {
+		return "", err
+	}
+	dev, err := db.LookupDevice(db.CanonicalProductType(device))
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrWikiNotFound, err)
+	}
+	family := wikiFamily(db.CanonicalProductType(device), dev)
+	if len(family) == 0 {
+		return "", fmt.Errorf("%w: no wiki firmware pages for device %s", ErrWikiNotFound, device)
+	}
+	major, err := wikiMajorForBuild(family, build)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrWikiNotFound, err)
+	}
+	return fmt.Sprintf("%s/%s/%d.x", ipswPage, family, major), nil
+}
+
+// GetWikiFirmware returns the firmware for device and build by fetching only the wiki page that lists it
+// (the device's family page for the build's major version); it returns ErrWikiNotFound if it isn't listed
+func GetWikiFirmware(device, build string, proxy string, insecure bool) (*WikiFirmware, error) {
+	return GetWikiFirmwareWithConfig(device, build, legacyDownloadConfig(proxy, insecure))
+}
+
+// GetWikiFirmwareWithConfig is GetWikiFirmware using the network settings in dl
+func GetWikiFirmwareWithConfig(device, build string, dl *DownloadConfig) (*WikiFirmware, error) {
+	c, err := NewWikiClient(dl)
+	if err != nil {
+		return nil, err
+	}
+	return c.GetFirmware(device, build)
+}
+
+// GetFirmware returns the firmware for device and build from the wiki page that lists it
+func (c *WikiClient) GetFirmware(device, build string) (*WikiFirmware, error) {
+	if len(device) == 0 || len(build) == 0 {
+		return nil, fmt.Errorf("both a device and a build are required")
+	}
+
+	page, err := wikiFirmwarePage(device, build)
+	if err != nil {
+		return nil, err
+	}
+
+	wtable, err := c.getWikiTable(context.Background(), page)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get wikitable for %s: %w", page, err)
+	}
+	fws, err := parseWikiTable(wtable.Parse.WikiText.Text)
+	if err != nil {
+		var perr *WikiParseError
+		if errors.As(err, &perr) {
+			perr.Page = page
+		}
+		return nil, fmt.Errorf("failed to parse wikitable: %w", err)
+	}
+
+	if fw := findWikiFirmware(fws, device, build); fw != nil {
+		fw.OS = inferWikiOS(page, fw.Version)
+		return fw, nil
+	}
+
+	return nil, fmt.Errorf("%w: %s (%s) is not listed on '%s'", ErrWikiNotFound, device, build, page)
+}
+
+// findWikiFirmware returns the firmware for device and build in fws
+func findWikiFirmware(fws []WikiFirmware, device, build string) *WikiFirmware {
+	for _, fw := range fws {
+		if strings.EqualFold(fw.BuildFor(device), build) && slices.ContainsFunc(fw.Devices, func(d string) bool { return strings.EqualFold(d, device) }) {
+			return &fw
+		}
+	}
+	return nil
+}
+
+// LatestOTADelta returns the newest OTA for device whose prerequisite build is fromBuild (i.e. the next
+// incremental update available from it); it returns ErrWikiNotFound if there isn't one
+func LatestOTADelta(device, fromBuild string, proxy string, insecure bool) (*WikiFirmware, error) {
+	return LatestOTADeltaWithConfig(device, fromBuild, legacyDownloadConfig(proxy, insecure))
+}
+
+// LatestOTADeltaWithConfig is LatestOTADelta using the network settings in dl
+func LatestOTADeltaWithConfig(device, fromBuild string, dl *DownloadConfig) (*WikiFirmware, error) {
+	c, err := NewWikiClient(dl)
+	if err != nil {
+		return nil, err
+	}
+	return c.LatestOTADelta(device, fromBuild)
+}
+
+// LatestOTADelta returns the newest OTA for device whose prerequisite build is fromBuild
+func (c *WikiClient) LatestOTADelta(device, fromBuild string) (*WikiFirmware, error) {
+	if len(device) == 0 || len(fromBuild) == 0 {
+		return nil, fmt.Errorf("both a device and a from-build are required")
+	}
+
+	otas, err := c.GetOTAs(&WikiConfig{OTA: true, Device: device, SortOrder: WikiSortNewest})
+	if err != nil {
+		return nil, err
+	}
+	if ota := findWikiDelta(otas, device, fromBuild); ota != nil {
+		return ota, nil
+	}
+
+	return nil, fmt.Errorf("%w: no OTA for %s from %s", ErrWikiNotFound, device, fromBuild)
+}
+
+// findWikiDelta returns the first OTA in otas (sorted newest first) for device with prerequisite build fromBuild
+func findWikiDelta(otas []WikiFirmware, device, fromBuild string) *WikiFirmware {
+	for _, ota := range otas {
+		if strings.EqualFold(ota.PrerequisiteBuild, fromBuild) && slices.ContainsFunc(ota.Devices, func(d string) bool { return strings.EqualFold(d, device) }) {
+			return &ota
+		}
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package download
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// WikiConfig.OS values
+const (
+	WikiOSiOS      = "ios"
+	WikiOSiPadOS   = "ipados"
+	WikiOStvOS     = "tvos"
+	WikiOSwatchOS  = "watchos"
+	WikiOSmacOS    = "macos"
+	WikiOSbridgeOS = "bridgeos"
+)
+
+var wikiOSes = []string{WikiOSiOS, WikiOSiPadOS, WikiOStvOS, WikiOSwatchOS, WikiOSmacOS, WikiOSbridgeOS}
+
+// ipadOSMajor is the first iPad release that shipped as iPadOS instead of iOS
+const ipadOSMajor = 13
+
+func validateWikiOS(os string) error {
+	if len(os) == 0 {
+		return nil
+	}
+	for _, o := range wikiOSes {
+		if strings.EqualFold(os, o) {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid wiki OS '%s' (expected one of %s)", os, strings.Join(wikiOSes, ", "))
+}
+
+// inferWikiOS returns the OS lineage of a firmware listed on the wiki page (i.e. "Firmware/iPad/17.x");
+// version is used to tell iOS from iPadOS on the iPad pages and falls back to the page's major version.
+// It returns "" when the lineage is unknown (i.e. HomePod) or can't be determined yet.
+func inferWikiOS(page, version string) string {
+	parts := strings.Split(page, "/")
+	if len(parts) < 2 {
+		return ""
+	}
+	family := parts[1]
+
+	switch {
+	case strings.HasPrefix(family, iphone), family == ipodTouch:
+		return WikiOSiOS
+	case strings.HasPrefix(family, ipad):
+		if len(version) == 0 && len(parts) > 2 {
+			version = parts[2]
+		}
+		major, err := strconv.Atoi(strings.SplitN(version, ".", 2)[0])
+		if err != nil {
+			return ""
+		}
+		if major >= ipadOSMajor {
+			return WikiOSiPadOS
+		}
+		return WikiOSiOS
+	case strings.HasPrefix(family, appleTV):
+		return WikiOStvOS
+	case strings.HasPrefix(family, appleWatch):
+		return WikiOSwatchOS
+	case family == macOS, family == macServer:
+		return WikiOSmacOS
+	case strings.HasPrefix(family, ibridge):
+		return WikiOSbridgeOS
+	}
+
+	return ""
+}
+
+// skipWikiPage returns true if none of the firmwares on page can match cfg.OS
+func (cfg *WikiConfig) skipWikiPage(page string) bool {
+	if len(cfg.OS) == 0 {
+		return false
+	}
+	os := inferWikiOS(page, "")
+	if len(os) == 0 {
+		// iPad pages without a major version can hold either lineage
+		parts := strings.Split(page, "/")
+		return len(parts) < 2 || !strings.HasPrefix(parts[1], ipad)
+	}
+	return !strings.EqualFold(os, cfg.OS)
+}
+
+// filterWikiOS sets the OS of each firmware parsed from page and drops those not matching cfg.OS
+func (cfg *WikiConfig) filterWikiOS(page string, fws []WikiFirmware) []WikiFirmware {
+	var out []WikiFirmware
+	for _, fw := range fws {
+		fw.OS = inferWikiOS(page, fw.Version)
+		if len(cfg.OS) > 0 && !strings.EqualFold(fw.OS, cfg.OS) {
+			continue
+		}
+		out = append(out, fw)
+	}
+	return out
+}
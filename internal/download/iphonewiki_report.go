@@ -0,0 +1,82 @@
+package download
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// WikiCrawlReport summarizes a wiki crawl; it is written as JSON to WikiConfig.ReportWriter at the end
+// of GetIPSWs/GetOTAs (even if the crawl failed) so that pipelines can assert on it (i.e. zero errors)
+type WikiCrawlReport struct {
+	Kind            string           `json:"kind"`   // ipsw or ota
+	Filter          string           `json:"filter"` // the page prefix crawled (i.e. Firmware/iPhone)
+	Started         time.Time        `json:"started"`
+	Duration        float64          `json:"duration_seconds"`
+	PagesDiscovered int              `json:"pages_discovered"` // pages under the filter
+	PagesFetched    int              `json:"pages_fetched"`    // pages requested
+	PagesParsed     int              `json:"pages_parsed"`     // pages whose firmware table was parsed
+	Retries         int64            `json:"retries"`          // requests retried by the client's RetryPolicy
+	Firmwares       int              `json:"firmwares"`        // firmwares returned
+	Errors          int              `json:"errors"`
+	Warnings        []string         `json:"warnings,omitempty"` // crawl warnings (i.e. no pages match the filter)
+	Pages           []WikiPageReport `json:"pages"`
+	Error           string           `json:"error,omitempty"` // why the crawl failed
+	retries         *atomic.Int64
+}
+
+// WikiPageReport is the outcome of crawling one wiki page
+type WikiPageReport struct {
+	Page       string   `json:"page"`
+	Fetched    bool     `json:"fetched"`
+	Parsed     bool     `json:"parsed"`             // the page links to firmwares and its table was parsed
+	Firmwares  int      `json:"firmwares"`          // firmwares parsed (before the OS filter)
+	RevisionID int      `json:"revid,omitempty"`    // revision of the page's parsed wikitext
+	Canceled   bool     `json:"canceled,omitempty"` // the crawl stopped before the page was done (not counted in Errors)
+	Error      string   `json:"error,omitempty"`
+	Warnings   []string `json:"warnings,omitempty"`
+}
+
+func newWikiCrawlReport(kind, filter string) *WikiCrawlReport {
+	return &WikiCrawlReport{Kind: kind, Filter: filter, Started: time.Now(), retries: new(atomic.Int64)}
+}
+
+// context returns ctx with the report counting its requests' retries
+func (r *WikiCrawlReport) context(ctx context.Context) context.Context {
+	return withRetryCounter(ctx, r.retries)
+}
+
+// finish totals the page reports and writes the report to w (if set)
+func (r *WikiCrawlReport) finish(w io.Writer, fws []WikiFirmware, err error) error {
+	if w == nil {
+		return err
+	}
+	r.Duration = time.Since(r.Started).Seconds()
+	r.Retries = r.retries.Load()
+	r.Firmwares = len(fws)
+	for _, p := range r.Pages {
+		if p.Fetched {
+			r.PagesFetched++
+		}
+		if p.Parsed {
+			r.PagesParsed++
+		}
+		if len(p.Error) > 0 {
+			r.Errors++
+		}
+	}
+	if err != nil {
+		r.Error = err.Error()
+		if r.Errors == 0 {
+			r.Errors++
+		}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if werr := enc.Encode(r); werr != nil && err == nil {
+		return werr
+	}
+	return err
+}
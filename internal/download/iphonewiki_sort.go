@@ -0,0 +1,180 @@
+package download
+
+import (
+	"cmp"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/blacktop/ipsw/internal/utils"
+)
+
+// WikiSortOrder is the order GetWikiIPSWs/GetWikiOTAs return their results in
+type WikiSortOrder string
+
+const (
+	WikiSortNone   WikiSortOrder = "none"   // wiki-table order
+	WikiSortNewest WikiSortOrder = "newest" // newest version/build first
+	WikiSortOldest WikiSortOrder = "oldest" // oldest version/build first
+)
+
+func (o WikiSortOrder) validate() error {
+	switch o {
+	case "", WikiSortNone, WikiSortNewest, WikiSortOldest:
+		return nil
+	default:
+		return fmt.Errorf("invalid wiki sort order '%s' (expected %s, %s or %s)", o, WikiSortNewest, WikiSortOldest, WikiSortNone)
+	}
+}
+
+// SortWikiFirmwares sorts firmwares with CompareFirmware (then by product) in the given order
+func SortWikiFirmwares(fws []WikiFirmware, order WikiSortOrder) {
+	if order == "" || order == WikiSortNone {
+		return
+	}
+	sort.SliceStable(fws, func(i, j int) bool {
+		c := CompareFirmware(fws[i], fws[j])
+		if c == 0 {
+			// keep device order ascending regardless of direction so output is deterministic
+			return strings.Compare(fws[i].Product, fws[j].Product) < 0
+		}
+		if order == WikiSortNewest {
+			return c > 0
+		}
+		return c < 0
+	})
+}
+
+// CompareFirmware returns -1, 0 or +1 if a was released before, with or after b: firmwares are ordered by
+// version, then build (see compareBuilds) and finally by their VersionExtra (beta N < RC N < release),
+// i.e. 16.1 beta 1 (20B5045d) < 16.1 RC (20B79) < 16.1 (20B82) < 16.1.1 (20B101) < 16.2 beta 1 (20C5032e).
+// A missing version or build is skipped.
+func CompareFirmware(a, b WikiFirmware) int {
+	if len(a.Version) > 0 && len(b.Version) > 0 {
+		if c := utils.Compare(a.Version, b.Version); c != 0 {
+			return c
+		}
+	}
+	if len(a.Build) > 0 && len(b.Build) > 0 {
+		if c := compareBuilds(a.Build, b.Build); c != 0 {
+			return c
+		}
+	}
+	ra, na := wikiPrerelease(a.VersionExtra)
+	rb, nb := wikiPrerelease(b.VersionExtra)
+	switch {
+	case ra != rb:
+		return cmp.Compare(ra, rb)
+	case na != nb:
+		return cmp.Compare(na, nb)
+	}
+	return strings.Compare(a.VersionExtra, b.VersionExtra)
+}
+
+// wikiPrereleaseRE matches the VersionExtra of a prerelease (i.e. "beta 3", "Public Beta 2", "RC", "GM seed")
+var wikiPrereleaseRE = regexp.MustCompile(`(?i)\b(beta|rc|release candidate|gm|golden master)\b(?:\s*seed)?\s*(\d+)?`)
+
+// wikiPrerelease ranks a VersionExtra: betas are 0, release candidates 1 and anything else (a release) 2;
+// n is the beta/RC number (1 if not listed)
+func wikiPrerelease(extra string) (rank, n int) {
+	m := wikiPrereleaseRE.FindStringSubmatch(extra)
+	if m == nil {
+		return 2, 0
+	}
+	n = 1
+	if len(m[2]) > 0 {
+		n, _ = strconv.Atoi(m[2])
+	}
+	if strings.EqualFold(m[1], "beta") {
+		return 0, n
+	}
+	return 1, n
+}
+
+// appleBuildRE matches an Apple build number: the major version, the train letter, the build and an optional suffix
+var appleBuildRE = regexp.MustCompile(`^(\d+)([A-Z])(\d+)([a-z]*)$`)
+
+// compareBuilds compares Apple build numbers (e.g. 20A362 < 20B5045d < 20B82 < 20C5032e < 20E252 < 20E772520a).
+// Builds are ordered by major version, train letter and build number except that a prerelease (a 4 digit
+// build with a suffix, i.e. 20B5045d) comes before the releases of its train; builds that don't look like
+// Apple's are compared piecewise.
+func compareBuilds(a, b string) int {
+	ma, mb := appleBuildRE.FindStringSubmatch(a), appleBuildRE.FindStringSubmatch(b)
+	if ma == nil || mb == nil {
+		return compareBuildParts(a, b)
+	}
+	if c := cmpAtoi(ma[1], mb[1]); c != 0 {
+		return c
+	}
+	if c := strings.Compare(ma[2], mb[2]); c != 0 {
+		return c
+	}
+	if pa, pb := isPrereleaseBuild(ma[3], ma[4]), isPrereleaseBuild(mb[3], mb[4]); pa != pb {
+		if pa {
+			return -1
+		}
+		return +1
+	}
+	if c := cmpAtoi(ma[3], mb[3]); c != 0 {
+		return c
+	}
+	return strings.Compare(ma[4], mb[4])
+}
+
+// isPrereleaseBuild returns true for the build number and suffix of a beta/seed (i.e. 5045 and d of 20B5045d)
+func isPrereleaseBuild(number, suffix string) bool {
+	return len(number) == 4 && len(suffix) > 0
+}
+
+func cmpAtoi(a, b string) int {
+	x, _ := strconv.Atoi(a)
+	y, _ := strconv.Atoi(b)
+	return cmp.Compare(x, y)
+}
+
+// compareBuildParts compares the digit/letter runs of two build numbers in turn
+func compareBuildParts(a, b string) int {
+	pa, pb := splitBuild(a), splitBuild(b)
+	for i := 0; i < len(pa) && i < len(pb); i++ {
+		x, errx := strconv.Atoi(pa[i])
+		y, erry := strconv.Atoi(pb[i])
+		var c int
+		if errx == nil && erry == nil {
+			c = x - y
+		} else {
+			c = strings.Compare(pa[i], pb[i])
+		}
+		if c < 0 {
+			return -1
+		} else if c > 0 {
+			return +1
+		}
+	}
+	switch {
+	case len(pa) < len(pb):
+		return -1
+	case len(pa) > len(pb):
+		return +1
+	}
+	return 0
+}
+
+// splitBuild splits a build number into alternating runs of digits and letters
+func splitBuild(build string) []string {
+	var parts []string
+	var cur strings.Builder
+	for i, r := range build {
+		if i > 0 && unicode.IsDigit(r) != unicode.IsDigit(rune(build[i-1])) {
+			parts = append(parts, cur.String())
+			cur.Reset()
+		}
+		cur.WriteRune(r)
+	}
+	if cur.Len() > 0 {
+		parts = append(parts, cur.String())
+	}
+	return parts
+}
@@ -0,0 +1,226 @@
+package download
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+// release order of real firmwares (builds from the wiki's Firmware and Beta Firmware pages)
+var wikiFirmwareSequences = map[string][]WikiFirmware{
+	"iOS 4": {
+		{Version: "4.0", VersionExtra: "beta", Build: "8A230m"},
+		{Version: "4.0", VersionExtra: "beta 2", Build: "8A248c"},
+		{Version: "4.0", VersionExtra: "beta 3", Build: "8A260b"},
+		{Version: "4.0", VersionExtra: "beta 4", Build: "8A274b"},
+		{Version: "4.0", VersionExtra: "GM", Build: "8A293"},
+		{Version: "4.0", Build: "8A293"},
+		{Version: "4.0.1", Build: "8A306"},
+		{Version: "4.2.1", Build: "8C148"},
+		{Version: "4.2.1", Build: "8C148a"},
+	},
+	"iOS 16": {
+		{Version: "16.0", VersionExtra: "beta", Build: "20A5283p"},
+		{Version: "16.0", VersionExtra: "beta 2", Build: "20A5303i"},
+		{Version: "16.0", VersionExtra: "beta 3", Build: "20A5312g"},
+		{Version: "16.0", VersionExtra: "beta 4", Build: "20A5328h"},
+		{Version: "16.0", VersionExtra: "beta 5", Build: "20A5339d"},
+		{Version: "16.0", VersionExtra: "beta 6", Build: "20A5349b"},
+		{Version: "16.0", VersionExtra: "beta 7", Build: "20A5356a"},
+		{Version: "16.0", VersionExtra: "beta 8", Build: "20A5358a"},
+		{Version: "16.0", VersionExtra: "RC", Build: "20A362"},
+		{Version: "16.0", Build: "20A362"},
+		{Version: "16.0.1", Build: "20A371"},
+		{Version: "16.0.2", Build: "20A380"},
+		{Version: "16.0.3", Build: "20A392"},
+		{Version: "16.1", VersionExtra: "beta", Build: "20B5045d"},
+		{Version: "16.1", VersionExtra: "beta 2", Build: "20B5050f"},
+		{Version: "16.1", VersionExtra: "beta 3", Build: "20B5056e"},
+		{Version: "16.1", VersionExtra: "beta 4", Build: "20B5064c"},
+		{Version: "16.1", VersionExtra: "beta 5", Build: "20B5072b"},
+		{Version: "16.1", VersionExtra: "RC", Build: "20B79"},
+		{Version: "16.1", Build: "20B82"},
+		{Version: "16.1.1", Build: "20B101"},
+		{Version: "16.1.2", Build: "20B110"},
+		{Version: "16.2", VersionExtra: "beta", Build: "20C5032e"},
+		{Version: "16.2", VersionExtra: "beta 2", Build: "20C5043e"},
+		{Version: "16.2", VersionExtra: "RC", Build: "20C65"},
+		{Version: "16.2", Build: "20C65"},
+		{Version: "16.3", Build: "20D47"},
+		{Version: "16.4", Build: "20E247"},
+		{Version: "16.4.1", Build: "20E252"},
+		{Version: "16.4.1", VersionExtra: "(a)", Build: "20E772520a"},
+		{Version: "16.5", Build: "20F66"},
+		{Version: "16.7", Build: "20H19"},
+	},
+	"iOS 17": {
+		{Version: "17.0", VersionExtra: "beta", Build: "21A5248v"},
+		{Version: "17.0", VersionExtra: "beta 2", Build: "21A5268h"},
+		{Version: "17.0", VersionExtra: "beta 3", Build: "21A5277h"},
+		{Version: "17.0", VersionExtra: "Public Beta 1", Build: "21A5277j"},
+		{Version: "17.0", VersionExtra: "beta 4", Build: "21A5291h"},
+		{Version: "17.0", VersionExtra: "beta 5", Build: "21A5303d"},
+		{Version: "17.0", VersionExtra: "beta 6", Build: "21A5312c"},
+		{Version: "17.0", VersionExtra: "beta 7", Build: "21A5319a"},
+		{Version: "17.0", VersionExtra: "beta 8", Build: "21A5326a"},
+		{Version: "17.0", VersionExtra: "RC", Build: "21A329"},
+		{Version: "17.0", Build: "21A329"},
+		{Version: "17.0.1", Build: "21A340"},
+		{Version: "17.0.2", Build: "21A350"},
+		{Version: "17.0.3", Build: "21A360"},
+		{Version: "17.1", VersionExtra: "beta", Build: "21B5045h"},
+		{Version: "17.1", VersionExtra: "beta 2", Build: "21B5056e"},
+		{Version: "17.1", VersionExtra: "RC", Build: "21B74"},
+		{Version: "17.1", Build: "21B74"},
+		{Version: "17.1.1", Build: "21B91"},
+		{Version: "17.2", VersionExtra: "beta", Build: "21C5029g"},
+		{Version: "17.2", Build: "21C62"},
+	},
+	"macOS 14": {
+		{Version: "14.0", VersionExtra: "beta", Build: "23A5257q"},
+		{Version: "14.0", VersionExtra: "beta 2", Build: "23A5276g"},
+		{Version: "14.0", VersionExtra: "RC", Build: "23A339"},
+		{Version: "14.0", VersionExtra: "RC 2", Build: "23A344"},
+		{Version: "14.0", Build: "23A344"},
+		{Version: "14.1", VersionExtra: "beta", Build: "23B5046f"},
+		{Version: "14.1", Build: "23B74"},
+		{Version: "14.1.1", Build: "23B81"},
+	},
+}
+
+func TestCompareFirmwareSequences(t *testing.T) {
+	for name, seq := range wikiFirmwareSequences {
+		t.Run(name, func(t *testing.T) {
+			for i := range seq {
+				if c := CompareFirmware(seq[i], seq[i]); c != 0 {
+					t.Errorf("CompareFirmware(%s %s, itself) = %d", seq[i].Version, seq[i].Build, c)
+				}
+				for j := i + 1; j < len(seq); j++ {
+					if c := CompareFirmware(seq[i], seq[j]); c != -1 {
+						t.Errorf("CompareFirmware(%s %s %s, %s %s %s) = %d, want -1",
+							seq[i].Version, seq[i].VersionExtra, seq[i].Build, seq[j].Version, seq[j].VersionExtra, seq[j].Build, c)
+					}
+					if c := CompareFirmware(seq[j], seq[i]); c != +1 {
+						t.Errorf("CompareFirmware(%s %s %s, %s %s %s) = %d, want +1",
+							seq[j].Version, seq[j].VersionExtra, seq[j].Build, seq[i].Version, seq[i].VersionExtra, seq[i].Build, c)
+					}
+				}
+			}
+
+			shuffled := append([]WikiFirmware(nil), seq...)
+			rand.New(rand.NewSource(1)).Shuffle(len(shuffled), func(i, j int) { shuffled[i], shuffled[j] = shuffled[j], shuffled[i] })
+			SortWikiFirmwares(shuffled, WikiSortOldest)
+			for i := range seq {
+				if !reflect.DeepEqual(shuffled[i], seq[i]) {
+					t.Fatalf("SortWikiFirmwares(oldest)[%d] = %s %s, want %s %s", i, shuffled[i].Version, shuffled[i].Build, seq[i].Version, seq[i].Build)
+				}
+			}
+			SortWikiFirmwares(shuffled, WikiSortNewest)
+			if first, last := shuffled[0], seq[len(seq)-1]; !reflect.DeepEqual(first, last) {
+				t.Errorf("SortWikiFirmwares(newest)[0] = %s %s, want %s %s", first.Version, first.Build, last.Version, last.Build)
+			}
+		})
+	}
+}
+
+func TestCompareBuilds(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"20B5045d", "20B82", -1},      // beta before the release of its train
+		{"20B79", "20B82", -1},         // RC before release
+		{"20A392", "20B5045d", -1},     // next train's beta after this train's releases
+		{"20E252", "20E772520a", -1},   // Rapid Security Response after its base build
+		{"20H19", "21A5248v", -1},      // next major
+		{"9A405", "10A403", -1},        // numeric major
+		{"8C148", "8C148a", -1},        // re-released build
+		{"21A5277h", "21A5277j", -1},   // suffix of the same seed
+		{"21A329", "21A329", 0},        // same build
+		{"10.1.1", "10.1.10", -1},      // not an Apple build: piecewise
+		{"2023.1", "2022.9", +1},       // not an Apple build: piecewise
+		{"7A341", "7A238j", +1},        // old 3 digit betas keep numeric order
+		{"23A5257q", "23A339", -1},     // macOS beta before RC
+		{"21G1974", "21G920", +1},      // 4 digit release builds without a suffix
+		{"22A5266r", "21G1974", +1},    // beta of the next major
+		{"15A5278f", "15A372", -1},     // iOS 11 beta
+		{"13A4325c", "13A344", -1},     // iOS 9 beta (4xxx seed)
+		{"18A5373a", "18A373", -1},     // same digits as the release
+		{"19H12", "19H370", -1},        // 15.7 < 15.7.9
+		{"20G5065a", "20G75", -1},      // 16.6 beta before 16.6
+		{"21E5184i", "21E219", -1},     // 17.4 beta before 17.4
+		{"21F5048f", "21E237", +1},     // 17.5 beta after 17.4.1
+		{"16H81", "16G201", +1},        // train letter
+		{"21A5248v", "21A5248v", 0},    // same beta
+		{"20C5032e", "20C5043e", -1},   // beta number
+		{"13G36", "13E238", +1},        // 9.3.5 after 9.3.1
+		{"1A543a", "1C25", -1},         // 1.0 before 1.0.1
+		{"11D257", "11D5145e", +1},     // 7.1.2 after the 7.1.2 beta
+		{"17G65", "17G2208", -1},       // 10.13.6 supplemental builds
+		{"20B101", "20B110", -1},       // 16.1.1 before 16.1.2
+		{"21B5045h", "21A360", +1},     // 17.1 beta after 17.0.3
+		{"20E772520a", "20F66", -1},    // RSR before the next update
+		{"", "20A362", -1},             // missing build
+		{"20A362", "", +1},             // missing build
+		{"", "", 0},                    // both missing
+		{"20A362", "20A362a", -1},      // suffix on a release build
+		{"4A93", "4A102", -1},          // iPhone OS 1.1.3 builds
+		{"5A347", "5A345", +1},         // iPhone OS 2.0 builds
+		{"21A5291h", "21A5291j", -1},   // re-spun seed
+		{"21A5326a", "21A329", -1},     // last beta before RC
+		{"20A5358a", "20A5356a", +1},   // beta 8 after beta 7
+		{"23B5046f", "23A344", +1},     // macOS 14.1 beta after 14.0
+		{"21C5029g", "21B91", +1},      // 17.2 beta after 17.1.1
+		{"20E5239b", "20E5229e", +1},   // 16.4 betas
+		{"20E247", "20E5260a", +1},     // 16.4 after its beta
+		{"20D47", "20D5024e", +1},      // 16.3 after its beta
+		{"20F5028e", "20E772520a", +1}, // 16.5 beta after 16.4.1 (a)
+	}
+	for _, tt := range tests {
+		if got := compareBuilds(tt.a, tt.b); got != tt.want {
+			t.Errorf("compareBuilds(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestCompareFirmwareVersionExtra(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"beta", "beta 2", -1},
+		{"beta 2", "beta 10", -1},
+		{"Developer Beta 3", "Public Beta 3", 0},
+		{"beta 8", "RC", -1},
+		{"RC", "RC 2", -1},
+		{"Release Candidate", "RC 2", -1},
+		{"GM seed", "RC", 0},
+		{"RC 3", "", -1},
+		{"beta", "", -1},
+		{"", "", 0},
+	}
+	for _, tt := range tests {
+		a := WikiFirmware{Version: "17.0", Build: "21A329", VersionExtra: tt.a}
+		b := WikiFirmware{Version: "17.0", Build: "21A329", VersionExtra: tt.b}
+		if tt.want == 0 {
+			// equal ranks are only tie-broken on the raw strings
+			ra, na := wikiPrerelease(tt.a)
+			rb, nb := wikiPrerelease(tt.b)
+			if ra != rb || na != nb {
+				t.Errorf("wikiPrerelease(%q) = %d/%d, wikiPrerelease(%q) = %d/%d; want equal", tt.a, ra, na, tt.b, rb, nb)
+			}
+			continue
+		}
+		if got := CompareFirmware(a, b); got != tt.want {
+			t.Errorf("CompareFirmware(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+
+	// a missing version or build falls through to the next key
+	if c := CompareFirmware(WikiFirmware{Build: "20B5045d"}, WikiFirmware{Version: "16.1", Build: "20B82"}); c != -1 {
+		t.Errorf("CompareFirmware(no version) = %d, want -1", c)
+	}
+	if c := CompareFirmware(WikiFirmware{Version: "16.1", VersionExtra: "beta"}, WikiFirmware{Version: "16.1", Build: "20B82"}); c != -1 {
+		t.Errorf("CompareFirmware(no build) = %d, want -1", c)
+	}
+}
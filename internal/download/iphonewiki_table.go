@@ -0,0 +1,226 @@
+package download
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/olekukonko/tablewriter"
+)
+
+const (
+	wikiTableGap        = 2
+	wikiTableMinURLSoft = 40 // shrink the URL to this before touching the device column
+	wikiTableMinURL     = 16
+	wikiTableMinDevice  = 12
+)
+
+// WikiTableConfig is the config for RenderWikiTable
+type WikiTableConfig struct {
+	Width   int  // terminal width (0 means unlimited)
+	NoTrunc bool // never truncate the device/URL columns
+}
+
+var wikiTableHeader = []string{"DEVICE", "VERSION", "BUILD", "DATE", "SIZE", "URL"}
+
+const (
+	wikiColDevice = iota
+	wikiColVersion
+	wikiColBuild
+	wikiColDate
+	wikiColSize
+	wikiColURL
+)
+
+// RenderWikiTable writes fws to w as a column-aligned table; when conf.Width is set the
+// URL and device columns are truncated so that each line fits the terminal
+func RenderWikiTable(w io.Writer, fws []WikiFirmware, conf *WikiTableConfig) error {
+	if conf == nil {
+		conf = &WikiTableConfig{}
+	}
+
+	rows := [][]string{wikiTableHeader}
+	for _, fw := range fws {
+		rows = append(rows, wikiTableRow(fw))
+	}
+
+	widths := make([]int, len(wikiTableHeader))
+	for _, row := range rows {
+		for i, cell := range row {
+			if n := utf8.RuneCountInString(cell); n > widths[i] {
+				widths[i] = n
+			}
+		}
+	}
+
+	if conf.Width > 0 && !conf.NoTrunc {
+		total := wikiTableGap * (len(widths) - 1)
+		for _, n := range widths {
+			total += n
+		}
+		for _, col := range []struct{ idx, min int }{
+			{wikiColURL, wikiTableMinURLSoft},
+			{wikiColDevice, wikiTableMinDevice},
+			{wikiColURL, wikiTableMinURL},
+		} {
+			if over := total - conf.Width; over > 0 && widths[col.idx] > col.min {
+				shrink := min(over, widths[col.idx]-col.min)
+				widths[col.idx] -= shrink
+				total -= shrink
+			}
+		}
+	}
+
+	for _, row := range rows {
+		var sb strings.Builder
+		for i, cell := range row {
+			switch i {
+			case wikiColURL:
+				cell = truncateLeft(cell, widths[i])
+			default:
+				cell = truncateRight(cell, widths[i])
+			}
+			sb.WriteString(cell)
+			if i < len(row)-1 {
+				sb.WriteString(strings.Repeat(" ", widths[i]-utf8.RuneCountInString(cell)+wikiTableGap))
+			}
+		}
+		if _, err := fmt.Fprintln(w, strings.TrimRight(sb.String(), " ")); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func wikiTableRow(fw WikiFirmware) []string {
+	device := strings.Join(wikiTableDevices(fw), ", ")
+	if len(device) == 0 {
+		device = fw.Product
+	}
+	version := fw.Version
+	if len(fw.VersionExtra) > 0 {
+		version += " " + fw.VersionExtra
+	}
+	date := "-"
+	if !fw.ReleaseDate.IsZero() {
+		date = fw.ReleaseDate.Format("2006-01-02")
+	}
+	return []string{
+		orDash(device),
+		orDash(version),
+		orDash(fw.Build),
+		date,
+		humanizeWikiSize(fw.FileSize),
+		orDash(fw.URL),
+	}
+}
+
+// wikiSignedCell is the signed column of a firmware (- when it wasn't checked)
+func wikiSignedCell(signed *bool) string {
+	switch {
+	case signed == nil:
+		return "-"
+	case *signed:
+		return "yes"
+	default:
+		return "no"
+	}
+}
+
+// wikiTableDevices returns the marketing names of fw's devices when they were resolved, its devices otherwise
+func wikiTableDevices(fw WikiFirmware) []string {
+	if len(fw.DeviceNames) > 0 {
+		return fw.DeviceNames
+	}
+	return fw.Devices
+}
+
+// wikiGridMaxDevices is the number of devices listed in a RenderWikiGrid cell before the rest are summarized
+const wikiGridMaxDevices = 3
+
+// RenderWikiGrid writes fws to w as a bordered ASCII grid (version, build, devices, release date and size);
+// a signed column is added when the signing status of any firmware was checked
+func RenderWikiGrid(w io.Writer, fws []WikiFirmware) error {
+	header := []string{"Version", "Build", "Devices", "Date", "Size"}
+	signed := slices.ContainsFunc(fws, func(fw WikiFirmware) bool { return fw.Signed != nil })
+	if signed {
+		header = append(header, "Signed")
+	}
+	table := tablewriter.NewWriter(w)
+	table.SetHeader(header)
+	table.SetAutoWrapText(false)
+	table.SetAutoFormatHeaders(false)
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	for _, fw := range fws {
+		row := wikiTableRow(fw)
+		cells := []string{
+			row[wikiColVersion],
+			row[wikiColBuild],
+			wikiGridDevices(fw),
+			row[wikiColDate],
+			row[wikiColSize],
+		}
+		if signed {
+			cells = append(cells, wikiSignedCell(fw.Signed))
+		}
+		table.Append(cells)
+	}
+	table.Render()
+	return nil
+}
+
+// wikiGridDevices lists the first wikiGridMaxDevices devices of fw and how many more there are
+func wikiGridDevices(fw WikiFirmware) string {
+	devices := wikiTableDevices(fw)
+	if len(devices) == 0 {
+		return orDash(fw.Product)
+	}
+	if len(devices) <= wikiGridMaxDevices {
+		return strings.Join(devices, ", ")
+	}
+	return fmt.Sprintf("%s (+%d more)", strings.Join(devices[:wikiGridMaxDevices], ", "), len(devices)-wikiGridMaxDevices)
+}
+
+// humanizeWikiSize formats size in GiB (or MiB when under 1 GiB) with one decimal
+func humanizeWikiSize(size int) string {
+	const (
+		mib = 1 << 20
+		gib = 1 << 30
+	)
+	switch {
+	case size <= 0:
+		return "-"
+	case size < gib:
+		return fmt.Sprintf("%.1f MiB", float64(size)/mib)
+	default:
+		return fmt.Sprintf("%.1f GiB", float64(size)/gib)
+	}
+}
+
+func orDash(s string) string {
+	if len(s) == 0 {
+		return "-"
+	}
+	return s
+}
+
+// truncateRight keeps the start of s (used for device lists)
+func truncateRight(s string, width int) string {
+	r := []rune(s)
+	if len(r) <= width {
+		return s
+	}
+	return string(r[:width-1]) + "…"
+}
+
+// truncateLeft keeps the end of s (the filename is the interesting part of a URL)
+func truncateLeft(s string, width int) string {
+	r := []rune(s)
+	if len(r) <= width {
+		return s
+	}
+	return "…" + string(r[len(r)-width+1:])
+}
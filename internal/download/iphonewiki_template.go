@@ -0,0 +1,92 @@
+package download
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+var wikiPathSegmentRE = regexp.MustCompile(`[<>:"\\|?*\x00-\x1f]+`)
+
+// wikiTemplateFuncs are the functions available to the --output-template and --format templates
+var wikiTemplateFuncs = template.FuncMap{
+	"join":  strings.Join,
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+	"first": func(s []string) string {
+		if len(s) == 0 {
+			return ""
+		}
+		return s[0]
+	},
+	"json": func(v any) (string, error) {
+		dat, err := json.Marshal(v)
+		return string(dat), err
+	},
+}
+
+// WikiOutputTemplate computes per-firmware destination directories under a base output directory
+type WikiOutputTemplate struct {
+	base string
+	tmpl *template.Template
+}
+
+// NewWikiOutputTemplate parses text as a Go template over the WikiFirmware fields (i.e. "{{.Product}}/{{.Version}}/{{.Build}}/");
+// an empty text puts every file directly in base
+func NewWikiOutputTemplate(base, text string) (*WikiOutputTemplate, error) {
+	if len(base) == 0 {
+		base = "."
+	}
+	t := &WikiOutputTemplate{base: filepath.Clean(base)}
+	if len(text) == 0 {
+		return t, nil
+	}
+	tmpl, err := template.New("output").Option("missingkey=error").Funcs(wikiTemplateFuncs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse output template: %w", err)
+	}
+	t.tmpl = tmpl
+	return t, nil
+}
+
+// Dir returns the destination directory for fw; each path segment is sanitized, empty segments are
+// dropped and templates that would escape the base directory are refused
+func (t *WikiOutputTemplate) Dir(fw WikiFirmware) (string, error) {
+	if t.tmpl == nil {
+		return t.base, nil
+	}
+
+	var buf bytes.Buffer
+	if err := t.tmpl.Execute(&buf, fw); err != nil {
+		return "", fmt.Errorf("failed to execute output template: %w", err)
+	}
+	out := strings.TrimSpace(buf.String())
+	if strings.HasPrefix(out, "/") || filepath.IsAbs(out) {
+		return "", fmt.Errorf("output template produced an absolute path '%s'", out)
+	}
+
+	var segs []string
+	for _, seg := range strings.FieldsFunc(out, func(r rune) bool { return r == '/' || r == '\\' }) {
+		seg = strings.TrimSpace(wikiPathSegmentRE.ReplaceAllString(seg, "_"))
+		switch seg {
+		case "", ".":
+			continue
+		case "..":
+			return "", fmt.Errorf("output template path '%s' escapes the output directory", out)
+		}
+		segs = append(segs, seg)
+	}
+	if len(segs) == 0 {
+		return t.base, nil
+	}
+
+	rel := filepath.Join(segs...)
+	if !filepath.IsLocal(rel) {
+		return "", fmt.Errorf("output template path '%s' escapes the output directory", out)
+	}
+	return filepath.Join(t.base, rel), nil
+}
@@ -0,0 +1,931 @@
+package download
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestParseWikiDocumentation(t *testing.T) {
+	tests := []struct {
+		name string
+		cell string
+		want []string
+	}{
+		{
+			name: "link markup",
+			cell: "[https://support.apple.com/kb/DL1 Release Notes]<br/>[https://support.apple.com/kb/DL2 Security]",
+			want: []string{"https://support.apple.com/kb/DL1 Release Notes", "https://support.apple.com/kb/DL2 Security"},
+		},
+		{
+			name: "bare pdf url",
+			cell: "https://example.com/deploy/iOS_17_Deployment.pdf<br />[https://example.com/notes Notes]",
+			want: []string{"https://example.com/deploy/iOS_17_Deployment.pdf", "https://example.com/notes Notes"},
+		},
+		{
+			name: "media and file links",
+			cell: "[[Media:iOS 17 Enterprise.pdf|Enterprise]]<br>[[File:Deploy.pdf]]",
+			want: []string{
+				"https://theapplewiki.com/wiki/Special:FilePath/iOS_17_Enterprise.pdf Enterprise",
+				"https://theapplewiki.com/wiki/Special:FilePath/Deploy.pdf",
+			},
+		},
+		{
+			name: "plain text and placeholders",
+			cell: "{{n/a}}<br/>See below",
+			want: []string{"See below"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseWikiDocumentation(tt.cell); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseWikiDocumentation() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+var updateGolden = flag.Bool("update", false, "update golden files")
+
+func TestRenderWikiTable(t *testing.T) {
+	fws := []WikiFirmware{
+		{
+			Version:     "17.0",
+			Build:       "21A329",
+			Devices:     []string{"iPhone15,2", "iPhone15,3"},
+			ReleaseDate: time.Date(2023, 9, 18, 0, 0, 0, 0, time.UTC),
+			FileSize:    7149483421,
+			URL:         "https://updates.cdn-apple.com/2023FallFCS/fullrestores/042-54861/A1B2C3D4/iPhone15,2_17.0_21A329_Restore.ipsw",
+		},
+		{
+			Version:      "17.1",
+			VersionExtra: "beta 2",
+			Build:        "21B5056e",
+			Product:      "iPad Pro (12.9-inch) (6th generation)",
+			FileSize:     524288000,
+			URL:          "https://updates.cdn-apple.com/2023FallSeed/fullrestores/042-70000/iPad_Fall_2022_17.1_21B5056e_Restore.ipsw",
+		},
+		{
+			Version: "16.7",
+			Build:   "20H19",
+		},
+	}
+
+	for _, width := range []int{80, 160} {
+		t.Run(fmt.Sprintf("width %d", width), func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := RenderWikiTable(&buf, fws, &WikiTableConfig{Width: width}); err != nil {
+				t.Fatalf("RenderWikiTable() error = %v", err)
+			}
+			golden := filepath.Join("testdata", fmt.Sprintf("wiki_table_%d.golden", width))
+			if *updateGolden {
+				if err := os.WriteFile(golden, buf.Bytes(), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := buf.String(); got != string(want) {
+				t.Errorf("RenderWikiTable() =\n%s\nwant:\n%s", got, want)
+			}
+			for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+				if n := utf8.RuneCountInString(line); n > width {
+					t.Errorf("line is %d wide (> %d): %q", n, width, line)
+				}
+			}
+		})
+	}
+
+	var buf bytes.Buffer
+	if err := RenderWikiTable(&buf, fws[:1], &WikiTableConfig{Width: 40, NoTrunc: true}); err != nil {
+		t.Fatalf("RenderWikiTable() error = %v", err)
+	}
+	if !strings.Contains(buf.String(), fws[0].URL) {
+		t.Errorf("NoTrunc should keep the full URL: %q", buf.String())
+	}
+}
+
+func TestRenderWikiGrid(t *testing.T) {
+	fws := []WikiFirmware{
+		{
+			Version:     "17.0",
+			Build:       "21A329",
+			Devices:     []string{"iPhone15,2", "iPhone15,3", "iPhone15,4", "iPhone15,5", "iPhone14,7"},
+			ReleaseDate: time.Date(2023, 9, 18, 0, 0, 0, 0, time.UTC),
+			FileSize:    7149483421,
+		},
+		{Version: "16.7", Build: "20H19", Product: "iPhone 14"},
+	}
+
+	var buf bytes.Buffer
+	if err := RenderWikiGrid(&buf, fws); err != nil {
+		t.Fatalf("RenderWikiGrid() error = %v", err)
+	}
+	out := buf.String()
+	for _, want := range []string{"+---", "| Version |", "iPhone15,2, iPhone15,3, iPhone15,4 (+2 more)", "2023-09-18", "6.7 GiB", "iPhone 14"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("RenderWikiGrid() is missing %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "iPhone14,7") {
+		t.Errorf("RenderWikiGrid() should truncate long device lists:\n%s", out)
+	}
+}
+
+func TestWikiFirmwareResolveDeviceNames(t *testing.T) {
+	fw := WikiFirmware{Version: "17.0", Build: "21A329", Devices: []string{"iPhone15,2", "iPhone15,3", "iphone15,2", "iPhone99,1"}}
+	if err := fw.ResolveDeviceNames(); err != nil {
+		t.Fatalf("ResolveDeviceNames() error = %v", err)
+	}
+	if want := []string{"iPhone 14 Pro", "iPhone 14 Pro Max", "iPhone99,1"}; !reflect.DeepEqual(fw.DeviceNames, want) {
+		t.Errorf("DeviceNames = %q, want %q", fw.DeviceNames, want)
+	}
+
+	var buf bytes.Buffer
+	if err := RenderWikiGrid(&buf, []WikiFirmware{fw}); err != nil {
+		t.Fatalf("RenderWikiGrid() error = %v", err)
+	}
+	if out := buf.String(); !strings.Contains(out, "iPhone 14 Pro, iPhone 14 Pro Max, iPhone99,1") {
+		t.Errorf("RenderWikiGrid() should list the device names:\n%s", out)
+	}
+}
+
+func TestDeviceCoverageDiff(t *testing.T) {
+	old := []WikiFirmware{
+		{Version: "16.7", Devices: []string{"iPhone10,3", "iPhone11,2"}},
+		{Version: "16.7", Devices: []string{"iPhone12,1"}},
+	}
+	new := []WikiFirmware{
+		{Version: "17.0", Devices: []string{"iPhone11,2", "iPhone12,1"}},
+		{Version: "17.0", Devices: []string{"iPhone16,1", "iPhone15,4"}},
+	}
+	added, dropped := DeviceCoverageDiff(old, new)
+	if want := []string{"iPhone15,4", "iPhone16,1"}; !reflect.DeepEqual(added, want) {
+		t.Errorf("newlySupported = %v, want %v", added, want)
+	}
+	if want := []string{"iPhone10,3"}; !reflect.DeepEqual(dropped, want) {
+		t.Errorf("dropped = %v, want %v", dropped, want)
+	}
+}
+
+func TestParseWikiStatus(t *testing.T) {
+	tests := []struct {
+		cell       string
+		wantCell   string
+		wantStatus WikiFirmwareStatus
+	}{
+		{"17.0", "17.0", WikiStatusReleased},
+		{"<s>21A329</s>", "21A329", WikiStatusPulled},
+		{"<del>16.0 beta 5</del>", "16.0 beta 5", WikiStatusPulled},
+		{"20A5349b (pulled)", "20A5349b", WikiStatusPulled},
+		{"18.2.1 (re-released)", "18.2.1", WikiStatusReReleased},
+		{"<s>16E227</s><br/>Re-released as 16E227a", "16E227<br/>Re-released as 16E227a", WikiStatusReReleased},
+	}
+	for _, tt := range tests {
+		cell, status := parseWikiStatus(tt.cell)
+		if cell != tt.wantCell || status != tt.wantStatus {
+			t.Errorf("parseWikiStatus(%q) = %q, %q; want %q, %q", tt.cell, cell, status, tt.wantCell, tt.wantStatus)
+		}
+	}
+}
+
+func TestParseWikiExpiration(t *testing.T) {
+	jan19 := time.Date(2024, time.January, 19, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		cell     string
+		wantCell string
+		want     time.Time
+	}{
+		{"17.3 beta 1", "17.3 beta 1", time.Time{}},
+		{"17.3 beta 1<ref>Expires on {{date|2024|01|19}}.</ref>", "17.3 beta 1", jan19},
+		{`21D5026f<ref name="exp">This beta expires January 19, 2024</ref>`, "21D5026f", jan19},
+		{"21D5026f<ref>Not available on the iPhone 15</ref>", "21D5026f<ref>Not available on the iPhone 15</ref>", time.Time{}},
+	}
+	for _, tt := range tests {
+		cell, expires := parseWikiExpiration(tt.cell)
+		if cell != tt.wantCell || !expires.Equal(tt.want) {
+			t.Errorf("parseWikiExpiration(%q) = %q, %v; want %q, %v", tt.cell, cell, expires, tt.wantCell, tt.want)
+		}
+	}
+
+	for _, cell := range []string{"{{date|2024|01|19}}", "Jan. 19, 2024", "19 January 2024", "2024-01-19"} {
+		if got, ok := parseWikiDate(cell); !ok || !got.Equal(jan19) {
+			t.Errorf("parseWikiDate(%q) = %v, %v", cell, got, ok)
+		}
+	}
+}
+
+func TestParseWikiTableDeviceCase(t *testing.T) {
+	text := `== iPhone 13 ==
+{| class="wikitable"
+|-
+! Version
+! Build
+! Keys
+! Release Date
+! Download URL
+|-
+| 15.0
+| 19A346
+| [[Sky 19A346 (iPhone14,5)|iphone14,5]]<br/>[[Sky 19A346 (iPhone14,5)|iPhone14,5]]<br/>[[Sky 19A346 (iPhone14,2)|IPHONE14,2]]
+| {{date|2021|09|20}}
+| [https://updates.cdn-apple.com/2021FallFCS/fullrestores/iPhone_6.1_P3_15.0_19A346_Restore.ipsw iPhone_6.1_P3_15.0_19A346_Restore.ipsw]
+|}
+`
+	fws, err := parseWikiTable(text)
+	if err != nil {
+		t.Fatalf("parseWikiTable() error = %v", err)
+	}
+	if len(fws) != 1 {
+		t.Fatalf("parseWikiTable() = %d firmwares, want 1", len(fws))
+	}
+	if want := []string{"iPhone14,5", "iPhone14,2"}; !reflect.DeepEqual(fws[0].Devices, want) {
+		t.Errorf("Devices = %v, want %v", fws[0].Devices, want)
+	}
+}
+
+func TestParseWikiTableBoardSubtitles(t *testing.T) {
+	text := `== iPhone 15 Pro ==
+=== [[D83AP]] ===
+{| class="wikitable"
+|-
+! Version
+! Build
+! Release Date
+! Download URL
+|-
+| 17.0
+| 21A329
+| {{date|2023|09|18}}
+| [https://updates.cdn-apple.com/2023FallFCS/fullrestores/042-54780/iPhone16,1_17.0_21A329_Restore.ipsw iPhone16,1_17.0_21A329_Restore.ipsw]
+|}
+== iPad Pro (11-inch) ==
+=== J317xAP ===
+{| class="wikitable"
+|-
+! Version
+! Build
+! Release Date
+! Download URL
+|-
+| 17.0
+| 21A329
+| {{date|2023|09|18}}
+| [https://updates.cdn-apple.com/2023FallFCS/fullrestores/042-54823/iPad_Pro_HFR_17.0_21A329_Restore.ipsw iPad_Pro_HFR_17.0_21A329_Restore.ipsw]
+|}
+== Unreleased ==
+=== Z999AP ===
+{| class="wikitable"
+|-
+! Version
+! Build
+! Release Date
+! Download URL
+|-
+| 17.0
+| 21A329
+| {{date|2023|09|18}}
+| [https://updates.cdn-apple.com/2023FallFCS/fullrestores/042-00000/Z999_17.0_21A329_Restore.ipsw Z999_17.0_21A329_Restore.ipsw]
+|}
+`
+	fws, err := parseWikiTable(text)
+	if err != nil {
+		t.Fatalf("parseWikiTable() error = %v", err)
+	}
+	var got []string
+	for _, fw := range fws {
+		got = append(got, strings.Join(fw.Devices, ",")+"/"+fw.BoardID)
+	}
+	// unknown boards are kept as the device as before (with a warning)
+	if want := []string{"iPhone16,1/D83AP", "iPad8,2/J317xAP", "Z999AP/"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("parseWikiTable() devices/boards = %v, want %v", got, want)
+	}
+}
+
+func TestParseWikiTableReportedVersion(t *testing.T) {
+	text := `== iPhone 14 ==
+{| class="wikitable"
+|-
+! Real Version
+! Reported Version
+! Build
+! Download URL
+|-
+| 16.4.1
+| 16.4.1 (a)<ref>Shown in Settings</ref>
+| 20E772520a
+| [https://updates.cdn-apple.com/2023SpringFCS/patches/rsr_a.zip rsr_a.zip]
+|-
+| 16.5
+| 16.5
+| 20F66
+| [https://updates.cdn-apple.com/2023SpringFCS/patches/16.5.zip 16.5.zip]
+|-
+| 16.5.1
+| {{n/a}}
+| 20F75
+| [https://updates.cdn-apple.com/2023SummerFCS/patches/16.5.1.zip 16.5.1.zip]
+|}
+`
+	fws, err := parseWikiTable(text)
+	if err != nil {
+		t.Fatalf("parseWikiTable() error = %v", err)
+	}
+	var got []string
+	for _, fw := range fws {
+		got = append(got, fw.Version+"/"+fw.ReportedVersion)
+	}
+	// the reported version is only kept when it differs from the real one
+	if want := []string{"16.4.1/16.4.1 (a)", "16.5/", "16.5.1/"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("parseWikiTable() versions/reported = %v, want %v", got, want)
+	}
+}
+
+func TestParseWikiTableBuilds(t *testing.T) {
+	text := `== iPhone 14 ==
+{| class="wikitable"
+|-
+! Version
+! Build
+! Keys
+! Download URL
+|-
+| 16.0
+| 20A362<br/>20A371
+| [[Bluebird 20A362 (iPhone14,7)|iPhone14,7]]<br/>[[Bluebird 20A371 (iPhone14,8)|iPhone14,8]]
+| [https://updates.cdn-apple.com/2022FallFCS/fullrestores/012-40402/iPhone14,7_16.0_20A362_Restore.ipsw iPhone14,7_16.0_20A362_Restore.ipsw]
+|-
+| 16.0.1
+| 20A371<ref>Only on the iPhone 14 Plus</ref>
+| [[Bluebird 20A371 (iPhone14,8)|iPhone14,8]]
+| [https://updates.cdn-apple.com/2022FallFCS/fullrestores/012-72340/iPhone14,8_16.0.1_20A371_Restore.ipsw iPhone14,8_16.0.1_20A371_Restore.ipsw]
+|}
+`
+	fws, err := parseWikiTable(text)
+	if err != nil {
+		t.Fatalf("parseWikiTable() error = %v", err)
+	}
+	if len(fws) != 2 {
+		t.Fatalf("parseWikiTable() = %d firmwares, want 2", len(fws))
+	}
+
+	fw := fws[0]
+	if fw.Build != "20A362" || !reflect.DeepEqual(fw.Builds, []string{"20A362", "20A371"}) {
+		t.Errorf("Build/Builds = %s/%v, want 20A362/[20A362 20A371]", fw.Build, fw.Builds)
+	}
+	if want := map[string]string{"iPhone14,7": "20A362", "iPhone14,8": "20A371"}; !reflect.DeepEqual(fw.DeviceBuilds, want) {
+		t.Errorf("DeviceBuilds = %v, want %v", fw.DeviceBuilds, want)
+	}
+	if got := fw.BuildFor("iphone14,8"); got != "20A371" {
+		t.Errorf("BuildFor(iphone14,8) = %s, want 20A371", got)
+	}
+	if found := findWikiFirmware(fws, "iPhone14,8", "20A371"); found == nil || found.Version != "16.0" {
+		t.Errorf("findWikiFirmware(iPhone14,8, 20A371) = %+v, want the 16.0 row", found)
+	}
+
+	// a single build keeps the old shape
+	fw = fws[1]
+	if fw.Build != "20A371" || fw.Builds != nil || fw.DeviceBuilds != nil || fw.BuildFor("iPhone14,8") != "20A371" {
+		t.Errorf("single build row = %s/%v/%v", fw.Build, fw.Builds, fw.DeviceBuilds)
+	}
+}
+
+func TestParseWikiTableNotes(t *testing.T) {
+	text := `== iPhone 14 ==
+{| class="wikitable"
+|-
+! Version
+! Build
+! Keys
+! Download URL
+|-
+| 16.0<ref name="cn">Only available in [[China (region)|China]]
+(see [https://support.apple.com/HT201222 About iOS 16 Updates])</ref>
+| 20A362
+| [[Bluebird 20A362 (iPhone14,7)|iPhone14,7]]<ref>Pulled on {{date|2022|09|20}} due to a '''camera''' bug</ref>
+| [https://updates.cdn-apple.com/2022FallFCS/fullrestores/012-40402/iPhone14,7_16.0_20A362_Restore.ipsw iPhone14,7_16.0_20A362_Restore.ipsw]
+|-
+| 16.0.1
+| 20A371<ref name="cn" />
+| [[Bluebird 20A371 (iPhone14,7)|iPhone14,7]]
+| [https://updates.cdn-apple.com/2022FallFCS/fullrestores/012-72340/iPhone14,7_16.0.1_20A371_Restore.ipsw iPhone14,7_16.0.1_20A371_Restore.ipsw]
+|-
+| 16.0.2
+| 20A380
+| [[Bluebird 20A380 (iPhone14,7)|iPhone14,7]]
+| [https://updates.cdn-apple.com/2022FallFCS/fullrestores/012-72341/iPhone14,7_16.0.2_20A380_Restore.ipsw iPhone14,7_16.0.2_20A380_Restore.ipsw]
+|}
+`
+	fws, err := parseWikiTable(text)
+	if err != nil {
+		t.Fatalf("parseWikiTable() error = %v", err)
+	}
+	if len(fws) != 3 {
+		t.Fatalf("parseWikiTable() = %d firmwares, want 3", len(fws))
+	}
+
+	china := "Only available in China (see About iOS 16 Updates)"
+	fw := fws[0]
+	if fw.Version != "16.0" || fw.VersionExtra != "" || !reflect.DeepEqual(fw.Devices, []string{"iPhone14,7"}) {
+		t.Errorf("multi-line footnote row = %s %q %v", fw.Version, fw.VersionExtra, fw.Devices)
+	}
+	if want := []string{china, "Pulled on 2022-09-20 due to a camera bug"}; !reflect.DeepEqual(fw.Notes, want) {
+		t.Errorf("Notes = %q, want %q", fw.Notes, want)
+	}
+	// a named footnote is reused by <ref name="..." /> in later rows
+	if fw = fws[1]; fw.Build != "20A371" || !reflect.DeepEqual(fw.Notes, []string{china}) {
+		t.Errorf("reused footnote row = %s notes %q, want %q", fw.Build, fw.Notes, china)
+	}
+	if fw = fws[2]; fw.Notes != nil {
+		t.Errorf("row without footnotes has notes %q", fw.Notes)
+	}
+}
+
+func TestParseWikiTableInlineCells(t *testing.T) {
+	text, err := os.ReadFile(filepath.Join("testdata", "wiki_inline_cells.wikitext"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fws, err := parseWikiTable(string(text))
+	if err != nil {
+		t.Fatalf("parseWikiTable() error = %v", err)
+	}
+	var got []string
+	for _, fw := range fws {
+		got = append(got, fmt.Sprintf("%s %s %v %s %s %d", fw.Version, fw.Build, fw.Devices, fw.ReleaseDate.Format("2006-01-02"), path.Base(fw.URL), fw.FileSize))
+	}
+	// the inline (first row), mixed (second row) and one cell per line (third row) styles parse the same
+	want := []string{
+		"16.0 20A362 [iPhone14,7] 2022-09-12 iPhone14,7_16.0_20A362_Restore.ipsw 6516846530",
+		"16.0.1 20A371 [iPhone14,7] 2022-09-14 iPhone14,7_16.0.1_20A371_Restore.ipsw 6516988411",
+		"16.0.2 20A380 [iPhone14,7] 2022-09-22 iPhone14,7_16.0.2_20A380_Restore.ipsw 6517061722",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseWikiTable() =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	// separators inside templates and links aren't cell separators
+	if got, want := splitWikiInlineCells("| {{n/a||x}} || [[a||b]] ||20A362"), []string{"| {{n/a||x}}", "| [[a||b]]", "| 20A362"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("splitWikiInlineCells() = %q, want %q", got, want)
+	}
+}
+
+func TestParseWikiMinHostVersion(t *testing.T) {
+	text := `== iPhone ==
+{| class="wikitable"
+|-
+! Version
+! Build
+! Keys
+! Minimum iTunes Version
+! Release Date
+! Download URL
+|-
+| 4.3
+| 8F190
+| [[Durango 8F190 (iPhone3,1)|iPhone3,1]]
+| [[iTunes]] 10.2<ref>iTunes 10.2 or later is required.</ref>
+| {{date|2011|03|09}}
+| [http://appldnld.apple.com/iPhone4/041-0330.20110311.Cswe3/iPhone3,1_4.3_8F190_Restore.ipsw iPhone3,1_4.3_8F190_Restore.ipsw]
+|}
+`
+	fws, err := parseWikiTable(text)
+	if err != nil {
+		t.Fatalf("parseWikiTable() error = %v", err)
+	}
+	if len(fws) != 1 || fws[0].MinHostVersion != "10.2" || fws[0].Build != "8F190" {
+		t.Errorf("parseWikiTable() = %+v, want 8F190 with MinHostVersion 10.2", fws)
+	}
+
+	for cell, want := range map[string]string{
+		"10.5":                     "10.5",
+		"[[iTunes 12.5.1|12.5.1]]": "12.5.1",
+		"{{n/a}}":                  "",
+		"<ref name=\"x\"/>9.0.3":   "9.0.3",
+	} {
+		if got := parseWikiMinHostVersion(cell); got != want {
+			t.Errorf("parseWikiMinHostVersion(%q) = %q, want %q", cell, got, want)
+		}
+	}
+}
+
+func TestGroupWikiFirmwares(t *testing.T) {
+	fws := []WikiFirmware{
+		{Version: "10.0", Build: "14A346", Devices: []string{"iPhone9,1", "iPhone10,1"}},
+		{Version: "9.3", Build: "13E233", Devices: []string{"iphone9,1"}},
+		{Version: "10.0", Build: "14A403", Devices: []string{"IPHONE9,1"}},
+		{Version: "", Build: "1A1", Product: "Apple TV (2nd generation)"},
+	}
+
+	for _, by := range [][]WikiGroupKey{{WikiGroupDevice, WikiGroupVersion}, {WikiGroupVersion, WikiGroupDevice}} {
+		name := fmt.Sprintf("%s_%s", by[0], by[1])
+		t.Run(name, func(t *testing.T) {
+			dat, err := json.MarshalIndent(GroupWikiFirmwares(fws, by...), "", "  ")
+			if err != nil {
+				t.Fatalf("json.MarshalIndent() error = %v", err)
+			}
+			dat = append(dat, '\n')
+			golden := filepath.Join("testdata", "wiki_group_"+name+".golden")
+			if *updateGolden {
+				if err := os.WriteFile(golden, dat, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(dat) != string(want) {
+				t.Errorf("GroupWikiFirmwares(%v) =\n%s\nwant:\n%s", by, dat, want)
+			}
+		})
+	}
+
+	groups := GroupWikiFirmwares(fws, WikiGroupDevice)
+	if g := groups.Get("iPhone9,1"); g == nil || len(g.Firmwares) != 3 {
+		t.Errorf("case variants of iPhone9,1 should share a group: %+v", groups)
+	}
+
+	if _, err := ParseWikiGroupKeys([]string{"device", "build"}); err == nil {
+		t.Error("expected error for an invalid group key")
+	}
+	if _, err := ParseWikiGroupKeys([]string{"device", "Device"}); err == nil {
+		t.Error("expected error for a duplicate group key")
+	}
+}
+
+func TestGroupByDevice(t *testing.T) {
+	fws := []WikiFirmware{
+		{Build: "21A329", Devices: []string{"iPhone14,5", "iPhone14,2"}},
+		{Build: "21A340", Devices: []string{"iPhone14,5", "iPhone14,5"}},
+		{Build: "8A400", Product: "Apple TV (2nd generation)"},
+		{Build: "1A1"},
+	}
+	groups := GroupByDevice(fws)
+	if len(groups) != 3 {
+		t.Fatalf("GroupByDevice() = %d groups, want 3", len(groups))
+	}
+	var builds []string
+	for _, fw := range groups["iPhone14,5"] {
+		builds = append(builds, fw.Build)
+	}
+	if want := []string{"21A329", "21A340"}; !reflect.DeepEqual(builds, want) {
+		t.Errorf("iPhone14,5 builds = %v, want %v", builds, want)
+	}
+	if len(groups["iPhone14,2"]) != 1 || len(groups["Apple TV (2nd generation)"]) != 1 {
+		t.Errorf("GroupByDevice() = %v", groups)
+	}
+}
+
+func TestWikiFirmwarePage(t *testing.T) {
+	tests := []struct {
+		device string
+		build  string
+		want   string
+	}{
+		{"iPhone15,2", "21A329", "Firmware/iPhone/17.x"},
+		{"iphone10,3", "15A372", "Firmware/iPhone/11.x"},
+		{"iPhone1,1", "7A341", "Firmware/iPhone/3.x"},
+		{"iPad13,8", "20A362", "Firmware/iPad Pro/16.x"},
+		{"iPad14,1", "21A329", "Firmware/iPad mini/17.x"},
+		{"Watch6,1", "21R356", "Firmware/Apple Watch/10.x"},
+		{"AppleTV14,1", "21J354", "Firmware/Apple TV/17.x"},
+		{"MacBookAir10,1", "23A344", "Firmware/Mac/14.x"},
+	}
+	for _, tt := range tests {
+		got, err := wikiFirmwarePage(tt.device, tt.build)
+		if err != nil || got != tt.want {
+			t.Errorf("wikiFirmwarePage(%s, %s) = %s, %v; want %s", tt.device, tt.build, got, err, tt.want)
+		}
+	}
+
+	for _, bad := range [][2]string{{"iPhone99,9", "21A329"}, {"iPhone15,2", "beta"}, {"Watch1,1", "11A465"}} {
+		if _, err := wikiFirmwarePage(bad[0], bad[1]); !errors.Is(err, ErrWikiNotFound) {
+			t.Errorf("wikiFirmwarePage(%s, %s) error = %v, want ErrWikiNotFound", bad[0], bad[1], err)
+		}
+	}
+
+	fws := []WikiFirmware{
+		{Build: "21A329", Devices: []string{"iPhone15,20"}},
+		{Build: "21A329", Devices: []string{"iPhone15,2", "iPhone15,3"}, URL: "want"},
+	}
+	if fw := findWikiFirmware(fws, "iphone15,2", "21a329"); fw == nil || fw.URL != "want" {
+		t.Errorf("findWikiFirmware() = %+v", fw)
+	}
+	if fw := findWikiFirmware(fws, "iPhone15,2", "21A340"); fw != nil {
+		t.Errorf("findWikiFirmware(other build) = %+v", fw)
+	}
+}
+
+func TestParseWikiURLs(t *testing.T) {
+	tests := []struct {
+		cell string
+		want []WikiFirmwareURL
+	}{
+		{
+			cell: "[https://updates.cdn-apple.com/iPhone15,2_17.0_21A329_Restore.ipsw iPhone15,2_17.0_21A329_Restore.ipsw]",
+			want: []WikiFirmwareURL{{URL: "https://updates.cdn-apple.com/iPhone15,2_17.0_21A329_Restore.ipsw"}},
+		},
+		{
+			cell: "[https://appldnld.apple.com/iOS7/iPhone6,2_7.0_11A465_Restore.ipsw]<br/>[https://appldnld.apple.com.cn/iOS7/iPhone6,2_7.0_11A465_Restore.ipsw China]",
+			want: []WikiFirmwareURL{
+				{URL: "https://appldnld.apple.com/iOS7/iPhone6,2_7.0_11A465_Restore.ipsw"},
+				{URL: "https://appldnld.apple.com.cn/iOS7/iPhone6,2_7.0_11A465_Restore.ipsw", Variant: "China"},
+			},
+		},
+		{
+			cell: "https://example.com/a.zip<br />[https://example.com/b.zip Verizon]",
+			want: []WikiFirmwareURL{{URL: "https://example.com/a.zip"}, {URL: "https://example.com/b.zip", Variant: "Verizon"}},
+		},
+		{cell: "{{n/a}}"},
+	}
+	for _, tt := range tests {
+		if got := parseWikiURLs(tt.cell); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseWikiURLs(%q) = %+v, want %+v", tt.cell, got, tt.want)
+		}
+	}
+}
+
+func TestWikiOSFilter(t *testing.T) {
+	tests := []struct {
+		page    string
+		version string
+		want    string
+	}{
+		{"Firmware/iPhone/17.x", "17.0", WikiOSiOS},
+		{"Firmware/iPad/12.x", "12.4", WikiOSiOS},
+		{"Firmware/iPad Pro/13.x", "13.1", WikiOSiPadOS},
+		{"Firmware/iPad/17.x", "", WikiOSiPadOS},
+		{"Firmware/Apple TV/17.x", "17.0", WikiOStvOS},
+		{"Beta Firmware/Apple Watch/10.x", "10.0", WikiOSwatchOS},
+		{"Firmware/Mac/14.x", "14.0", WikiOSmacOS},
+		{"Firmware/iBridge", "8.0", WikiOSbridgeOS},
+		{"Firmware/HomePod/17.x", "17.0", ""},
+	}
+	for _, tt := range tests {
+		if got := inferWikiOS(tt.page, tt.version); got != tt.want {
+			t.Errorf("inferWikiOS(%q, %q) = %q, want %q", tt.page, tt.version, got, tt.want)
+		}
+	}
+
+	cfg := &WikiConfig{OS: "iPadOS"}
+	if cfg.skipWikiPage("Firmware/iPad") || cfg.skipWikiPage("Firmware/iPad Air/13.x") {
+		t.Error("skipWikiPage() skipped an iPad page that may hold iPadOS")
+	}
+	if !cfg.skipWikiPage("Firmware/iPhone/17.x") || !cfg.skipWikiPage("Firmware/iPad/12.x") {
+		t.Error("skipWikiPage() kept a page that can't hold iPadOS")
+	}
+	fws := cfg.filterWikiOS("Firmware/iPad", []WikiFirmware{{Version: "12.4"}, {Version: "13.1"}})
+	if len(fws) != 1 || fws[0].Version != "13.1" || fws[0].OS != WikiOSiPadOS {
+		t.Errorf("filterWikiOS() = %+v, want only 13.1", fws)
+	}
+
+	if err := validateWikiOS("android"); err == nil {
+		t.Error("expected error for unknown OS")
+	}
+}
+
+func TestWikiOutputTemplate(t *testing.T) {
+	fw := WikiFirmware{Product: "iPhone 15 Pro", Version: "17.0", Build: "21A329", Devices: []string{"iPhone16,1"}}
+
+	tmpl, err := NewWikiOutputTemplate("out", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dir, err := tmpl.Dir(fw); err != nil || dir != "out" {
+		t.Errorf("default Dir() = %q, %v; want out", dir, err)
+	}
+
+	tests := []struct {
+		text    string
+		want    string
+		wantErr bool
+	}{
+		{text: "{{.Product}}/{{.Version}}/{{.Build}}/", want: filepath.Join("out", "iPhone 15 Pro", "17.0", "21A329")},
+		{text: "{{first .Devices}}/{{.VersionExtra}}/{{.Build}}", want: filepath.Join("out", "iPhone16,1", "21A329")},
+		{text: "{{.Product}}:{{.Build}}?", want: filepath.Join("out", "iPhone 15 Pro_21A329_")},
+		{text: "../{{.Build}}", wantErr: true},
+		{text: "{{.Build}}/../../etc", wantErr: true},
+		{text: "/etc/{{.Build}}", wantErr: true},
+		{text: "{{.Nope}}", wantErr: true},
+	}
+	for _, tt := range tests {
+		tmpl, err := NewWikiOutputTemplate("out", tt.text)
+		if err != nil {
+			t.Fatalf("NewWikiOutputTemplate(%q) error = %v", tt.text, err)
+		}
+		dir, err := tmpl.Dir(fw)
+		if (err != nil) != tt.wantErr || dir != tt.want {
+			t.Errorf("Dir(%q) = %q, %v; want %q (err=%t)", tt.text, dir, err, tt.want, tt.wantErr)
+		}
+	}
+
+	if _, err := NewWikiOutputTemplate("out", "{{.Build"); err == nil {
+		t.Error("expected error for an unparsable template")
+	}
+}
+
+func TestWikiFormat(t *testing.T) {
+	signed := true
+	fws := []WikiFirmware{
+		{Version: "17.0", Build: "21A329", Devices: []string{"iPhone15,2"}, Signed: &signed,
+			URLs: []WikiFirmwareURL{{URL: "https://a/1.ipsw"}, {URL: "https://a/2.ipsw", Variant: "China"}}},
+		{Version: "16.0", Build: "20A362", Devices: []string{"iPhone14,7", "iPhone14,8"}, Builds: []string{"20A362", "20A371"},
+			DeviceBuilds: map[string]string{"iPhone14,7": "20A362", "iPhone14,8": "20A371"}},
+	}
+
+	tests := []struct {
+		text string
+		want string
+	}{
+		{text: `{{.Version}} ({{.Build}})\t{{join .Devices ","}}`, want: "17.0 (21A329)\tiPhone15,2\n16.0 (20A362)\tiPhone14,7,iPhone14,8\n"},
+		{text: "{{.Build}}\n", want: "21A329\n20A362\n"}, // no doubled newline
+		{text: `{{json .Devices}}`, want: "[\"iPhone15,2\"]\n[\"iPhone14,7\",\"iPhone14,8\"]\n"},
+		{text: `{{range .URLs}}{{.Variant}}={{.URL}} {{end}}`, want: "=https://a/1.ipsw China=https://a/2.ipsw \n\n"},
+		{text: `{{index .DeviceBuilds "iPhone14,8"}}|{{if .Signed}}{{.Signed}}{{else}}-{{end}}`, want: "|true\n20A371|-\n"},
+		{text: `{{range .URLs}}{{.URL}}{{"\n"}}{{end}}`, want: "https://a/1.ipsw\nhttps://a/2.ipsw\n\n"}, // escapes in actions are left alone
+		{text: `{{.Build}}{{"}}\t"}}\t{{.Version}}`, want: "21A329}}\t\t17.0\n20A362}}\t\t16.0\n"},
+	}
+	for _, tt := range tests {
+		f, err := NewWikiFormat(tt.text)
+		if err != nil {
+			t.Fatalf("NewWikiFormat(%q) error = %v", tt.text, err)
+		}
+		var buf bytes.Buffer
+		if err := f.Execute(&buf, fws); err != nil {
+			t.Fatalf("Execute(%q) error = %v", tt.text, err)
+		}
+		if buf.String() != tt.want {
+			t.Errorf("Execute(%q) = %q, want %q", tt.text, buf.String(), tt.want)
+		}
+	}
+
+	if _, err := NewWikiFormat("{{.Build"); err == nil {
+		t.Error("expected error for an unparsable template")
+	}
+	f, err := NewWikiFormat("{{.Nope}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Execute(io.Discard, fws); err == nil {
+		t.Error("expected error for an unknown field")
+	}
+	if help := WikiFormatHelp(); !strings.Contains(help, ".Devices") || !strings.Contains(help, "    .Variant") {
+		t.Errorf("WikiFormatHelp() is missing fields:\n%s", help)
+	}
+}
+
+func TestWikiFormatHelpExamples(t *testing.T) {
+	fws := []WikiFirmware{{Version: "17.0", Build: "21A329", Devices: []string{"iPhone15,2"}, URLs: []WikiFirmwareURL{{URL: "https://a/1.ipsw"}}}}
+	examples := regexp.MustCompile(`--format '([^']+)'`).FindAllStringSubmatch(WikiFormatHelp(), -1)
+	if len(examples) == 0 {
+		t.Fatal("WikiFormatHelp() has no --format examples")
+	}
+	for _, ex := range examples {
+		f, err := NewWikiFormat(ex[1])
+		if err != nil {
+			t.Errorf("help example %q: NewWikiFormat() error = %v", ex[1], err)
+			continue
+		}
+		if err := f.Execute(io.Discard, fws); err != nil {
+			t.Errorf("help example %q: Execute() error = %v", ex[1], err)
+		}
+	}
+}
+
+func TestWikiVersionsFromLinks(t *testing.T) {
+	links := []wikiLink{
+		{Link: "Firmware/iPhone/16.x"},
+		{Link: "Firmware/iPhone/17.x"},
+		{Link: "Firmware/iPhone/9.x"},
+		{Link: "Firmware/iPad/17.x"},
+		{Link: "Firmware/Apple Watch/10.x"},
+		{Link: "Firmware/iPhone/17.x"},
+		{Link: "Firmware/iPhone"},
+	}
+	if got, want := wikiVersionsFromLinks(links, "Firmware/iPhone/"), []string{"17", "16", "9"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("wikiVersionsFromLinks(iPhone) = %v, want %v", got, want)
+	}
+	if got, want := wikiVersionsFromLinks(links, "Firmware/"), []string{"17", "16", "10", "9"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("wikiVersionsFromLinks() = %v, want %v", got, want)
+	}
+}
+
+func TestParseWikiXMLExport(t *testing.T) {
+	table := func(version, build, device string) string {
+		return `== Firmware ==
+{| class="wikitable"
+|-
+! Version
+! Build
+! Keys
+! Release Date
+! Download URL
+|-
+| ` + version + `
+| ` + build + `
+| [[Sky ` + build + ` (` + device + `)|` + device + `]]
+| {{date|2023|09|18}}
+| [https://updates.cdn-apple.com/fullrestores/` + device + `_` + version + `_` + build + `_Restore.ipsw ` + device + `_` + version + `_` + build + `_Restore.ipsw]
+|}
+`
+	}
+	page := func(title, text string, extra string) string {
+		var buf bytes.Buffer
+		xml.EscapeText(&buf, []byte(text))
+		return `<page><title>` + title + `</title><ns>0</ns>` + extra +
+			`<revision><text xml:space="preserve">old revision</text></revision>` +
+			`<revision><text xml:space="preserve">` + buf.String() + `</text></revision></page>`
+	}
+	export := `<mediawiki xmlns="http://www.mediawiki.org/xml/export-0.11/" version="0.11" xml:lang="en">
+<siteinfo><sitename>The Apple Wiki</sitename></siteinfo>
+` + page("Firmware/iPhone/17.x", table("17.0", "21A329", "iPhone15,2"), "") +
+		page("Firmware/iPad/17.x", table("17.0", "21A329", "iPad14,1"), "") +
+		page("Firmware/iPhone/16.x", table("16.6", "20G75", "iPhone15,2"), "") +
+		page("Firmware/iPhone/Old", "#REDIRECT [[Firmware/iPhone/16.x]]", `<redirect title="Firmware/iPhone/16.x" />`) +
+		page("Sky 21A329 (iPhone15,2)", "{{keys}} .ipsw", "") + `
+</mediawiki>`
+
+	fws, err := ParseWikiXMLExport(strings.NewReader(export), &WikiConfig{IPSW: true, SortOrder: WikiSortNewest})
+	if err != nil {
+		t.Fatalf("ParseWikiXMLExport() error = %v", err)
+	}
+	var builds []string
+	for _, fw := range fws {
+		builds = append(builds, fw.Build+"/"+strings.Join(fw.Devices, ","))
+	}
+	if want := []string{"21A329/iPhone15,2", "21A329/iPad14,1", "20G75/iPhone15,2"}; !reflect.DeepEqual(builds, want) {
+		t.Errorf("ParseWikiXMLExport() = %v, want %v", builds, want)
+	}
+
+	// --device limits the pages to its family (and --version to its major version)
+	fws, err = ParseWikiXMLExport(strings.NewReader(export), &WikiConfig{Device: "iPhone15,2", Version: "16.6"})
+	if err != nil {
+		t.Fatalf("ParseWikiXMLExport(device) error = %v", err)
+	}
+	if len(fws) != 1 || fws[0].Build != "20G75" {
+		t.Errorf("ParseWikiXMLExport(device) = %+v, want 20G75", fws)
+	}
+
+	if _, err := ParseWikiXMLExport(strings.NewReader("<mediawiki><page><title>"), &WikiConfig{}); err == nil {
+		t.Error("ParseWikiXMLExport(truncated) = nil error")
+	}
+}
+
+func TestParseWikiSHA1(t *testing.T) {
+	const sha = "da39a3ee5e6b4b0d3255bfef95601890afd80709"
+	for cell, want := range map[string]string{
+		"<code>" + sha + "</code>":                                  sha,
+		"<code>DA39A3EE 5E6B4B0D 3255BFEF 95601890 AFD80709</code>": sha,
+		"DA39A3EE\t5E6B4B0D 3255BFEF\n95601890 AFD80709":            sha,
+		sha + `<ref name="sha"/>`:                                   sha,
+		"{{n/a}}":                                                   "",
+		"":                                                          "",
+		"<code>da39a3ee5e6b4b0d</code>":                             "",
+		"<code>zz39a3ee5e6b4b0d3255bfef95601890afd80709</code>": "",
+	} {
+		if got := parseWikiSHA1(cell); got != want {
+			t.Errorf("parseWikiSHA1(%q) = %q, want %q", cell, got, want)
+		}
+	}
+}
+
+func TestParseWikiFileSize(t *testing.T) {
+	for _, tt := range []struct {
+		cell   string
+		want   int
+		wantOK bool
+	}{
+		{"1,234,567", 1234567, true},
+		{"2831155200", 2831155200, true},
+		{"9217 blocks", 9217 * 4096, true},
+		{"1 block", 4096, true},
+		{"12,345 Blocks", 12345 * 4096, true},
+		{"1.5 GB", 1500000000, true},
+		{"300 MiB", 300 << 20, true},
+		{"512 bytes", 512, true},
+		{"1024<ref>approximate</ref>", 1024, true},
+		{"{{n/a}}", 0, false},
+		{"", 0, false},
+		{"unknown", 0, false},
+	} {
+		if got, ok := parseWikiFileSize(tt.cell); got != tt.want || ok != tt.wantOK {
+			t.Errorf("parseWikiFileSize(%q) = %d, %t, want %d, %t", tt.cell, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
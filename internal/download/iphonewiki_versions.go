@@ -0,0 +1,74 @@
+package download
+
+import (
+	"context"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/blacktop/ipsw/pkg/info"
+)
+
+// wikiMajorPageRE matches the per-major-version firmware pages (i.e. Firmware/iPhone/17.x)
+var wikiMajorPageRE = regexp.MustCompile(`/(\d+)\.x$`)
+
+// GetWikiVersions returns the major versions (newest first) that have a firmware page on the wiki
+// for cfg's device family (or for every family if cfg.Device is empty or unknown)
+func GetWikiVersions(cfg *WikiConfig, proxy string, insecure bool) ([]string, error) {
+	return GetWikiVersionsWithConfig(cfg, legacyDownloadConfig(proxy, insecure))
+}
+
+// GetWikiVersionsWithConfig is GetWikiVersions using the network settings in dl
+func GetWikiVersionsWithConfig(cfg *WikiConfig, dl *DownloadConfig) ([]string, error) {
+	c, err := NewWikiClient(dl.withMinTLS(cfg.MinTLS))
+	if err != nil {
+		return nil, err
+	}
+	return c.GetVersions(cfg)
+}
+
+// GetVersions returns the major versions (newest first) that have a firmware page on the wiki
+func (c *WikiClient) GetVersions(cfg *WikiConfig) ([]string, error) {
+	page := wikiIndexPage(cfg)
+
+	prefix := page + "/"
+	if len(cfg.Device) > 0 {
+		if db, err := info.GetIpswDB(); err == nil {
+			prod := db.CanonicalProductType(cfg.Device)
+			if dev, err := db.LookupDevice(prod); err == nil {
+				if family := wikiFamily(prod, dev); len(family) > 0 {
+					prefix = page + "/" + family + "/"
+				}
+			}
+		}
+	}
+
+	wpage, err := c.getWikiPage(context.Background(), page)
+	if err != nil {
+		return nil, err
+	}
+	return wikiVersionsFromLinks(wpage.Parse.Links, prefix), nil
+}
+
+// wikiVersionsFromLinks returns the unique major versions of the links under prefix (newest first)
+func wikiVersionsFromLinks(links []wikiLink, prefix string) []string {
+	var majors []int
+	for _, link := range links {
+		if !strings.HasPrefix(link.Link, prefix) {
+			continue
+		}
+		if m := wikiMajorPageRE.FindStringSubmatch(link.Link); m != nil {
+			if major, err := strconv.Atoi(m[1]); err == nil && !slices.Contains(majors, major) {
+				majors = append(majors, major)
+			}
+		}
+	}
+	slices.Sort(majors)
+	slices.Reverse(majors)
+	versions := make([]string, 0, len(majors))
+	for _, major := range majors {
+		versions = append(versions, strconv.Itoa(major))
+	}
+	return versions
+}
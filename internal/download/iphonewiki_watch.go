@@ -0,0 +1,304 @@
+package download
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/blacktop/ipsw/pkg/info"
+)
+
+// WikiWatchConfig is the config for a WikiWatcher
+type WikiWatchConfig struct {
+	Devices  []string
+	OTA      bool // watch the OTA pages instead of the IPSW pages
+	Beta     bool
+	Interval time.Duration
+	Webhook  string // URL to POST a WikiWatchEvent to when new firmwares are listed (optional)
+	// StatePath is the JSON file the firmwares already seen are saved to (so restarts don't re-notify)
+	StatePath string
+	// WebhookRetries is how many times a failed webhook POST is retried (with exponential backoff)
+	WebhookRetries int
+	Download       *DownloadConfig // network settings of the scrapes and the webhook (proxy, CA bundle, rate limit...)
+}
+
+// WikiWatchEvent is the JSON payload POSTed to the webhook
+type WikiWatchEvent struct {
+	Time      time.Time      `json:"time"`
+	Devices   []string       `json:"devices"`
+	Firmwares []WikiFirmware `json:"firmwares"`
+}
+
+// wikiWatchState is what a WikiWatcher persists between runs
+type wikiWatchState struct {
+	Seen      map[string]time.Time `json:"seen"`              // build|url -> when it was first seen
+	Devices   []string             `json:"devices,omitempty"` // devices whose firmwares have been recorded
+	Pending   []WikiFirmware       `json:"pending,omitempty"` // new firmwares the webhook hasn't accepted yet
+	LastCheck time.Time            `json:"last_check"`
+}
+
+// watchClock is the time source of a WikiWatcher (faked in tests)
+type watchClock interface {
+	Now() time.Time
+	After(time.Duration) <-chan time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// WikiWatcher periodically scrapes the wiki for the configured devices and reports firmwares it hasn't seen before
+type WikiWatcher struct {
+	conf   WikiWatchConfig
+	state  wikiWatchState
+	clock  watchClock
+	scrape func(*WikiConfig, *DownloadConfig) ([]WikiFirmware, error)
+	client *http.Client
+}
+
+const (
+	wikiWatchMinInterval    = time.Minute
+	wikiWatchWebhookBackoff = 2 * time.Second
+	wikiWatchMaxBackoff     = 5 * time.Minute
+)
+
+// NewWikiWatcher returns a WikiWatcher resuming from the state at conf.StatePath (if it exists)
+func NewWikiWatcher(conf WikiWatchConfig) (*WikiWatcher, error) {
+	if len(conf.Devices) == 0 {
+		return nil, fmt.Errorf("at least one device is required")
+	}
+	if conf.Interval < wikiWatchMinInterval {
+		return nil, fmt.Errorf("interval must be at least %s (to be polite to the wiki)", wikiWatchMinInterval)
+	}
+	if len(conf.StatePath) == 0 {
+		return nil, fmt.Errorf("a state file path is required")
+	}
+	db, err := info.GetIpswDB()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get ipsw db: %v", err)
+	}
+	devices := make([]string, 0, len(conf.Devices))
+	for _, device := range conf.Devices {
+		device = db.CanonicalProductType(device)
+		if _, err := db.LookupDevice(device); err != nil {
+			return nil, err
+		}
+		devices = append(devices, device)
+	}
+	conf.Devices = devices
+
+	opts := conf.Download.ClientOptions()
+	opts.RateLimit, opts.Limiter = 0, nil // the wiki's rate limit isn't the webhook's
+	opts.RetryPolicy = nil                // the webhook has its own retries
+	if opts.Timeout == 0 {
+		opts.Timeout = 30 * time.Second
+	}
+	client, err := NewHTTPClient(opts)
+	if err != nil {
+		return nil, err
+	}
+	w := &WikiWatcher{
+		conf:   conf,
+		state:  wikiWatchState{Seen: make(map[string]time.Time)},
+		clock:  realClock{},
+		scrape: GetWikiIPSWsWithConfig,
+		client: client,
+	}
+	if conf.OTA {
+		w.scrape = GetWikiOTAsWithConfig
+	}
+	data, err := os.ReadFile(conf.StatePath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed to read watch state: %v", err)
+		}
+		return w, nil
+	}
+	if err := json.Unmarshal(data, &w.state); err != nil {
+		return nil, fmt.Errorf("failed to parse watch state %s: %v", conf.StatePath, err)
+	}
+	if w.state.Seen == nil {
+		w.state.Seen = make(map[string]time.Time)
+	}
+	return w, nil
+}
+
+// wikiWatchKey identifies a firmware across scrapes
+func wikiWatchKey(fw WikiFirmware) string {
+	return strings.ToUpper(fw.Build) + "|" + fw.URL
+}
+
+// Run checks for new firmwares immediately and then every interval until ctx is done;
+// failed checks are logged and retried on the next tick (rate limits double the wait)
+func (w *WikiWatcher) Run(ctx context.Context) error {
+	wait := w.conf.Interval
+	for {
+		if _, err := w.Check(ctx); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			if errors.Is(err, ErrWikiRateLimited) {
+				wait = min(wait*2, max(w.conf.Interval, time.Hour))
+			}
+			log.WithError(err).Errorf("wiki watch check failed (next check in %s)", wait)
+		} else {
+			wait = w.conf.Interval
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-w.clock.After(wait):
+		}
+	}
+}
+
+// Check scrapes the wiki once and returns the firmwares listed since the last check (the first
+// check of a device only records its current firmwares); new firmwares are logged and POSTed to the webhook
+func (w *WikiWatcher) Check(ctx context.Context) ([]WikiFirmware, error) {
+	now := w.clock.Now()
+
+	// nothing is recorded unless every device was scraped (so a failed check can't hide new firmwares)
+	var (
+		found      []WikiFirmware
+		newDevices []string
+	)
+	seen := make(map[string]bool)
+	reported := make(map[string]bool)
+	for _, device := range w.conf.Devices {
+		baseline := !slices.Contains(w.state.Devices, device)
+		if baseline {
+			newDevices = append(newDevices, device)
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		fws, err := w.scrape(&WikiConfig{
+			Device: device,
+			IPSW:   !w.conf.OTA,
+			OTA:    w.conf.OTA,
+			Beta:   w.conf.Beta,
+		}, w.conf.Download)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scrape %s: %w", device, err)
+		}
+		for _, fw := range fws {
+			if len(fw.URL) == 0 || !slices.ContainsFunc(fw.Devices, func(d string) bool { return strings.EqualFold(d, device) }) {
+				continue
+			}
+			key := wikiWatchKey(fw)
+			if _, ok := w.state.Seen[key]; ok {
+				continue
+			}
+			seen[key] = true
+			// a firmware is only new if a device that was already watched lists it
+			if !baseline && !reported[key] {
+				reported[key] = true
+				found = append(found, fw)
+			}
+		}
+	}
+	for key := range seen {
+		w.state.Seen[key] = now
+	}
+	w.state.Devices = append(w.state.Devices, newDevices...)
+	w.state.LastCheck = now
+
+	if len(newDevices) > 0 {
+		log.Infof("Watching %d firmware(s) for %s", len(w.state.Seen), strings.Join(newDevices, ", "))
+	}
+	for _, fw := range found {
+		log.WithFields(log.Fields{
+			"version": fw.Version,
+			"build":   fw.Build,
+			"devices": strings.Join(fw.Devices, ", "),
+		}).Info("New firmware")
+	}
+
+	w.state.Pending = append(w.state.Pending, found...)
+	if len(w.conf.Webhook) > 0 && len(w.state.Pending) > 0 {
+		if err := w.notify(ctx, w.state.Pending); err != nil {
+			log.WithError(err).Errorf("failed to notify webhook (will retry %d firmware(s) on the next check)", len(w.state.Pending))
+		} else {
+			w.state.Pending = nil
+		}
+	} else if len(w.conf.Webhook) == 0 {
+		w.state.Pending = nil
+	}
+
+	if err := w.save(); err != nil {
+		return found, err
+	}
+	return found, nil
+}
+
+// notify POSTs fws to the webhook, retrying network errors, 429s and 5xxs with exponential backoff
+func (w *WikiWatcher) notify(ctx context.Context, fws []WikiFirmware) error {
+	body, err := json.Marshal(WikiWatchEvent{Time: w.clock.Now().UTC(), Devices: w.conf.Devices, Firmwares: fws})
+	if err != nil {
+		return fmt.Errorf("failed to marshal webhook payload: %v", err)
+	}
+	backoff := wikiWatchWebhookBackoff
+	for attempt := 0; ; attempt++ {
+		err = w.post(ctx, body)
+		if err == nil {
+			return nil
+		}
+		var serr *StatusError
+		if errors.As(err, &serr) && serr.StatusCode != http.StatusTooManyRequests && serr.StatusCode < http.StatusInternalServerError {
+			return err // the webhook rejected the payload; retrying won't help
+		}
+		if attempt >= w.conf.WebhookRetries {
+			return err
+		}
+		log.WithError(err).Warnf("webhook failed, retrying in %s", backoff)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-w.clock.After(backoff):
+		}
+		backoff = min(backoff*2, wikiWatchMaxBackoff)
+	}
+}
+
+func (w *WikiWatcher) post(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.conf.Webhook, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create webhook request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &StatusError{StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+	return nil
+}
+
+// save writes the state atomically
+func (w *WikiWatcher) save() error {
+	data, err := json.MarshalIndent(w.state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal watch state: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(w.conf.StatePath), 0750); err != nil {
+		return fmt.Errorf("failed to create watch state folder: %v", err)
+	}
+	tmp := w.conf.StatePath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0660); err != nil {
+		return fmt.Errorf("failed to write watch state: %v", err)
+	}
+	return os.Rename(tmp, w.conf.StatePath)
+}
@@ -0,0 +1,235 @@
+package download
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	waits   []time.Duration
+	onAfter func()
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// After advances the clock by d and fires immediately
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	c.waits = append(c.waits, d)
+	c.now = c.now.Add(d)
+	ch := make(chan time.Time, 1)
+	ch <- c.now
+	onAfter := c.onAfter
+	c.mu.Unlock()
+	if onAfter != nil {
+		onAfter()
+	}
+	return ch
+}
+
+func newTestWatcher(t *testing.T, conf WikiWatchConfig, fws *[]WikiFirmware) (*WikiWatcher, *fakeClock) {
+	t.Helper()
+	w, err := NewWikiWatcher(conf)
+	if err != nil {
+		t.Fatalf("NewWikiWatcher() error = %v", err)
+	}
+	clock := &fakeClock{now: time.Date(2023, 9, 18, 17, 0, 0, 0, time.UTC)}
+	w.clock = clock
+	w.scrape = func(cfg *WikiConfig, dl *DownloadConfig) ([]WikiFirmware, error) {
+		if cfg.Device != "iPhone15,2" || !cfg.IPSW {
+			t.Errorf("unexpected scrape config %+v", cfg)
+		}
+		if dl != conf.Download {
+			t.Errorf("scrape download config = %+v, want %+v", dl, conf.Download)
+		}
+		return *fws, nil
+	}
+	return w, clock
+}
+
+func TestWikiWatcherCheck(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		statuses = []int{http.StatusBadGateway, http.StatusOK, http.StatusBadRequest, http.StatusOK}
+		events   []WikiWatchEvent
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		status := statuses[0]
+		statuses = statuses[1:]
+		if status == http.StatusOK {
+			var event WikiWatchEvent
+			if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+				t.Errorf("webhook payload is not JSON: %v", err)
+			}
+			events = append(events, event)
+		}
+		rw.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	conf := WikiWatchConfig{
+		Devices:        []string{"iphone15,2"},
+		Interval:       30 * time.Minute,
+		Webhook:        srv.URL,
+		StatePath:      filepath.Join(t.TempDir(), "watch.json"),
+		WebhookRetries: 2,
+		Download:       &DownloadConfig{RateLimit: 1, Retries: 3},
+	}
+	a := WikiFirmware{Version: "17.0", Build: "21A329", Devices: []string{"iPhone15,2"}, URL: "https://example.com/a.ipsw"}
+	b := WikiFirmware{Version: "17.0.1", Build: "21A340", Devices: []string{"iPhone15,2", "iPhone15,3"}, URL: "https://example.com/b.ipsw"}
+	c := WikiFirmware{Version: "17.0.2", Build: "21A350", Devices: []string{"iPhone15,2"}, URL: "https://example.com/c.ipsw"}
+	other := WikiFirmware{Version: "17.0.3", Build: "21A360", Devices: []string{"iPhone14,7"}, URL: "https://example.com/d.ipsw"}
+	fws := []WikiFirmware{a, other}
+
+	w, clock := newTestWatcher(t, conf, &fws)
+	ctx := context.Background()
+
+	// the first check is the baseline
+	if found, err := w.Check(ctx); err != nil || len(found) != 0 {
+		t.Fatalf("baseline Check() = %v, %v; want nothing new", found, err)
+	}
+
+	// a new build is POSTed to the webhook (after retrying the 502)
+	fws = []WikiFirmware{a, b, other}
+	found, err := w.Check(ctx)
+	if err != nil || len(found) != 1 || found[0].Build != "21A340" {
+		t.Fatalf("Check() = %v, %v; want 21A340", found, err)
+	}
+	if len(events) != 1 || len(events[0].Firmwares) != 1 || events[0].Firmwares[0].Build != "21A340" {
+		t.Errorf("webhook events = %+v", events)
+	}
+	if len(clock.waits) != 1 || clock.waits[0] != wikiWatchWebhookBackoff {
+		t.Errorf("webhook backoffs = %v, want [%s]", clock.waits, wikiWatchWebhookBackoff)
+	}
+
+	// the webhook rejects the next one (no retries); it is kept and sent with the next check
+	fws = []WikiFirmware{a, b, c}
+	if found, err := w.Check(ctx); err != nil || len(found) != 1 {
+		t.Fatalf("Check() = %v, %v; want 21A350", found, err)
+	}
+	if len(events) != 1 || len(clock.waits) != 1 {
+		t.Errorf("a 400 should not be retried: events = %d, backoffs = %v", len(events), clock.waits)
+	}
+
+	// state survives a restart
+	w, _ = newTestWatcher(t, conf, &fws)
+	if found, err := w.Check(ctx); err != nil || len(found) != 0 {
+		t.Fatalf("Check() after restart = %v, %v; want nothing new", found, err)
+	}
+	if len(events) != 2 || len(events[1].Firmwares) != 1 || events[1].Firmwares[0].Build != "21A350" {
+		t.Errorf("pending firmware was not re-sent: events = %+v", events)
+	}
+}
+
+func TestWikiWatcherRun(t *testing.T) {
+	fws := []WikiFirmware{{Version: "17.0", Build: "21A329", Devices: []string{"iPhone15,2"}, URL: "https://example.com/a.ipsw"}}
+	w, clock := newTestWatcher(t, WikiWatchConfig{
+		Devices:   []string{"iPhone15,2"},
+		Interval:  30 * time.Minute,
+		StatePath: filepath.Join(t.TempDir(), "watch.json"),
+	}, &fws)
+
+	checks := 0
+	scrape := w.scrape
+	w.scrape = func(cfg *WikiConfig, dl *DownloadConfig) ([]WikiFirmware, error) {
+		checks++
+		if checks == 2 {
+			return nil, ErrWikiRateLimited
+		}
+		return scrape(cfg, dl)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	clock.onAfter = func() {
+		if len(clock.waits) == 3 {
+			cancel()
+		}
+	}
+	if err := w.Run(ctx); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if checks < 3 {
+		t.Errorf("Run() checked %d times, want at least 3", checks)
+	}
+	// a rate limited check doubles the wait
+	if want := []time.Duration{30 * time.Minute, time.Hour, 30 * time.Minute}; len(clock.waits) != 3 ||
+		clock.waits[0] != want[0] || clock.waits[1] != want[1] || clock.waits[2] != want[2] {
+		t.Errorf("waits = %v, want %v", clock.waits, want)
+	}
+}
+
+func TestWikiWatcherNewDevice(t *testing.T) {
+	var events []WikiWatchEvent
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		var event WikiWatchEvent
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			t.Errorf("webhook payload is not JSON: %v", err)
+		}
+		events = append(events, event)
+	}))
+	defer srv.Close()
+
+	a := WikiFirmware{Version: "17.0", Build: "21A329", Devices: []string{"iPhone15,2"}, URL: "https://example.com/a.ipsw"}
+	b := WikiFirmware{Version: "17.0", Build: "21A329", Devices: []string{"iPhone14,7"}, URL: "https://example.com/b.ipsw"}
+	c := WikiFirmware{Version: "17.0.1", Build: "21A340", Devices: []string{"iPhone14,7", "iPhone15,2"}, URL: "https://example.com/c.ipsw"}
+	fws := map[string][]WikiFirmware{"iPhone15,2": {a}, "iPhone14,7": {b}}
+
+	conf := WikiWatchConfig{
+		Devices:   []string{"iPhone15,2"},
+		Interval:  30 * time.Minute,
+		Webhook:   srv.URL,
+		StatePath: filepath.Join(t.TempDir(), "watch.json"),
+	}
+	newWatcher := func() *WikiWatcher {
+		w, err := NewWikiWatcher(conf)
+		if err != nil {
+			t.Fatalf("NewWikiWatcher() error = %v", err)
+		}
+		w.clock = &fakeClock{now: time.Date(2023, 9, 18, 17, 0, 0, 0, time.UTC)}
+		w.scrape = func(cfg *WikiConfig, dl *DownloadConfig) ([]WikiFirmware, error) {
+			return fws[cfg.Device], nil
+		}
+		return w
+	}
+	ctx := context.Background()
+
+	if found, err := newWatcher().Check(ctx); err != nil || len(found) != 0 {
+		t.Fatalf("baseline Check() = %v, %v; want nothing new", found, err)
+	}
+
+	// a device added to the watch only records its firmwares
+	conf.Devices = []string{"iPhone15,2", "iPhone14,7"}
+	w := newWatcher()
+	if found, err := w.Check(ctx); err != nil || len(found) != 0 {
+		t.Fatalf("Check() with a new device = %v, %v; want nothing new", found, err)
+	}
+	if len(events) != 0 {
+		t.Errorf("a new device's firmwares were POSTed to the webhook: %+v", events)
+	}
+
+	// and is watched from then on
+	fws["iPhone14,7"] = []WikiFirmware{b, c}
+	fws["iPhone15,2"] = []WikiFirmware{a, c}
+	found, err := w.Check(ctx)
+	if err != nil || len(found) != 1 || found[0].Build != "21A340" {
+		t.Fatalf("Check() = %v, %v; want 21A340", found, err)
+	}
+	if len(events) != 1 || len(events[0].Firmwares) != 1 {
+		t.Errorf("webhook events = %+v", events)
+	}
+}
@@ -0,0 +1,110 @@
+package download
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/apex/log"
+)
+
+// wikiExportPage is a <page> of a MediaWiki XML export (Special:Export)
+type wikiExportPage struct {
+	Title    string    `xml:"title"`
+	NS       int       `xml:"ns"`
+	Redirect *struct{} `xml:"redirect"`
+	// exports can include the page history (the last revision is the current one)
+	Revisions []struct {
+		Text string `xml:"text"`
+	} `xml:"revision"`
+}
+
+// wikiIndexPage returns the wiki page that links to the firmware pages cfg selects
+func wikiIndexPage(cfg *WikiConfig) string {
+	switch {
+	case cfg.OTA && cfg.Beta:
+		return otaBetaPage
+	case cfg.OTA:
+		return otaPage
+	case cfg.Beta:
+		return ipswBetaPage
+	default:
+		return ipswPage
+	}
+}
+
+// ParseWikiXMLExport parses the firmwares from the firmware pages in a theapplewiki.com
+// MediaWiki XML export (i.e. from Special:Export) that match cfg; this is the offline
+// equivalent of GetWikiIPSWs/GetWikiOTAs (cfg.OTA selects the OTA pages).
+func ParseWikiXMLExport(r io.Reader, cfg *WikiConfig) ([]WikiFirmware, error) {
+	var fws []WikiFirmware
+
+	if err := cfg.SortOrder.validate(); err != nil {
+		return nil, err
+	}
+	if err := validateWikiOS(cfg.OS); err != nil {
+		return nil, err
+	}
+
+	filter := wikiIndexPage(cfg) + "/"
+	if len(cfg.Device) > 0 {
+		c := *cfg
+		c.IPSW = !cfg.OTA
+		var err error
+		if filter, err = CreateWikiFilter(&c); err != nil {
+			return nil, err
+		}
+	}
+	link := ".ipsw"
+	if cfg.OTA {
+		link = ".zip"
+	}
+
+	dec := xml.NewDecoder(r)
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, &WikiParseError{Msg: "failed to read XML export", Err: err}
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok || start.Name.Local != "page" {
+			continue
+		}
+		var page wikiExportPage
+		if err := dec.DecodeElement(&page, &start); err != nil {
+			return nil, &WikiParseError{Msg: "failed to parse XML export page", Err: err}
+		}
+
+		if page.NS != 0 || page.Redirect != nil || len(page.Revisions) == 0 || !strings.HasPrefix(page.Title, filter) {
+			continue
+		}
+		if strings.HasSuffix(page.Title, "iPod") || cfg.skipWikiPage(page.Title) { // skip weird info page (and other OS lineages)
+			continue
+		}
+		text := page.Revisions[len(page.Revisions)-1].Text
+		if !strings.Contains(text, link) {
+			continue
+		}
+
+		log.Debugf("Parsing wiki page: '%s'", page.Title)
+
+		tableFWs, err := parseWikiTable(text)
+		if err != nil {
+			var perr *WikiParseError
+			if errors.As(err, &perr) {
+				perr.Page = page.Title
+			}
+			return nil, fmt.Errorf("failed to parse wikitable: %w", err)
+		}
+
+		fws = append(fws, cfg.filterWikiOS(page.Title, tableFWs)...)
+	}
+
+	SortWikiFirmwares(fws, cfg.SortOrder)
+
+	return fws, nil
+}
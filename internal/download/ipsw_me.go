@@ -11,6 +11,8 @@ import (
 	"io"
 	"net/http"
 	"time"
+
+	"github.com/blacktop/ipsw/internal/ffi"
 )
 
 const ipswMeAPI = "https://api.ipsw.me/v4/"
@@ -67,27 +69,32 @@ func GetAllDevices() ([]Device, error) {
 }
 
 //export c_internal_download_ipsw_me_GetDevice
-func c_internal_download_ipsw_me_GetDevice(identifier *C.char, identifierLen C.uint, outJson **C.char, outJsonLen *C.uint, err **C.char, errLen *C.uint) C.char {
-
+func c_internal_download_ipsw_me_GetDevice(identifier *C.char, identifierLen C.uint, outJson **C.char, outJsonLen *C.uint, err **C.char, errLen *C.uint) (status C.char) {
+	defer ffi.Recover("c_internal_download_ipsw_me_GetDevice", func(perr error) {
+		outError := perr.Error()
+		*err = C.CString(outError)
+		*errLen = C.uint(len(outError))
+		status = C.char(ffi.InternalPanic)
+	})
 	device, deviceError := GetDevice(C.GoStringN(identifier, C.int(identifierLen)))
 	if deviceError != nil {
 		outError := fmt.Sprintf("c_GetDevice: GetDevice failed with %w", deviceError)
 		*err = C.CString(outError)
 		*errLen = C.uint(len(outError))
-		return C.char(0)
+		return C.char(ffi.Failure)
 	}
 	fret, jsonErr := json.Marshal(device)
 	if jsonErr != nil {
 		outError := fmt.Sprintf("c_GetDevice: Failed to serialize Device object: %w", jsonErr)
 		*err = C.CString(outError)
 		*errLen = C.uint(len(outError))
-		return C.char(0)
+		return C.char(ffi.Failure)
 	}
 	cs := C.CString(string(fret))
 	*outJson = cs
 	*outJsonLen = C.uint(C.strlen(cs))
 
-	return C.char(1)
+	return C.char(ffi.Success)
 }
 
 // GetDevice returns a device from it's identifier
@@ -117,26 +124,32 @@ func GetDevice(identifier string) (Device, error) {
 }
 
 //export c_internal_download_ipsw_me_GetDeviceIPSWs
-func c_internal_download_ipsw_me_GetDeviceIPSWs(identifier *C.char, identifierLen C.uint, outJson **C.char, outJsonLen *C.uint, err **C.char, errLen *C.uint) C.char {
+func c_internal_download_ipsw_me_GetDeviceIPSWs(identifier *C.char, identifierLen C.uint, outJson **C.char, outJsonLen *C.uint, err **C.char, errLen *C.uint) (status C.char) {
+	defer ffi.Recover("c_internal_download_ipsw_me_GetDeviceIPSWs", func(perr error) {
+		outError := perr.Error()
+		*err = C.CString(outError)
+		*errLen = C.uint(len(outError))
+		status = C.char(ffi.InternalPanic)
+	})
 	device, deviceError := GetDeviceIPSWs(C.GoStringN(identifier, C.int(identifierLen)))
 	if deviceError != nil {
 		outError := fmt.Sprintf("c_GetDeviceIPSWs: GetDeviceIPSWs failed with %w", deviceError)
 		*err = C.CString(outError)
 		*errLen = C.uint(len(outError))
-		return C.char(0)
+		return C.char(ffi.Failure)
 	}
 	fret, jsonErr := json.Marshal(device)
 	if jsonErr != nil {
 		outError := fmt.Sprintf("c_GetDeviceIPSWs: Failed to serialize Device object: %w", jsonErr)
 		*err = C.CString(outError)
 		*errLen = C.uint(len(outError))
-		return C.char(0)
+		return C.char(ffi.Failure)
 	}
 	cs := C.CString(string(fret))
 	*outJson = cs
 	*outJsonLen = C.uint(C.strlen(cs))
 
-	return C.char(1)
+	return C.char(ffi.Success)
 }
 
 // GetDeviceIPSWs returns a device's IPSWs from it's identifier
@@ -176,9 +189,22 @@ func GetAllIPSW(version string) ([]IPSW, error) {
 
 // GetIPSW will get an IPSW when supplied an identifier and build ID
 func GetIPSW(identifier, buildID string) (IPSW, error) {
+	return getIPSW(http.DefaultClient, identifier, buildID)
+}
+
+// GetIPSWWithConfig is GetIPSW using the download config's network settings (proxy, CA bundle, timeout...)
+func GetIPSWWithConfig(identifier, buildID string, dl *DownloadConfig) (IPSW, error) {
+	client, err := dl.NewClient()
+	if err != nil {
+		return IPSW{}, err
+	}
+	return getIPSW(client, identifier, buildID)
+}
+
+func getIPSW(client *http.Client, identifier, buildID string) (IPSW, error) {
 	i := IPSW{}
 
-	res, err := http.Get(ipswMeAPI + "ipsw/" + identifier + "/" + buildID)
+	res, err := client.Get(ipswMeAPI + "ipsw/" + identifier + "/" + buildID)
 	if err != nil {
 		return i, err
 	}
@@ -0,0 +1,143 @@
+package download
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/apex/log"
+)
+
+// MirrorRule rewrites download URLs starting with From to start with To instead
+// (i.e. "https://updates.cdn-apple.com/=https://mirror.lab.local/apple/")
+type MirrorRule struct {
+	From string
+	To   string
+}
+
+// ParseMirrorRules parses "from-prefix=to-prefix" rules
+func ParseMirrorRules(rules []string) ([]MirrorRule, error) {
+	var out []MirrorRule
+	for _, rule := range rules {
+		from, to, ok := strings.Cut(rule, "=")
+		from, to = strings.TrimSpace(from), strings.TrimSpace(to)
+		if !ok || len(from) == 0 || len(to) == 0 {
+			return nil, fmt.Errorf("invalid mirror rule '%s' (expected from-prefix=to-prefix)", rule)
+		}
+		out = append(out, MirrorRule{From: from, To: to})
+	}
+	return out, nil
+}
+
+// RewriteURL applies the first rule whose prefix matches url; it returns false if none did
+func RewriteURL(url string, rules []MirrorRule) (string, bool) {
+	for _, rule := range rules {
+		if strings.HasPrefix(url, rule.From) {
+			return rule.To + strings.TrimPrefix(url, rule.From), true
+		}
+	}
+	return url, false
+}
+
+// WikiDownloadConfig is the config for DownloadWikiFirmware
+type WikiDownloadConfig struct {
+	Mirrors []MirrorRule // URL rewrite rules
+	Index   *HashIndex   // index of previously downloaded files (optional)
+	Link    bool         // hardlink (or copy) indexed files to the destination instead of just skipping them
+}
+
+// WikiDownloadResult is the outcome of DownloadWikiFirmware
+type WikiDownloadResult struct {
+	Path     string // where the firmware was saved
+	URL      string // the URL that served the file
+	Mirrored bool   // the file was served by a mirror (and not the URL listed on the wiki)
+	Existing string // the previously downloaded copy that was reused (nothing was fetched)
+}
+
+// DownloadWikiFirmware downloads fw to destName with d; the URL is rewritten with the first matching
+// mirror rule and the original URL is tried when the mirror doesn't have the file (404).
+// Files already in the conf.Index are not downloaded again.
+// The returned result records which URL served (or failed to serve) the file.
+func DownloadWikiFirmware(fw WikiFirmware, destName string, d *Download, conf *WikiDownloadConfig) (*WikiDownloadResult, error) {
+	if len(fw.URL) == 0 {
+		return nil, fmt.Errorf("no download URL listed on the wiki for %s", fw.Build)
+	}
+	if conf == nil {
+		conf = &WikiDownloadConfig{}
+	}
+
+	if res, ok, err := reuseWikiDownload(fw, destName, conf); ok || err != nil {
+		return res, err
+	}
+
+	d.Sha1 = fw.Sha1Hash
+	d.DestName = destName
+
+	res := &WikiDownloadResult{Path: destName, URL: fw.URL}
+
+	if mirror, ok := RewriteURL(fw.URL, conf.Mirrors); ok {
+		res.URL = mirror
+		res.Mirrored = true
+		d.URL = mirror
+		err := d.Do()
+		if err == nil {
+			conf.indexDownload(fw, destName, d)
+			return res, nil
+		}
+		var serr *StatusError
+		if !errors.As(err, &serr) || serr.StatusCode != http.StatusNotFound {
+			return res, fmt.Errorf("failed to download %s from mirror: %w", mirror, err)
+		}
+		log.WithField("url", mirror).Warn("Firmware not found on mirror (falling back to the original URL)")
+		res.URL = fw.URL
+		res.Mirrored = false
+	}
+
+	d.URL = fw.URL
+	if err := d.Do(); err != nil {
+		return res, fmt.Errorf("failed to download %s: %w", fw.URL, err)
+	}
+	conf.indexDownload(fw, destName, d)
+	return res, nil
+}
+
+// indexDownload adds a download whose SHA1 was verified to the index
+func (conf *WikiDownloadConfig) indexDownload(fw WikiFirmware, destName string, d *Download) {
+	if conf.Index == nil || len(fw.Sha1Hash) == 0 || d.ignoreSha1 {
+		return
+	}
+	if _, err := os.Stat(destName); err != nil {
+		return // skipped by Do (i.e. being downloaded elsewhere)
+	}
+	if err := conf.Index.Add(fw.Sha1Hash, destName); err != nil {
+		log.WithError(err).Warn("failed to update download index")
+	}
+}
+
+// reuseWikiDownload skips downloading fw if the index holds a copy (linking it to destName if conf.Link is set)
+func reuseWikiDownload(fw WikiFirmware, destName string, conf *WikiDownloadConfig) (*WikiDownloadResult, bool, error) {
+	if conf.Index == nil || len(fw.Sha1Hash) == 0 {
+		return nil, false, nil
+	}
+	existing, ok := conf.Index.Lookup(fw.Sha1Hash)
+	if !ok {
+		return nil, false, nil
+	}
+	res := &WikiDownloadResult{Path: existing, Existing: existing}
+	if abs, err := filepath.Abs(destName); err == nil && abs == existing {
+		return res, true, nil
+	}
+	if conf.Link {
+		if err := linkOrCopy(existing, destName); err != nil {
+			return nil, false, fmt.Errorf("failed to link %s to %s: %v", existing, destName, err)
+		}
+		res.Path = destName
+		log.WithField("existing", existing).Infof("Linked already downloaded firmware to %s", destName)
+	} else {
+		log.WithField("path", existing).Info("Firmware already downloaded (skipping)")
+	}
+	return res, true, nil
+}
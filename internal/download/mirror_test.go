@@ -0,0 +1,106 @@
+package download
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/blacktop/ipsw/internal/utils"
+)
+
+func TestRewriteURL(t *testing.T) {
+	rules, err := ParseMirrorRules([]string{
+		"https://updates.cdn-apple.com/=https://mirror.lab/cdn/",
+		"http://appldnld.apple.com/ = https://mirror.lab/archive/",
+	})
+	if err != nil {
+		t.Fatalf("ParseMirrorRules() error = %v", err)
+	}
+
+	tests := map[string]string{
+		"https://updates.cdn-apple.com/2023FallFCS/fullrestores/iPhone15,2_17.0_21A329_Restore.ipsw": "https://mirror.lab/cdn/2023FallFCS/fullrestores/iPhone15,2_17.0_21A329_Restore.ipsw",
+		"http://appldnld.apple.com/iOS7/091-9495.20130918.Ab3d/iPhone5,1_7.0_11A465_Restore.ipsw":    "https://mirror.lab/archive/iOS7/091-9495.20130918.Ab3d/iPhone5,1_7.0_11A465_Restore.ipsw",
+		"https://secure-appldnld.apple.com/ios/foo.ipsw":                                             "https://secure-appldnld.apple.com/ios/foo.ipsw",
+	}
+	for in, want := range tests {
+		if got, _ := RewriteURL(in, rules); got != want {
+			t.Errorf("RewriteURL(%s) = %s, want %s", in, got, want)
+		}
+	}
+
+	for _, bad := range []string{"https://updates.cdn-apple.com/", "=https://mirror.lab/", "https://a/="} {
+		if _, err := ParseMirrorRules([]string{bad}); err == nil {
+			t.Errorf("expected error for mirror rule '%s'", bad)
+		}
+	}
+}
+
+func TestDownloadWikiFirmwareMirror(t *testing.T) {
+	const body = "IPSW"
+	sum := sha1.Sum([]byte(body))
+
+	var hits []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits = append(hits, r.Method+" "+r.URL.Path)
+		if strings.HasPrefix(r.URL.Path, "/mirror/missing") {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(body))
+	}))
+	defer srv.Close()
+
+	rules := []MirrorRule{{From: srv.URL + "/apple/", To: srv.URL + "/mirror/"}}
+
+	d, err := NewDownload("", false, false, false, false, false, false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Progress = utils.NopProgress{}
+
+	fw := WikiFirmware{Build: "21A329", URL: srv.URL + "/apple/present.ipsw", Sha1Hash: hex.EncodeToString(sum[:])}
+	dest := filepath.Join(t.TempDir(), "present.ipsw")
+	res, err := DownloadWikiFirmware(fw, dest, d, &WikiDownloadConfig{Mirrors: rules})
+	if err != nil {
+		t.Fatalf("DownloadWikiFirmware() error = %v", err)
+	}
+	if !res.Mirrored || res.URL != srv.URL+"/mirror/present.ipsw" {
+		t.Errorf("DownloadWikiFirmware() = %+v, want served by the mirror", res)
+	}
+	if got, _ := os.ReadFile(dest); string(got) != body {
+		t.Errorf("downloaded %q, want %q", got, body)
+	}
+
+	// mirror 404s -> falls back to the wiki URL
+	fw.URL = srv.URL + "/apple/missing.ipsw"
+	dest = filepath.Join(t.TempDir(), "missing.ipsw")
+	hits = nil
+	res, err = DownloadWikiFirmware(fw, dest, d, &WikiDownloadConfig{Mirrors: rules})
+	if err != nil {
+		t.Fatalf("DownloadWikiFirmware(fallback) error = %v", err)
+	}
+	if res.Mirrored || res.URL != fw.URL {
+		t.Errorf("DownloadWikiFirmware(fallback) = %+v, want served by %s", res, fw.URL)
+	}
+	if len(hits) == 0 || !strings.Contains(strings.Join(hits, ","), "GET /mirror/missing.ipsw") {
+		t.Errorf("mirror was not tried first: %v", hits)
+	}
+
+	// bad hashes are attributed to the URL that served the file
+	fw.URL = srv.URL + "/apple/present.ipsw"
+	fw.Sha1Hash = strings.Repeat("0", 40)
+	res, err = DownloadWikiFirmware(fw, filepath.Join(t.TempDir(), "bad.ipsw"), d, &WikiDownloadConfig{Mirrors: rules})
+	if err == nil || res == nil || res.URL != srv.URL+"/mirror/present.ipsw" || !strings.Contains(err.Error(), res.URL) {
+		t.Errorf("DownloadWikiFirmware(bad hash) = %+v, %v", res, err)
+	}
+	var serr *StatusError
+	if errors.As(err, &serr) {
+		t.Errorf("bad hash should not be reported as a status error: %v", err)
+	}
+}
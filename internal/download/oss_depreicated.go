@@ -34,7 +34,10 @@ type Oss struct {
 func (p *project) Download() error {
 
 	// proxy, insecure are null because we override the client below
-	downloader := NewDownload("", false, false, false, false, false, false)
+	downloader, err := NewDownload("", false, false, false, false, false, false, 0)
+	if err != nil {
+		return err
+	}
 
 	destName := getDestName(p.URL, false)
 	if _, err := os.Stat(destName); os.IsNotExist(err) {
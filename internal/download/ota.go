@@ -499,7 +499,7 @@ func sendPostAsync(body []byte, rc chan *http.Response, config *OtaConf) error {
 			Proxy:           GetProxy(config.Proxy),
 			TLSClientConfig: &tls.Config{InsecureSkipVerify: config.Insecure},
 		},
-		Timeout: config.Timeout * time.Second,
+		Timeout: config.Timeout,
 	}
 
 	resp, err := client.Do(req)
@@ -0,0 +1,102 @@
+package download
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/apex/log"
+	"golang.org/x/net/http/httpproxy"
+	"golang.org/x/net/proxy"
+)
+
+// ParseProxy parses and validates a proxy URL (http, https, socks5 or socks5h)
+func ParseProxy(proxyStr string) (*url.URL, error) {
+	proxyURL, err := url.Parse(proxyStr)
+	if err != nil {
+		return nil, fmt.Errorf("bad proxy url %q: %w", proxyStr, err)
+	}
+	switch proxyURL.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("bad proxy url %q: unsupported scheme '%s' (expected http, https, socks5 or socks5h)", proxyStr, proxyURL.Scheme)
+	}
+	if len(proxyURL.Host) == 0 {
+		return nil, fmt.Errorf("bad proxy url %q: missing host", proxyStr)
+	}
+	return proxyURL, nil
+}
+
+// GetProxy takes either an input string or read the enviornment and returns a proxy function
+func GetProxy(proxyStr string) func(*http.Request) (*url.URL, error) {
+	if len(proxyStr) > 0 {
+		proxyURL, err := ParseProxy(proxyStr)
+		if err != nil {
+			log.WithError(err).Error("bad proxy url")
+			return func(*http.Request) (*url.URL, error) { return nil, err }
+		}
+		log.Debugf("proxy set to: %s", proxyURL.Redacted())
+		if proxyURL.Scheme == "socks5h" {
+			// net/http always lets a SOCKS5 proxy resolve the destination host
+			proxyURL.Scheme = "socks5"
+		}
+		return http.ProxyURL(proxyURL)
+	}
+
+	conf := httpproxy.FromEnvironment()
+	if len(conf.HTTPProxy) > 0 || len(conf.HTTPSProxy) > 0 {
+		log.WithFields(log.Fields{
+			"http_proxy":  conf.HTTPProxy,
+			"https_proxy": conf.HTTPSProxy,
+			"no_proxy":    conf.NoProxy,
+		}).Debugf("proxy info from environment")
+	}
+
+	return http.ProxyFromEnvironment
+}
+
+// SetProxy configures a transport to use the given proxy; socks5:// and socks5h:// URLs
+// are dialed directly (with optional user:pass auth) and everything else goes through GetProxy
+func SetProxy(tr *http.Transport, proxyStr string) error {
+	if len(proxyStr) == 0 {
+		tr.Proxy = GetProxy("")
+		return nil
+	}
+
+	proxyURL, err := ParseProxy(proxyStr)
+	if err != nil {
+		return err
+	}
+
+	switch proxyURL.Scheme {
+	case "socks5", "socks5h":
+		dialer, err := proxy.FromURL(proxyURL, proxy.Direct)
+		if err != nil {
+			return fmt.Errorf("failed to create socks5 dialer: %w", err)
+		}
+		cd, ok := dialer.(proxy.ContextDialer)
+		if !ok {
+			return fmt.Errorf("socks5 dialer for %s does not support contexts", proxyURL.Redacted())
+		}
+		log.Debugf("socks proxy set to: %s", proxyURL.Redacted())
+		tr.Proxy = nil
+		tr.DialContext = cd.DialContext
+	default:
+		tr.Proxy = GetProxy(proxyStr)
+	}
+
+	return nil
+}
+
+// NewTransport returns an *http.Transport routed through the given proxy (or the proxy from the environment)
+func NewTransport(proxyStr string, insecure bool) (*http.Transport, error) {
+	tr := &http.Transport{
+		TLSClientConfig:   &tls.Config{InsecureSkipVerify: insecure},
+		ForceAttemptHTTP2: true,
+	}
+	if err := SetProxy(tr, proxyStr); err != nil {
+		return nil, err
+	}
+	return tr, nil
+}
@@ -0,0 +1,188 @@
+package download
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+)
+
+// socks5Server is a minimal SOCKS5 (RFC 1928/1929) CONNECT-only proxy
+type socks5Server struct {
+	ln       net.Listener
+	user     string
+	pass     string
+	requests atomic.Int32
+}
+
+func newSocks5Server(t *testing.T, user, pass string) *socks5Server {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &socks5Server{ln: ln, user: user, pass: pass}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *socks5Server) serve(conn net.Conn) {
+	defer conn.Close()
+
+	hdr := make([]byte, 2)
+	if _, err := io.ReadFull(conn, hdr); err != nil || hdr[0] != 5 {
+		return
+	}
+	if _, err := io.ReadFull(conn, make([]byte, hdr[1])); err != nil {
+		return
+	}
+	if len(s.user) > 0 {
+		conn.Write([]byte{5, 2}) // username/password
+		if _, err := io.ReadFull(conn, hdr); err != nil {
+			return
+		}
+		user := make([]byte, hdr[1])
+		if _, err := io.ReadFull(conn, user); err != nil {
+			return
+		}
+		plen := make([]byte, 1)
+		if _, err := io.ReadFull(conn, plen); err != nil {
+			return
+		}
+		pass := make([]byte, plen[0])
+		if _, err := io.ReadFull(conn, pass); err != nil {
+			return
+		}
+		if string(user) != s.user || string(pass) != s.pass {
+			conn.Write([]byte{1, 1})
+			return
+		}
+		conn.Write([]byte{1, 0})
+	} else {
+		conn.Write([]byte{5, 0}) // no auth
+	}
+
+	req := make([]byte, 4)
+	if _, err := io.ReadFull(conn, req); err != nil || req[1] != 1 {
+		return
+	}
+	var host string
+	switch req[3] {
+	case 1:
+		ip := make([]byte, net.IPv4len)
+		if _, err := io.ReadFull(conn, ip); err != nil {
+			return
+		}
+		host = net.IP(ip).String()
+	case 3:
+		l := make([]byte, 1)
+		if _, err := io.ReadFull(conn, l); err != nil {
+			return
+		}
+		name := make([]byte, l[0])
+		if _, err := io.ReadFull(conn, name); err != nil {
+			return
+		}
+		host = string(name)
+	default:
+		return
+	}
+	port := make([]byte, 2)
+	if _, err := io.ReadFull(conn, port); err != nil {
+		return
+	}
+
+	target, err := net.Dial("tcp", net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port)))))
+	if err != nil {
+		conn.Write([]byte{5, 5, 0, 1, 0, 0, 0, 0, 0, 0})
+		return
+	}
+	defer target.Close()
+	s.requests.Add(1)
+	conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+
+	go io.Copy(target, conn)
+	io.Copy(conn, target)
+}
+
+func TestNewTransportSocks5(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "ok")
+	}))
+	defer ts.Close()
+
+	tests := []struct {
+		name  string
+		user  string
+		pass  string
+		proxy func(addr string) string
+	}{
+		{"socks5", "", "", func(addr string) string { return "socks5://" + addr }},
+		{"socks5h", "", "", func(addr string) string { return "socks5h://" + addr }},
+		{"socks5 auth", "user", "p@ss", func(addr string) string { return "socks5://user:p%40ss@" + addr }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newSocks5Server(t, tt.user, tt.pass)
+			tr, err := NewTransport(tt.proxy(srv.ln.Addr().String()), false)
+			if err != nil {
+				t.Fatalf("NewTransport() error = %v", err)
+			}
+			defer tr.CloseIdleConnections()
+
+			resp, err := (&http.Client{Transport: tr}).Get(ts.URL)
+			if err != nil {
+				t.Fatalf("GET through proxy failed: %v", err)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if string(body) != "ok" {
+				t.Errorf("body = %q, want %q", body, "ok")
+			}
+			if got := srv.requests.Load(); got != 1 {
+				t.Errorf("proxy saw %d CONNECT requests, want 1", got)
+			}
+		})
+	}
+}
+
+func TestNewTransportSocks5BadAuth(t *testing.T) {
+	srv := newSocks5Server(t, "user", "secret")
+	tr, err := NewTransport("socks5://user:wrong@"+srv.ln.Addr().String(), false)
+	if err != nil {
+		t.Fatalf("NewTransport() error = %v", err)
+	}
+	if _, err := (&http.Client{Transport: tr}).Get("http://127.0.0.1:1/"); err == nil {
+		t.Fatal("expected authentication failure")
+	}
+}
+
+func TestParseProxy(t *testing.T) {
+	for _, p := range []string{"http://127.0.0.1:8080", "https://proxy:443", "socks5://127.0.0.1:1080", "socks5h://u:p@localhost:9050"} {
+		if _, err := ParseProxy(p); err != nil {
+			t.Errorf("ParseProxy(%q) error = %v", p, err)
+		}
+	}
+	for _, p := range []string{"ftp://127.0.0.1:21", "socks4://127.0.0.1:1080", "127.0.0.1:8080", "socks5://"} {
+		if _, err := ParseProxy(p); err == nil {
+			t.Errorf("ParseProxy(%q) expected error", p)
+		}
+		if _, err := NewTransport(p, false); err == nil {
+			t.Errorf("NewTransport(%q) expected error", p)
+		}
+	}
+}
@@ -3,51 +3,71 @@ package download
 import (
 	"archive/zip"
 	"crypto/tls"
+	"fmt"
 	"net/http"
-	"net/url"
+	"time"
 
-	"github.com/blacktop/ipsw/internal/utils"
-	"github.com/blacktop/ranger"
-	"github.com/pkg/errors"
+	"github.com/blacktop/ipsw/internal/remotezip"
 )
 
+// DefaultRemotePattern is the pattern ExtractRemoteZip uses when none is given
+const DefaultRemotePattern = `kernelcache.*`
+
+// ErrRangeNotSupported is returned when the server hosting a remote zip does not support byte-range requests
+var ErrRangeNotSupported = remotezip.ErrRangeNotSupported
+
 // RemoteConfig is the remote reader config
 type RemoteConfig struct {
 	Proxy    string
 	Insecure bool
+	Timeout  time.Duration // response header timeout for each range request (0 means no timeout)
 }
 
 // NewRemoteZipReader returns a new remote zip file reader
 func NewRemoteZipReader(zipURL string, config *RemoteConfig) (*zip.Reader, error) {
+	return remotezip.NewReader(zipURL, &http.Client{
+		Transport: &http.Transport{
+			Proxy:                 GetProxy(config.Proxy),
+			TLSClientConfig:       &tls.Config{InsecureSkipVerify: config.Insecure},
+			ResponseHeaderTimeout: config.Timeout,
+		},
+	})
+}
 
-	url, err := url.Parse(zipURL)
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to parse url")
+// ExtractRemoteZip downloads and inflates only the entries of the remote zip at zipURL whose
+// names match the regex pattern (DefaultRemotePattern if empty) into output and returns their paths
+func ExtractRemoteZip(zipURL, pattern, output string, config *RemoteConfig) ([]string, error) {
+	if len(pattern) == 0 {
+		pattern = DefaultRemotePattern
 	}
 
-	reader, err := ranger.NewReader(&ranger.HTTPRanger{
-		URL:       url,
-		UserAgent: utils.RandomAgent(),
-		Client: &http.Client{
-			Transport: &http.Transport{
-				Proxy:           GetProxy(config.Proxy),
-				TLSClientConfig: &tls.Config{InsecureSkipVerify: config.Insecure},
-			},
-		},
-	})
+	zr, err := NewRemoteZipReader(zipURL, config)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to create ranger reader")
+		return nil, err
 	}
 
-	length, err := reader.Length()
+	m, err := remotezip.Extract(zr, &remotezip.Config{
+		Patterns: []string{pattern},
+		Output:   output,
+		Flatten:  true,
+	})
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to get reader length")
+		return nil, fmt.Errorf("failed to extract from %s: %w", zipURL, err)
 	}
 
-	zr, err := zip.NewReader(reader, length)
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to create zip reader")
+	var artifacts []string
+	for _, e := range m.Entries {
+		artifacts = append(artifacts, e.Path)
 	}
 
-	return zr, nil
+	return artifacts, nil
+}
+
+// ExtractRemote extracts the files matching pattern (DefaultRemotePattern if empty) from the remote firmware
+// into output without downloading the whole IPSW/OTA
+func (fw WikiFirmware) ExtractRemote(pattern, output string, config *RemoteConfig) ([]string, error) {
+	if len(fw.URL) == 0 {
+		return nil, fmt.Errorf("firmware %s (%s) has no URL", fw.Version, fw.Build)
+	}
+	return ExtractRemoteZip(fw.URL, pattern, output, config)
 }
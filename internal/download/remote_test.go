@@ -0,0 +1,106 @@
+package download
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func testZip(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, data := range map[string]string{
+		"BuildManifest.plist":                   "<plist/>",
+		"kernelcache.release.iphone15":          "KERNEL",
+		"Firmware/all_flash/DeviceTree.im4p":    "DTREE",
+		"Firmware/dfu/iBEC.d73.RELEASE.im4p":    "IBEC",
+		"kernelcache.research.iphone15.payload": "RESEARCH",
+	} {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestExtractRemoteZip(t *testing.T) {
+	dat := testZip(t)
+	var full int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet && len(r.Header.Get("Range")) == 0 {
+			full++
+		}
+		http.ServeContent(w, r, "test.ipsw", time.Unix(1700000000, 0), bytes.NewReader(dat))
+	}))
+	defer srv.Close()
+
+	out := t.TempDir()
+	fw := WikiFirmware{Version: "17.0", Build: "21A329", URL: srv.URL + "/test.ipsw"}
+	files, err := fw.ExtractRemote("", out, &RemoteConfig{})
+	if err != nil {
+		t.Fatalf("ExtractRemote() error = %v", err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("ExtractRemote() = %v, want the 2 kernelcaches", files)
+	}
+	if got, _ := os.ReadFile(filepath.Join(out, "kernelcache.release.iphone15")); string(got) != "KERNEL" {
+		t.Errorf("extracted kernelcache = %q", got)
+	}
+	if full != 0 {
+		t.Errorf("made %d full (non-ranged) GET requests", full)
+	}
+
+	files, err = ExtractRemoteZip(fw.URL, `DeviceTree`, out, &RemoteConfig{})
+	if err != nil || len(files) != 1 || filepath.Base(files[0]) != "DeviceTree.im4p" {
+		t.Errorf("ExtractRemoteZip(DeviceTree) = %v, %v", files, err)
+	}
+
+	if _, err := ExtractRemoteZip(fw.URL, `sep-firmware`, out, &RemoteConfig{}); err == nil {
+		t.Error("expected error when nothing matches")
+	}
+}
+
+func TestExtractRemoteZipNoRanges(t *testing.T) {
+	dat := testZip(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Last-Modified", time.Unix(1700000000, 0).UTC().Format(http.TimeFormat))
+		w.Write(dat)
+	}))
+	defer srv.Close()
+
+	_, err := ExtractRemoteZip(srv.URL+"/test.ipsw", "", t.TempDir(), &RemoteConfig{})
+	if !errors.Is(err, ErrRangeNotSupported) {
+		t.Errorf("ExtractRemoteZip() error = %v, want ErrRangeNotSupported", err)
+	}
+}
+
+func TestNewRemoteZipReaderTimeout(t *testing.T) {
+	done := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-done // never answers
+	}))
+	defer srv.Close()
+	defer close(done)
+
+	start := time.Now()
+	if _, err := NewRemoteZipReader(srv.URL+"/test.ipsw", &RemoteConfig{Timeout: 100 * time.Millisecond}); err == nil {
+		t.Fatal("NewRemoteZipReader() error = nil, want a timeout")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("NewRemoteZipReader() took %s, want it to honor the 100ms timeout", elapsed)
+	}
+}
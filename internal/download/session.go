@@ -0,0 +1,198 @@
+package download
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/apex/log"
+)
+
+// SessionFileName is the default name of the session manifest (in the download's output folder)
+const SessionFileName = "ipsw_download_session.json"
+
+// SessionVersion is the version of the session manifest format
+const SessionVersion = 1
+
+// SessionState is the download state of a session entry
+type SessionState string
+
+const (
+	SessionPending SessionState = "pending" // not started
+	SessionPartial SessionState = "partial" // started (Dest + ".download" holds what was downloaded so far)
+	SessionDone    SessionState = "done"    // downloaded (and verified if it has a SHA1) to Dest
+)
+
+// SessionEntry is a file of a download session
+type SessionEntry struct {
+	URL   string       `json:"url"`
+	Dest  string       `json:"dest"`
+	Sha1  string       `json:"sha1,omitempty"` // expected SHA1 (if known)
+	State SessionState `json:"state"`
+}
+
+// Session is the state of a multi-file download, saved as a JSON manifest so that an interrupted
+// download can be resumed. The manifest is stable (fields are only ever added) and looks like:
+//
+//	{
+//	  "version": 1,
+//	  "updated": "2023-09-18T10:00:00Z",
+//	  "files": [
+//	    {"url": "https://...", "dest": "iPhone15,2_17.0_21A329_Restore.ipsw", "sha1": "...", "state": "done"},
+//	    {"url": "https://...", "dest": "iPhone15,3_17.0_21A329_Restore.ipsw", "sha1": "...", "state": "partial"}
+//	  ]
+//	}
+//
+// The manifest is rewritten atomically every time a file's state changes.
+type Session struct {
+	Version int             `json:"version"`
+	Updated time.Time       `json:"updated"`
+	Files   []*SessionEntry `json:"files"`
+
+	path string
+	mu   sync.Mutex
+}
+
+// LoadSession reads the session manifest at path
+func LoadSession(path string) (*Session, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	s := &Session{path: path}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("failed to parse download session %s: %v", path, err)
+	}
+	if s.Version > SessionVersion {
+		return nil, fmt.Errorf("download session %s is version %d (only version %d and older are supported)", path, s.Version, SessionVersion)
+	}
+	return s, nil
+}
+
+// OpenSession returns the session for downloading files (URL, Dest and Sha1 are used) saved at path.
+// If path holds a session for the same files their states are kept (so completed files are skipped and
+// partial ones resumed), otherwise a new session is started; ok reports whether the session was resumed.
+func OpenSession(path string, files []SessionEntry) (s *Session, ok bool, err error) {
+	if prev, err := LoadSession(path); err == nil {
+		if prev.matches(files) {
+			return prev, true, nil
+		}
+		log.Debugf("download session %s is for other files (starting a new one)", path)
+	} else if !os.IsNotExist(err) {
+		log.WithError(err).Warnf("failed to load download session %s (starting a new one)", path)
+	}
+
+	s = &Session{Version: SessionVersion, path: path}
+	for _, f := range files {
+		f := f
+		f.State = SessionPending
+		s.Files = append(s.Files, &f)
+	}
+	return s, false, s.save()
+}
+
+// matches reports whether s is a session for exactly files
+func (s *Session) matches(files []SessionEntry) bool {
+	if len(s.Files) != len(files) {
+		return false
+	}
+	for i, f := range files {
+		if s.Files[i].URL != f.URL || s.Files[i].Dest != f.Dest {
+			return false
+		}
+	}
+	return true
+}
+
+// Path returns where the session manifest is saved
+func (s *Session) Path() string {
+	return s.path
+}
+
+// Entry returns the session entry for url
+func (s *Session) Entry(url string) (*SessionEntry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, f := range s.Files {
+		if f.URL == url {
+			return f, true
+		}
+	}
+	return nil, false
+}
+
+// Completed reports whether url was already downloaded to dest in this session (and is still there)
+func (s *Session) Completed(url, dest string) bool {
+	e, ok := s.Entry(url)
+	if !ok || e.State != SessionDone || e.Dest != dest {
+		return false
+	}
+	fi, err := os.Stat(dest)
+	return err == nil && fi.Mode().IsRegular()
+}
+
+// SetState records the state of url and saves the session
+func (s *Session) SetState(url string, state SessionState) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, f := range s.Files {
+		if f.URL == url {
+			f.State = state
+			return s.save()
+		}
+	}
+	return fmt.Errorf("%s is not part of download session %s", url, s.path)
+}
+
+// Download downloads fw to destName like DownloadWikiFirmware, recording its state in the session.
+// A partial download left by an interrupted session is resumed without prompting.
+func (s *Session) Download(fw WikiFirmware, destName string, d *Download, conf *WikiDownloadConfig) (*WikiDownloadResult, error) {
+	e, ok := s.Entry(fw.URL)
+	if !ok {
+		return nil, fmt.Errorf("%s is not part of download session %s", fw.URL, s.path)
+	}
+	if e.State == SessionPartial {
+		defer func(resumeAll bool) { d.resumeAll = resumeAll }(d.resumeAll)
+		d.resumeAll = true
+	} else if err := s.SetState(fw.URL, SessionPartial); err != nil {
+		return nil, err
+	}
+	res, err := DownloadWikiFirmware(fw, destName, d, conf)
+	if err != nil {
+		return nil, err
+	}
+	return res, s.SetState(fw.URL, SessionDone)
+}
+
+// save writes the session manifest atomically (callers hold s.mu)
+func (s *Session) save() error {
+	s.Updated = time.Now().UTC()
+	return writeJSONAtomic(s.path, s)
+}
+
+// writeJSONAtomic writes v as indented JSON to path through a temp file (so an interrupted write can't corrupt it)
+func writeJSONAtomic(path string, v any) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		return fmt.Errorf("failed to create folder for %s: %v", path, err)
+	}
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s: %v", path, err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %v", path, err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write %s: %v", path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %v", path, err)
+	}
+	return os.Rename(tmp.Name(), path)
+}
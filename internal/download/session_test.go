@@ -0,0 +1,103 @@
+package download
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/blacktop/ipsw/internal/utils"
+)
+
+func TestSessionResume(t *testing.T) {
+	body := bytes.Repeat([]byte("IPSW"), 64*1024)
+	sum := sha1.Sum(body)
+
+	kill := true
+	var ranges []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			ranges = append(ranges, r.Header.Get("Range"))
+			if kill { // die halfway through the first download
+				kill = false
+				w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+				w.Write(body[:len(body)/2])
+				w.(http.Flusher).Flush()
+				panic(http.ErrAbortHandler)
+			}
+		}
+		http.ServeContent(w, r, "a.ipsw", time.Time{}, bytes.NewReader(body))
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, SessionFileName)
+	fw := WikiFirmware{Build: "21A329", URL: srv.URL + "/a.ipsw", Sha1Hash: hex.EncodeToString(sum[:])}
+	files := []SessionEntry{
+		{URL: fw.URL, Dest: filepath.Join(dir, "a.ipsw"), Sha1: fw.Sha1Hash},
+		{URL: srv.URL + "/b.ipsw", Dest: filepath.Join(dir, "b.ipsw")},
+	}
+
+	newDownload := func() *Download {
+		d, err := NewDownload("", false, false, false, false, false, false, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		d.Progress = utils.NopProgress{}
+		return d
+	}
+
+	sess, resumed, err := OpenSession(path, files)
+	if err != nil || resumed {
+		t.Fatalf("OpenSession() = %t, %v; want a new session", resumed, err)
+	}
+	if _, err := sess.Download(fw, files[0].Dest, newDownload(), nil); err == nil {
+		t.Fatal("Session.Download() of a killed download succeeded")
+	}
+
+	// restart with the same files
+	sess, resumed, err = OpenSession(path, files)
+	if err != nil || !resumed {
+		t.Fatalf("OpenSession() = %t, %v; want the interrupted session", resumed, err)
+	}
+	if e, _ := sess.Entry(fw.URL); e.State != SessionPartial {
+		t.Fatalf("interrupted entry state = %s, want %s", e.State, SessionPartial)
+	}
+	if sess.Completed(fw.URL, files[0].Dest) {
+		t.Fatal("Completed() = true for an interrupted download")
+	}
+	// resumed without prompting
+	if _, err := sess.Download(fw, files[0].Dest, newDownload(), nil); err != nil {
+		t.Fatalf("Session.Download() error = %v", err)
+	}
+	if want := []string{"", "bytes=" + strconv.Itoa(len(body)/2) + "-"}; len(ranges) != 2 || ranges[1] != want[1] {
+		t.Errorf("Range headers = %q, want %q", ranges, want)
+	}
+	if got, _ := os.ReadFile(files[0].Dest); !bytes.Equal(got, body) {
+		t.Errorf("resumed download is %d bytes, want the %d byte file", len(got), len(body))
+	}
+
+	// the manifest on disk has the new state
+	saved, err := LoadSession(path)
+	if err != nil {
+		t.Fatalf("LoadSession() error = %v", err)
+	}
+	if saved.Version != SessionVersion || len(saved.Files) != 2 ||
+		saved.Files[0].State != SessionDone || saved.Files[1].State != SessionPending {
+		t.Errorf("saved session = %+v %+v, want a/done b/pending", *saved.Files[0], *saved.Files[1])
+	}
+	if !saved.Completed(fw.URL, files[0].Dest) {
+		t.Error("Completed() = false for a finished download")
+	}
+
+	// other files start a new session
+	if _, resumed, err := OpenSession(path, files[1:]); err != nil || resumed {
+		t.Errorf("OpenSession(other files) = %t, %v; want a new session", resumed, err)
+	}
+}
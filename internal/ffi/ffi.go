@@ -0,0 +1,57 @@
+// Package ffi holds the helpers shared by the cgo //export functions.
+//
+// Every exported function returns one of the status codes below and reports errors through its
+// err/errLen out-parameters. Its body is guarded by deferring Recover so that a panic in the Go code
+// it calls is reported as an error instead of taking down the host process:
+//
+//	//export c_pkg_foo_Bar
+//	func c_pkg_foo_Bar(..., err **C.char, errLen *C.uint) (status C.char) {
+//		defer ffi.Recover("c_pkg_foo_Bar", func(perr error) {
+//			outError := perr.Error()
+//			*err = C.CString(outError)
+//			*errLen = C.uint(len(outError))
+//			status = C.char(ffi.InternalPanic)
+//		})
+//		...
+//	}
+package ffi
+
+import (
+	"fmt"
+	"runtime/debug"
+)
+
+// Status codes returned by the exported functions
+const (
+	Failure       = 0 // the call failed (see the error out-parameter)
+	Success       = 1
+	InternalPanic = 2 // the call panicked (the error out-parameter has the panic and its stack)
+)
+
+// MaxPanicStack is the most stack trace bytes included in a PanicError
+const MaxPanicStack = 4096
+
+// PanicError is a panic recovered in an exported function
+type PanicError struct {
+	Func  string // the exported function
+	Value any    // the value passed to panic
+	Stack []byte // the (truncated) stack of the panic
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("%s: internal panic: %v\n%s", e.Func, e.Value, e.Stack)
+}
+
+// Recover reports a panic in the exported function fn as a *PanicError to report; it must be deferred
+// directly (i.e. `defer ffi.Recover(...)`) at the top of the exported function
+func Recover(fn string, report func(error)) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	stack := debug.Stack()
+	if len(stack) > MaxPanicStack {
+		stack = append(stack[:MaxPanicStack:MaxPanicStack], "\n..."...)
+	}
+	report(&PanicError{Func: fn, Value: r, Stack: stack})
+}
@@ -0,0 +1,50 @@
+package ffi
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// export mimics an //export function (with Go types for its out-parameters)
+func export(wiki map[string]string, err *string, errLen *uint) (status byte) {
+	defer Recover("c_test_export", func(perr error) {
+		*err = perr.Error()
+		*errLen = uint(len(*err))
+		status = InternalPanic
+	})
+	wiki["iPhone15,2"] = "21A329" // panics on a nil map
+	return Success
+}
+
+func TestRecover(t *testing.T) {
+	var err string
+	var errLen uint
+
+	if status := export(map[string]string{}, &err, &errLen); status != Success || len(err) > 0 {
+		t.Fatalf("export() = %d, %q; want %d with no error", status, err, Success)
+	}
+
+	// the panic is reported through the out-parameters and the test process survives
+	if status := export(nil, &err, &errLen); status != InternalPanic {
+		t.Fatalf("export(nil) = %d, want %d", status, InternalPanic)
+	}
+	if !strings.HasPrefix(err, "c_test_export: internal panic: assignment to entry in nil map\n") {
+		t.Errorf("export(nil) error = %q, want the panic message", err)
+	}
+	if !strings.Contains(err, "ffi.export") || errLen != uint(len(err)) {
+		t.Errorf("export(nil) error = %q (len %d), want the stack of the panic", err, errLen)
+	}
+	if len(err) > len("c_test_export: internal panic: assignment to entry in nil map\n")+MaxPanicStack+len("\n...") {
+		t.Errorf("export(nil) error is %d bytes, want the stack truncated to %d", len(err), MaxPanicStack)
+	}
+
+	var perr *PanicError
+	func() {
+		defer Recover("c_test_export", func(e error) { errors.As(e, &perr) })
+		panic(errors.New("boom"))
+	}()
+	if perr == nil || perr.Func != "c_test_export" || perr.Value.(error).Error() != "boom" {
+		t.Errorf("Recover() reported %+v, want the boom panic", perr)
+	}
+}
@@ -0,0 +1,44 @@
+package models
+
+import "time"
+
+// WikiFirmware is a firmware seen in theapplewiki.com scrapes; it is unique by build and URL.
+type WikiFirmware struct {
+	ID          uint         `gorm:"primaryKey" json:"-"`
+	Build       string       `gorm:"uniqueIndex:idx_firmwares_build_url;not null" json:"build"`
+	URL         string       `gorm:"uniqueIndex:idx_firmwares_build_url;not null" json:"url"`
+	Version     string       `gorm:"index" json:"version"`
+	Product     string       `json:"product,omitempty"`
+	OS          string       `json:"os,omitempty"`
+	Sha1Hash    string       `json:"sha1,omitempty"`
+	FileSize    int64        `json:"file_size,omitempty"`
+	ReleaseDate time.Time    `gorm:"index" json:"release_date,omitempty"`
+	Devices     []WikiDevice `gorm:"many2many:firmware_devices" json:"devices"`
+	FirstSeen   time.Time    `json:"first_seen"`
+	LastSeen    time.Time    `json:"last_seen"`
+	FirstRunID  uint         `json:"first_run_id"`
+	LastRunID   uint         `json:"last_run_id"`
+}
+
+// TableName overrides the table name used by WikiFirmware to `firmwares`
+func (WikiFirmware) TableName() string { return "firmwares" }
+
+// WikiDevice is a device product type (i.e. iPhone14,5) listed for wiki firmwares.
+type WikiDevice struct {
+	ID   uint   `gorm:"primaryKey" json:"-"`
+	Name string `gorm:"uniqueIndex;not null" json:"name"`
+}
+
+// TableName overrides the table name used by WikiDevice to `devices`
+func (WikiDevice) TableName() string { return "devices" }
+
+// WikiScrapeRun is one scrape merged into the database.
+type WikiScrapeRun struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	StartedAt time.Time `json:"started_at"`
+	Firmwares int       `json:"firmwares"` // firmwares in the scrape
+	New       int       `json:"new"`       // firmwares first seen in this run
+}
+
+// TableName overrides the table name used by WikiScrapeRun to `scrape_runs`
+func (WikiScrapeRun) TableName() string { return "scrape_runs" }
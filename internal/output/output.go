@@ -0,0 +1,104 @@
+// Package output writes styled text that respects the global --color/--plain settings
+// and only colorizes when writing to a terminal (so piped output is free of ANSI codes).
+package output
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/fatih/color"
+	"golang.org/x/term"
+)
+
+var (
+	mu        sync.RWMutex
+	colorize  bool
+	plainMode bool
+)
+
+// Configure sets the global color/plain state (from the root --color and --plain flags)
+func Configure(color, plain bool) {
+	mu.Lock()
+	defer mu.Unlock()
+	colorize = color
+	plainMode = plain
+}
+
+// IsPlain reports whether --plain was given: no colors and no decorations (for log ingestion)
+func IsPlain() bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	return plainMode
+}
+
+// Style is a set of text attributes (i.e. bold, blue)
+type Style []color.Attribute
+
+// Writer writes to an io.Writer, styling text only if color is enabled and the writer is a terminal
+type Writer struct {
+	w     io.Writer
+	color bool
+	plain bool
+}
+
+// NewWriter returns a Writer for w using the global color/plain state
+func NewWriter(w io.Writer) *Writer {
+	mu.RLock()
+	defer mu.RUnlock()
+	return &Writer{
+		w:     w,
+		color: colorize && !plainMode && isTerminal(w),
+		plain: plainMode,
+	}
+}
+
+// NewPlainWriter returns a Writer for w that never styles or decorates text
+func NewPlainWriter(w io.Writer) *Writer {
+	return &Writer{w: w, plain: true}
+}
+
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	return ok && term.IsTerminal(int(f.Fd()))
+}
+
+// Color reports whether the writer styles text
+func (w *Writer) Color() bool { return w.color }
+
+// Plain reports whether the writer should skip decorations (i.e. separators, alignment padding)
+func (w *Writer) Plain() bool { return w.plain }
+
+// Write implements io.Writer
+func (w *Writer) Write(p []byte) (int, error) { return w.w.Write(p) }
+
+// Sprint formats a with style s (if the writer styles text)
+func (w *Writer) Sprint(s Style, a ...any) string {
+	if !w.color || len(s) == 0 {
+		return fmt.Sprint(a...)
+	}
+	c := color.New(s...)
+	c.EnableColor()
+	return c.Sprint(a...)
+}
+
+// Sprintf formats according to format with style s (if the writer styles text)
+func (w *Writer) Sprintf(s Style, format string, a ...any) string {
+	return w.Sprint(s, fmt.Sprintf(format, a...))
+}
+
+// Print writes a to the writer
+func (w *Writer) Print(a ...any) {
+	fmt.Fprint(w.w, a...)
+}
+
+// Printf writes according to format to the writer
+func (w *Writer) Printf(format string, a ...any) {
+	fmt.Fprintf(w.w, format, a...)
+}
+
+// Println writes a followed by a newline to the writer
+func (w *Writer) Println(a ...any) {
+	fmt.Fprintln(w.w, a...)
+}
@@ -0,0 +1,34 @@
+package output
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/fatih/color"
+)
+
+func TestWriter(t *testing.T) {
+	defer Configure(false, false)
+
+	// a non-terminal writer is never styled
+	Configure(true, false)
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	if w.Color() || w.Plain() {
+		t.Errorf("NewWriter(buffer) color = %t, plain = %t; want false, false", w.Color(), w.Plain())
+	}
+	if got := w.Sprintf(Style{color.Bold}, "%d", 1); got != "1" {
+		t.Errorf("Sprintf() = %q, want no ANSI codes", got)
+	}
+
+	// a styling writer
+	w.color = true
+	if got := w.Sprint(Style{color.Bold}, "x"); got != "\x1b[1mx\x1b[0m" {
+		t.Errorf("Sprint() = %q, want bold", got)
+	}
+
+	Configure(true, true)
+	if w := NewWriter(&buf); w.Color() || !w.Plain() {
+		t.Errorf("NewWriter() with --plain: color = %t, plain = %t; want false, true", w.Color(), w.Plain())
+	}
+}
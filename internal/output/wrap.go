@@ -0,0 +1,214 @@
+package output
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/mattn/go-runewidth"
+	"golang.org/x/term"
+)
+
+var (
+	ansiRE      = regexp.MustCompile(`\x1b\[[0-9;]*[A-Za-z]`)
+	wrapAddrRE  = regexp.MustCompile(`^(=>)?(\+?0x)?[0-9a-fA-F]+:$`)
+	wrapByteRE  = regexp.MustCompile(`^[0-9a-fA-F]{2}$`)
+	commentMark = []string{";", "//"}
+)
+
+// terminalWidth returns the width of w if it is a terminal (0 otherwise)
+var terminalWidth = func(w io.Writer) int {
+	f, ok := w.(*os.File)
+	if !ok || !term.IsTerminal(int(f.Fd())) {
+		return 0
+	}
+	width, _, err := term.GetSize(int(f.Fd()))
+	if err != nil {
+		return 0
+	}
+	return width
+}
+
+// wrapToken is a run of non-whitespace text (ANSI codes included) and the whitespace before it
+type wrapToken struct {
+	sep  string
+	text string
+}
+
+func tokenizeLine(line string) []wrapToken {
+	var toks []wrapToken
+	for len(line) > 0 {
+		sepEnd := len(line) - len(strings.TrimLeft(line, " \t"))
+		textEnd := strings.IndexAny(line[sepEnd:], " \t")
+		if textEnd < 0 {
+			textEnd = len(line)
+		} else {
+			textEnd += sepEnd
+		}
+		toks = append(toks, wrapToken{sep: line[:sepEnd], text: line[sepEnd:textEnd]})
+		line = line[textEnd:]
+	}
+	return toks
+}
+
+func visibleWidth(s string) int {
+	return runewidth.StringWidth(ansiRE.ReplaceAllString(s, ""))
+}
+
+// advance returns the column after writing the whitespace sep at col (tabs stop every 8 columns)
+func advance(col int, sep string) int {
+	for _, c := range sep {
+		if c == '\t' {
+			col += 8 - col%8
+		} else {
+			col++
+		}
+	}
+	return col
+}
+
+// WrapLine soft-wraps line into lines at most width columns wide (ANSI codes don't count), breaking only on
+// whitespace so tokens are never split (a token wider than the line is left to overflow). A leading address
+// column (i.e. "0x100004000:" or "+0x10:") and the hex bytes following it are never broken; continuation lines
+// are indented to the instruction column or, once inside a trailing ";" or "//" annotation comment, to the
+// comment's text.
+func WrapLine(line string, width int) []string {
+	if width <= 0 || lineWidth(line) <= width {
+		return []string{line}
+	}
+
+	toks := tokenizeLine(line)
+
+	// the address and hex byte columns are kept together
+	prefix := 0
+	if len(toks) > 0 && wrapAddrRE.MatchString(ansiRE.ReplaceAllString(toks[0].text, "")) {
+		prefix = 1
+		for prefix < len(toks) && prefix <= 4 && wrapByteRE.MatchString(ansiRE.ReplaceAllString(toks[prefix].text, "")) {
+			prefix++
+		}
+	}
+
+	var lines []string
+	var cur strings.Builder
+	col, indent, comment := 0, 0, -1
+	placed := false // a token was placed on the current line after its indent
+	marker := false // the previous token was a bare comment marker (kept with the comment's first word)
+	for i, tok := range toks {
+		start := advance(col, tok.sep)
+		end := start + visibleWidth(tok.text)
+		if i == 0 {
+			indent = start + 4
+		} else if i == prefix && prefix > 0 {
+			indent = start
+		}
+
+		need := end // a bare comment marker only fits with the comment's first word
+		if i > prefix && i+1 < len(toks) && isCommentMark(tok.text) {
+			need = advance(end, toks[i+1].sep) + visibleWidth(toks[i+1].text)
+		}
+
+		if i > prefix && placed && !marker && need > width && len(tok.text) > 0 {
+			lines = append(lines, cur.String())
+			cur.Reset()
+			in := indent
+			if comment >= 0 {
+				in = comment
+			}
+			start = min(in, width/2)
+			end = start + visibleWidth(tok.text)
+			cur.WriteString(strings.Repeat(" ", start))
+		} else {
+			cur.WriteString(tok.sep)
+		}
+		cur.WriteString(tok.text)
+		col = end
+		if i >= prefix {
+			placed = true
+		}
+
+		marker = isCommentMark(tok.text)
+		if comment < 0 && i > prefix {
+			plain := ansiRE.ReplaceAllString(tok.text, "")
+			for _, mark := range commentMark {
+				if strings.HasPrefix(plain, mark) {
+					comment = start + len(mark) + 1
+					break
+				}
+			}
+		}
+	}
+
+	return append(lines, cur.String())
+}
+
+func isCommentMark(text string) bool {
+	plain := ansiRE.ReplaceAllString(text, "")
+	for _, mark := range commentMark {
+		if plain == mark {
+			return true
+		}
+	}
+	return false
+}
+
+// lineWidth returns the number of columns line takes up (with tabs expanded)
+func lineWidth(line string) int {
+	col := 0
+	for _, tok := range tokenizeLine(line) {
+		col = advance(col, tok.sep) + visibleWidth(tok.text)
+	}
+	return col
+}
+
+// wrapWriter soft-wraps each complete line written to it with WrapLine (a partial line is held until Flush)
+type wrapWriter struct {
+	w     io.Writer
+	width int
+	buf   []byte
+}
+
+func (ww *wrapWriter) Write(p []byte) (int, error) {
+	ww.buf = append(ww.buf, p...)
+	for {
+		i := bytes.IndexByte(ww.buf, '\n')
+		if i < 0 {
+			break
+		}
+		if _, err := io.WriteString(ww.w, strings.Join(WrapLine(string(ww.buf[:i]), ww.width), "\n")+"\n"); err != nil {
+			return 0, err
+		}
+		ww.buf = append(ww.buf[:0], ww.buf[i+1:]...)
+	}
+	return len(p), nil
+}
+
+// Flush writes the held partial line
+func (ww *wrapWriter) Flush() error {
+	if len(ww.buf) == 0 {
+		return nil
+	}
+	_, err := io.WriteString(ww.w, strings.Join(WrapLine(string(ww.buf), ww.width), "\n"))
+	ww.buf = ww.buf[:0]
+	return err
+}
+
+// SoftWrap makes the writer soft-wrap lines at its terminal's width (see WrapLine); output that isn't going to
+// a terminal is never wrapped. Flush must be called once done to write a trailing partial line.
+func (w *Writer) SoftWrap() {
+	if _, ok := w.w.(*wrapWriter); ok {
+		return
+	}
+	if width := terminalWidth(w.w); width > 0 {
+		w.w = &wrapWriter{w: w.w, width: width}
+	}
+}
+
+// Flush writes any partial line held by a soft-wrapping writer
+func (w *Writer) Flush() error {
+	if ww, ok := w.w.(*wrapWriter); ok {
+		return ww.Flush()
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package output
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var updateGolden = flag.Bool("update", false, "update golden files")
+
+// wrapTestLines are disass/listing lines that overflow narrow terminals
+var wrapTestLines = []string{
+	"0x100004000:  fd 7b bf a9   stp\tx29, x30, [sp, #-0x10]!",
+	"0xfffffff007b2c41c:  e0 03 13 aa   bl\t_ZN12IOUserClient24externalMethodEjP25IOExternalMethodArgumentsP24IOExternalMethodDispatchP8OSObjectPv ; IOUserClient::externalMethod(unsigned int, IOExternalMethodArguments*, IOExternalMethodDispatch*, OSObject*, void*)",
+	"0x1000080a4:  00 00 00 90   adrp\tx0, 0x100008000 ; std::__1::basic_string<char, std::__1::char_traits<char>, std::__1::allocator<char>>::__init(char const*, unsigned long)",
+	"=>000080b0:  e1 03 00 aa\tmov\tx1, x0 // a very long annotation comment that overflows a narrow terminal and has to be wrapped",
+	"0x1000080b4:  \x1b[34m08 00 40 f9\x1b[0m   \x1b[1mldr\x1b[0m     x8, [x0] \x1b[90m; objc_msgSend(self, \"initWithContentsOfURL:options:error:\", url, options, error)\x1b[0m",
+	"_ZN12IOUserClient24externalMethodEjP25IOExternalMethodArgumentsP24IOExternalMethodDispatchP8OSObjectPvAndSomeMoreToOverflow:",
+	"file-read* file-write* file-ioctl mach-lookup mach-register iokit-open-user-client iokit-get-properties sysctl-read sysctl-write",
+}
+
+func TestWrapLine(t *testing.T) {
+	for _, width := range []int{80, 200} {
+		t.Run(fmt.Sprint(width), func(t *testing.T) {
+			var buf bytes.Buffer
+			for _, line := range wrapTestLines {
+				wrapped := WrapLine(line, width)
+				for _, l := range wrapped {
+					// only tokens wider than the line may overflow it
+					if w := lineWidth(l); w > width && len(tokenizeLine(strings.TrimSpace(l))) > 1 {
+						t.Errorf("line is %d wide (> %d): %q", w, width, l)
+					}
+				}
+				if got := strings.Join(wrapped, ""); strings.Join(strings.Fields(got), " ") != strings.Join(strings.Fields(line), " ") {
+					t.Errorf("WrapLine(%q) changed the line's tokens: %q", line, wrapped)
+				}
+				fmt.Fprintln(&buf, strings.Join(wrapped, "\n"))
+			}
+
+			golden := filepath.Join("testdata", fmt.Sprintf("wrap_%d.golden", width))
+			if *updateGolden {
+				if err := os.WriteFile(golden, buf.Bytes(), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := buf.String(); got != string(want) {
+				t.Errorf("WrapLine(%d) =\n%s\nwant:\n%s", width, got, want)
+			}
+		})
+	}
+}
+
+func TestWriterSoftWrap(t *testing.T) {
+	line := wrapTestLines[1]
+
+	// output that isn't going to a terminal is never wrapped
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.SoftWrap()
+	w.Println(line)
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); got != line+"\n" {
+		t.Errorf("SoftWrap(non-terminal) = %q, want %q", got, line+"\n")
+	}
+
+	defer func(f func(io.Writer) int) { terminalWidth = f }(terminalWidth)
+	terminalWidth = func(io.Writer) int { return 80 }
+	buf.Reset()
+	w = NewWriter(&buf)
+	w.SoftWrap()
+	w.Print(line[:20]) // lines written in pieces are wrapped once complete
+	w.Printf("%s\n", line[20:])
+	w.Print("0x100004000:  ret")
+	if got, want := buf.String(), strings.Join(WrapLine(line, 80), "\n")+"\n"; got != want {
+		t.Errorf("SoftWrap() = %q, want %q", got, want)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(buf.String(), "\n0x100004000:  ret") {
+		t.Errorf("Flush() didn't write the partial line: %q", buf.String())
+	}
+}
@@ -0,0 +1,213 @@
+// Package remotezip reads and extracts individual entries of zip files (IPSWs, OTAs) served over HTTP using byte-range requests.
+package remotezip
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/blacktop/ipsw/internal/utils"
+	"github.com/blacktop/ranger"
+	"github.com/dustin/go-humanize"
+)
+
+var (
+	// ErrRangeNotSupported is returned when the server hosting a remote zip does not support byte-range requests
+	ErrRangeNotSupported = errors.New("server does not support byte-range requests (download the full file instead)")
+	// ErrTooLarge is returned when the matched entries are larger than Config.MaxSize
+	ErrTooLarge = errors.New("matched files exceed the max size")
+	// ErrNoMatch is returned when no entries match Config.Patterns
+	ErrNoMatch = errors.New("no files matched")
+)
+
+// NewReader returns a zip reader for the remote zip at zipURL that only fetches the byte ranges it reads (client may be nil)
+func NewReader(zipURL string, client *http.Client) (*zip.Reader, error) {
+	u, err := url.Parse(zipURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse url: %w", err)
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	reader, err := ranger.NewReader(&ranger.HTTPRanger{
+		URL:       u,
+		UserAgent: utils.RandomAgent(),
+		Client:    client,
+	})
+	if err != nil {
+		return nil, rangeError(u, fmt.Errorf("failed to create ranger reader: %w", err))
+	}
+
+	length, err := reader.Length()
+	if err != nil {
+		return nil, rangeError(u, fmt.Errorf("failed to get reader length: %w", err))
+	}
+
+	zr, err := zip.NewReader(reader, length)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create zip reader: %w", err)
+	}
+
+	return zr, nil
+}
+
+// rangeError replaces ranger's "does not support byte-ranged requests" error with ErrRangeNotSupported
+func rangeError(u *url.URL, err error) error {
+	if strings.Contains(err.Error(), "does not support byte-ranged requests") {
+		return fmt.Errorf("%s: %w", u.Host, ErrRangeNotSupported)
+	}
+	return err
+}
+
+// Compile joins patterns into a single regex that matches if any of them do
+func Compile(patterns []string) (*regexp.Regexp, error) {
+	if len(patterns) == 0 {
+		return nil, fmt.Errorf("no pattern provided")
+	}
+	var parts []string
+	for _, p := range patterns {
+		if _, err := regexp.Compile(p); err != nil {
+			return nil, fmt.Errorf("failed to compile pattern '%s': %w", p, err)
+		}
+		parts = append(parts, "(?:"+p+")")
+	}
+	return regexp.Compile(strings.Join(parts, "|"))
+}
+
+// Config is the config for Extract
+type Config struct {
+	Patterns []string // regexes matched against the full entry names (an entry is extracted if any match)
+	Output   string   // folder to extract to
+	Flatten  bool     // drop the archive's directory structure and write every file to Output
+	MaxSize  uint64   // refuse to extract if the matched files are larger than this in total (0 means no limit)
+}
+
+// Entry is a single extracted file
+type Entry struct {
+	Name           string `json:"name"` // path inside the zip
+	Path           string `json:"path"` // path on disk
+	Size           uint64 `json:"size"`
+	CompressedSize uint64 `json:"compressed_size"`
+}
+
+// Manifest lists the files fetched by Extract
+type Manifest struct {
+	URL     string  `json:"url,omitempty"`
+	Entries []Entry `json:"entries"`
+	Size    uint64  `json:"size"`
+}
+
+// String returns one "<size>  <path>" line per entry followed by the total
+func (m Manifest) String() string {
+	var sb strings.Builder
+	for _, e := range m.Entries {
+		fmt.Fprintf(&sb, "%10s  %s\n", humanize.IBytes(e.Size), e.Path)
+	}
+	fmt.Fprintf(&sb, "%10s  total (%d files)\n", humanize.IBytes(m.Size), len(m.Entries))
+	return sb.String()
+}
+
+// Match returns the (non-directory) entries of zr whose names match re sorted by name
+func Match(zr *zip.Reader, re *regexp.Regexp) []*zip.File {
+	var files []*zip.File
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() || !re.MatchString(f.Name) {
+			continue
+		}
+		files = append(files, f)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+	return files
+}
+
+// Extract inflates the entries of zr that match conf.Patterns into conf.Output and returns a manifest
+// of what was written; nothing is fetched if the matched entries are larger than conf.MaxSize
+func Extract(zr *zip.Reader, conf *Config) (*Manifest, error) {
+	re, err := Compile(conf.Patterns)
+	if err != nil {
+		return nil, err
+	}
+
+	files := Match(zr, re)
+	if len(files) == 0 {
+		return nil, fmt.Errorf("%w pattern(s) %q", ErrNoMatch, conf.Patterns)
+	}
+
+	var m Manifest
+	for _, f := range files {
+		m.Size += f.UncompressedSize64
+	}
+	if conf.MaxSize > 0 && m.Size > conf.MaxSize {
+		largest := files[0]
+		for _, f := range files {
+			if f.UncompressedSize64 > largest.UncompressedSize64 {
+				largest = f
+			}
+		}
+		return nil, fmt.Errorf("%w: %d files are %s > %s (largest is %s at %s)", ErrTooLarge,
+			len(files), humanize.IBytes(m.Size), humanize.IBytes(conf.MaxSize),
+			largest.Name, humanize.IBytes(largest.UncompressedSize64))
+	}
+
+	for _, f := range files {
+		fname, err := outputPath(conf.Output, f.Name, conf.Flatten)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.MkdirAll(filepath.Dir(fname), 0750); err != nil {
+			return nil, fmt.Errorf("failed to create output directory: %w", err)
+		}
+		if err := extractFile(f, fname); err != nil {
+			return nil, err
+		}
+		m.Entries = append(m.Entries, Entry{
+			Name:           f.Name,
+			Path:           fname,
+			Size:           f.UncompressedSize64,
+			CompressedSize: f.CompressedSize64,
+		})
+	}
+
+	return &m, nil
+}
+
+// outputPath returns where the zip entry name should be written under output (refusing entries that escape it)
+func outputPath(output, name string, flatten bool) (string, error) {
+	if flatten {
+		return filepath.Join(output, filepath.Base(name)), nil
+	}
+	rel := filepath.FromSlash(name)
+	if !filepath.IsLocal(rel) {
+		return "", fmt.Errorf("refusing to extract %s: path escapes the output folder", name)
+	}
+	return filepath.Join(output, rel), nil
+}
+
+func extractFile(f *zip.File, fname string) error {
+	rc, err := f.Open()
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", f.Name, err)
+	}
+	defer rc.Close()
+
+	out, err := os.Create(fname)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", fname, err)
+	}
+	defer out.Close()
+
+	if _, err := io.Copy(out, rc); err != nil {
+		return fmt.Errorf("failed to extract %s: %w", f.Name, err)
+	}
+
+	return nil
+}
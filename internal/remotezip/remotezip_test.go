@@ -0,0 +1,129 @@
+package remotezip
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testFiles = map[string]string{
+	"BuildManifest.plist":                "<plist/>",
+	"kernelcache.release.iphone15":       "KERNEL",
+	"Firmware/all_flash/iBoot.d73.im4p":  "IBOOT",
+	"Firmware/dfu/iBEC.d73.RELEASE.im4p": "IBEC",
+	"Firmware/dfu/iBSS.d73.RELEASE.im4p": "IBSS",
+	"090-12345-678.dmg":                  strings.Repeat("A", 4096),
+}
+
+func testServer(t *testing.T, ranges bool) *httptest.Server {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, data := range testFiles {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	dat := buf.Bytes()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !ranges {
+			w.Header().Set("Last-Modified", time.Unix(1700000000, 0).UTC().Format(http.TimeFormat))
+			w.Write(dat)
+			return
+		}
+		if r.Method == http.MethodGet && len(r.Header.Get("Range")) == 0 {
+			t.Errorf("unexpected full (non-ranged) GET request")
+		}
+		http.ServeContent(w, r, "test.ipsw", time.Unix(1700000000, 0), bytes.NewReader(dat))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestExtract(t *testing.T) {
+	srv := testServer(t, true)
+	zr, err := NewReader(srv.URL+"/test.ipsw", nil)
+	if err != nil {
+		t.Fatalf("NewReader() error = %v", err)
+	}
+
+	out := t.TempDir()
+	m, err := Extract(zr, &Config{
+		Patterns: []string{`.*iBoot.*`, `Firmware/dfu/.*`},
+		Output:   out,
+	})
+	if err != nil {
+		t.Fatalf("Extract() error = %v", err)
+	}
+	if len(m.Entries) != 3 {
+		t.Fatalf("Extract() = %+v, want iBoot, iBEC and iBSS", m.Entries)
+	}
+	if m.Size != uint64(len("IBOOT")+len("IBEC")+len("IBSS")) {
+		t.Errorf("manifest size = %d", m.Size)
+	}
+	want := filepath.Join(out, "Firmware", "dfu", "iBEC.d73.RELEASE.im4p")
+	if m.Entries[1].Path != want {
+		t.Errorf("entry path = %s, want %s", m.Entries[1].Path, want)
+	}
+	if got, _ := os.ReadFile(want); string(got) != "IBEC" {
+		t.Errorf("extracted iBEC = %q", got)
+	}
+
+	m, err = Extract(zr, &Config{Patterns: []string{`iBoot`}, Output: out, Flatten: true})
+	if err != nil || len(m.Entries) != 1 || m.Entries[0].Path != filepath.Join(out, "iBoot.d73.im4p") {
+		t.Errorf("Extract(Flatten) = %+v, %v", m, err)
+	}
+
+	if _, err := Extract(zr, &Config{Patterns: []string{`sep-firmware`}, Output: out}); !errors.Is(err, ErrNoMatch) {
+		t.Errorf("Extract() error = %v, want ErrNoMatch", err)
+	}
+	if _, err := Extract(zr, &Config{Patterns: []string{`(`}, Output: out}); err == nil {
+		t.Error("expected error for an invalid pattern")
+	}
+}
+
+func TestExtractMaxSize(t *testing.T) {
+	zr, err := NewReader(testServer(t, true).URL+"/test.ipsw", nil)
+	if err != nil {
+		t.Fatalf("NewReader() error = %v", err)
+	}
+
+	out := t.TempDir()
+	_, err = Extract(zr, &Config{Patterns: []string{`\.dmg$`, `kernelcache`}, Output: out, MaxSize: 1024})
+	if !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("Extract() error = %v, want ErrTooLarge", err)
+	}
+	if entries, _ := os.ReadDir(out); len(entries) != 0 {
+		t.Errorf("Extract() wrote %d files despite exceeding the max size", len(entries))
+	}
+}
+
+func TestNewReaderNoRanges(t *testing.T) {
+	if _, err := NewReader(testServer(t, false).URL+"/test.ipsw", nil); !errors.Is(err, ErrRangeNotSupported) {
+		t.Errorf("NewReader() error = %v, want ErrRangeNotSupported", err)
+	}
+}
+
+func TestOutputPath(t *testing.T) {
+	if _, err := outputPath("out", "../../etc/passwd", false); err == nil {
+		t.Error("expected error for an entry escaping the output folder")
+	}
+	if got, err := outputPath("out", "../../etc/passwd", true); err != nil || got != filepath.Join("out", "passwd") {
+		t.Errorf("outputPath(flatten) = %s, %v", got, err)
+	}
+}
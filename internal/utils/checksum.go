@@ -0,0 +1,128 @@
+package utils
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"sort"
+	"strings"
+)
+
+var checksumAlgorithms = map[string]func() hash.Hash{
+	"md5":    md5.New,
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+}
+
+// ChecksumResult is the result of verifying one hash algorithm
+type ChecksumResult struct {
+	Algorithm string `json:"algorithm"`
+	Expected  string `json:"expected"`
+	Actual    string `json:"actual"`
+	OK        bool   `json:"ok"`
+}
+
+// ChecksumResults are the per-algorithm results of VerifyChecksums
+type ChecksumResults map[string]ChecksumResult
+
+// OK returns true if every checksum matched
+func (rs ChecksumResults) OK() bool {
+	for _, r := range rs {
+		if !r.OK {
+			return false
+		}
+	}
+	return len(rs) > 0
+}
+
+// Mismatches returns the results that did not match (sorted by algorithm)
+func (rs ChecksumResults) Mismatches() []ChecksumResult {
+	var bad []ChecksumResult
+	for _, r := range rs {
+		if !r.OK {
+			bad = append(bad, r)
+		}
+	}
+	sort.Slice(bad, func(i, j int) bool { return bad[i].Algorithm < bad[j].Algorithm })
+	return bad
+}
+
+type checksumConfig struct {
+	progress func(read int64)
+}
+
+// ChecksumOption is an option for VerifyChecksums
+type ChecksumOption func(*checksumConfig)
+
+// WithChecksumProgress calls fn with the total number of bytes hashed so far after every read
+func WithChecksumProgress(fn func(read int64)) ChecksumOption {
+	return func(c *checksumConfig) {
+		c.progress = fn
+	}
+}
+
+// VerifyChecksums reads r once while computing every hash in expected (algorithm -> hex digest;
+// md5, sha1, sha256 and sha512 are supported) and returns the per-algorithm results
+func VerifyChecksums(r io.Reader, expected map[string]string, opts ...ChecksumOption) (ChecksumResults, error) {
+	var conf checksumConfig
+	for _, opt := range opts {
+		opt(&conf)
+	}
+
+	if len(expected) == 0 {
+		return nil, fmt.Errorf("no checksums to verify")
+	}
+
+	hashes := make(map[string]hash.Hash)
+	var writers []io.Writer
+	for algo := range expected {
+		newHash, ok := checksumAlgorithms[strings.ToLower(algo)]
+		if !ok {
+			return nil, fmt.Errorf("unsupported checksum algorithm '%s'", algo)
+		}
+		h := newHash()
+		hashes[algo] = h
+		writers = append(writers, h)
+	}
+
+	w := io.MultiWriter(writers...)
+	if conf.progress != nil {
+		w = &checksumProgressWriter{w: w, fn: conf.progress}
+	}
+	if _, err := io.Copy(w, r); err != nil {
+		return nil, fmt.Errorf("failed to hash data: %w", err)
+	}
+
+	results := make(ChecksumResults)
+	for algo, h := range hashes {
+		want := strings.ToLower(strings.TrimSpace(expected[algo]))
+		got := hex.EncodeToString(h.Sum(nil))
+		results[strings.ToLower(algo)] = ChecksumResult{
+			Algorithm: strings.ToLower(algo),
+			Expected:  want,
+			Actual:    got,
+			OK:        want == got,
+		}
+	}
+
+	return results, nil
+}
+
+type checksumProgressWriter struct {
+	w     io.Writer
+	fn    func(int64)
+	total int64
+}
+
+func (c *checksumProgressWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.total += int64(n)
+	c.fn(c.total)
+	return n, err
+}
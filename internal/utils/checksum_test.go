@@ -0,0 +1,64 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+const checksumFixture = "The quick brown fox jumps over the lazy dog"
+
+func TestVerifyChecksums(t *testing.T) {
+	expected := map[string]string{
+		"md5":    "9e107d9d372bb6826bd81d3542a419d6",
+		"sha1":   "2fd4e1c67a2d28fced849ee1bb76e7391b93eb12",
+		"sha256": "D7A8FBB307D7809469CA9ABCB0082E4F8D5651E46D3CDB762D02D0BF37C9E592",
+		"sha512": "07e547d9586f6a73f73fbac0435ed76951218fb7d0c8d788a309d785436bbb642e93a252a954f23912547d1e8a3b5ed6e1bfd7097821233fa0538f3db854fee6",
+	}
+
+	var read int64
+	results, err := VerifyChecksums(strings.NewReader(checksumFixture), expected, WithChecksumProgress(func(n int64) { read = n }))
+	if err != nil {
+		t.Fatalf("VerifyChecksums() error = %v", err)
+	}
+	if !results.OK() {
+		t.Errorf("VerifyChecksums() mismatches = %+v", results.Mismatches())
+	}
+	if len(results) != len(expected) {
+		t.Errorf("got %d results, want %d", len(results), len(expected))
+	}
+	if read != int64(len(checksumFixture)) {
+		t.Errorf("progress reported %d bytes, want %d", read, len(checksumFixture))
+	}
+}
+
+func TestVerifyChecksumsMismatch(t *testing.T) {
+	results, err := VerifyChecksums(strings.NewReader(checksumFixture), map[string]string{
+		"sha1":   "2fd4e1c67a2d28fced849ee1bb76e7391b93eb12",
+		"sha256": "0000000000000000000000000000000000000000000000000000000000000000",
+	})
+	if err != nil {
+		t.Fatalf("VerifyChecksums() error = %v", err)
+	}
+	if results.OK() {
+		t.Fatal("VerifyChecksums() should report a mismatch")
+	}
+	bad := results.Mismatches()
+	if len(bad) != 1 || bad[0].Algorithm != "sha256" {
+		t.Fatalf("Mismatches() = %+v, want only sha256", bad)
+	}
+	if bad[0].Actual != "d7a8fbb307d7809469ca9abcb0082e4f8d5651e46d3cdb762d02d0bf37c9e592" {
+		t.Errorf("computed sha256 = %s", bad[0].Actual)
+	}
+	if !results["sha1"].OK {
+		t.Error("sha1 should still match")
+	}
+}
+
+func TestVerifyChecksumsUnsupported(t *testing.T) {
+	if _, err := VerifyChecksums(strings.NewReader(""), map[string]string{"crc32": "00000000"}); err == nil {
+		t.Error("expected error for unsupported algorithm")
+	}
+	if _, err := VerifyChecksums(strings.NewReader(""), nil); err == nil {
+		t.Error("expected error for no checksums")
+	}
+}
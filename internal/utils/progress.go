@@ -0,0 +1,214 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/vbauerster/mpb/v7"
+	"github.com/vbauerster/mpb/v7/decor"
+)
+
+// ProgressReporter reports the progress of a long running operation (i.e. a download)
+type ProgressReporter interface {
+	Start(total int64) // total <= 0 means unknown
+	Add(n int64)
+	Finish()
+}
+
+// ProgressStyle selects a ProgressReporter implementation
+type ProgressStyle string
+
+const (
+	ProgressBar  ProgressStyle = "bar"
+	ProgressJSON ProgressStyle = "json"
+	ProgressNone ProgressStyle = "none"
+)
+
+// NewProgressReporter returns a ProgressReporter of the given style that writes to w
+func NewProgressReporter(style ProgressStyle, w io.Writer, name string) (ProgressReporter, error) {
+	switch style {
+	case "", ProgressBar:
+		return NewTerminalProgress(w, 0), nil
+	case ProgressJSON:
+		return NewJSONProgress(w, name, time.Second), nil
+	case ProgressNone:
+		return NopProgress{}, nil
+	default:
+		return nil, fmt.Errorf("invalid progress style '%s' (expected %s, %s or %s)", style, ProgressBar, ProgressJSON, ProgressNone)
+	}
+}
+
+// ProgressReader wraps r so that every read is reported to p
+func ProgressReader(r io.Reader, p ProgressReporter) io.Reader {
+	return &progressReader{r: r, p: p}
+}
+
+type progressReader struct {
+	r io.Reader
+	p ProgressReporter
+}
+
+func (pr *progressReader) Read(b []byte) (int, error) {
+	n, err := pr.r.Read(b)
+	if n > 0 {
+		pr.p.Add(int64(n))
+	}
+	return n, err
+}
+
+// NopProgress is a ProgressReporter that reports nothing
+type NopProgress struct{}
+
+func (NopProgress) Start(int64) {}
+func (NopProgress) Add(int64)   {}
+func (NopProgress) Finish()     {}
+
+// TerminalProgress renders a progress bar
+type TerminalProgress struct {
+	w       io.Writer
+	resumed int64
+	p       *mpb.Progress
+	bar     *mpb.Bar
+	last    time.Time
+}
+
+// NewTerminalProgress creates a progress bar that writes to w; resumed is the number of bytes
+// already done by a previous (resumed) run which are shown as a refill
+func NewTerminalProgress(w io.Writer, resumed int64) *TerminalProgress {
+	return &TerminalProgress{w: w, resumed: resumed}
+}
+
+// Start adds the bar to the terminal
+func (t *TerminalProgress) Start(total int64) {
+	t.p = mpb.New(
+		mpb.WithOutput(t.w),
+		mpb.WithWidth(60),
+		mpb.WithRefreshRate(180*time.Millisecond),
+	)
+	style := mpb.BarStyle().Lbound("[").Filler("=").Tip(">").Padding("-").Rbound("|")
+	if t.resumed > 0 {
+		t.bar = t.p.New(total, style,
+			mpb.PrependDecorators(
+				decor.CountersKibiByte("\t% .2f / % .2f"),
+			),
+			mpb.AppendDecorators(
+				decor.OnComplete(decor.EwmaETA(decor.ET_STYLE_GO, float64(total)/2048), "✅ "),
+				decor.Name(" ] "),
+				decor.EwmaSpeed(decor.UnitKiB, "% .2f", float64(total)/2048),
+			),
+		)
+		t.bar.SetRefill(t.resumed)
+		t.bar.IncrInt64(t.resumed)
+	} else {
+		t.bar = t.p.New(total, style,
+			mpb.PrependDecorators(
+				decor.CountersKibiByte("\t% .2f / % .2f"),
+			),
+			mpb.AppendDecorators(
+				decor.OnComplete(decor.AverageETA(decor.ET_STYLE_GO), "✅ "),
+				decor.Name(" ] "),
+				decor.AverageSpeed(decor.UnitKiB, "% .2f"),
+			),
+		)
+	}
+	t.last = time.Now()
+}
+
+// Add advances the bar by n
+func (t *TerminalProgress) Add(n int64) {
+	if t.bar == nil {
+		return
+	}
+	now := time.Now()
+	t.bar.IncrInt64(n)
+	if t.resumed > 0 {
+		t.bar.DecoratorEwmaUpdate(now.Sub(t.last))
+	}
+	t.last = now
+}
+
+// Finish completes the bar and waits for it to be rendered
+func (t *TerminalProgress) Finish() {
+	if t.bar == nil {
+		return
+	}
+	t.bar.SetTotal(-1, true)
+	t.p.Wait()
+	t.bar = nil
+}
+
+type progressEvent struct {
+	Event   string  `json:"event"`
+	Name    string  `json:"name,omitempty"`
+	Current int64   `json:"current"`
+	Total   int64   `json:"total,omitempty"`
+	Percent float64 `json:"percent,omitempty"`
+	Elapsed float64 `json:"elapsed"`
+}
+
+// JSONProgress writes progress as JSON lines (start, progress and finish events)
+type JSONProgress struct {
+	sync.Mutex
+
+	w        io.Writer
+	name     string
+	interval time.Duration
+	now      func() time.Time
+
+	total   int64
+	current int64
+	started time.Time
+	lastOut time.Time
+}
+
+// NewJSONProgress creates a JSON lines reporter that writes at most one progress event per interval
+func NewJSONProgress(w io.Writer, name string, interval time.Duration) *JSONProgress {
+	return &JSONProgress{w: w, name: name, interval: interval, now: time.Now}
+}
+
+func (j *JSONProgress) emit(event string) {
+	e := progressEvent{
+		Event:   event,
+		Name:    j.name,
+		Current: j.current,
+		Total:   j.total,
+		Elapsed: j.now().Sub(j.started).Seconds(),
+	}
+	if j.total > 0 {
+		e.Percent = float64(j.current) * 100 / float64(j.total)
+	}
+	dat, _ := json.Marshal(e)
+	fmt.Fprintln(j.w, string(dat))
+}
+
+// Start writes a start event
+func (j *JSONProgress) Start(total int64) {
+	j.Lock()
+	defer j.Unlock()
+	j.total = total
+	j.current = 0
+	j.started = j.now()
+	j.lastOut = j.started
+	j.emit("start")
+}
+
+// Add writes a progress event if the interval has elapsed since the last one
+func (j *JSONProgress) Add(n int64) {
+	j.Lock()
+	defer j.Unlock()
+	j.current += n
+	if now := j.now(); now.Sub(j.lastOut) >= j.interval {
+		j.lastOut = now
+		j.emit("progress")
+	}
+}
+
+// Finish writes a finish event
+func (j *JSONProgress) Finish() {
+	j.Lock()
+	defer j.Unlock()
+	j.emit("finish")
+}
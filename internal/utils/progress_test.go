@@ -0,0 +1,82 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJSONProgress(t *testing.T) {
+	var buf bytes.Buffer
+	now := time.Unix(0, 0)
+	p := NewJSONProgress(&buf, "test.ipsw", time.Second)
+	p.now = func() time.Time { return now }
+
+	p.Start(100)
+	p.Add(10) // throttled
+	now = now.Add(time.Second)
+	p.Add(40)
+	now = now.Add(500 * time.Millisecond)
+	p.Add(50) // throttled
+	p.Finish()
+
+	var events []progressEvent
+	sc := bufio.NewScanner(&buf)
+	for sc.Scan() {
+		var e progressEvent
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			t.Fatalf("invalid JSON line %q: %v", sc.Text(), err)
+		}
+		events = append(events, e)
+	}
+
+	want := []progressEvent{
+		{Event: "start", Name: "test.ipsw", Total: 100},
+		{Event: "progress", Name: "test.ipsw", Current: 50, Total: 100, Percent: 50, Elapsed: 1},
+		{Event: "finish", Name: "test.ipsw", Current: 100, Total: 100, Percent: 100, Elapsed: 1.5},
+	}
+	if len(events) != len(want) {
+		t.Fatalf("got %d events, want %d: %+v", len(events), len(want), events)
+	}
+	for i := range want {
+		if events[i] != want[i] {
+			t.Errorf("event[%d] = %+v, want %+v", i, events[i], want[i])
+		}
+	}
+}
+
+func TestTerminalProgress(t *testing.T) {
+	var buf bytes.Buffer
+	p := NewTerminalProgress(&buf, 0)
+
+	data := strings.Repeat("A", 64*1024)
+	p.Start(int64(len(data)))
+	n, err := io.Copy(io.Discard, ProgressReader(strings.NewReader(data), p))
+	if err != nil || n != int64(len(data)) {
+		t.Fatalf("io.Copy() = %d, %v", n, err)
+	}
+	p.Finish()
+
+	out := buf.String()
+	if !strings.Contains(out, "64.00 KiB / 64.00 KiB") {
+		t.Errorf("bar output missing counters: %q", out)
+	}
+	if !strings.Contains(out, "✅") {
+		t.Errorf("bar output missing completion marker: %q", out)
+	}
+}
+
+func TestNewProgressReporter(t *testing.T) {
+	for _, style := range []ProgressStyle{"", ProgressBar, ProgressJSON, ProgressNone} {
+		if _, err := NewProgressReporter(style, io.Discard, "x"); err != nil {
+			t.Errorf("NewProgressReporter(%q) error = %v", style, err)
+		}
+	}
+	if _, err := NewProgressReporter("fancy", io.Discard, "x"); err == nil {
+		t.Error("expected error for unknown progress style")
+	}
+}
@@ -0,0 +1,14 @@
+//go:build darwin || linux || freebsd
+
+package utils
+
+import "golang.org/x/sys/unix"
+
+// FreeDiskSpace returns the bytes available to the user on the filesystem containing path
+func FreeDiskSpace(path string) (uint64, error) {
+	var st unix.Statfs_t
+	if err := unix.Statfs(path, &st); err != nil {
+		return 0, err
+	}
+	return uint64(st.Bavail) * uint64(st.Bsize), nil
+}
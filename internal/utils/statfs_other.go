@@ -0,0 +1,13 @@
+//go:build !darwin && !linux && !freebsd && !windows
+
+package utils
+
+import (
+	"errors"
+	"runtime"
+)
+
+// FreeDiskSpace returns the bytes available to the user on the filesystem containing path
+func FreeDiskSpace(path string) (uint64, error) {
+	return 0, errors.New("free disk space is not supported on " + runtime.GOOS)
+}
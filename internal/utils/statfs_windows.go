@@ -0,0 +1,18 @@
+//go:build windows
+
+package utils
+
+import "golang.org/x/sys/windows"
+
+// FreeDiskSpace returns the bytes available to the user on the volume containing path
+func FreeDiskSpace(path string) (uint64, error) {
+	p, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, err
+	}
+	var free uint64
+	if err := windows.GetDiskFreeSpaceEx(p, &free, nil, nil); err != nil {
+		return 0, err
+	}
+	return free, nil
+}
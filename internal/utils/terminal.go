@@ -4,13 +4,63 @@ import (
 	"encoding/base64"
 	"fmt"
 	"io"
+	"os"
+	"os/exec"
+	"runtime"
+
+	"github.com/apex/log"
+	"golang.org/x/term"
+)
+
+var (
+	// supportsInlineImages reports whether stdout is a terminal that can display inline images (iTerm2's protocol)
+	supportsInlineImages = func() bool {
+		if !term.IsTerminal(int(os.Stdout.Fd())) {
+			return false
+		}
+		switch os.Getenv("TERM_PROGRAM") {
+		case "iTerm.app", "vscode", "WezTerm":
+			return true
+		}
+		return os.Getenv("LC_TERMINAL") == "iTerm2"
+	}
+	// openFile opens path with its default macOS app
+	openFile = func(path string) error {
+		return exec.Command("open", path).Run()
+	}
 )
 
-// DisplayImageInTerminal displays an image in the terminal (supported in iTerm2 and VSCode)
-func DisplayImageInTerminal(r io.Reader, size, width, height int) error {
+// SupportsInlineImages reports whether the terminal can display images inline (so callers that only want
+// to show an image in passing can skip the temp file DisplayImageInTerminal falls back to)
+func SupportsInlineImages() bool {
+	return supportsInlineImages()
+}
+
+// DisplayImageInTerminal displays a PNG image in the terminal (supported in iTerm2 and VSCode).
+// In other terminals it writes the image to a temp file instead, prints its path and (on macOS, if open is set)
+// opens it; the returned path is empty if the image was displayed inline.
+func DisplayImageInTerminal(r io.Reader, size, width, height int, open bool) (string, error) {
 	data, err := io.ReadAll(r)
 	if err != nil {
-		return fmt.Errorf("failed to read terminal image data: %w", err)
+		return "", fmt.Errorf("failed to read terminal image data: %w", err)
+	}
+
+	if !supportsInlineImages() {
+		f, err := os.CreateTemp("", "ipsw_image_*.png")
+		if err != nil {
+			return "", fmt.Errorf("failed to create temp image file: %w", err)
+		}
+		defer f.Close()
+		if _, err := f.Write(data); err != nil {
+			return "", fmt.Errorf("failed to write temp image file: %w", err)
+		}
+		log.Infof("Terminal can't display images, wrote image to %s", f.Name())
+		if open && runtime.GOOS == "darwin" {
+			if err := openFile(f.Name()); err != nil {
+				return f.Name(), fmt.Errorf("failed to open %s: %w", f.Name(), err)
+			}
+		}
+		return f.Name(), nil
 	}
 
 	fmt.Print("\033]1337;")
@@ -24,5 +74,5 @@ func DisplayImageInTerminal(r io.Reader, size, width, height int) error {
 	fmt.Printf("%s", base64.StdEncoding.EncodeToString(data))
 	fmt.Print("\a\n")
 
-	return nil
+	return "", nil
 }
@@ -0,0 +1,43 @@
+package utils
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestDisplayImageInTerminalFallback(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+	defer func(inline func() bool, open func(string) error) {
+		supportsInlineImages, openFile = inline, open
+	}(supportsInlineImages, openFile)
+	supportsInlineImages = func() bool { return false }
+	var opened []string
+	openFile = func(path string) error {
+		opened = append(opened, path)
+		return nil
+	}
+
+	data := []byte("\x89PNG\r\n\x1a\nfake")
+	for _, open := range []bool{false, true} {
+		opened = nil
+		path, err := DisplayImageInTerminal(bytes.NewReader(data), len(data), 256, 256, open)
+		if err != nil {
+			t.Fatalf("DisplayImageInTerminal(open=%t) error = %v", open, err)
+		}
+		if filepath.Dir(path) != tmp || !strings.HasSuffix(path, ".png") {
+			t.Errorf("DisplayImageInTerminal(open=%t) path = %q, want a .png in %s", open, path, tmp)
+		}
+		if got, err := os.ReadFile(path); err != nil || !bytes.Equal(got, data) {
+			t.Errorf("DisplayImageInTerminal(open=%t) wrote %q (err %v), want %q", open, got, err, data)
+		}
+		wantOpened := open && runtime.GOOS == "darwin"
+		if (len(opened) == 1 && opened[0] == path) != wantOpened || len(opened) > 1 {
+			t.Errorf("DisplayImageInTerminal(open=%t) opened %v, want opened=%t", open, opened, wantOpened)
+		}
+	}
+}
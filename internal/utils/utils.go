@@ -4,7 +4,6 @@ import (
 	"archive/tar"
 	"archive/zip"
 	"compress/gzip"
-	"crypto/sha1"
 	"fmt"
 	"io"
 	"math/rand"
@@ -95,6 +94,18 @@ func UniqueAppend[T comparable](slice []T, i T) []T {
 	return append(slice, i)
 }
 
+// UniqueAppendFunc appends i to slice unless an element with the same key is already in it
+// (i.e. UniqueAppendFunc(devs, dev, strings.ToLower) for case-insensitive device lists)
+func UniqueAppendFunc[T any, K comparable](slice []T, i T, key func(T) K) []T {
+	k := key(i)
+	for _, ele := range slice {
+		if key(ele) == k {
+			return slice
+		}
+	}
+	return append(slice, i)
+}
+
 func UniqueConcat[T comparable](slice []T, in []T) []T {
 	for _, i := range in {
 		for _, ele := range slice {
@@ -162,17 +173,17 @@ func Verify(sha1sum, name string) (bool, error) {
 	}
 	defer f.Close()
 
-	h := sha1.New()
-	if _, err := io.Copy(h, f); err != nil {
+	results, err := VerifyChecksums(f, map[string]string{"sha1": sha1sum})
+	if err != nil {
 		return false, err
 	}
 
-	match := strings.EqualFold(sha1sum, fmt.Sprintf("%x", h.Sum(nil)))
+	match := results.OK()
 
 	if !match {
 		Indent(log.WithFields(log.Fields{
 			"expected": sha1sum,
-			"actual":   fmt.Sprintf("%x", h.Sum(nil)),
+			"actual":   results["sha1"].Actual,
 		}).Error, 3)("BAD CHECKSUM")
 	}
 
@@ -0,0 +1,23 @@
+package utils
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestUniqueAppendFunc(t *testing.T) {
+	var devs []string
+	for _, dev := range []string{"iPhone14,5", "iphone14,5", "iPhone14,2", "IPHONE14,5"} {
+		devs = UniqueAppendFunc(devs, dev, strings.ToLower)
+	}
+	if want := []string{"iPhone14,5", "iPhone14,2"}; !reflect.DeepEqual(devs, want) {
+		t.Errorf("UniqueAppendFunc() = %v, want %v", devs, want)
+	}
+
+	type fw struct{ Build, URL string }
+	fws := UniqueAppendFunc([]fw{{"21A329", "a"}}, fw{"21A329", "b"}, func(f fw) string { return f.Build })
+	if len(fws) != 1 || fws[0].URL != "a" {
+		t.Errorf("UniqueAppendFunc(key) = %v, want the first element kept", fws)
+	}
+}
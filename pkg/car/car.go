@@ -476,14 +476,16 @@ func Parse(name string, conf *Config) (*Asset, error) {
 									imgFile.Close()
 								}
 								if a.conf.Verbose {
-									// display image in terminal
 									log.Debug(rend.Name)
+								}
+								if a.conf.Verbose && utils.SupportsInlineImages() {
+									// display image in terminal (only inline, so dumping doesn't leave temp files behind)
 									var dat bytes.Buffer
 									buf := bufio.NewWriter(&dat)
 									if err := png.Encode(buf, img); err != nil {
 										return nil, err
 									}
-									utils.DisplayImageInTerminal(bytes.NewReader(dat.Bytes()), dat.Len(), int(cheader.Width), int(cheader.Height))
+									utils.DisplayImageInTerminal(bytes.NewReader(dat.Bytes()), dat.Len(), int(cheader.Width), int(cheader.Height), false)
 								}
 								rend.Asset = img
 							}
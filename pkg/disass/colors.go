@@ -1,40 +1,46 @@
 package disass
 
 import (
+	"io"
+	"os"
 	"regexp"
 
+	"github.com/blacktop/ipsw/internal/output"
 	"github.com/fatih/color"
 )
 
+// stdout is where the disassembly is written (swapped in tests)
+var stdout io.Writer = os.Stdout
+
 // disassembly colors
-var colorOp = color.New(color.Bold).SprintfFunc()
-var colorRegs = color.New(color.Bold, color.FgHiBlue).SprintFunc()
-var colorImm = color.New(color.Bold, color.FgMagenta).SprintFunc()
-var colorAddr = color.New(color.Bold, color.FgMagenta).SprintfFunc()
-var colorOpCodes = color.New(color.Faint, color.FgHiWhite).SprintFunc()
-var colorComment = color.New(color.Faint, color.FgWhite).SprintFunc()
-var colorLocation = color.New(color.FgHiYellow).SprintfFunc()
-var printCurLine = color.New(color.Bold, color.FgBlack, color.BgHiWhite).PrintfFunc()
+var (
+	styleOp       = output.Style{color.Bold}
+	styleRegs     = output.Style{color.Bold, color.FgHiBlue}
+	styleImm      = output.Style{color.Bold, color.FgMagenta}
+	styleAddr     = output.Style{color.Bold, color.FgMagenta}
+	styleOpCodes  = output.Style{color.Faint, color.FgHiWhite}
+	styleComment  = output.Style{color.Faint, color.FgWhite}
+	styleLocation = output.Style{color.FgHiYellow}
+	styleCurLine  = output.Style{color.Bold, color.FgBlack, color.BgHiWhite}
+)
+
+var (
+	immMatch = regexp.MustCompile(`#?-?0x[0-9a-z]+`)
+	locMatch = regexp.MustCompile(`\sloc_[0-9a-z]+`)
+	regMatch = regexp.MustCompile(`\W([wxvbhsdqzp][0-9]{1,2}|(c|s)psr(_c)?|pc|sl|sb|fp|ip|sp|lr|fpsid|fpscr|fpexc)`)
+)
 
-func colorOperands(operands string) string {
+func colorOperands(out *output.Writer, operands string) string {
 	if len(operands) > 0 {
-		immMatch := regexp.MustCompile(`#?-?0x[0-9a-z]+`)
 		operands = immMatch.ReplaceAllStringFunc(operands, func(s string) string {
-			return colorImm(s)
+			return out.Sprint(styleImm, s)
 		})
-		locMatch := regexp.MustCompile(`\sloc_[0-9a-z]+`)
 		operands = locMatch.ReplaceAllStringFunc(operands, func(s string) string {
-			return colorLocation(s)
+			return out.Sprint(styleLocation, s)
 		})
-		regMatch := regexp.MustCompile(`\W([wxvbhsdqzp][0-9]{1,2}|(c|s)psr(_c)?|pc|sl|sb|fp|ip|sp|lr|fpsid|fpscr|fpexc)`)
 		operands = regMatch.ReplaceAllStringFunc(operands, func(s string) string {
-			return string(s[0]) + colorRegs(s[1:])
+			return string(s[0]) + out.Sprint(styleRegs, s[1:])
 		})
-		// TODO: delete this (moved comment coloring into disass module)
-		// commentMatch := regexp.MustCompile(`;\s.*$`)
-		// operands = commentMatch.ReplaceAllStringFunc(operands, func(s string) string {
-		// 	return colorComment(s)
-		// })
 	}
 	return operands
 }
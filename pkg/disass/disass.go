@@ -6,18 +6,35 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"slices"
 	"strings"
 
 	"github.com/apex/log"
 	"github.com/blacktop/arm64-cgo/disassemble"
 	"github.com/blacktop/go-macho"
 	"github.com/blacktop/go-macho/types"
+	"github.com/blacktop/ipsw/internal/output"
 	"github.com/blacktop/ipsw/internal/utils"
 )
 
+// PartialDisassemblyError is returned by Disassemble when it has to stop before the end of the data
+// (i.e. on a trailing partial instruction); everything before Addr was still disassembled
+type PartialDisassemblyError struct {
+	Offset uint64 // offset into the data
+	Addr   uint64
+	Err    error
+}
+
+func (e *PartialDisassemblyError) Error() string {
+	return fmt.Sprintf("stopped disassembling at %#x (offset %#x): %v", e.Addr, e.Offset, e.Err)
+}
+
+func (e *PartialDisassemblyError) Unwrap() error { return e.Err }
+
 type Disass interface {
 	Triage() error
 	IsFunctionStart(uint64) (bool, string)
+	FunctionStarts() []uint64
 	IsLocation(uint64) bool
 	IsBranchLocation(uint64) (bool, uint64)
 	IsData(uint64) (bool, *AddrDetails)
@@ -29,6 +46,11 @@ type Disass interface {
 	Quite() bool
 	Color() bool
 	AsJSON() bool
+	Groups() bool
+	Simplify() bool
+	MemOnly() bool
+	NoWrap() bool
+	Relative() bool
 	Data() []byte
 	StartAddr() uint64
 	Middle() uint64
@@ -122,9 +144,16 @@ type Config struct {
 	StartAddress uint64
 	Middle       uint64
 	AsJSON       bool
+	Groups       bool // annotate --json instructions with their control-flow groups
+	Simplify     bool // rewrite common idioms to their pseudo-instructions (i.e. movz/movk => mov)
+	MemOnly      bool // only print the instructions that access memory or compute an adrp address
+	NoWrap       bool // don't soft-wrap long lines at the terminal's width
+	Relative     bool // print addresses (and branch targets within the function) as offsets from the function start
 	Demangle     bool
 	Quite        bool
 	Color        bool
+	Symbols      SymbolIndex // additional symbols (i.e. from other images) to resolve branch targets with
+	Lines        *LineTable  // DWARF line info to annotate instructions with their source file:line
 }
 type AddrDetails struct {
 	Image   string
@@ -140,6 +169,19 @@ func (d AddrDetails) String() string {
 	return fmt.Sprintf("%s.%s", d.Segment, d.Section)
 }
 
+// objcRefResolver is implemented by disassemblers that can resolve Objective-C
+// selector/class references (i.e. __objc_selrefs and __objc_classrefs entries)
+type objcRefResolver interface {
+	ObjCSelRef(uint64) (string, bool)
+	ObjCClassRef(uint64) (string, bool)
+}
+
+// objcReg is an Objective-C selector or class loaded into a register
+type objcReg struct {
+	Name    string
+	IsClass bool
+}
+
 type Triage struct {
 	Details   map[uint64]AddrDetails
 	Function  *types.Function
@@ -147,12 +189,57 @@ type Triage struct {
 	Locations map[uint64][]uint64
 }
 
-func Disassemble(d Disass) {
+// Disassemble prints the disassembly of d's data; if it can't disassemble all of it, it still prints the
+// instructions before the failure and returns a *PartialDisassemblyError
+func Disassemble(d Disass) error {
+	out := output.NewWriter(stdout)
+	colored := d.Color() && out.Color()
+	if !d.NoWrap() && !d.AsJSON() {
+		out.SoftWrap()
+		defer out.Flush()
+	}
+
 	var instrStr string
 	var instrValue uint32
 	var results [1024]byte
 	var prevInstr *disassemble.Instruction
 	var instructions []disassemble.Instruction
+	var partial *PartialDisassemblyError
+
+	objcRegs := make(map[disassemble.Register]objcReg)
+	objc, _ := d.(objcRefResolver)
+	lines, _ := d.(sourceLineResolver)
+	var prevFile string
+	var prevLine int
+
+	var simp *Simplifier
+	if d.Simplify() {
+		simp = NewSimplifier()
+	}
+
+	var mem *MemAccessFilter
+	if d.MemOnly() && !d.AsJSON() {
+		mem = NewMemAccessFilter()
+	}
+
+	var rel *relativeAddrs
+	if d.Relative() && !d.AsJSON() {
+		rel = newRelativeAddrs(d)
+	}
+	// addr formats the address column of addr
+	addr := func(addr uint64) string {
+		if rel != nil {
+			return rel.offset(addr)
+		}
+		return fmt.Sprintf("%#08x", addr)
+	}
+	// label names the branch target target of the instruction at addr
+	label := func(addr, target uint64) string {
+		if rel != nil && rel.sameFunc(addr, target) {
+			return rel.offset(target)
+		}
+		return fmt.Sprintf("loc_%x", target)
+	}
 
 	r := bytes.NewReader(d.Data())
 
@@ -164,11 +251,18 @@ func Disassemble(d Disass) {
 		if err == io.EOF {
 			break
 		}
+		if err != nil {
+			partial = &PartialDisassemblyError{Offset: startAddr - d.StartAddr(), Addr: startAddr, Err: err}
+			break
+		}
 
 		if !d.AsJSON() {
 			var comment string
 			instruction, err := disassemble.Decompose(startAddr, instrValue, &results)
 			if err != nil {
+				if mem != nil {
+					goto INCR_ADDR
+				}
 				var op string
 				var oprs string
 				if instrValue == 0xfeedfacf {
@@ -221,46 +315,66 @@ func Disassemble(d Disass) {
 					comment = fmt.Sprintf(" ; (%s)", err.Error())
 				}
 
-				if d.Color() {
-					fmt.Printf("%s:  %s   %s %s%s\n",
-						colorAddr("%#08x", uint64(startAddr)),
-						colorOpCodes(disassemble.GetOpCodeByteString(instrValue)),
-						colorOp("%-7s", op),
-						colorOperands(" "+oprs),
-						colorComment(comment),
+				if colored {
+					out.Printf("%s:  %s   %s %s%s\n",
+						out.Sprint(styleAddr, addr(startAddr)),
+						out.Sprint(styleOpCodes, disassemble.GetOpCodeByteString(instrValue)),
+						out.Sprintf(styleOp, "%-7s", op),
+						colorOperands(out, " "+oprs),
+						out.Sprint(styleComment, comment),
 					)
 				} else {
-					fmt.Printf("%#08x:  %s   %s\t%s%s\n", uint64(startAddr), disassemble.GetOpCodeByteString(instrValue), op, oprs, comment)
+					out.Printf("%s:  %s   %s\t%s%s\n", addr(startAddr), disassemble.GetOpCodeByteString(instrValue), op, oprs, comment)
 				}
 
 				goto INCR_ADDR
 			}
 
 			instrStr = instruction.String()
+			mnemonic := instruction.Operation.String()
+
+			if simp != nil {
+				if ok, _ := d.IsFunctionStart(instruction.Address); ok || d.IsLocation(instruction.Address) {
+					simp.Reset()
+				}
+				if pseudo, ok := simp.Simplify(instruction); ok {
+					instrStr = pseudo
+					mnemonic, _, _ = strings.Cut(pseudo, "\t")
+				}
+			}
+
+			keep := true
+			if mem != nil {
+				if ok, _ := d.IsFunctionStart(instruction.Address); ok {
+					mem.Reset()
+				}
+				keep = mem.Keep(instruction)
+			}
 
 			if !d.Quite() {
 				// check for start of a new function
 				if ok, fname := d.IsFunctionStart(instruction.Address); ok {
-					if d.Color() {
-						fmt.Print(colorOp("\n%s:\n", fname))
+					objcRegs = make(map[disassemble.Register]objcReg)
+					if colored {
+						out.Print(out.Sprintf(styleOp, "\n%s:\n", fname))
 					} else {
-						fmt.Printf("\n%s:\n", fname)
+						out.Printf("\n%s:\n", fname)
 					}
 				} else {
 					if name, ok := d.FindSymbol(uint64(instruction.Address)); ok {
-						if d.Color() {
-							fmt.Print(colorOp("\n%s\n", name))
+						if colored {
+							out.Print(out.Sprintf(styleOp, "\n%s\n", name))
 						} else {
-							fmt.Printf("\n%s\n", name)
+							out.Printf("\n%s\n", name)
 						}
 					}
 				}
 
-				if d.IsLocation(instruction.Address) {
-					if d.Color() {
-						fmt.Printf("%s:  %s\n", colorAddr("%#08x", instruction.Address), colorLocation("loc_%x", instruction.Address))
+				if d.IsLocation(instruction.Address) && keep {
+					if colored {
+						out.Printf("%s:  %s\n", out.Sprint(styleAddr, addr(instruction.Address)), out.Sprint(styleLocation, label(instruction.Address, instruction.Address)))
 					} else {
-						fmt.Printf("%#08x:  ; loc_%x\n", instruction.Address, instruction.Address)
+						out.Printf("%s:  ; %s\n", addr(instruction.Address), label(instruction.Address, instruction.Address))
 					}
 				}
 
@@ -274,6 +388,10 @@ func Disassemble(d Disass) {
 				// 	}
 				// }
 
+				for _, reg := range writtenRegs(instruction) {
+					delete(objcRegs, reg) // the selector/class it held is overwritten
+				}
+
 				if instruction.Operation == disassemble.ARM64_MRS || instruction.Operation == disassemble.ARM64_MSR {
 					var ops []string
 					replaced := false
@@ -307,7 +425,7 @@ func Disassemble(d Disass) {
 								} else {
 									direction = fmt.Sprintf(" ; ⤴ %#x", delta)
 								}
-								opStr = strings.Replace(opStr, fmt.Sprintf("%#x", loc), fmt.Sprintf("loc_%x%s", loc, direction), 1)
+								opStr = strings.Replace(opStr, fmt.Sprintf("%#x", loc), label(instruction.Address, loc)+direction, 1)
 							}
 						}
 					}
@@ -315,6 +433,18 @@ func Disassemble(d Disass) {
 				} else if instruction.Encoding == disassemble.ENC_BL_ONLY_BRANCH_IMM || instruction.Encoding == disassemble.ENC_B_ONLY_BRANCH_IMM {
 					if name, ok := d.FindSymbol(uint64(instruction.Operands[0].Immediate)); ok {
 						instrStr = fmt.Sprintf("%s\t%s", instruction.Operation, name)
+						if strings.Contains(name, "objc_msgSend") {
+							if sel, ok := objcRegs[disassemble.REG_X1]; ok && !sel.IsClass {
+								if cls, ok := objcRegs[disassemble.REG_X0]; ok && cls.IsClass {
+									comment = fmt.Sprintf(" ; +[%s %s]", cls.Name, sel.Name)
+								} else {
+									comment = fmt.Sprintf(" ; -[? %s]", sel.Name)
+								}
+							}
+						}
+					}
+					if instruction.Encoding == disassemble.ENC_BL_ONLY_BRANCH_IMM {
+						objcRegs = make(map[disassemble.Register]objcReg) // call clobbers the argument registers
 					}
 				} else if strings.Contains(instruction.Encoding.String(), "loadlit") {
 					if name, ok := d.FindSymbol(uint64(instruction.Operands[1].Immediate)); ok {
@@ -358,11 +488,17 @@ func Disassemble(d Disass) {
 					} else if instruction.Operation == disassemble.ARM64_LDRSW && adrpRegister == instruction.Operands[1].Registers[0] {
 						adrpImm += instruction.Operands[1].Immediate
 					}
-					if name, ok := d.FindSymbol(uint64(adrpImm)); ok {
+					if sel, ok := objcSelRef(objc, instruction, adrpImm); ok {
+						objcRegs[instruction.Operands[0].Registers[0]] = objcReg{Name: sel}
+						comment = fmt.Sprintf(" ; @selector(%s)", sel)
+					} else if cls, ok := objcClassRef(objc, instruction, adrpImm); ok {
+						objcRegs[instruction.Operands[0].Registers[0]] = objcReg{Name: cls, IsClass: true}
+						comment = fmt.Sprintf(" ; _OBJC_CLASS_$_%s", cls)
+					} else if name, ok := d.FindSymbol(uint64(adrpImm)); ok {
 						if ok, detail := d.IsData(adrpImm); ok {
 							_ = detail
 							if ok, detail := d.IsPointer(adrpImm); ok {
-								fmt.Printf("ptr_%x: .quad %s ; %s\n", adrpImm, detail, name)
+								out.Printf("ptr_%x: .quad %s ; %s\n", adrpImm, detail, name)
 							}
 							if ptr, err := d.ReadAddr(adrpImm); err == nil {
 								if ptrname, ok := d.FindSymbol(ptr); ok {
@@ -398,29 +534,49 @@ func Disassemble(d Disass) {
 				}
 
 				if instruction.Encoding == disassemble.ENC_LDR_B_LDST_IMMPRE {
-					fmt.Println(instrStr)
+					out.Println(instrStr)
+				}
+			}
+
+			if rel != nil {
+				instrStr = rel.labels(instruction, instrStr)
+			}
+
+			if !keep {
+				prevInstr = instruction
+				goto INCR_ADDR
+			}
+
+			if lines != nil {
+				if file, line, ok := lines.SourceLine(instruction.Address); ok && (line != prevLine || file != prevFile) {
+					if colored {
+						out.Println(out.Sprint(styleComment, fmt.Sprintf("; %s:%d", file, line)))
+					} else {
+						out.Printf("; %s:%d\n", file, line)
+					}
+					prevFile, prevLine = file, line
 				}
 			}
 
 			if d.Middle() != 0 && d.Middle() == startAddr {
-				if d.Color() {
-					opStr := strings.TrimSpace(strings.TrimPrefix(instrStr, instruction.Operation.String()))
-					printCurLine("=>%08x:  %s   %-7s %s%s\n", uint64(startAddr), disassemble.GetOpCodeByteString(instrValue), instruction.Operation, opStr, comment)
+				if colored {
+					opStr := strings.TrimSpace(strings.TrimPrefix(instrStr, mnemonic))
+					out.Print(out.Sprintf(styleCurLine, "=>%s:  %s   %-7s %s%s\n", strings.TrimPrefix(addr(startAddr), "0x"), disassemble.GetOpCodeByteString(instrValue), mnemonic, opStr, comment))
 				} else {
-					fmt.Printf("=>%08x:  %s\t%s%s\n", uint64(startAddr), disassemble.GetOpCodeByteString(instrValue), instrStr, comment)
+					out.Printf("=>%s:  %s\t%s%s\n", strings.TrimPrefix(addr(startAddr), "0x"), disassemble.GetOpCodeByteString(instrValue), instrStr, comment)
 				}
 			} else {
-				if d.Color() {
-					opStr := strings.TrimSpace(strings.TrimPrefix(instrStr, instruction.Operation.String()))
-					fmt.Printf("%s:  %s   %s %s%s\n",
-						colorAddr("%#08x", uint64(startAddr)),
-						colorOpCodes(disassemble.GetOpCodeByteString(instrValue)),
-						colorOp("%-7s", instruction.Operation),
-						colorOperands(" "+opStr),
-						colorComment(comment),
+				if colored {
+					opStr := strings.TrimSpace(strings.TrimPrefix(instrStr, mnemonic))
+					out.Printf("%s:  %s   %s %s%s\n",
+						out.Sprint(styleAddr, addr(startAddr)),
+						out.Sprint(styleOpCodes, disassemble.GetOpCodeByteString(instrValue)),
+						out.Sprintf(styleOp, "%-7s", mnemonic),
+						colorOperands(out, " "+opStr),
+						out.Sprint(styleComment, comment),
 					)
 				} else {
-					fmt.Printf("%#08x:  %s   %s%s\n", uint64(startAddr), disassemble.GetOpCodeByteString(instrValue), instrStr, comment)
+					out.Printf("%s:  %s   %s%s\n", addr(startAddr), disassemble.GetOpCodeByteString(instrValue), instrStr, comment)
 				}
 			}
 
@@ -439,6 +595,14 @@ func Disassemble(d Disass) {
 				})
 				goto INCR_ADDR
 			}
+			if simp != nil {
+				if ok, _ := d.IsFunctionStart(instruction.Address); ok || d.IsLocation(instruction.Address) {
+					simp.Reset()
+				}
+				if pseudo, ok := simp.Simplify(instruction); ok {
+					instruction.Disassembly = pseudo
+				}
+			}
 			instructions = append(instructions, *instruction)
 		}
 	INCR_ADDR:
@@ -447,27 +611,85 @@ func Disassemble(d Disass) {
 
 	if d.AsJSON() {
 		var curFunc string
-		funcsJSON := make(map[string][]disassemble.Instruction)
-		for _, inst := range instructions {
+		var output []any
+		for i := range instructions {
+			if d.Groups() {
+				output = append(output, NewGroupedInstruction(instructions[i]))
+			} else {
+				output = append(output, &instructions[i])
+			}
+		}
+		funcsJSON := make(map[string][]any)
+		for i, inst := range instructions {
 			if ok, fname := d.IsFunctionStart(inst.Address); ok {
 				curFunc = fname
-				funcsJSON[curFunc] = append(funcsJSON[curFunc], inst)
+				funcsJSON[curFunc] = append(funcsJSON[curFunc], output[i])
 			} else {
 				if len(curFunc) > 0 {
-					funcsJSON[curFunc] = append(funcsJSON[curFunc], inst)
+					funcsJSON[curFunc] = append(funcsJSON[curFunc], output[i])
 				}
 			}
 		}
 		if len(funcsJSON) > 0 {
 			if dat, err := json.Marshal(funcsJSON); err == nil {
-				fmt.Println(string(dat))
+				out.Println(string(dat))
 			}
 		} else {
-			if dat, err := json.Marshal(instructions); err == nil {
-				fmt.Println(string(dat))
+			if dat, err := json.Marshal(output); err == nil {
+				out.Println(string(dat))
+			}
+		}
+	}
+
+	if partial != nil {
+		return partial
+	}
+	return nil
+}
+
+func objcSelRef(objc objcRefResolver, instruction *disassemble.Instruction, addr uint64) (string, bool) {
+	if objc == nil || instruction.Operation != disassemble.ARM64_LDR || len(instruction.Operands[0].Registers) == 0 {
+		return "", false
+	}
+	return objc.ObjCSelRef(addr)
+}
+
+func objcClassRef(objc objcRefResolver, instruction *disassemble.Instruction, addr uint64) (string, bool) {
+	if objc == nil || instruction.Operation != disassemble.ARM64_LDR || len(instruction.Operands[0].Registers) == 0 {
+		return "", false
+	}
+	return objc.ObjCClassRef(addr)
+}
+
+// objcReadOnlyOps are the operations whose first register operand is only read (stores, compares and branches)
+var objcReadOnlyOps = []string{"st", "cmp", "cmn", "tst", "ccm", "fcm", "fccm", "cb", "tb", "br", "blr", "ret", "msr", "prfm", "b."}
+
+// writtenRegs returns the (64-bit) registers inst writes: its destination register(s) and a written back base
+// register; a tracked Objective-C selector/class in them is gone once they are written
+func writtenRegs(inst *disassemble.Instruction) []disassemble.Register {
+	var regs []disassemble.Register
+	op := inst.Operation.String()
+	readOnly := slices.ContainsFunc(objcReadOnlyOps, func(prefix string) bool { return strings.HasPrefix(op, prefix) })
+	if strings.HasPrefix(op, "st") && strings.Contains(op, "xr") {
+		readOnly = false // stxr/stlxr write their status register
+	}
+	if !readOnly {
+		n := 1
+		if op == "ldp" || op == "ldpsw" || op == "ldnp" || op == "ldxp" || op == "ldaxp" {
+			n = 2
+		}
+		for i := 0; i < n && i < len(inst.Operands); i++ {
+			if inst.Operands[i].Class == disassemble.REG && len(inst.Operands[i].Registers) > 0 {
+				regs = append(regs, xReg(inst.Operands[i].Registers[0]))
 			}
 		}
 	}
+	for _, operand := range inst.Operands {
+		if (operand.Class == disassemble.MEM_PRE_IDX || operand.Class == disassemble.MEM_POST_IDX) && len(operand.Registers) > 0 {
+			regs = append(regs, xReg(operand.Registers[0]))
+		}
+	}
+	return regs
 }
 
 func ParseGotPtrs(m *macho.File) (map[uint64]uint64, error) {
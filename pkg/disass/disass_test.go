@@ -0,0 +1,288 @@
+package disass
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/blacktop/ipsw/internal/output"
+)
+
+// fakeDisass disassembles data at 0x1000 with a function (_main) at its start
+type fakeDisass struct {
+	data     []byte
+	color    bool
+	simplify bool
+	memOnly  bool
+	relative bool
+	funcs    map[uint64]string // functions other than _main
+}
+
+func (d fakeDisass) Triage() error                              { return nil }
+func (d fakeDisass) IsFunctionStart(addr uint64) (bool, string) { return d.function(addr) }
+func (d fakeDisass) IsLocation(addr uint64) bool                { return addr == 0x1008 }
+func (d fakeDisass) IsBranchLocation(uint64) (bool, uint64)     { return false, 0 }
+func (d fakeDisass) IsData(uint64) (bool, *AddrDetails)         { return false, nil }
+func (d fakeDisass) IsPointer(uint64) (bool, *AddrDetails)      { return false, nil }
+func (d fakeDisass) FindSymbol(uint64) (string, bool)           { return "", false }
+func (d fakeDisass) GetCString(uint64) (string, error)          { return "", fmt.Errorf("not a string") }
+func (d fakeDisass) Demangle() bool                             { return false }
+func (d fakeDisass) Quite() bool                                { return false }
+func (d fakeDisass) Color() bool                                { return d.color }
+func (d fakeDisass) AsJSON() bool                               { return false }
+func (d fakeDisass) Groups() bool                               { return false }
+func (d fakeDisass) Simplify() bool                             { return d.simplify }
+func (d fakeDisass) MemOnly() bool                              { return d.memOnly }
+func (d fakeDisass) NoWrap() bool                               { return false }
+func (d fakeDisass) Relative() bool                             { return d.relative }
+func (d fakeDisass) Data() []byte                               { return d.data }
+func (d fakeDisass) StartAddr() uint64                          { return 0x1000 }
+func (d fakeDisass) Middle() uint64                             { return 0 }
+func (d fakeDisass) ReadAddr(uint64) (uint64, error)            { return 0, fmt.Errorf("no pointers") }
+
+func (d fakeDisass) FunctionStarts() []uint64 {
+	starts := []uint64{0x1000}
+	for addr := range d.funcs {
+		starts = append(starts, addr)
+	}
+	return starts
+}
+
+func (d fakeDisass) function(addr uint64) (bool, string) {
+	if name, ok := d.funcs[addr]; ok {
+		return true, name
+	}
+	return addr == 0x1000, "_main"
+}
+
+func TestDisassemblePlain(t *testing.T) {
+	var buf bytes.Buffer
+	stdout = &buf
+	output.Configure(true, false)
+	defer func() {
+		stdout = os.Stdout
+		output.Configure(false, false)
+	}()
+
+	data := make([]byte, 0, 12)
+	for _, raw := range []uint32{0xd503201f, 0x94000001, 0xd65f03c0} { // nop; bl #4; ret
+		data = binary.LittleEndian.AppendUint32(data, raw)
+	}
+	// --color is ignored when the output isn't a terminal
+	if err := Disassemble(fakeDisass{data: data, color: true}); err != nil {
+		t.Fatalf("Disassemble() error = %v", err)
+	}
+
+	want := "\n" +
+		"_main:\n" +
+		"0x00001000:  1f 20 03 d5   nop\n" +
+		"0x00001004:  01 00 00 94   bl\t0x1008\n" +
+		"0x00001008:  ; loc_1008\n" +
+		"0x00001008:  c0 03 5f d6   ret\n"
+	if got := buf.String(); got != want {
+		t.Errorf("Disassemble() =\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestDisassemblePartial(t *testing.T) {
+	var buf bytes.Buffer
+	stdout = &buf
+	defer func() { stdout = os.Stdout }()
+
+	data := make([]byte, 0, 10)
+	for _, raw := range []uint32{0xd503201f, 0xd65f03c0} { // nop; ret
+		data = binary.LittleEndian.AppendUint32(data, raw)
+	}
+	data = append(data, 0xde, 0xad) // trailing partial instruction
+
+	err := Disassemble(fakeDisass{data: data})
+	var perr *PartialDisassemblyError
+	if !errors.As(err, &perr) {
+		t.Fatalf("Disassemble() error = %v, want a *PartialDisassemblyError", err)
+	}
+	if perr.Addr != 0x1008 || perr.Offset != 8 || !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("Disassemble() error = %v, want it to stop at 0x1008 (offset 0x8) with io.ErrUnexpectedEOF", err)
+	}
+
+	// the instructions before the failure are still printed (and only once)
+	want := "\n" +
+		"_main:\n" +
+		"0x00001000:  1f 20 03 d5   nop\n" +
+		"0x00001004:  c0 03 5f d6   ret\n"
+	if got := buf.String(); got != want {
+		t.Errorf("Disassemble() =\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestDisassembleMemOnly(t *testing.T) {
+	var buf bytes.Buffer
+	stdout = &buf
+	defer func() { stdout = os.Stdout }()
+
+	data := make([]byte, 0, 28)
+	for _, raw := range []uint32{
+		0x90000008, // adrp x8, 0x1000
+		0xd2800020, // mov  x0, #1
+		0x91004108, // add  x8, x8, #0x10 (completes the adrp)
+		0xf9400100, // ldr  x0, [x8]
+		0x91004129, // add  x9, x9, #0x10 (not an adrp page)
+		0xb90007e1, // str  w1, [sp, #4]
+		0xd65f03c0, // ret
+	} {
+		data = binary.LittleEndian.AppendUint32(data, raw)
+	}
+	if err := Disassemble(fakeDisass{data: data, memOnly: true}); err != nil {
+		t.Fatalf("Disassemble() error = %v", err)
+	}
+
+	want := "\n" +
+		"_main:\n" +
+		"0x00001000:  08 00 00 90   adrp\tx8, 0x1000\n" +
+		"0x00001008:  ; loc_1008\n" +
+		"0x00001008:  08 41 00 91   add\tx8, x8, #0x10\n" +
+		"0x0000100c:  00 01 40 f9   ldr\tx0, [x8]\n" +
+		"0x00001014:  e1 07 00 b9   str\tw1, [sp, #0x4]\n"
+	if got := buf.String(); got != want {
+		t.Errorf("Disassemble() =\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestDisassembleRelative(t *testing.T) {
+	var buf bytes.Buffer
+	stdout = &buf
+	defer func() { stdout = os.Stdout }()
+
+	data := make([]byte, 0, 24)
+	for _, raw := range []uint32{
+		0xd503201f, // nop
+		0xb4000040, // cbz x0, 0x100c
+		0x94000002, // bl  0x1010 (_helper)
+		0xd65f03c0, // ret
+		0x14000001, // b   0x1014
+		0xd65f03c0, // ret
+	} {
+		data = binary.LittleEndian.AppendUint32(data, raw)
+	}
+	if err := Disassemble(fakeDisass{data: data, relative: true, funcs: map[uint64]string{0x1010: "_helper"}}); err != nil {
+		t.Fatalf("Disassemble() error = %v", err)
+	}
+
+	// branch targets in the same function are offsets too, the call into _helper isn't
+	want := "\n" +
+		"_main:\n" +
+		"+0x0:  1f 20 03 d5   nop\n" +
+		"+0x4:  40 00 00 b4   cbz\tx0, +0xc\n" +
+		"+0x8:  ; +0x8\n" +
+		"+0x8:  02 00 00 94   bl\t0x1010\n" +
+		"+0xc:  c0 03 5f d6   ret\n" +
+		"\n" +
+		"_helper:\n" +
+		"+0x0:  01 00 00 14   b\t+0x4\n" +
+		"+0x4:  c0 03 5f d6   ret\n"
+	if got := buf.String(); got != want {
+		t.Errorf("Disassemble() =\n%q\nwant\n%q", got, want)
+	}
+}
+
+// objcFakeDisass is a fakeDisass with Objective-C selrefs/classrefs and an _objc_msgSend stub at 0x1100
+type objcFakeDisass struct {
+	fakeDisass
+}
+
+func (d objcFakeDisass) FindSymbol(addr uint64) (string, bool) {
+	return "_objc_msgSend", addr == 0x1100
+}
+
+func (d objcFakeDisass) ObjCSelRef(addr uint64) (string, bool) {
+	return "init", addr == 0x2008
+}
+
+func (d objcFakeDisass) ObjCClassRef(addr uint64) (string, bool) {
+	return "NSObject", addr == 0x2010
+}
+
+func TestDisassembleObjCRegs(t *testing.T) {
+	var buf bytes.Buffer
+	stdout = &buf
+	defer func() { stdout = os.Stdout }()
+
+	data := make([]byte, 0, 64)
+	for _, raw := range []uint32{
+		0xb0000001, // 0x1000 adrp x1, 0x2000
+		0xf9400421, // 0x1004 ldr  x1, [x1, #0x8]  ; @selector(init)
+		0xb0000000, // 0x1008 adrp x0, 0x2000
+		0xf9400800, // 0x100c ldr  x0, [x0, #0x10] ; _OBJC_CLASS_$_NSObject
+		0x9400003c, // 0x1010 bl   _objc_msgSend
+		0xb0000001, // 0x1014 adrp x1, 0x2000
+		0xf9400421, // 0x1018 ldr  x1, [x1, #0x8]
+		0xf90007e1, // 0x101c str  x1, [sp, #0x8] (only reads x1)
+		0xb0000000, // 0x1020 adrp x0, 0x2000
+		0xf9400800, // 0x1024 ldr  x0, [x0, #0x10]
+		0x52800020, // 0x1028 mov  w0, #0x1 (overwrites the class in x0)
+		0x94000035, // 0x102c bl   _objc_msgSend
+		0xb0000001, // 0x1030 adrp x1, 0x2000
+		0xf9400421, // 0x1034 ldr  x1, [x1, #0x8]
+		0xaa0203e1, // 0x1038 mov  x1, x2 (overwrites the selector)
+		0x94000031, // 0x103c bl   _objc_msgSend
+	} {
+		data = binary.LittleEndian.AppendUint32(data, raw)
+	}
+	if err := Disassemble(objcFakeDisass{fakeDisass{data: data}}); err != nil {
+		t.Fatalf("Disassemble() error = %v", err)
+	}
+
+	calls := make(map[string]string)
+	for _, line := range strings.Split(buf.String(), "\n") {
+		if addr, rest, ok := strings.Cut(line, ":"); ok && strings.Contains(rest, "bl\t_objc_msgSend") {
+			_, comment, _ := strings.Cut(rest, ";")
+			calls[addr] = strings.TrimSpace(comment)
+		}
+	}
+	want := map[string]string{
+		"0x00001010": "+[NSObject init]",
+		"0x0000102c": "-[? init]",
+		"0x0000103c": "",
+	}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("objc_msgSend annotations = %q, want %q\n%s", calls, want, buf.String())
+	}
+}
+
+func TestProgress(t *testing.T) {
+	var buf bytes.Buffer
+	p := NewProgress(&buf)
+	p.interval = time.Hour // only Done draws
+
+	p.Discovered(3)
+	p.Processed(0x100)
+	p.Processed(0x100)
+	if buf.Len() != 0 {
+		t.Errorf("Progress drew %q before its interval", buf.String())
+	}
+	p.Done()
+
+	got := buf.String()
+	if want := "\r\033[Kfunctions 2/3 (66.7%) | 512 B covered | elapsed 0s | ETA "; !strings.HasPrefix(got, want) || !strings.HasSuffix(got, "\n") {
+		t.Errorf("Progress = %q, want %q...", got, want)
+	}
+
+	// every update is drawn without an interval
+	buf.Reset()
+	p = NewProgress(&buf)
+	p.interval = 0
+	p.Discovered(1)
+	p.Processed(4)
+	if got := strings.Count(buf.String(), "\r\033[K"); got != 2 {
+		t.Errorf("Progress drew %d lines, want 2: %q", got, buf.String())
+	}
+	if !strings.Contains(buf.String(), "functions 1/1 (100.0%) | 4 B covered") {
+		t.Errorf("Progress = %q, want 1/1 functions and 4 B", buf.String())
+	}
+}
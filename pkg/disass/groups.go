@@ -0,0 +1,104 @@
+package disass
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/blacktop/arm64-cgo/disassemble"
+)
+
+// InstructionGroup is a control-flow class of an instruction (the same classes capstone uses)
+type InstructionGroup string
+
+const (
+	GroupJump           InstructionGroup = "jump"
+	GroupCall           InstructionGroup = "call"
+	GroupRet            InstructionGroup = "ret"
+	GroupInt            InstructionGroup = "int"
+	GroupPrivilege      InstructionGroup = "privilege"
+	GroupBranchRelative InstructionGroup = "branch_relative"
+)
+
+// InstructionGroups returns the control-flow groups of inst (derived from its operation)
+func InstructionGroups(inst *disassemble.Instruction) []InstructionGroup {
+	var groups []InstructionGroup
+	switch inst.Operation {
+	case disassemble.ARM64_B,
+		disassemble.ARM64_B_AL, disassemble.ARM64_B_CC, disassemble.ARM64_B_CS, disassemble.ARM64_B_EQ,
+		disassemble.ARM64_B_GE, disassemble.ARM64_B_GT, disassemble.ARM64_B_HI, disassemble.ARM64_B_LE,
+		disassemble.ARM64_B_LS, disassemble.ARM64_B_LT, disassemble.ARM64_B_MI, disassemble.ARM64_B_NE,
+		disassemble.ARM64_B_NV, disassemble.ARM64_B_PL, disassemble.ARM64_B_VC, disassemble.ARM64_B_VS,
+		disassemble.ARM64_CBZ, disassemble.ARM64_CBNZ, disassemble.ARM64_TBZ, disassemble.ARM64_TBNZ:
+		groups = append(groups, GroupJump, GroupBranchRelative)
+	case disassemble.ARM64_BR, disassemble.ARM64_BRAA, disassemble.ARM64_BRAAZ, disassemble.ARM64_BRAB, disassemble.ARM64_BRABZ:
+		groups = append(groups, GroupJump)
+	case disassemble.ARM64_BL:
+		groups = append(groups, GroupCall, GroupBranchRelative)
+	case disassemble.ARM64_BLR, disassemble.ARM64_BLRAA, disassemble.ARM64_BLRAAZ, disassemble.ARM64_BLRAB, disassemble.ARM64_BLRABZ:
+		groups = append(groups, GroupCall)
+	case disassemble.ARM64_RET, disassemble.ARM64_RETAA, disassemble.ARM64_RETAB:
+		groups = append(groups, GroupRet)
+	case disassemble.ARM64_ERET, disassemble.ARM64_ERETAA, disassemble.ARM64_ERETAB:
+		groups = append(groups, GroupRet, GroupPrivilege)
+	case disassemble.ARM64_SVC, disassemble.ARM64_BRK, disassemble.ARM64_HLT:
+		groups = append(groups, GroupInt)
+	case disassemble.ARM64_HVC, disassemble.ARM64_SMC:
+		groups = append(groups, GroupInt, GroupPrivilege)
+	case disassemble.ARM64_MSR, disassemble.ARM64_SYS, disassemble.ARM64_SYSL,
+		disassemble.ARM64_DCPS1, disassemble.ARM64_DCPS2, disassemble.ARM64_DCPS3:
+		groups = append(groups, GroupPrivilege)
+	}
+	return groups
+}
+
+// GroupedInstruction is an instruction in the --json output annotated with its control-flow groups
+type GroupedInstruction struct {
+	disassemble.Instruction
+	Groups   []InstructionGroup
+	IsBranch bool // a jump (conditional or not)
+	IsCall   bool
+	IsRet    bool
+}
+
+// NewGroupedInstruction classifies inst
+func NewGroupedInstruction(inst disassemble.Instruction) GroupedInstruction {
+	gi := GroupedInstruction{Instruction: inst, Groups: InstructionGroups(&inst)}
+	for _, g := range gi.Groups {
+		switch g {
+		case GroupJump:
+			gi.IsBranch = true
+		case GroupCall:
+			gi.IsCall = true
+		case GroupRet:
+			gi.IsRet = true
+		}
+	}
+	return gi
+}
+
+// MarshalJSON appends the groups to the instruction's JSON (the embedded instruction's MarshalJSON would otherwise hide them)
+func (gi GroupedInstruction) MarshalJSON() ([]byte, error) {
+	inst, err := json.Marshal(&gi.Instruction)
+	if err != nil {
+		return nil, err
+	}
+	groups := gi.Groups
+	if groups == nil {
+		groups = []InstructionGroup{}
+	}
+	extra, err := json.Marshal(struct {
+		Groups   []InstructionGroup `json:"groups"`
+		IsBranch bool               `json:"is_branch"`
+		IsCall   bool               `json:"is_call"`
+		IsRet    bool               `json:"is_ret"`
+	}{groups, gi.IsBranch, gi.IsCall, gi.IsRet})
+	if err != nil {
+		return nil, err
+	}
+	// merge the two objects: {inst...,extra...}
+	inst = bytes.TrimSuffix(inst, []byte("}"))
+	if len(inst) > 1 {
+		inst = append(inst, ',')
+	}
+	return append(inst, extra[1:]...), nil
+}
@@ -0,0 +1,34 @@
+package disass
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/blacktop/arm64-cgo/disassemble"
+)
+
+func TestGroupedInstructionJSON(t *testing.T) {
+	var results [1024]byte
+	for _, tt := range []struct {
+		raw  uint32
+		want string
+	}{
+		{0x94000001, `"groups":["call","branch_relative"],"is_branch":false,"is_call":true,"is_ret":false`}, // bl #4
+		{0xd65f03c0, `"groups":["ret"],"is_branch":false,"is_call":false,"is_ret":true`},                    // ret
+		{0x54000040, `"groups":["jump","branch_relative"],"is_branch":true,"is_call":false,"is_ret":false`}, // b.eq #8
+		{0xd503201f, `"groups":[],"is_branch":false,"is_call":false,"is_ret":false`},                        // nop
+	} {
+		inst, err := disassemble.Decompose(0x1000, tt.raw, &results)
+		if err != nil {
+			t.Fatalf("Decompose(%#x) error = %v", tt.raw, err)
+		}
+		dat, err := json.Marshal(NewGroupedInstruction(*inst))
+		if err != nil {
+			t.Fatalf("Marshal(%s) error = %v", inst, err)
+		}
+		if !strings.HasPrefix(string(dat), `{"addr":4096,`) || !strings.HasSuffix(string(dat), ","+tt.want+"}") || !json.Valid(dat) {
+			t.Errorf("Marshal(%s) = %s, want the instruction followed by %s", inst, dat, tt.want)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package disass
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/blacktop/go-dwarf"
+)
+
+// lineRow is a row of a DWARF line program; it covers [addr, next row's addr)
+type lineRow struct {
+	addr uint64
+	file string
+	line int
+	end  bool
+}
+
+// LineTable maps instruction addresses to their source file:line using the DWARF line programs
+type LineTable struct {
+	rows []lineRow
+}
+
+// sourceLineResolver is implemented by disassemblers that can annotate instructions with their source file:line
+type sourceLineResolver interface {
+	SourceLine(uint64) (string, int, bool)
+}
+
+// NewLineTable builds a LineTable from the line programs of all the compile units in d;
+// it returns an error if d has no line info
+func NewLineTable(d *dwarf.Data) (*LineTable, error) {
+	if d == nil {
+		return nil, fmt.Errorf("no DWARF debug info")
+	}
+
+	var rows []lineRow
+
+	r := d.Reader()
+	for {
+		entry, err := r.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read DWARF compile unit: %v", err)
+		}
+		if entry == nil {
+			break
+		}
+		if entry.Tag != dwarf.TagCompileUnit {
+			r.SkipChildren()
+			continue
+		}
+		lr, err := d.LineReader(entry)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read DWARF line program: %v", err)
+		}
+		r.SkipChildren()
+		if lr == nil {
+			continue
+		}
+		var le dwarf.LineEntry
+		for {
+			if err := lr.Next(&le); err != nil {
+				if err == io.EOF {
+					break
+				}
+				return nil, fmt.Errorf("failed to read DWARF line entry: %v", err)
+			}
+			row := lineRow{addr: le.Address, line: le.Line, end: le.EndSequence}
+			if le.File != nil {
+				row.file = le.File.Name
+			}
+			rows = append(rows, row)
+		}
+	}
+
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("no DWARF line info")
+	}
+
+	// end_sequence rows sort before rows starting at the same address so those rows win the lookup
+	sort.SliceStable(rows, func(i, j int) bool {
+		if rows[i].addr == rows[j].addr {
+			return rows[i].end && !rows[j].end
+		}
+		return rows[i].addr < rows[j].addr
+	})
+
+	return &LineTable{rows: rows}, nil
+}
+
+// Lookup returns the source file:line of the instruction at addr
+func (t *LineTable) Lookup(addr uint64) (string, int, bool) {
+	if t == nil {
+		return "", 0, false
+	}
+	i := sort.Search(len(t.rows), func(i int) bool { return t.rows[i].addr > addr })
+	if i == 0 {
+		return "", 0, false
+	}
+	row := t.rows[i-1]
+	if row.end || row.line == 0 {
+		return "", 0, false
+	}
+	return row.file, row.line, true
+}
@@ -45,6 +45,21 @@ func (d MachoDisass) Color() bool {
 func (d MachoDisass) AsJSON() bool {
 	return d.cfg.AsJSON
 }
+func (d MachoDisass) Groups() bool {
+	return d.cfg.Groups
+}
+func (d MachoDisass) Simplify() bool {
+	return d.cfg.Simplify
+}
+func (d MachoDisass) MemOnly() bool {
+	return d.cfg.MemOnly
+}
+func (d MachoDisass) NoWrap() bool {
+	return d.cfg.NoWrap
+}
+func (d MachoDisass) Relative() bool {
+	return d.cfg.Relative
+}
 func (d MachoDisass) Data() []byte {
 	return d.cfg.Data
 }
@@ -54,6 +69,14 @@ func (d MachoDisass) StartAddr() uint64 {
 func (d MachoDisass) Middle() uint64 {
 	return d.cfg.Middle
 }
+
+// SourceLine returns the source file:line of the instruction at addr (if DWARF line info was loaded)
+func (d MachoDisass) SourceLine(addr uint64) (string, int, bool) {
+	if d.cfg.Lines == nil {
+		return "", 0, false
+	}
+	return d.cfg.Lines.Lookup(addr)
+}
 func (d MachoDisass) ReadAddr(addr uint64) (uint64, error) {
 	ptr, err := d.f.GetPointerAtAddress(addr)
 	if err != nil {
@@ -262,7 +285,7 @@ func (d MachoDisass) IsFunctionStart(addr uint64) (bool, string) {
 						symName, _ = swift.Demangle(symName)
 						return ok, symName
 					}
-					return ok, demangle.Do(symName, false, false)
+					return ok, demangle.CachedDo(symName, false, false)
 				}
 				return ok, symName
 			}
@@ -272,6 +295,15 @@ func (d MachoDisass) IsFunctionStart(addr uint64) (bool, string) {
 	return false, ""
 }
 
+// FunctionStarts returns the start addresses of the functions in the function table
+func (d MachoDisass) FunctionStarts() []uint64 {
+	var starts []uint64
+	for _, fn := range d.f.GetFunctions() {
+		starts = append(starts, fn.StartAddr)
+	}
+	return starts
+}
+
 // IsLocation returns if given address is a local branch location within the disassembled function
 func (d MachoDisass) IsLocation(imm uint64) bool {
 	if _, ok := d.tr.Locations[imm]; ok {
@@ -314,13 +346,16 @@ func (d MachoDisass) IsPointer(imm uint64) (bool, *AddrDetails) {
 
 // FindSymbol returns symbol from the addr2symbol map for a given virtual address
 func (d MachoDisass) FindSymbol(addr uint64) (string, bool) {
-	if symName, ok := d.a2s[addr]; ok {
-		if d.cfg.Demangle {
-			return demangle.Do(symName, false, false), true
+	symName, ok := d.a2s[addr]
+	if !ok {
+		if symName, ok = d.cfg.Symbols[addr]; !ok {
+			return "", false
 		}
-		return symName, true
 	}
-	return "", false
+	if d.cfg.Demangle {
+		return demangle.CachedDo(symName, false, false), true
+	}
+	return symName, true
 }
 
 // Contains returns true if Triage immediates contains a given address and will return the instruction address
@@ -333,6 +368,38 @@ func (d MachoDisass) Contains(address uint64) (bool, uint64) {
 	return false, 0
 }
 
+// ObjCSelRef returns the selector name for the given __objc_selrefs entry address
+func (d MachoDisass) ObjCSelRef(addr uint64) (string, bool) {
+	if sec := d.f.FindSectionForVMAddr(addr); sec == nil || sec.Name != "__objc_selrefs" {
+		return "", false
+	}
+	if name, ok := d.a2s[addr]; ok && strings.HasPrefix(name, "sel_") {
+		return strings.TrimPrefix(name, "sel_"), true
+	}
+	if ptr, err := d.ReadAddr(addr); err == nil {
+		if sel, err := d.f.GetCString(ptr); err == nil && len(sel) > 0 {
+			return sel, true
+		}
+	}
+	return "", false
+}
+
+// ObjCClassRef returns the class name for the given __objc_classrefs/__objc_superrefs entry address
+func (d MachoDisass) ObjCClassRef(addr uint64) (string, bool) {
+	if sec := d.f.FindSectionForVMAddr(addr); sec == nil || (sec.Name != "__objc_classrefs" && sec.Name != "__objc_superrefs") {
+		return "", false
+	}
+	if name, ok := d.a2s[addr]; ok && strings.HasPrefix(name, "class_") {
+		return strings.TrimPrefix(name, "class_"), true
+	}
+	if ptr, err := d.ReadAddr(addr); err == nil {
+		if name, ok := d.a2s[ptr]; ok {
+			return strings.TrimPrefix(name, "_OBJC_CLASS_$_"), true
+		}
+	}
+	return "", false
+}
+
 func (d MachoDisass) GetCString(addr uint64) (string, error) {
 	return d.f.GetCString(addr)
 }
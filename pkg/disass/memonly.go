@@ -0,0 +1,64 @@
+package disass
+
+import (
+	"strings"
+
+	"github.com/blacktop/arm64-cgo/disassemble"
+)
+
+// MemAccessFilter picks the instructions shown with --mem-only: the ones with a memory operand
+// (loads/stores, pc-relative literal loads) and the adr/adrp based address computations
+type MemAccessFilter struct {
+	pages map[disassemble.Register]bool // registers holding an adrp page
+}
+
+// NewMemAccessFilter returns a filter with no adrp pages tracked
+func NewMemAccessFilter() *MemAccessFilter {
+	return &MemAccessFilter{pages: make(map[disassemble.Register]bool)}
+}
+
+// Reset forgets the tracked adrp pages (i.e. at the start of a function or basic block)
+func (f *MemAccessFilter) Reset() {
+	clear(f.pages)
+}
+
+// Keep returns whether inst accesses memory or participates in an adrp address computation
+// (instructions must be fed in order so that the add/ldr completing an adrp are kept)
+func (f *MemAccessFilter) Keep(inst *disassemble.Instruction) bool {
+	keep := inst.Operation == disassemble.ARM64_ADRP ||
+		inst.Operation == disassemble.ARM64_ADR ||
+		strings.Contains(inst.Encoding.String(), "loadlit") ||
+		hasMemOperand(inst)
+
+	// add xD, xN, #pageoff completes an adrp xN
+	if inst.Operation == disassemble.ARM64_ADD && len(inst.Operands) > 1 && len(inst.Operands[1].Registers) > 0 &&
+		f.pages[inst.Operands[1].Registers[0]] {
+		keep = true
+	}
+
+	if len(inst.Operands) > 0 && inst.Operands[0].Class == disassemble.REG && len(inst.Operands[0].Registers) > 0 {
+		dst := inst.Operands[0].Registers[0]
+		switch {
+		case inst.Operation == disassemble.ARM64_ADRP:
+			f.pages[dst] = true
+		case !isStore(inst): // stores read their first register
+			delete(f.pages, dst)
+		}
+	}
+
+	return keep
+}
+
+func hasMemOperand(inst *disassemble.Instruction) bool {
+	for _, op := range inst.Operands {
+		switch op.Class {
+		case disassemble.MEM_REG, disassemble.MEM_PRE_IDX, disassemble.MEM_POST_IDX, disassemble.MEM_OFFSET, disassemble.MEM_EXTENDED:
+			return true
+		}
+	}
+	return false
+}
+
+func isStore(inst *disassemble.Instruction) bool {
+	return hasMemOperand(inst) && strings.HasPrefix(inst.Operation.String(), "st")
+}
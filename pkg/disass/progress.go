@@ -0,0 +1,79 @@
+package disass
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/dustin/go-humanize"
+)
+
+// Progress renders a single status line for long (whole binary) disassembly runs
+type Progress struct {
+	sync.Mutex
+
+	w        io.Writer
+	interval time.Duration
+
+	discovered int
+	processed  int
+	bytes      uint64
+	start      time.Time
+	last       time.Time
+}
+
+// NewProgress creates a Progress that redraws its status line on w at most every 200ms
+func NewProgress(w io.Writer) *Progress {
+	now := time.Now()
+	return &Progress{w: w, interval: 200 * time.Millisecond, start: now, last: now}
+}
+
+// Discovered adds n functions to the total to be disassembled
+func (p *Progress) Discovered(n int) {
+	p.Lock()
+	defer p.Unlock()
+	p.discovered += n
+	p.render(false)
+}
+
+// Processed marks a function of size bytes as disassembled
+func (p *Progress) Processed(size uint64) {
+	p.Lock()
+	defer p.Unlock()
+	p.processed++
+	p.bytes += size
+	p.render(false)
+}
+
+// Done draws the final status line
+func (p *Progress) Done() {
+	p.Lock()
+	defer p.Unlock()
+	p.render(true)
+	fmt.Fprintln(p.w)
+}
+
+func (p *Progress) render(force bool) {
+	now := time.Now()
+	if !force && now.Sub(p.last) < p.interval {
+		return
+	}
+	p.last = now
+
+	elapsed := now.Sub(p.start)
+	eta := "?"
+	if p.processed > 0 && p.discovered >= p.processed {
+		remaining := time.Duration(float64(elapsed) / float64(p.processed) * float64(p.discovered-p.processed))
+		eta = remaining.Round(time.Second).String()
+	}
+	var pct float64
+	if p.discovered > 0 {
+		pct = float64(p.processed) * 100 / float64(p.discovered)
+	}
+	fmt.Fprintf(p.w, "\r\033[Kfunctions %d/%d (%.1f%%) | %s covered | elapsed %s | ETA %s",
+		p.processed, p.discovered, pct,
+		humanize.Bytes(p.bytes),
+		elapsed.Round(time.Second),
+		eta)
+}
@@ -0,0 +1,58 @@
+package disass
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/blacktop/arm64-cgo/disassemble"
+)
+
+// relativeAddrs turns the addresses of the disassembled data into offsets from the start of their function
+// (the start of the data for the instructions before the first function) for --relative
+type relativeAddrs struct {
+	begin, end uint64
+	starts     []uint64 // function starts in [begin, end) sorted
+}
+
+func newRelativeAddrs(d Disass) *relativeAddrs {
+	r := &relativeAddrs{begin: d.StartAddr(), end: d.StartAddr() + uint64(len(d.Data()))}
+	for _, addr := range d.FunctionStarts() {
+		if addr >= r.begin && addr < r.end {
+			r.starts = append(r.starts, addr)
+		}
+	}
+	slices.Sort(r.starts)
+	r.starts = slices.Compact(r.starts)
+	return r
+}
+
+// funcStart returns the start of the function addr is in
+func (r *relativeAddrs) funcStart(addr uint64) uint64 {
+	i := sort.Search(len(r.starts), func(i int) bool { return r.starts[i] > addr })
+	if i == 0 {
+		return r.begin
+	}
+	return r.starts[i-1]
+}
+
+// offset returns addr as an offset from its function's start (i.e. "+0x10")
+func (r *relativeAddrs) offset(addr uint64) string {
+	return fmt.Sprintf("+%#x", addr-r.funcStart(addr))
+}
+
+// sameFunc reports whether target is in the (disassembled) function of the instruction at addr
+func (r *relativeAddrs) sameFunc(addr, target uint64) bool {
+	return target >= r.begin && target < r.end && r.funcStart(target) == r.funcStart(addr)
+}
+
+// labels replaces the absolute label operands of inst in instrStr that land in its function with their offsets
+func (r *relativeAddrs) labels(inst *disassemble.Instruction, instrStr string) string {
+	for _, op := range inst.Operands {
+		if op.Class == disassemble.LABEL && r.sameFunc(inst.Address, op.Immediate) {
+			instrStr = strings.Replace(instrStr, fmt.Sprintf("%#x", op.Immediate), r.offset(op.Immediate), 1)
+		}
+	}
+	return instrStr
+}
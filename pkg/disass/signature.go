@@ -0,0 +1,101 @@
+package disass
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	"github.com/blacktop/arm64-cgo/disassemble"
+	"github.com/blacktop/go-macho"
+	"github.com/blacktop/go-macho/types"
+)
+
+// sigOperandBits are the bits of the immediate/label field of each encoding class (matched on the suffix of the
+// encoding's name); these are the bits that change when the code is relocated or rebuilt
+var sigOperandBits = []struct {
+	suffix string
+	bits   uint32
+}{
+	{"_BRANCH_IMM", 0x03ffffff},    // b/bl imm26
+	{"_CONDBRANCH", 0x00ffffe0},    // b.cond imm19
+	{"_COMPBRANCH", 0x00ffffe0},    // cbz/cbnz imm19
+	{"_TESTBRANCH", 0x0007ffe0},    // tbz/tbnz imm14 (the bit number is kept)
+	{"_LOADLIT", 0x00ffffe0},       // ldr (literal) imm19
+	{"_PCRELADDR", 0x60ffffe0},     // adr/adrp immlo:immhi
+	{"_ADDSUB_IMM", 0x007ffc00},    // add/sub sh:imm12 (i.e. an adrp's page offset)
+	{"_MOVEWIDE", 0x001fffe0},      // movz/movk/movn imm16 (the shift is kept)
+	{"_LDST_POS", 0x003ffc00},      // ldr/str [xN, #imm12]
+	{"_LDST_IMMPRE", 0x001ff000},   // ldr/str [xN, #imm9]!
+	{"_LDST_IMMPOST", 0x001ff000},  // ldr/str [xN], #imm9
+	{"_LDST_UNSCALED", 0x001ff000}, // ldur/stur [xN, #imm9]
+	{"_LDSTPAIR_OFF", 0x003f8000},  // ldp/stp [xN, #imm7]
+	{"_LDSTPAIR_PRE", 0x003f8000},  // ldp/stp [xN, #imm7]!
+	{"_LDSTPAIR_POST", 0x003f8000}, // ldp/stp [xN], #imm7
+}
+
+// operandMask returns the mask of the bits of inst that must match: the bits of its immediate/label field are
+// cleared when the disassembler found an immediate, label or memory offset operand in it
+func operandMask(inst *disassemble.Instruction) uint32 {
+	var imm bool
+	for _, op := range inst.Operands {
+		switch op.Class {
+		case disassemble.IMM32, disassemble.IMM64, disassemble.LABEL,
+			disassemble.MEM_OFFSET, disassemble.MEM_PRE_IDX, disassemble.MEM_POST_IDX:
+			imm = true
+		}
+	}
+	if !imm {
+		return 0xffffffff
+	}
+	enc := strings.ToUpper(inst.Encoding.String())
+	for _, ob := range sigOperandBits {
+		if strings.HasSuffix(enc, ob.suffix) {
+			return ^ob.bits
+		}
+	}
+	return 0xffffffff
+}
+
+// Signature returns the byte signature of the instructions in data (disassembled at startAddr): pattern is the
+// instruction bytes (as in memory) and mask has the bits that must match set, so a location matches when
+// (b & mask) == pattern for each byte. The immediate and label operands the disassembler finds are masked out
+// (see operandMask) and words that don't decode are kept as is. Both are strings of space separated hex bytes.
+func Signature(data []byte, startAddr uint64) (pattern, mask string, err error) {
+	if len(data) == 0 || len(data)%4 != 0 {
+		return "", "", fmt.Errorf("data must be a non-empty multiple of 4 bytes (got %d)", len(data))
+	}
+
+	var results [1024]byte
+	pat := make([]byte, len(data))
+	msk := make([]byte, len(data))
+	for i := 0; i < len(data); i += 4 {
+		raw := binary.LittleEndian.Uint32(data[i:])
+		m := uint32(0xffffffff)
+		if inst, err := disassemble.Decompose(startAddr+uint64(i), raw, &results); err == nil {
+			m = operandMask(inst)
+		}
+		binary.LittleEndian.PutUint32(pat[i:], raw&m)
+		binary.LittleEndian.PutUint32(msk[i:], m)
+	}
+
+	return fmt.Sprintf("% x", pat), fmt.Sprintf("% x", msk), nil
+}
+
+// SignatureForRange returns the Signature of the n instructions at the virtual address start of m (an arm64 MachO)
+func SignatureForRange(m *macho.File, start uint64, n int) (pattern, mask string, err error) {
+	if m.CPU != types.CPUArm64 {
+		return "", "", fmt.Errorf("only arm64 MachOs are supported (got %s)", m.CPU)
+	}
+	if n <= 0 {
+		return "", "", fmt.Errorf("invalid instruction count %d", n)
+	}
+	off, err := m.GetOffset(start)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to get offset of %#x: %v", start, err)
+	}
+	data := make([]byte, n*4)
+	if _, err := m.ReadAt(data, int64(off)); err != nil {
+		return "", "", fmt.Errorf("failed to read %d instructions at %#x: %v", n, start, err)
+	}
+	return Signature(data, start)
+}
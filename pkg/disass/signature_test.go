@@ -0,0 +1,42 @@
+package disass
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/blacktop/go-macho"
+)
+
+func TestSignature(t *testing.T) {
+	insts := []uint32{
+		0xa9bf7bfd, // stp x29, x30, [sp, #-0x10]!
+		0x910003fd, // mov x29, sp
+		0x90000008, // adrp x8, #0x1000
+		0x91004108, // add x8, x8, #0x10
+		0xf9400100, // ldr x0, [x8] (a struct offset field too)
+		0x94000001, // bl #0x1014
+		0xd65f03c0, // ret
+	}
+	data := make([]byte, len(insts)*4)
+	for i, inst := range insts {
+		binary.LittleEndian.PutUint32(data[i*4:], inst)
+	}
+
+	pattern, mask, err := Signature(data, 0x1000)
+	if err != nil {
+		t.Fatalf("Signature() error = %v", err)
+	}
+	if want := "fd 7b 80 a9 fd 03 00 91 08 00 00 90 08 01 00 91 00 01 40 f9 00 00 00 94 c0 03 5f d6"; pattern != want {
+		t.Errorf("Signature() pattern = %s, want %s", pattern, want)
+	}
+	if want := "ff 7f c0 ff ff ff ff ff 1f 00 00 9f ff 03 80 ff ff 03 c0 ff 00 00 00 fc ff ff ff ff"; mask != want {
+		t.Errorf("Signature() mask = %s, want %s", mask, want)
+	}
+
+	if _, _, err := Signature(data[:6], 0x1000); err == nil {
+		t.Error("Signature() of a partial instruction should fail")
+	}
+	if _, _, err := SignatureForRange(&macho.File{}, 0x1000, 1); err == nil {
+		t.Error("SignatureForRange() of a non-arm64 MachO should fail")
+	}
+}
@@ -0,0 +1,99 @@
+package disass
+
+import (
+	"fmt"
+
+	"github.com/blacktop/arm64-cgo/disassemble"
+)
+
+// Simplifier rewrites common AArch64 idioms in a decoded instruction stream to their canonical
+// pseudo-instructions (i.e. `orr x0, xzr, #0xf` => `mov x0, #0xf`)
+type Simplifier struct {
+	// wide are the values built so far by mov/movk sequences (keyed by X register)
+	wide map[disassemble.Register]uint64
+	// adrp is the register written by the previous instruction if it was an adrp (REG_NONE otherwise)
+	adrp disassemble.Register
+}
+
+// NewSimplifier returns a Simplifier with no known register values
+func NewSimplifier() *Simplifier {
+	return &Simplifier{wide: make(map[disassemble.Register]uint64)}
+}
+
+// Reset forgets the known register values (i.e. at a function start or branch target, where
+// the values built by a previous mov/movk sequence may not reach)
+func (s *Simplifier) Reset() {
+	clear(s.wide)
+	s.adrp = disassemble.REG_NONE
+}
+
+// Simplify returns inst as its canonical pseudo-instruction if it is a recognized idiom:
+//
+//	orr  xN, xzr, #imm          => mov xN, #imm
+//	mov  xN, #lo; movk xN, #hi  => mov xN, #(hi<<shift|lo) (the value reconstructed so far)
+//	add  xN, xN, #0             => nop (unless it completes an adrp xN, as a page offset of 0)
+//
+// add wN, wN, #0 is left alone as it zeroes the upper half of xN.
+func (s *Simplifier) Simplify(inst *disassemble.Instruction) (string, bool) {
+	adrp := s.adrp
+	s.adrp = disassemble.REG_NONE
+	switch inst.Encoding {
+	case disassemble.ENC_ORR_32_LOG_IMM, disassemble.ENC_ORR_64_LOG_IMM:
+		if len(inst.Operands) == 3 && isZeroReg(inst.Operands[1]) {
+			rd := inst.Operands[0].Registers[0]
+			imm := truncImm(rd, inst.Operands[2].Immediate)
+			s.wide[xReg(rd)] = imm
+			return fmt.Sprintf("mov\t%s, #%#x", rd, imm), true
+		}
+	case disassemble.ENC_MOV_MOVZ_32_MOVEWIDE, disassemble.ENC_MOV_MOVZ_64_MOVEWIDE,
+		disassemble.ENC_MOV_MOVN_32_MOVEWIDE, disassemble.ENC_MOV_MOVN_64_MOVEWIDE:
+		// already printed as mov, but it starts a sequence the movks build on
+		rd := inst.Operands[0].Registers[0]
+		s.wide[xReg(rd)] = truncImm(rd, inst.Operands[1].Immediate)
+		return "", false
+	case disassemble.ENC_MOVK_32_MOVEWIDE, disassemble.ENC_MOVK_64_MOVEWIDE:
+		rd := inst.Operands[0].Registers[0]
+		val, ok := s.wide[xReg(rd)]
+		if !ok {
+			return "", false
+		}
+		shift := inst.Operands[1].ShiftValue
+		val = val&^(0xffff<<shift) | (inst.Operands[1].Immediate&0xffff)<<shift
+		val = truncImm(rd, val)
+		s.wide[xReg(rd)] = val
+		return fmt.Sprintf("mov\t%s, #%#x", rd, val), true
+	case disassemble.ENC_ADRP_ONLY_PCRELADDR:
+		s.adrp = inst.Operands[0].Registers[0]
+	case disassemble.ENC_ADD_64_ADDSUB_IMM, disassemble.ENC_MOV_ADD_64_ADDSUB_IMM:
+		if len(inst.Operands) >= 2 && inst.Operands[0].Registers[0] == inst.Operands[1].Registers[0] &&
+			inst.Operands[0].Registers[0] != adrp && (len(inst.Operands) == 2 || inst.Operands[2].Immediate == 0) {
+			return "nop", true
+		}
+	}
+	// any other write to a register ends the mov/movk sequence building it
+	if len(inst.Operands) > 0 && inst.Operands[0].Class == disassemble.REG && len(inst.Operands[0].Registers) > 0 {
+		delete(s.wide, xReg(inst.Operands[0].Registers[0]))
+	}
+	return "", false
+}
+
+func isZeroReg(op disassemble.Operand) bool {
+	return op.Class == disassemble.REG && len(op.Registers) > 0 &&
+		(op.Registers[0] == disassemble.REG_XZR || op.Registers[0] == disassemble.REG_WZR)
+}
+
+// xReg returns the X register for a W register (so w0 and x0 share a known value)
+func xReg(r disassemble.Register) disassemble.Register {
+	if r >= disassemble.REG_W0 && r <= disassemble.REG_WSP {
+		return r - disassemble.REG_W0 + disassemble.REG_X0
+	}
+	return r
+}
+
+// truncImm truncates imm to the width of register r
+func truncImm(r disassemble.Register, imm uint64) uint64 {
+	if r >= disassemble.REG_W0 && r <= disassemble.REG_WSP {
+		return imm & 0xffffffff
+	}
+	return imm
+}
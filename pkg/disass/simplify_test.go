@@ -0,0 +1,84 @@
+package disass
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"testing"
+
+	"github.com/blacktop/arm64-cgo/disassemble"
+	"github.com/blacktop/ipsw/internal/output"
+)
+
+func TestSimplifier(t *testing.T) {
+	var results [1024]byte
+	for _, tt := range []struct {
+		name   string
+		raws   []uint32
+		want   string // the pseudo-instruction for the last instruction ("" if not simplified)
+		reset  bool   // reset before the last instruction
+		wantOK bool
+	}{
+		{"orr xzr", []uint32{0xb2400fe0}, "mov\tx0, #0xf", false, true},                              // orr x0, xzr, #0xf
+		{"orr wzr", []uint32{0x32000be0}, "mov\tw0, #0x7", false, true},                              // orr w0, wzr, #0x7
+		{"movz/movk", []uint32{0xd28acf00, 0xf2a24680}, "mov\tx0, #0x12345678", false, true},         // mov x0, #0x5678; movk x0, #0x1234, lsl #16
+		{"movn/movk", []uint32{0x92800000, 0xf2a24680}, "mov\tx0, #0xffffffff1234ffff", false, true}, // mov x0, #-1; movk x0, #0x1234, lsl #16
+		{"movz/movk w", []uint32{0x52800020, 0x72a00040}, "mov\tw0, #0x20001", false, true},          // mov w0, #1; movk w0, #2, lsl #16
+		{"movk unknown", []uint32{0xf2a24680}, "", false, false},                                     // movk x0, #0x1234, lsl #16
+		{"movk clobbered", []uint32{0xd28acf00, 0xaa0103e0, 0xf2a24680}, "", false, false},           // mov x0, x1 in between
+		{"movk after reset", []uint32{0xd28acf00, 0xf2a24680}, "", true, false},                      // the sequence doesn't reach a branch target
+		{"add #0", []uint32{0x91000000}, "nop", false, true},                                         // add x0, x0, #0
+		{"add #0 lsl", []uint32{0x91400000}, "nop", false, true},                                     // add x0, x0, #0, lsl #12
+		{"mov sp", []uint32{0x910003ff}, "nop", false, true},                                         // mov sp, sp
+		{"mov x0 sp", []uint32{0x910003e0}, "", false, false},                                        // mov x0, sp
+		{"add x0 x1", []uint32{0x91000020}, "", false, false},                                        // add x0, x1, #0
+		{"add w #0", []uint32{0x11000000}, "", false, false},                                         // add w0, w0, #0 zeroes the upper half of x0
+		{"adrp add #0", []uint32{0x90000000, 0x91000000}, "", false, false},                          // adrp x0, page; add x0, x0, #0 (page offset)
+		{"adrp other add #0", []uint32{0x90000001, 0x91000000}, "nop", false, true},                  // adrp x1, page; add x0, x0, #0
+		{"adrp add #0 reset", []uint32{0x90000000, 0x91000000}, "nop", true, true},                   // the adrp doesn't reach a branch target
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewSimplifier()
+			var got string
+			var ok bool
+			for i, raw := range tt.raws {
+				inst, err := disassemble.Decompose(0x1000, raw, &results)
+				if err != nil {
+					t.Fatalf("Decompose(%#x) error = %v", raw, err)
+				}
+				if tt.reset && i == len(tt.raws)-1 {
+					s.Reset()
+				}
+				got, ok = s.Simplify(inst)
+			}
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("Simplify() = %q, %t, want %q, %t", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestDisassembleSimplify(t *testing.T) {
+	var buf bytes.Buffer
+	stdout = &buf
+	defer func() { stdout = os.Stdout }()
+	output.Configure(false, false)
+
+	data := make([]byte, 0, 12)
+	for _, raw := range []uint32{0xd28acf00, 0xf2a24680, 0xd65f03c0} { // mov x0, #0x5678; movk x0, #0x1234, lsl #16; ret
+		data = binary.LittleEndian.AppendUint32(data, raw)
+	}
+	if err := Disassemble(fakeDisass{data: data, simplify: true}); err != nil {
+		t.Fatalf("Disassemble() error = %v", err)
+	}
+
+	want := "\n" +
+		"_main:\n" +
+		"0x00001000:  00 cf 8a d2   mov\tx0, #0x5678\n" +
+		"0x00001004:  80 46 a2 f2   mov\tx0, #0x12345678\n" +
+		"0x00001008:  ; loc_1008\n" +
+		"0x00001008:  c0 03 5f d6   ret\n"
+	if got := buf.String(); got != want {
+		t.Errorf("Disassemble() =\n%q\nwant\n%q", got, want)
+	}
+}
@@ -0,0 +1,59 @@
+package disass
+
+import (
+	"github.com/blacktop/go-macho"
+	"github.com/blacktop/go-macho/types"
+)
+
+// SymbolIndex is an address to symbol index shared across multiple images (i.e. other kexts)
+// that is used to name branch targets that fall outside of the image being disassembled
+type SymbolIndex map[uint64]string
+
+// NewSymbolIndex creates an empty SymbolIndex
+func NewSymbolIndex() SymbolIndex {
+	return make(SymbolIndex)
+}
+
+// Add adds a symbol to the index (the first name added for an address wins)
+func (idx SymbolIndex) Add(addr uint64, name string) bool {
+	if addr == 0 || len(name) == 0 {
+		return false
+	}
+	if _, ok := idx[addr]; ok {
+		return false
+	}
+	idx[addr] = name
+	return true
+}
+
+// AddImage adds the symbols of m (and all of its fileset entries) to the index and returns the number added
+func (idx SymbolIndex) AddImage(m *macho.File) (int, error) {
+	count := 0
+
+	if m.FileTOC.FileHeader.Type == types.MH_FILESET {
+		for _, fe := range m.FileSets() {
+			mfe, err := m.GetFileSetFileByName(fe.EntryID)
+			if err != nil {
+				return count, err
+			}
+			n, err := idx.AddImage(mfe)
+			count += n
+			if err != nil {
+				return count, err
+			}
+		}
+	}
+
+	if m.Symtab != nil {
+		for _, sym := range m.Symtab.Syms {
+			if sym.Type.IsDebugSym() || sym.Sect == 0 { // skip stabs and undefined/imported symbols
+				continue
+			}
+			if idx.Add(sym.Value, sym.Name) {
+				count++
+			}
+		}
+	}
+
+	return count, nil
+}
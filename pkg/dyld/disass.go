@@ -37,6 +37,21 @@ func (d DyldDisass) Color() bool {
 func (d DyldDisass) AsJSON() bool {
 	return d.cfg.AsJSON
 }
+func (d DyldDisass) Groups() bool {
+	return d.cfg.Groups
+}
+func (d DyldDisass) Simplify() bool {
+	return d.cfg.Simplify
+}
+func (d DyldDisass) MemOnly() bool {
+	return d.cfg.MemOnly
+}
+func (d DyldDisass) NoWrap() bool {
+	return d.cfg.NoWrap
+}
+func (d DyldDisass) Relative() bool {
+	return d.cfg.Relative
+}
 func (d DyldDisass) Data() []byte {
 	return d.cfg.Data
 }
@@ -339,7 +354,7 @@ func (d DyldDisass) IsFunctionStart(addr uint64) (bool, string) {
 						symName, _ = swift.Demangle(symName)
 						return ok, symName
 					}
-					return ok, demangle.Do(symName, false, false)
+					return ok, demangle.CachedDo(symName, false, false)
 				}
 				return ok, symName
 			}
@@ -349,6 +364,23 @@ func (d DyldDisass) IsFunctionStart(addr uint64) (bool, string) {
 	return false, ""
 }
 
+// FunctionStarts returns the start addresses of the functions in the image's function table
+func (d DyldDisass) FunctionStarts() []uint64 {
+	image, err := d.f.Image(d.cfg.Image)
+	if err != nil {
+		return nil
+	}
+	m, err := image.GetMacho()
+	if err != nil {
+		return nil
+	}
+	var starts []uint64
+	for _, fn := range m.GetFunctions() {
+		starts = append(starts, fn.StartAddr)
+	}
+	return starts
+}
+
 // FindSymbol returns symbol from the addr2symbol map for a given virtual address
 func (d DyldDisass) FindSymbol(addr uint64) (string, bool) {
 	if symName, ok := d.f.AddressToSymbol[addr]; ok {
@@ -357,7 +389,7 @@ func (d DyldDisass) FindSymbol(addr uint64) (string, bool) {
 				symName, _ = swift.DemangleSimple(symName)
 				return symName, true
 			}
-			return demangle.Do(symName, false, false), true
+			return demangle.CachedDo(symName, false, false), true
 		}
 		return symName, true
 	}
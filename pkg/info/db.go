@@ -1,12 +1,20 @@
 package info
 
 import (
+	"bufio"
 	"bytes"
 	"compress/gzip"
 	_ "embed"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/apex/log"
 	"github.com/blacktop/ipsw/internal/utils"
@@ -41,17 +49,92 @@ type Device struct {
 
 type Devices map[string]Device
 
-func GetIpswDB() (*Devices, error) {
-	var db Devices
+// IpswDBPathEnv is the environment variable that overrides the embedded device DB with a JSON file
+const IpswDBPathEnv = "IPSW_DB_PATH"
+
+// ErrIpswDBUnavailable is returned when the device DB cannot be loaded
+var ErrIpswDBUnavailable = errors.New("ipsw device DB unavailable")
+
+type dbConfig struct {
+	path    string
+	offline bool
+}
+
+// DBOption is an option for GetIpswDB
+type DBOption func(*dbConfig)
+
+// WithDBPath loads the device DB from a JSON (or gzipped JSON) file instead of the embedded copy
+func WithDBPath(path string) DBOption {
+	return func(c *dbConfig) {
+		c.path = path
+	}
+}
+
+// WithOffline only uses the DB embedded in the binary (ignoring any override)
+func WithOffline() DBOption {
+	return func(c *dbConfig) {
+		c.offline = true
+	}
+}
+
+var (
+	ipswDBOnce sync.Once
+	ipswDB     *Devices
+	ipswDBErr  error
+)
+
+// GetIpswDB returns the device DB; by default it is loaded once from $IPSW_DB_PATH (if set)
+// or the data embedded in the binary and shared between callers. It never touches the network.
+func GetIpswDB(opts ...DBOption) (*Devices, error) {
+	var conf dbConfig
+	for _, opt := range opts {
+		opt(&conf)
+	}
+
+	if conf.offline {
+		return loadIpswDB(bytes.NewReader(ipswDbData), "embedded data")
+	}
+	if len(conf.path) > 0 {
+		return loadIpswDBFile(conf.path)
+	}
 
-	zr, err := gzip.NewReader(bytes.NewReader(ipswDbData))
+	ipswDBOnce.Do(func() {
+		if path := os.Getenv(IpswDBPathEnv); len(path) > 0 {
+			ipswDB, ipswDBErr = loadIpswDBFile(path)
+			return
+		}
+		ipswDB, ipswDBErr = loadIpswDB(bytes.NewReader(ipswDbData), "embedded data")
+	})
+
+	return ipswDB, ipswDBErr
+}
+
+func loadIpswDBFile(path string) (*Devices, error) {
+	f, err := os.Open(path)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("%w: %w", ErrIpswDBUnavailable, err)
+	}
+	defer f.Close()
+	return loadIpswDB(f, path)
+}
+
+func loadIpswDB(r io.Reader, src string) (*Devices, error) {
+	var db Devices
+
+	br := bufio.NewReader(r)
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %w", ErrIpswDBUnavailable, src, err)
+		}
+		defer zr.Close()
+		r = zr
+	} else {
+		r = br
 	}
-	defer zr.Close()
 
-	if err := json.NewDecoder(zr).Decode(&db); err != nil {
-		return nil, fmt.Errorf("failed unmarshaling ipsw_db data: %w", err)
+	if err := json.NewDecoder(r).Decode(&db); err != nil {
+		return nil, fmt.Errorf("%w: failed unmarshaling ipsw_db data from %s: %w", ErrIpswDBUnavailable, src, err)
 	}
 
 	return &db, nil
@@ -64,6 +147,21 @@ func (ds Devices) LookupDevice(prod string) (Device, error) {
 	return Device{}, fmt.Errorf("device %s not found", prod)
 }
 
+// CanonicalProductType returns prod with the DB's capitalization (i.e. "iphone14,5" -> "iPhone14,5");
+// unknown product types are returned as is
+func (ds Devices) CanonicalProductType(prod string) string {
+	prod = strings.TrimSpace(prod)
+	if _, ok := ds[prod]; ok {
+		return prod
+	}
+	for p := range ds {
+		if strings.EqualFold(p, prod) {
+			return p
+		}
+	}
+	return prod
+}
+
 func (ds Devices) GetProductForModel(model string) (string, error) {
 	for prod, dev := range ds {
 		for m := range dev.Boards {
@@ -85,13 +183,119 @@ func (ds Devices) GetDevicesForType(typ string) (*Devices, error) {
 	return &devs, nil
 }
 
+// GetDeviceForName returns the first (sorted) product type of GetDevicesForName
 func (ds Devices) GetDeviceForName(name string) (string, Device, error) {
+	prods, err := ds.GetDevicesForName(name)
+	if err != nil {
+		return "", Device{}, err
+	}
+	return prods[0], ds[prods[0]], nil
+}
+
+// GetNameForDevice returns the marketing name of a product type (i.e. "iPhone15,2" -> "iPhone 14 Pro");
+// it is the reverse of GetDeviceForName
+func (ds Devices) GetNameForDevice(prod string) (string, error) {
+	d, err := ds.LookupDevice(ds.CanonicalProductType(prod))
+	if err != nil {
+		return "", err
+	}
+	if name := d.marketingName(); len(name) > 0 {
+		return name, nil
+	}
+	return "", fmt.Errorf("device %s has no name", prod)
+}
+
+// GetDevicesForName returns the sorted product types for a marketing name (i.e. "iPhone SE (3rd generation)");
+// the curated aliases are tried first, then exact and finally normalized (see NormalizeDeviceName) name matches
+func (ds Devices) GetDevicesForName(name string) ([]string, error) {
+	key := NormalizeDeviceName(name)
+
+	var prods []string
+	for _, prod := range deviceNameAliases[key] {
+		if _, ok := ds[prod]; ok {
+			prods = append(prods, prod)
+		}
+	}
+	for _, match := range []func(Device) bool{
+		func(d Device) bool { return strings.EqualFold(d.marketingName(), name) },
+		func(d Device) bool { return NormalizeDeviceName(d.marketingName()) == key },
+		func(d Device) bool { return strings.EqualFold(d.Name, name) || strings.EqualFold(d.Description, name) },
+	} {
+		if len(prods) > 0 {
+			break
+		}
+		for prod, dev := range ds {
+			if match(dev) {
+				prods = append(prods, prod)
+			}
+		}
+	}
+	if len(prods) == 0 {
+		return nil, fmt.Errorf("device not found with name %s", name)
+	}
+	sortProducts(prods)
+	return prods, nil
+}
+
+// DevicesForChip returns the devices with a board using chip; chip can be the SoC platform (i.e. "T8120"),
+// the chip ID (i.e. "0x8120") or the CPU name (i.e. "A16 Bionic")
+func (ds Devices) DevicesForChip(chip string) (*Devices, error) {
+	devs := make(Devices)
 	for prod, dev := range ds {
-		if strings.EqualFold(dev.Name, name) || strings.EqualFold(dev.Description, name) {
-			return prod, dev, nil
+		for _, board := range dev.Boards {
+			if board.hasChip(chip) {
+				devs[prod] = dev
+				break
+			}
 		}
 	}
-	return "", Device{}, fmt.Errorf("device not found with name %s", name)
+	if len(devs) == 0 {
+		return nil, fmt.Errorf("no devices found with chip %s", chip)
+	}
+	return &devs, nil
+}
+
+// Chips returns the sorted SoC platforms (i.e. "T8120") of the device's boards
+func (d Device) Chips() []string {
+	var chips []string
+	for _, board := range d.Boards {
+		if len(board.Platform) > 0 && !slices.Contains(chips, strings.ToUpper(board.Platform)) {
+			chips = append(chips, strings.ToUpper(board.Platform))
+		}
+	}
+	sort.Strings(chips)
+	return chips
+}
+
+func (b Board) hasChip(chip string) bool {
+	chip = strings.TrimSpace(chip)
+	if len(chip) == 0 {
+		return false
+	}
+	if strings.EqualFold(b.Platform, chip) || strings.EqualFold(b.CPU, chip) {
+		return true
+	}
+	// only compare chip IDs for "0x8120" or "8120" (so CPU names like "A10" aren't parsed as hex)
+	if len(b.ChipID) == 0 || !(strings.HasPrefix(strings.ToLower(chip), "0x") || strings.Trim(chip, "0123456789") == "") {
+		return false
+	}
+	cpid, err := strconv.ParseUint(strings.TrimPrefix(strings.ToLower(b.ChipID), "0x"), 16, 64)
+	if err != nil {
+		return false
+	}
+	id, err := strconv.ParseUint(strings.TrimPrefix(strings.ToLower(chip), "0x"), 16, 64)
+	return err == nil && id == cpid
+}
+
+// sortProducts sorts product types in natural order (iPad13,8 before iPad13,10)
+func sortProducts(prods []string) {
+	sort.Slice(prods, func(i, j int) bool {
+		a, b := utils.DeconstructDevice(prods[i]), utils.DeconstructDevice(prods[j])
+		if len(a.Family) == 0 || len(b.Family) == 0 {
+			return prods[i] < prods[j]
+		}
+		return utils.Devices{a, b}.Less(0, 1)
+	})
 }
 
 func (ds Devices) GetDevicesForSDK(sdk string) (*Devices, error) {
@@ -0,0 +1,255 @@
+package info
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func resetIpswDB() {
+	ipswDBOnce = sync.Once{}
+	ipswDB = nil
+	ipswDBErr = nil
+}
+
+func TestGetIpswDBOverride(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ipsw_db.json")
+	if err := os.WriteFile(path, []byte(`{"iPhone99,1":{"name":"iPhone Test","boards":{"X99AP":{"cpuid":"0x9999"}}}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := GetIpswDB(WithDBPath(path))
+	if err != nil {
+		t.Fatalf("GetIpswDB(WithDBPath) error = %v", err)
+	}
+	if dev, err := db.LookupDevice("iPhone99,1"); err != nil || dev.Name != "iPhone Test" {
+		t.Errorf("LookupDevice() = %v, %v; want iPhone Test", dev, err)
+	}
+
+	resetIpswDB()
+	t.Cleanup(resetIpswDB)
+	t.Setenv(IpswDBPathEnv, path)
+	db, err = GetIpswDB()
+	if err != nil {
+		t.Fatalf("GetIpswDB() with %s error = %v", IpswDBPathEnv, err)
+	}
+	if len(*db) != 1 {
+		t.Errorf("GetIpswDB() with %s returned %d devices, want 1", IpswDBPathEnv, len(*db))
+	}
+
+	// offline ignores the override
+	db, err = GetIpswDB(WithOffline())
+	if err != nil {
+		t.Fatalf("GetIpswDB(WithOffline) error = %v", err)
+	}
+	if _, err := db.LookupDevice("iPhone99,1"); err == nil {
+		t.Error("GetIpswDB(WithOffline) should only use the embedded DB")
+	}
+}
+
+func TestGetIpswDBMissingOverride(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "missing.json")
+
+	if _, err := GetIpswDB(WithDBPath(missing)); !errors.Is(err, ErrIpswDBUnavailable) || !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("GetIpswDB(WithDBPath) error = %v, want ErrIpswDBUnavailable and os.ErrNotExist", err)
+	}
+
+	resetIpswDB()
+	t.Cleanup(resetIpswDB)
+	t.Setenv(IpswDBPathEnv, missing)
+	if _, err := GetIpswDB(); !errors.Is(err, ErrIpswDBUnavailable) {
+		t.Errorf("GetIpswDB() error = %v, want ErrIpswDBUnavailable", err)
+	}
+}
+
+func TestGetIpswDBConcurrentFirstLoad(t *testing.T) {
+	resetIpswDB()
+	t.Cleanup(resetIpswDB)
+	t.Setenv(IpswDBPathEnv, "")
+
+	const n = 16
+	dbs := make([]*Devices, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			db, err := GetIpswDB()
+			if err != nil {
+				t.Errorf("GetIpswDB() error = %v", err)
+			}
+			dbs[i] = db
+		}(i)
+	}
+	wg.Wait()
+
+	for i := 1; i < n; i++ {
+		if dbs[i] != dbs[0] {
+			t.Fatal("concurrent GetIpswDB() calls returned different DBs")
+		}
+	}
+	if len(*dbs[0]) == 0 {
+		t.Error("embedded DB is empty")
+	}
+}
+
+func TestGetDevicesForName(t *testing.T) {
+	db, err := GetIpswDB(WithOffline())
+	if err != nil {
+		t.Fatalf("GetIpswDB() error = %v", err)
+	}
+
+	// section titles from the wiki's Firmware/<family> pages
+	tests := map[string][]string{
+		// iPhone
+		"iPhone":                     {"iPhone1,1"},
+		"iPhone 4 (GSM)":             {"iPhone3,1"},
+		"iPhone 4":                   {"iPhone3,1", "iPhone3,2", "iPhone3,3"},
+		"iPhone 5s":                  {"iPhone6,1", "iPhone6,2"},
+		"iPhone SE":                  {"iPhone8,4"},
+		"iPhone SE (1st generation)": {"iPhone8,4"},
+		"iPhone SE (2nd generation)": {"iPhone12,8"},
+		"iPhone SE (3rd generation)": {"iPhone14,6"},
+		"iPhone 15 Pro Max":          {"iPhone16,2"},
+		// iPad
+		"iPad":                                  {"iPad1,1"},
+		"iPad (4th generation)":                 {"iPad3,4", "iPad3,5", "iPad3,6"},
+		"iPad (9th generation)":                 {"iPad12,1", "iPad12,2"},
+		"iPad (10th generation)":                {"iPad13,18", "iPad13,19"},
+		"iPad Air (1st generation)":             {"iPad4,1", "iPad4,2", "iPad4,3"},
+		"iPad Air 2":                            {"iPad5,3", "iPad5,4"},
+		"iPad Air (5th generation)":             {"iPad13,16", "iPad13,17"},
+		"iPad mini (1st generation)":            {"iPad2,5", "iPad2,6", "iPad2,7"},
+		"iPad mini 4":                           {"iPad5,1", "iPad5,2"},
+		"iPad mini (6th generation)":            {"iPad14,1", "iPad14,2"},
+		"iPad Pro (9.7-inch)":                   {"iPad6,3", "iPad6,4"},
+		"iPad Pro 9.7\"":                        {"iPad6,3", "iPad6,4"},
+		"iPad Pro (12.9-inch)":                  {"iPad6,7", "iPad6,8"},
+		"iPad Pro (12.9-inch) (1st generation)": {"iPad6,7", "iPad6,8"},
+		"iPad Pro (10.5-inch)":                  {"iPad7,3", "iPad7,4"},
+		"iPad Pro (11-inch) (1st generation)":   {"iPad8,1", "iPad8,2", "iPad8,3", "iPad8,4"},
+		"iPad Pro (11-inch) (4th generation)":   {"iPad14,3", "iPad14,4"},
+		"iPad Pro 11-inch (4th generation)":     {"iPad14,3", "iPad14,4"},
+		"iPad Pro (12.9-inch, 6th generation)":  {"iPad14,5", "iPad14,6"},
+		// iPod touch
+		"iPod touch (1st generation)": {"iPod1,1"},
+		"iPod touch (7th generation)": {"iPod9,1"},
+		// Apple TV
+		"Apple TV (2nd generation)":    {"AppleTV2,1"},
+		"Apple TV (3rd generation)":    {"AppleTV3,1", "AppleTV3,2"},
+		"Apple TV HD":                  {"AppleTV5,3"},
+		"Apple TV 4K (1st generation)": {"AppleTV6,2"},
+		"Apple TV 4K (3rd generation)": {"AppleTV14,1"},
+		// Apple Watch
+		"Apple Watch (1st generation)":          {"Watch1,1", "Watch1,2"},
+		"Apple Watch Series 3":                  {"Watch3,1", "Watch3,2", "Watch3,3", "Watch3,4"},
+		"Apple Watch Series 8":                  {"Watch6,14", "Watch6,15", "Watch6,16", "Watch6,17"},
+		"Apple Watch Series 8 (GPS + Cellular)": {"Watch6,16", "Watch6,17"},
+		"Apple Watch SE (2nd generation)":       {"Watch6,10", "Watch6,11", "Watch6,12", "Watch6,13"},
+		"Apple Watch Ultra 2":                   {"Watch7,5"},
+		// HomePod
+		"HomePod (1st generation)": {"AudioAccessory1,1", "AudioAccessory1,2"},
+		"HomePod mini":             {"AudioAccessory5,1"},
+	}
+	for name, want := range tests {
+		got, err := db.GetDevicesForName(name)
+		if err != nil {
+			t.Errorf("GetDevicesForName(%q) error = %v", name, err)
+			continue
+		}
+		if strings.Join(got, " ") != strings.Join(want, " ") {
+			t.Errorf("GetDevicesForName(%q) = %v, want %v", name, got, want)
+		}
+	}
+
+	if prod, _, err := db.GetDeviceForName("iPhone SE (3rd generation)"); err != nil || prod != "iPhone14,6" {
+		t.Errorf("GetDeviceForName() = %s, %v", prod, err)
+	}
+	if _, err := db.GetDevicesForName("iPhone 99"); err == nil {
+		t.Error("expected error for an unknown device name")
+	}
+}
+
+func TestGetNameForDevice(t *testing.T) {
+	db, err := GetIpswDB(WithOffline())
+	if err != nil {
+		t.Fatalf("GetIpswDB() error = %v", err)
+	}
+
+	for prod, want := range map[string]string{
+		"iPhone15,2": "iPhone 14 Pro",
+		"iphone15,3": "iPhone 14 Pro Max",
+		"iPad14,5":   "iPad Pro (12.9-inch) (6th generation)",
+	} {
+		if got, err := db.GetNameForDevice(prod); err != nil || got != want {
+			t.Errorf("GetNameForDevice(%q) = %q, %v; want %q", prod, got, err, want)
+		}
+		// round trip
+		if got, _ := db.GetNameForDevice(prod); len(got) > 0 {
+			if prods, err := db.GetDevicesForName(got); err != nil || !slices.Contains(prods, db.CanonicalProductType(prod)) {
+				t.Errorf("GetDevicesForName(%q) = %v, %v; want it to include %s", got, prods, err, prod)
+			}
+		}
+	}
+	if _, err := db.GetNameForDevice("iPhone99,1"); err == nil {
+		t.Error("expected error for an unknown product type")
+	}
+}
+
+func TestDevicesForChip(t *testing.T) {
+	db, err := GetIpswDB(WithOffline())
+	if err != nil {
+		t.Fatalf("GetIpswDB() error = %v", err)
+	}
+
+	tests := map[string]string{
+		"iPhone15,2":     "T8120",
+		"MacBookAir10,1": "T8103",
+		"iPad13,8":       "T8103",
+		"iPhone14,5":     "T8110",
+	}
+	for prod, chip := range tests {
+		if got := (*db)[prod].Chips(); len(got) != 1 || got[0] != chip {
+			t.Errorf("%s.Chips() = %v, want [%s]", prod, got, chip)
+		}
+		for _, query := range []string{chip, strings.ToLower(chip), "0x" + chip[1:]} {
+			devs, err := db.DevicesForChip(query)
+			if err != nil {
+				t.Fatalf("DevicesForChip(%s) error = %v", query, err)
+			}
+			if _, ok := (*devs)[prod]; !ok {
+				t.Errorf("DevicesForChip(%s) is missing %s", query, prod)
+			}
+		}
+	}
+
+	devs, err := db.DevicesForChip("M1")
+	if err != nil {
+		t.Fatalf("DevicesForChip(M1) error = %v", err)
+	}
+	if _, ok := (*devs)["iPhone15,2"]; ok {
+		t.Error("DevicesForChip(M1) contains iPhone15,2")
+	}
+	if _, err := db.DevicesForChip("T9999"); err == nil {
+		t.Error("expected error for an unknown chip")
+	}
+}
+
+func TestNormalizeDeviceName(t *testing.T) {
+	for name, want := range map[string]string{
+		"iPad Pro (11-inch) (4th generation)":   "ipad pro 11-inch gen4",
+		"iPad Pro 11 inch (fourth generation)":  "ipad pro 11-inch gen4",
+		"iPad Pro 12.9\" (2nd gen)":             "ipad pro 12.9-inch gen2",
+		"Apple Watch Series 8 (GPS + Cellular)": "apple watch series 8",
+		"Apple Watch Series 3 (GPS) 38mm":       "apple watch series 3",
+		"iPhone 4 (GSM)":                        "iphone 4 gsm",
+	} {
+		if got := NormalizeDeviceName(name); got != want {
+			t.Errorf("NormalizeDeviceName(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package info
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	deviceNameDashRE  = regexp.MustCompile(`[‐‑‒–—]`)
+	deviceNameInchRE  = regexp.MustCompile(`(\d+(?:\.\d+)?)\s*(?:-\s*|\s)?(?:inch(?:es)?\b|in\.|"|”|″)`)
+	deviceNameGenRE   = regexp.MustCompile(`\b(\d+)(?:st|nd|rd|th)\s+gen(?:eration)?\b`)
+	deviceNameWordRE  = regexp.MustCompile(`\b(first|second|third|fourth|fifth|sixth|seventh|eighth|ninth|tenth)\s+gen(?:eration)?\b`)
+	deviceNameConnRE  = regexp.MustCompile(`\((?:gps|wi-?fi|cellular)(?:\s*\+\s*(?:cellular|lte))?\)`)
+	deviceNameMMRE    = regexp.MustCompile(`\b\d+\s*mm\b`)
+	deviceNamePunctRE = regexp.MustCompile(`[(),/]+`)
+)
+
+var deviceNameOrdinals = map[string]string{
+	"first": "1", "second": "2", "third": "3", "fourth": "4", "fifth": "5",
+	"sixth": "6", "seventh": "7", "eighth": "8", "ninth": "9", "tenth": "10",
+}
+
+// deviceNameAliases maps normalized names that the DB names/descriptions can't resolve (or resolve
+// ambiguously) to their product types
+var deviceNameAliases = map[string][]string{
+	"iphone se":               {"iPhone8,4"},
+	"iphone 4":                {"iPhone3,1", "iPhone3,2", "iPhone3,3"},
+	"ipad gen1":               {"iPad1,1"},
+	"ipad gen2":               {"iPad2,1", "iPad2,2", "iPad2,3", "iPad2,4"},
+	"ipad gen4":               {"iPad3,4", "iPad3,5", "iPad3,6"},
+	"ipad air gen1":           {"iPad4,1", "iPad4,2", "iPad4,3"},
+	"ipad air gen2":           {"iPad5,3", "iPad5,4"},
+	"ipad mini":               {"iPad2,5", "iPad2,6", "iPad2,7"},
+	"ipad mini gen1":          {"iPad2,5", "iPad2,6", "iPad2,7"},
+	"ipad mini gen2":          {"iPad4,4", "iPad4,5", "iPad4,6"},
+	"ipad mini gen3":          {"iPad4,7", "iPad4,8", "iPad4,9"},
+	"ipad mini gen4":          {"iPad5,1", "iPad5,2"},
+	"ipad pro 11-inch gen1":   {"iPad8,1", "iPad8,2", "iPad8,3", "iPad8,4"},
+	"ipad pro 12.9-inch gen1": {"iPad6,7", "iPad6,8"},
+	"ipod touch gen1":         {"iPod1,1"},
+	"apple tv gen2":           {"AppleTV2,1"},
+	"apple tv gen3":           {"AppleTV3,1", "AppleTV3,2"},
+	"apple tv gen4":           {"AppleTV5,3"},
+	"apple tv hd":             {"AppleTV5,3"},
+	"apple tv 4k gen1":        {"AppleTV6,2"},
+	"homepod gen1":            {"AudioAccessory1,1", "AudioAccessory1,2"},
+	"apple watch se gen1":     {"Watch5,9", "Watch5,10", "Watch5,11", "Watch5,12"},
+	"apple watch se gen2":     {"Watch6,10", "Watch6,11", "Watch6,12", "Watch6,13"},
+}
+
+// NormalizeDeviceName reduces an Apple marketing name to a canonical lookup key: sizes become "<n>-inch",
+// ordinal generations become "gen<n>" and connectivity/case size suffixes are dropped
+// (i.e. "iPad Pro (11-inch) (4th generation)" and "iPad Pro 11 inch (4th gen)" are both "ipad pro 11-inch gen4")
+func NormalizeDeviceName(name string) string {
+	s := strings.ToLower(strings.TrimSpace(name))
+	s = deviceNameDashRE.ReplaceAllString(s, "-")
+	s = deviceNameInchRE.ReplaceAllString(s, "$1-inch")
+	s = deviceNameGenRE.ReplaceAllString(s, "gen$1")
+	s = deviceNameWordRE.ReplaceAllStringFunc(s, func(m string) string {
+		word, _, _ := strings.Cut(m, " ")
+		return "gen" + deviceNameOrdinals[word]
+	})
+	s = deviceNameConnRE.ReplaceAllString(s, " ")
+	s = deviceNameMMRE.ReplaceAllString(s, " ")
+	s = deviceNamePunctRE.ReplaceAllString(s, " ")
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// marketingName is the most specific name the DB has for a device (the description when it refines the name)
+func (d Device) marketingName() string {
+	if len(d.Description) > 0 && (len(d.Name) == 0 || strings.HasPrefix(d.Description, d.Name)) {
+		return d.Description
+	}
+	return d.Name
+}
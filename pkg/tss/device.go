@@ -0,0 +1,163 @@
+package tss
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/blacktop/ipsw/pkg/usb/lockdownd"
+)
+
+// DeviceInfo is everything a personalization (TSS) request needs to know about a connected device
+type DeviceInfo struct {
+	UDID           string `json:"udid"`
+	ProductType    string `json:"product_type"`    // i.e. iPhone15,2
+	HardwareModel  string `json:"hardware_model"`  // i.e. D73AP
+	ProductVersion string `json:"product_version"` // i.e. 17.0
+	BuildVersion   string `json:"build_version"`   // i.e. 21A329
+	BoardID        uint64 `json:"board_id"`        // ApBoardID
+	ChipID         uint64 `json:"chip_id"`         // ApChipID
+	ECID           uint64 `json:"ecid"`            // ApECID
+	// ApNonce is the hex-encoded nonce from the image mounter (it changes after every personalization)
+	ApNonce string `json:"ap_nonce"`
+	// Identifiers are the image mounter's raw personalization identifiers (i.e. ApSecurityDomain)
+	Identifiers map[string]any `json:"personalization_identifiers,omitempty"`
+	// CachedAt is when the static fields (everything but ApNonce) were queried from the device
+	CachedAt time.Time `json:"cached_at"`
+}
+
+// LockdownClient is the lockdownd query DeviceInfo needs (a *lockdownd.Client)
+type LockdownClient interface {
+	GetValues() (*lockdownd.DeviceValues, error)
+}
+
+// ImageMounter is the mobile_image_mounter queries DeviceInfo needs (a *mount.Client)
+type ImageMounter interface {
+	Nonce(imageType string) (string, error)
+	PersonalizationIdentifiers(imageType string) (map[string]any, error)
+}
+
+// DeviceInfoConfig is the config for GetDeviceInfo
+type DeviceInfoConfig struct {
+	UDID string
+	// Lockdown connects to lockdownd (only called when the static fields aren't cached)
+	Lockdown func() (LockdownClient, error)
+	Mounter  ImageMounter
+	// CacheDir caches the static fields per UDID ("" disables caching)
+	CacheDir string
+	// Refresh re-queries the static fields (i.e. after a software update)
+	Refresh bool
+}
+
+// GetDeviceInfo returns the DeviceInfo for the device; only the nonce is queried if its static fields are cached
+func GetDeviceInfo(conf *DeviceInfoConfig) (*DeviceInfo, error) {
+	var cachePath string
+	if len(conf.CacheDir) > 0 {
+		cachePath = filepath.Join(conf.CacheDir, conf.UDID+".json")
+	}
+
+	var di *DeviceInfo
+	if len(cachePath) > 0 && !conf.Refresh {
+		if dat, err := os.ReadFile(cachePath); err == nil {
+			var cached DeviceInfo
+			if err := json.Unmarshal(dat, &cached); err == nil && cached.UDID == conf.UDID {
+				di = &cached
+			}
+		}
+	}
+
+	if di == nil {
+		var err error
+		if di, err = queryDeviceInfo(conf); err != nil {
+			return nil, err
+		}
+		if len(cachePath) > 0 {
+			if err := writeDeviceInfoCache(cachePath, di); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	nonce, err := conf.Mounter.Nonce("DeveloperDiskImage")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get nonce: %w", err)
+	}
+	di.ApNonce = nonce
+
+	return di, nil
+}
+
+// queryDeviceInfo queries the static fields from lockdownd and the image mounter
+func queryDeviceInfo(conf *DeviceInfoConfig) (*DeviceInfo, error) {
+	cli, err := conf.Lockdown()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to lockdownd: %w", err)
+	}
+	values, err := cli.GetValues()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get device values: %w", err)
+	}
+	ids, err := conf.Mounter.PersonalizationIdentifiers("")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get personalization identifiers: %w", err)
+	}
+
+	di := &DeviceInfo{
+		UDID:           conf.UDID,
+		ProductType:    values.ProductType,
+		HardwareModel:  values.HardwareModel,
+		ProductVersion: values.ProductVersion,
+		BuildVersion:   values.BuildVersion,
+		BoardID:        uint64(values.BoardID),
+		ChipID:         uint64(values.ChipID),
+		ECID:           uint64(values.UniqueChipID),
+		Identifiers:    ids,
+		CachedAt:       time.Now().UTC(),
+	}
+	// the image mounter's identifiers are authoritative (lockdownd omits them on some devices)
+	if v, ok := identifierUint(ids, "BoardId"); ok {
+		di.BoardID = v
+	}
+	if v, ok := identifierUint(ids, "ChipID"); ok {
+		di.ChipID = v
+	}
+	if v, ok := identifierUint(ids, "UniqueChipID"); ok {
+		di.ECID = v
+	}
+	return di, nil
+}
+
+func writeDeviceInfoCache(path string, di *DeviceInfo) error {
+	static := *di
+	static.ApNonce = ""
+	dat, err := json.MarshalIndent(static, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal device info: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		return fmt.Errorf("failed to create device info cache folder: %w", err)
+	}
+	if err := os.WriteFile(path, dat, 0660); err != nil {
+		return fmt.Errorf("failed to write device info cache: %w", err)
+	}
+	return nil
+}
+
+// identifierUint returns the integer personalization identifier key (plist integers decode as various int types)
+func identifierUint(ids map[string]any, key string) (uint64, bool) {
+	switch v := ids[key].(type) {
+	case uint64:
+		return v, true
+	case int64:
+		return uint64(v), true
+	case int:
+		return uint64(v), true
+	case uint32:
+		return uint64(v), true
+	case float64: // from a JSON cache
+		return uint64(v), true
+	}
+	return 0, false
+}
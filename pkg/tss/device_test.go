@@ -0,0 +1,85 @@
+package tss
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/blacktop/ipsw/pkg/usb/lockdownd"
+)
+
+type mockLockdown struct {
+	calls int
+}
+
+func (m *mockLockdown) GetValues() (*lockdownd.DeviceValues, error) {
+	m.calls++
+	return &lockdownd.DeviceValues{
+		ProductType:    "iPhone15,2",
+		HardwareModel:  "D73AP",
+		ProductVersion: "17.0",
+		BuildVersion:   "21A329",
+		BoardID:        12,
+		ChipID:         33040,
+		UniqueChipID:   1234567890,
+	}, nil
+}
+
+type mockMounter struct {
+	nonce string
+	err   error
+}
+
+func (m *mockMounter) Nonce(imageType string) (string, error) { return m.nonce, m.err }
+
+func (m *mockMounter) PersonalizationIdentifiers(imageType string) (map[string]any, error) {
+	return map[string]any{"BoardId": uint64(12), "ChipID": uint64(33040), "UniqueChipID": uint64(9876543210), "ApSecurityDomain": uint64(1)}, nil
+}
+
+func TestGetDeviceInfo(t *testing.T) {
+	ld := &mockLockdown{}
+	mounter := &mockMounter{nonce: "aabb"}
+	conf := &DeviceInfoConfig{
+		UDID:     "00008120-001A2B3C4D5E6F70",
+		Lockdown: func() (LockdownClient, error) { return ld, nil },
+		Mounter:  mounter,
+		CacheDir: t.TempDir(),
+	}
+
+	di, err := GetDeviceInfo(conf)
+	if err != nil {
+		t.Fatalf("GetDeviceInfo() error = %v", err)
+	}
+	if di.ProductType != "iPhone15,2" || di.HardwareModel != "D73AP" || di.BuildVersion != "21A329" || di.ApNonce != "aabb" {
+		t.Errorf("GetDeviceInfo() = %+v", di)
+	}
+	if di.BoardID != 12 || di.ChipID != 33040 || di.ECID != 9876543210 { // the image mounter's ECID wins
+		t.Errorf("GetDeviceInfo() ids = %d/%d/%d", di.BoardID, di.ChipID, di.ECID)
+	}
+
+	// the cache has no nonce and the next poll only queries the nonce
+	dat, err := os.ReadFile(filepath.Join(conf.CacheDir, conf.UDID+".json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cached DeviceInfo
+	if err := json.Unmarshal(dat, &cached); err != nil || len(cached.ApNonce) > 0 {
+		t.Errorf("cached device info = %s (%v)", dat, err)
+	}
+	mounter.nonce = "ccdd"
+	if di, err = GetDeviceInfo(conf); err != nil || di.ApNonce != "ccdd" || di.ECID != 9876543210 || ld.calls != 1 {
+		t.Errorf("GetDeviceInfo(cached) = %+v, %v with %d lockdownd queries", di, err, ld.calls)
+	}
+
+	conf.Refresh = true
+	if _, err = GetDeviceInfo(conf); err != nil || ld.calls != 2 {
+		t.Errorf("GetDeviceInfo(refresh) = %v with %d lockdownd queries, want 2", err, ld.calls)
+	}
+
+	mounter.err = errors.New("device locked")
+	if _, err := GetDeviceInfo(conf); err == nil {
+		t.Error("expected error when the nonce can't be queried")
+	}
+}
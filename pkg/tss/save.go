@@ -0,0 +1,273 @@
+package tss
+
+import (
+	"context"
+	"encoding/asn1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/apex/log"
+	"github.com/blacktop/go-plist"
+	"github.com/blacktop/ipsw/internal/download"
+	"github.com/blacktop/ipsw/internal/remotezip"
+	info "github.com/blacktop/ipsw/pkg/plist"
+	"github.com/google/uuid"
+)
+
+// ErrNotSigned is returned by SaveBlob when Apple no longer signs the build for the device
+var ErrNotSigned = errors.New("build is not signed for this device")
+
+// ipswURL returns the IPSW URL of a device's build (a var so tests can serve their own IPSW)
+var ipswURL = func(device, build string, dl *download.DownloadConfig) (string, error) {
+	ipsw, err := download.GetIPSWWithConfig(device, build, dl)
+	if err != nil {
+		return "", err
+	}
+	return ipsw.URL, nil
+}
+
+// SaveConfig is the config for SaveBlob
+type SaveConfig struct {
+	Device *DeviceInfo // ECID, board/chip and product type (Device.ApNonce is NOT used)
+	// ApNonce is the device's boot nonce (lockdownd's ApNonce) which the ticket is bound to; it is NOT the image
+	// mounter's personalization nonce (DeviceInfo.ApNonce) which only personalizes DeveloperDiskImages
+	ApNonce  []byte
+	SepNonce []byte                   // the device's SEPNonce (random if empty)
+	Build    string                   // build to save a ticket for (defaults to the device's current build)
+	Manifest *info.BuildManifest      // BuildManifest of Build (fetched from its IPSW if nil)
+	Download *download.DownloadConfig // network settings (proxy, CA bundle, timeout...)
+	URL      string                   // TSS endpoint (defaults to Apple's)
+	Output   string                   // folder to write the blob to
+}
+
+// SaveBlob requests an ApImg4Ticket for the device's build bound to its current ApNonce and writes the TSS
+// response to <Output>/<ECID>_<product type>_<build>_<apnonce>.shsh2, returning its path.
+// NOTE: the blob has no generator; it can only be used while the device boots with the same nonce
+// (setting the nonce from a generator needs nvram access that a stock device doesn't give)
+func SaveBlob(ctx context.Context, conf *SaveConfig) (string, error) {
+	if conf.Device == nil || conf.Device.ECID == 0 {
+		return "", fmt.Errorf("the device's ECID is required to save a blob")
+	}
+	if len(conf.ApNonce) == 0 {
+		return "", fmt.Errorf("the device's ApNonce is required to save a blob")
+	}
+	build := conf.Build
+	if len(build) == 0 {
+		build = conf.Device.BuildVersion
+	}
+
+	client, err := conf.Download.NewClient()
+	if err != nil {
+		return "", err
+	}
+
+	bm := conf.Manifest
+	if bm == nil {
+		u, err := ipswURL(conf.Device.ProductType, build, conf.Download)
+		if err != nil {
+			return "", fmt.Errorf("failed to find the %s IPSW for %s: %w", build, conf.Device.ProductType, err)
+		}
+		c := *client
+		c.Transport = &contextTransport{ctx: ctx, next: client.Transport}
+		zr, err := remotezip.NewReader(u, &c)
+		if err != nil {
+			return "", fmt.Errorf("failed to open remote IPSW: %w", err)
+		}
+		plists, err := info.ParseZipFiles(zr.File)
+		if err != nil {
+			return "", fmt.Errorf("failed to parse remote IPSW plists: %w", err)
+		}
+		if plists.BuildManifest == nil {
+			return "", fmt.Errorf("no BuildManifest.plist in %s", u)
+		}
+		bm = plists.BuildManifest
+	}
+
+	buildID, pearl, manifest, err := buildIdentityFor(bm, conf.Device.BoardID, conf.Device.ChipID)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", build, err)
+	}
+
+	sepNonce := conf.SepNonce
+	if len(sepNonce) == 0 {
+		if sepNonce, err = randomHex(20); err != nil {
+			return "", err
+		}
+	}
+	tssReq, err := withComponents(&Request{
+		UUID:                      uuid.New().String(),
+		ApImg4Ticket:              true,
+		HostPlatformInfo:          "mac",
+		Locality:                  "en_US",
+		VersionInfo:               tssClientVersion,
+		ApBoardID:                 conf.Device.BoardID,
+		ApChipID:                  conf.Device.ChipID,
+		ApECID:                    conf.Device.ECID,
+		ApNonce:                   conf.ApNonce,
+		ApProductionMode:          true,
+		ApSecurityDomain:          1,
+		ApSecurityMode:            true,
+		ApSupportsImg4:            true,
+		SepNonce:                  sepNonce,
+		UniqueBuildID:             buildID,
+		PearlCertificationRootPub: pearl,
+	}, manifest)
+	if err != nil {
+		return "", err
+	}
+	tr, err := sendRequest(ctx, client, conf.URL, tssReq)
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case tr.Status == 0 && tr.Message == "SUCCESS":
+	case tr.Status == tssStatusNotEligible:
+		return "", fmt.Errorf("%s for %s: %w", build, conf.Device.ProductType, ErrNotSigned)
+	default:
+		return "", fmt.Errorf("unexpected TSS response: %d %s", tr.Status, tr.Message)
+	}
+
+	if err := os.MkdirAll(conf.Output, 0750); err != nil {
+		return "", fmt.Errorf("failed to create output folder: %w", err)
+	}
+	fname := filepath.Join(conf.Output, fmt.Sprintf("%d_%s_%s_%s.shsh2", conf.Device.ECID, conf.Device.ProductType, build, hex.EncodeToString(conf.ApNonce)))
+	if err := os.WriteFile(fname, []byte(tr.Plist), 0660); err != nil {
+		return "", fmt.Errorf("failed to write blob: %w", err)
+	}
+	log.Debugf("Saved %s blob to %s", build, fname)
+
+	return fname, nil
+}
+
+// buildIdentityFor returns the UniqueBuildID, PearlCertificationRootPub and components of the manifest's build
+// identity for the board/chip (preferring the Erase identity)
+func buildIdentityFor(bm *info.BuildManifest, boardID, chipID uint64) ([]byte, []byte, map[string]info.IdentityManifest, error) {
+	var buildID, pearl []byte
+	var manifest map[string]info.IdentityManifest
+	for _, bi := range bm.BuildIdentities {
+		board, err := strconv.ParseUint(bi.ApBoardID, 0, 64)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("invalid ApBoardID '%s': %v", bi.ApBoardID, err)
+		}
+		chip, err := strconv.ParseUint(bi.ApChipID, 0, 64)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("invalid ApChipID '%s': %v", bi.ApChipID, err)
+		}
+		if board != boardID || chip != chipID {
+			continue
+		}
+		buildID, pearl, manifest = bi.UniqueBuildID, bi.PearlCertificationRootPub, bi.Manifest
+		if strings.EqualFold(bi.Info.RestoreBehavior, "Erase") {
+			break
+		}
+	}
+	if len(buildID) == 0 {
+		return nil, nil, nil, fmt.Errorf("no build identity for board %#x chip %#x in the BuildManifest", boardID, chipID)
+	}
+	return buildID, pearl, manifest, nil
+}
+
+// withComponents returns the request as a dict with the build identity's personalized components (iBSS, iBEC,
+// KernelCache...) added so the ticket covers the images the device boots
+func withComponents(tssReq *Request, manifest map[string]info.IdentityManifest) (map[string]any, error) {
+	dat, err := plist.Marshal(tssReq, plist.XMLFormat)
+	if err != nil {
+		return nil, err
+	}
+	req := make(map[string]any)
+	if _, err := plist.Unmarshal(dat, &req); err != nil {
+		return nil, err
+	}
+	parameters := map[string]any{
+		"ApProductionMode": tssReq.ApProductionMode,
+		"ApSecurityMode":   tssReq.ApSecurityMode,
+		"ApSupportsImg4":   tssReq.ApSupportsImg4,
+	}
+	for name, comp := range manifest {
+		if personalize, _ := comp.Info["Personalize"].(bool); !personalize || name == "BasebandFirmware" {
+			continue // not in the ApImg4Ticket (the baseband has its own BBTicket)
+		}
+		digest := comp.Digest
+		if digest == nil {
+			digest = []byte{} // the TSS server wants a Digest even if it is empty
+		}
+		entry := map[string]any{
+			"Digest":  digest,
+			"Trusted": comp.Trusted,
+		}
+		if rules, ok := comp.Info["RestoreRequestRules"].([]any); ok {
+			for k, v := range restoreRequestActions(rules, parameters) {
+				entry[k] = v
+			}
+		}
+		req[name] = entry
+	}
+	return req, nil
+}
+
+// restoreRequestActions returns the actions (EPRO, ESEC) of the component's RestoreRequestRules whose conditions
+// are all met by the request parameters
+func restoreRequestActions(rules []any, parameters map[string]any) map[string]any {
+	actions := make(map[string]any)
+	for _, r := range rules {
+		rule, ok := r.(map[string]any)
+		if !ok {
+			continue
+		}
+		satisfied := true
+		if conds, ok := rule["Conditions"].(map[string]any); ok {
+			for k, v := range conds {
+				switch k {
+				case "ApRawProductionMode", "ApCurrentProductionMode":
+					satisfied = satisfied && parameters["ApProductionMode"] == v
+				case "ApRawSecurityMode":
+					satisfied = satisfied && parameters["ApSecurityMode"] == v
+				case "ApRequiresImage4":
+					satisfied = satisfied && parameters["ApSupportsImg4"] == v
+				default: // i.e. ApInRomDFU and ApDemotionPolicyOverride which a booted device doesn't set
+					satisfied = satisfied && parameters[k] == v
+				}
+			}
+		}
+		if !satisfied {
+			continue
+		}
+		if acts, ok := rule["Actions"].(map[string]any); ok {
+			for k, v := range acts {
+				actions[k] = v
+			}
+		}
+	}
+	return actions
+}
+
+// VerifyBlob re-parses a blob written by SaveBlob and checks that its ApImg4Ticket is an IM4M
+func VerifyBlob(path string) (*Blob, error) {
+	dat, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var blob Blob
+	if _, err := plist.Unmarshal(dat, &blob); err != nil {
+		return nil, fmt.Errorf("failed to parse blob %s: %w", path, err)
+	}
+	if len(blob.ApImg4Ticket) == 0 {
+		return nil, fmt.Errorf("blob %s has no ApImg4Ticket", path)
+	}
+	var im4m struct { // the manifest body, signature and certificate chain that follow are ignored
+		Name    string `asn1:"ia5"`
+		Version int
+	}
+	if _, err := asn1.Unmarshal(blob.ApImg4Ticket, &im4m); err != nil {
+		return nil, fmt.Errorf("failed to ASN.1 parse the ApImg4Ticket of %s: %w", path, err)
+	}
+	if im4m.Name != "IM4M" {
+		return nil, fmt.Errorf("the ApImg4Ticket of %s is a '%s' (expected an IM4M)", path, im4m.Name)
+	}
+	return &blob, nil
+}
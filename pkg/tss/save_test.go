@@ -0,0 +1,145 @@
+package tss
+
+import (
+	"bytes"
+	"context"
+	"encoding/asn1"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/blacktop/go-plist"
+	"github.com/blacktop/ipsw/internal/download"
+)
+
+func TestSaveBlob(t *testing.T) {
+	ticket, err := asn1.Marshal(struct {
+		Name    string `asn1:"ia5"`
+		Version int
+		Body    []byte
+	}{"IM4M", 0, []byte{1, 2, 3}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ipsws := map[string][]byte{
+		"/21A329.ipsw": signingTestIPSW(t, "21A329", "AQID"), // 01 02 03
+		"/20A362.ipsw": signingTestIPSW(t, "20A362", "BAUG"), // 04 05 06
+	}
+
+	var requests []Request
+	var components []map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/TSS/controller" {
+			body, _ := io.ReadAll(r.Body)
+			var req Request
+			if _, err := plist.Unmarshal(body, &req); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			requests = append(requests, req)
+			var dict map[string]any
+			if _, err := plist.Unmarshal(body, &dict); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			components = append(components, dict)
+			if bytes.Equal(req.UniqueBuildID, []byte{1, 2, 3}) {
+				fmt.Fprintf(w, "STATUS=0&MESSAGE=SUCCESS&REQUEST_STRING=<plist><dict><key>ApImg4Ticket</key><data>%s</data></dict></plist>", base64.StdEncoding.EncodeToString(ticket))
+			} else {
+				fmt.Fprint(w, "STATUS=94&MESSAGE=This device isn't eligible for the requested build.")
+			}
+			return
+		}
+		data, ok := ipsws[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("ETag", `"`+r.URL.Path+`"`)
+		http.ServeContent(w, r, r.URL.Path, time.Time{}, bytes.NewReader(data))
+	}))
+	defer srv.Close()
+
+	dl := &download.DownloadConfig{Timeout: time.Minute}
+	defer func(f func(string, string, *download.DownloadConfig) (string, error)) { ipswURL = f }(ipswURL)
+	ipswURL = func(device, build string, conf *download.DownloadConfig) (string, error) {
+		if device != "iPhone15,2" {
+			return "", fmt.Errorf("unexpected device %s", device)
+		}
+		if conf != dl {
+			return "", fmt.Errorf("the IPSW lookup must use the blob's download config")
+		}
+		return srv.URL + "/" + build + ".ipsw", nil
+	}
+
+	conf := &SaveConfig{
+		Device:   &DeviceInfo{ProductType: "iPhone15,2", BuildVersion: "21A329", BoardID: 0x0C, ChipID: 0x8120, ECID: 9876543210, ApNonce: "ffff"},
+		ApNonce:  []byte{0xaa, 0xbb},
+		Download: dl,
+		URL:      srv.URL + "/TSS/controller",
+		Output:   t.TempDir(),
+	}
+	fname, err := SaveBlob(context.Background(), conf)
+	if err != nil {
+		t.Fatalf("SaveBlob() error = %v", err)
+	}
+	if want := filepath.Join(conf.Output, "9876543210_iPhone15,2_21A329_aabb.shsh2"); fname != want {
+		t.Errorf("SaveBlob() = %s, want %s", fname, want)
+	}
+	if len(requests) != 1 {
+		t.Fatalf("TSS requests = %d, want 1", len(requests))
+	}
+	if req := requests[0]; req.ApECID != 9876543210 || !bytes.Equal(req.ApNonce, []byte{0xaa, 0xbb}) || len(req.SepNonce) != 20 {
+		t.Errorf("TSS request = %+v (the boot nonce, not the personalization nonce, must be sent)", req)
+	}
+	for name, want := range map[string]map[string]any{
+		"iBSS":        {"Digest": []byte{0xaa, 0xaa}, "Trusted": true, "EPRO": true}, // not ESEC (its rule is for DFU)
+		"KernelCache": {"Digest": []byte{0xbb, 0xbb}, "Trusted": true},
+	} {
+		if got, _ := components[0][name].(map[string]any); !reflect.DeepEqual(got, want) {
+			t.Errorf("TSS request %s = %#v, want %#v", name, got, want)
+		}
+	}
+	for _, name := range []string{"BasebandFirmware", "OS"} { // the baseband has its own ticket and the OS isn't personalized
+		if _, ok := components[0][name]; ok {
+			t.Errorf("TSS request has %s, want only personalized AP components", name)
+		}
+	}
+
+	blob, err := VerifyBlob(fname)
+	if err != nil {
+		t.Fatalf("VerifyBlob() error = %v", err)
+	}
+	if !bytes.Equal(blob.ApImg4Ticket, ticket) {
+		t.Errorf("ApImg4Ticket = %x, want %x", blob.ApImg4Ticket, ticket)
+	}
+
+	// an unsigned build
+	conf.Build = "20A362"
+	if _, err := SaveBlob(context.Background(), conf); !errors.Is(err, ErrNotSigned) {
+		t.Errorf("SaveBlob(unsigned) error = %v, want ErrNotSigned", err)
+	}
+	// a device without an identity in the manifest
+	conf.Build = ""
+	conf.Device.BoardID = 0x0E
+	if _, err := SaveBlob(context.Background(), conf); err == nil {
+		t.Error("SaveBlob(unknown board) expected error")
+	}
+
+	// a blob whose ticket isn't an IM4M
+	bad := filepath.Join(conf.Output, "bad.shsh2")
+	if err := os.WriteFile(bad, []byte("<plist><dict><key>ApImg4Ticket</key><data>AQID</data></dict></plist>"), 0660); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := VerifyBlob(bad); err == nil {
+		t.Error("VerifyBlob(bad) expected error")
+	}
+}
@@ -0,0 +1,263 @@
+package tss
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/blacktop/go-plist"
+	"github.com/blacktop/ipsw/internal/download"
+	"github.com/blacktop/ipsw/internal/remotezip"
+	ipswdb "github.com/blacktop/ipsw/pkg/info"
+	info "github.com/blacktop/ipsw/pkg/plist"
+	"github.com/google/uuid"
+)
+
+const (
+	// DefaultSigningConcurrency is the number of firmwares CheckSigning checks at a time
+	DefaultSigningConcurrency = 4
+	// tssStatusNotEligible is the TSS status for a build that is no longer signed for the device
+	tssStatusNotEligible = 94
+)
+
+// SigningConfig is the config for CheckSigning
+type SigningConfig struct {
+	Download    *download.DownloadConfig // network settings (proxy, CA bundle...)
+	Concurrency int                      // firmwares checked at a time (0 means DefaultSigningConcurrency)
+	Timeout     time.Duration            // for the whole pass (0 means only ctx applies)
+	URL         string                   // TSS endpoint (defaults to Apple's)
+}
+
+// CheckSigning sets the Signed field of each firmware in fws to whether Apple's TSS server still signs its build
+// for its first device. A minimal ApImg4Ticket request (random ECID/nonces) is made with the build identity from
+// the firmware's BuildManifest. Signed is left nil for firmwares that could not be checked (no device, no manifest,
+// an unexpected TSS response or the timeout); those errors are logged, only a canceled ctx is returned.
+func CheckSigning(ctx context.Context, fws []download.WikiFirmware, conf *SigningConfig) error {
+	if conf == nil {
+		conf = &SigningConfig{}
+	}
+	if conf.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, conf.Timeout)
+		defer cancel()
+	}
+	concurrency := conf.Concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultSigningConcurrency
+	}
+
+	client, err := conf.Download.NewClient()
+	if err != nil {
+		return err
+	}
+	db, err := ipswdb.GetIpswDB()
+	if err != nil {
+		return err
+	}
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, concurrency)
+	for i := range fws {
+		if len(fws[i].Devices) == 0 || len(fws[i].URL) == 0 {
+			continue
+		}
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func(fw *download.WikiFirmware) {
+			defer func() { <-sem; wg.Done() }()
+			signed, err := checkSigned(ctx, client, db, fw, conf.URL)
+			if err != nil {
+				log.WithError(err).Debugf("failed to check if %s %s is signed for %s", fw.Version, fw.Build, fw.Devices[0])
+				return
+			}
+			fw.Signed = &signed
+		}(&fws[i])
+	}
+	wg.Wait()
+
+	if errors.Is(ctx.Err(), context.Canceled) {
+		return ctx.Err()
+	}
+	if ctx.Err() != nil {
+		log.Warn("timed out checking the signing status of some firmwares")
+	}
+	return nil
+}
+
+// checkSigned asks the TSS server for a ticket for fw's build on its first device
+func checkSigned(ctx context.Context, client *http.Client, db *ipswdb.Devices, fw *download.WikiFirmware, tssURL string) (bool, error) {
+	device := db.CanonicalProductType(fw.Devices[0])
+
+	// the remote zip reader doesn't take a context
+	c := *client
+	c.Transport = &contextTransport{ctx: ctx, next: client.Transport}
+	zr, err := remotezip.NewReader(fw.URL, &c)
+	if err != nil {
+		return false, fmt.Errorf("failed to open remote firmware: %w", err)
+	}
+	plists, err := info.ParseZipFiles(zr.File)
+	if err != nil {
+		return false, fmt.Errorf("failed to parse remote firmware plists: %w", err)
+	}
+	if plists.BuildManifest == nil {
+		return false, fmt.Errorf("no BuildManifest.plist in %s", fw.URL)
+	}
+
+	dev, err := db.LookupDevice(device)
+	if err != nil {
+		return false, err
+	}
+	var boardID, chipID uint64
+	var buildID []byte
+	for _, bi := range plists.BuildManifest.BuildIdentities {
+		if _, ok := dev.Boards[strings.ToUpper(bi.Info.DeviceClass)]; !ok {
+			continue
+		}
+		if boardID, err = strconv.ParseUint(bi.ApBoardID, 0, 64); err != nil {
+			return false, fmt.Errorf("invalid ApBoardID '%s': %v", bi.ApBoardID, err)
+		}
+		if chipID, err = strconv.ParseUint(bi.ApChipID, 0, 64); err != nil {
+			return false, fmt.Errorf("invalid ApChipID '%s': %v", bi.ApChipID, err)
+		}
+		buildID = bi.UniqueBuildID
+		if strings.EqualFold(bi.Info.RestoreBehavior, "Erase") {
+			break
+		}
+	}
+	if len(buildID) == 0 {
+		return false, fmt.Errorf("no build identity for %s in the BuildManifest of %s", device, fw.Build)
+	}
+
+	apNonce, err := randomHex(32)
+	if err != nil {
+		return false, err
+	}
+	sepNonce, err := randomHex(20)
+	if err != nil {
+		return false, err
+	}
+	ecid, err := randomHex(8)
+	if err != nil {
+		return false, err
+	}
+	tr, err := sendRequest(ctx, client, tssURL, &Request{
+		UUID:             uuid.New().String(),
+		ApImg4Ticket:     true,
+		HostPlatformInfo: "mac",
+		Locality:         "en_US",
+		VersionInfo:      tssClientVersion,
+		ApBoardID:        boardID,
+		ApChipID:         chipID,
+		ApECID:           binary.LittleEndian.Uint64(ecid) & 0xffffffffffff, // ECIDs are 48-bit
+		ApNonce:          apNonce,
+		ApProductionMode: true,
+		ApSecurityDomain: 1,
+		ApSecurityMode:   true,
+		ApSupportsImg4:   true,
+		SepNonce:         sepNonce,
+		UniqueBuildID:    buildID,
+	})
+	if err != nil {
+		return false, err
+	}
+	switch {
+	case tr.Status == 0 && tr.Message == "SUCCESS":
+		return true, nil
+	case tr.Status == tssStatusNotEligible:
+		return false, nil
+	default:
+		return false, fmt.Errorf("unexpected TSS response: %d %s", tr.Status, tr.Message)
+	}
+}
+
+// sendRequest posts tssReq to the TSS server at url (Apple's if empty) and parses its response
+func sendRequest(ctx context.Context, client *http.Client, url string, tssReq any) (*Response, error) {
+	if len(url) == 0 {
+		url = tssControllerActionURL
+	}
+	trdata, err := plist.Marshal(tssReq, plist.XMLFormat)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewBuffer(trdata))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create https request: %v", err)
+	}
+	req.Header.Set("Cache-Control", "no-cache")
+	req.Header.Set("Content-type", "text/xml; charset=\"utf-8\"")
+	req.Header.Add("User-Agent", "InetURL/1.0")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("failed to connect to URL: got status %s", resp.Status)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %v", err)
+	}
+
+	var tr Response
+	for _, field := range strings.Split(string(body), "&") {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok {
+			log.Error("failed to parse response field")
+			continue
+		}
+		switch key {
+		case "STATUS":
+			sInt, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, err
+			}
+			tr.Status = sInt
+		case "MESSAGE":
+			tr.Message = value
+		case "REQUEST_STRING":
+			tr.Plist = value
+		}
+	}
+
+	log.WithFields(log.Fields{
+		"status":      tr.Status,
+		"message":     tr.Message,
+		"request_len": len(tr.Plist),
+	}).Debug("TSS Response")
+
+	return &tr, nil
+}
+
+// contextTransport attaches ctx to requests made by clients that don't take one
+type contextTransport struct {
+	ctx  context.Context
+	next http.RoundTripper
+}
+
+func (t *contextTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	next := t.next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return next.RoundTrip(req.WithContext(t.ctx))
+}
@@ -0,0 +1,221 @@
+package tss
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/blacktop/go-plist"
+	"github.com/blacktop/ipsw/internal/download"
+)
+
+// signingTestManifest is a BuildManifest with a D73AP (iPhone15,2) identity whose UniqueBuildID is buildID
+const signingTestManifest = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>BuildIdentities</key>
+	<array>
+		<dict>
+			<key>ApBoardID</key>
+			<string>0x0C</string>
+			<key>ApChipID</key>
+			<string>0x8120</string>
+			<key>Info</key>
+			<dict>
+				<key>DeviceClass</key>
+				<string>d73ap</string>
+				<key>RestoreBehavior</key>
+				<string>Erase</string>
+			</dict>
+			<key>Manifest</key>
+			<dict>
+				<key>iBSS</key>
+				<dict>
+					<key>Digest</key>
+					<data>qqo=</data>
+					<key>Info</key>
+					<dict>
+						<key>Path</key>
+						<string>Firmware/dfu/iBSS.d73.RELEASE.im4p</string>
+						<key>Personalize</key>
+						<true/>
+						<key>RestoreRequestRules</key>
+						<array>
+							<dict>
+								<key>Actions</key>
+								<dict>
+									<key>EPRO</key>
+									<true/>
+								</dict>
+								<key>Conditions</key>
+								<dict>
+									<key>ApRawProductionMode</key>
+									<true/>
+									<key>ApRequiresImage4</key>
+									<true/>
+								</dict>
+							</dict>
+							<dict>
+								<key>Actions</key>
+								<dict>
+									<key>ESEC</key>
+									<true/>
+								</dict>
+								<key>Conditions</key>
+								<dict>
+									<key>ApInRomDFU</key>
+									<true/>
+								</dict>
+							</dict>
+						</array>
+					</dict>
+					<key>Trusted</key>
+					<true/>
+				</dict>
+				<key>KernelCache</key>
+				<dict>
+					<key>Digest</key>
+					<data>u7s=</data>
+					<key>Info</key>
+					<dict>
+						<key>Path</key>
+						<string>kernelcache.release.iphone15</string>
+						<key>Personalize</key>
+						<true/>
+					</dict>
+					<key>Trusted</key>
+					<true/>
+				</dict>
+				<key>BasebandFirmware</key>
+				<dict>
+					<key>Info</key>
+					<dict>
+						<key>Path</key>
+						<string>Firmware/Mav21-1.00.00.Release.bbfw</string>
+						<key>Personalize</key>
+						<true/>
+					</dict>
+				</dict>
+				<key>OS</key>
+				<dict>
+					<key>Digest</key>
+					<data>zMw=</data>
+					<key>Info</key>
+					<dict>
+						<key>Path</key>
+						<string>090-00000-000.dmg</string>
+					</dict>
+				</dict>
+			</dict>
+			<key>UniqueBuildID</key>
+			<data>%s</data>
+		</dict>
+	</array>
+	<key>ProductBuildVersion</key>
+	<string>%s</string>
+</dict>
+</plist>`
+
+func signingTestIPSW(t *testing.T, build, buildID string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, err := zw.Create("BuildManifest.plist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Fprintf(w, signingTestManifest, buildID, build)
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestCheckSigning(t *testing.T) {
+	ipsws := map[string][]byte{
+		"/signed.ipsw":   signingTestIPSW(t, "21A329", "AQID"), // 01 02 03
+		"/unsigned.ipsw": signingTestIPSW(t, "20A362", "BAUG"), // 04 05 06
+	}
+
+	var mu sync.Mutex
+	var requests []Request
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/TSS/controller" {
+			body, _ := io.ReadAll(r.Body)
+			var req Request
+			if _, err := plist.Unmarshal(body, &req); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			mu.Lock()
+			requests = append(requests, req)
+			mu.Unlock()
+			switch {
+			case req.ApBoardID != 0x0C || req.ApChipID != 0x8120:
+				fmt.Fprint(w, "STATUS=100&MESSAGE=An internal error occurred.")
+			case bytes.Equal(req.UniqueBuildID, []byte{1, 2, 3}):
+				fmt.Fprint(w, "STATUS=0&MESSAGE=SUCCESS&REQUEST_STRING=<plist><dict></dict></plist>")
+			default:
+				fmt.Fprint(w, "STATUS=94&MESSAGE=This device isn't eligible for the requested build.")
+			}
+			return
+		}
+		data, ok := ipsws[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("ETag", `"`+r.URL.Path+`"`) // remote zips need a validator for range requests
+		http.ServeContent(w, r, r.URL.Path, time.Time{}, bytes.NewReader(data))
+	}))
+	defer srv.Close()
+
+	fws := []download.WikiFirmware{
+		{Version: "17.0", Build: "21A329", Devices: []string{"iPhone15,2"}, URL: srv.URL + "/signed.ipsw"},
+		{Version: "16.0", Build: "20A362", Devices: []string{"iphone15,2"}, URL: srv.URL + "/unsigned.ipsw"},
+		{Version: "16.0", Build: "20A362", Devices: []string{"iPhone15,2"}, URL: srv.URL + "/missing.ipsw"},
+		{Version: "16.0", Build: "20A362", URL: srv.URL + "/unsigned.ipsw"}, // no device
+	}
+	if err := CheckSigning(context.Background(), fws, &SigningConfig{URL: srv.URL + "/TSS/controller", Concurrency: 2, Timeout: time.Minute}); err != nil {
+		t.Fatalf("CheckSigning() error = %v", err)
+	}
+
+	if fws[0].Signed == nil || !*fws[0].Signed {
+		t.Errorf("%s Signed = %v, want true", fws[0].Build, fws[0].Signed)
+	}
+	if fws[1].Signed == nil || *fws[1].Signed {
+		t.Errorf("%s Signed = %v, want false", fws[1].Build, fws[1].Signed)
+	}
+	for _, fw := range fws[2:] {
+		if fw.Signed != nil {
+			t.Errorf("%s Signed = %v, want nil (not checked)", fw.URL, *fw.Signed)
+		}
+	}
+	if len(requests) != 2 {
+		t.Fatalf("TSS requests = %d, want 2", len(requests))
+	}
+	for _, req := range requests {
+		if !req.ApImg4Ticket || len(req.ApNonce) != 32 || req.ApECID == 0 || req.ApECID>>48 != 0 {
+			t.Errorf("TSS request = %+v", req)
+		}
+	}
+
+	// a canceled pass leaves everything unchecked
+	fws[0].Signed = nil
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := CheckSigning(ctx, fws[:1], &SigningConfig{URL: srv.URL + "/TSS/controller"}); err == nil {
+		t.Error("CheckSigning(canceled) expected error")
+	}
+	if fws[0].Signed != nil {
+		t.Errorf("Signed = %v after a canceled check, want nil", *fws[0].Signed)
+	}
+}
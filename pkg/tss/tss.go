@@ -1,12 +1,11 @@
 package tss
 
 import (
-	"bytes"
+	"context"
 	"crypto/rand"
 	"crypto/tls"
 	"encoding/hex"
 	"fmt"
-	"io"
 	"net/http"
 	"strconv"
 	"strings"
@@ -93,20 +92,6 @@ func randomHexStr(n int) (string, error) {
 }
 
 func getApImg4Ticket(tssReq *Request, proxy string, insecure bool) (*Blob, error) {
-	trdata, err := plist.Marshal(tssReq, plist.XMLFormat)
-	if err != nil {
-		return nil, err
-	}
-	// os.WriteFile("/tmp/tss.plist", trdata, 0644)
-
-	req, err := http.NewRequest("POST", tssControllerActionURL, bytes.NewBuffer(trdata))
-	if err != nil {
-		return nil, fmt.Errorf("failed to create https request: %v", err)
-	}
-	req.Header.Set("Cache-Control", "no-cache")
-	req.Header.Set("Content-type", "text/xml; charset=\"utf-8\"")
-	req.Header.Add("User-Agent", "InetURL/1.0")
-
 	client := &http.Client{
 		Transport: &http.Transport{
 			Proxy:           download.GetProxy(proxy),
@@ -114,47 +99,10 @@ func getApImg4Ticket(tssReq *Request, proxy string, insecure bool) (*Blob, error
 		},
 	}
 
-	resp, err := client.Do(req)
+	tr, err := sendRequest(context.Background(), client, tssControllerActionURL, tssReq)
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("failed to connect to URL: got status %s", resp.Status)
-	}
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response body: %v", err)
-	}
-
-	var tr Response
-	for _, field := range strings.Split(string(body), "&") {
-		key, value, ok := strings.Cut(field, "=")
-		if !ok {
-			log.Error("failed to parse response field")
-			continue
-		}
-		switch key {
-		case "STATUS":
-			sInt, err := strconv.Atoi(value)
-			if err != nil {
-				return nil, err
-			}
-			tr.Status = sInt
-		case "MESSAGE":
-			tr.Message = value
-		case "REQUEST_STRING":
-			tr.Plist = value
-		}
-	}
-
-	log.WithFields(log.Fields{
-		"status":      tr.Status,
-		"message":     tr.Message,
-		"request_len": len(tr.Plist),
-	}).Debug("TSS Response")
 
 	if tr.Status == 0 && tr.Message == "SUCCESS" {
 		var blob Blob
@@ -69,7 +69,7 @@ func (c *Client) EnableSSL() error {
 		ClientAuth:         tls.NoClientCert,
 		InsecureSkipVerify: true,
 	})
-	if err := c.tlsConn.Handshake(); err != nil {
+	if err := withDeadline(c.tlsConn, c.tlsConn.Handshake); err != nil {
 		return fmt.Errorf("failed to perform tls handshake: %v", err)
 	}
 
@@ -81,11 +81,12 @@ func (c *Client) DisableSSL() {
 }
 
 func (c *Client) Request(req, resp any) error {
-	if err := c.Send(req); err != nil {
-		return err
-	}
-
-	return c.Recv(resp)
+	return withDeadline(c.Conn(), func() error {
+		if err := c.Send(req); err != nil {
+			return err
+		}
+		return c.Recv(resp)
+	})
 }
 
 func (c *Client) Send(req any) error {
@@ -7,5 +7,5 @@ import (
 )
 
 func usbmuxdDial() (net.Conn, error) {
-	return net.Dial("unix", "/var/run/usbmuxd")
+	return net.DialTimeout("unix", "/var/run/usbmuxd", Timeout)
 }
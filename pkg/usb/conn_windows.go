@@ -7,5 +7,5 @@ import (
 )
 
 func usbmuxdDial() (net.Conn, error) {
-	return net.Dial("tcp", "localhost:27015")
+	return net.DialTimeout("tcp", "localhost:27015", Timeout)
 }
@@ -7,6 +7,7 @@ import (
 	"net"
 	"sync/atomic"
 	"syscall"
+	"time"
 
 	"github.com/apex/log"
 	"github.com/blacktop/go-plist"
@@ -31,6 +32,21 @@ type Header struct {
 
 var HeaderSize = uint32(binary.Size(Header{}))
 
+// Timeout bounds dialing usbmuxd and each request/response round trip with it or a device service (0 means no timeout)
+var Timeout time.Duration
+
+// withDeadline runs a request/response round trip on conn under Timeout
+func withDeadline(conn net.Conn, roundTrip func() error) error {
+	if Timeout <= 0 {
+		return roundTrip()
+	}
+	if err := conn.SetDeadline(time.Now().Add(Timeout)); err != nil {
+		return err
+	}
+	defer conn.SetDeadline(time.Time{})
+	return roundTrip()
+}
+
 type Conn struct {
 	net.Conn
 	tag uint32
@@ -215,11 +231,12 @@ func (c *Conn) ReadPairRecord(udid string) (*PairRecord, error) {
 }
 
 func (c *Conn) Request(req, resp any) error {
-	if err := c.Send(req); err != nil {
-		return err
-	}
-
-	return c.Recv(resp)
+	return withDeadline(c.Conn, func() error {
+		if err := c.Send(req); err != nil {
+			return err
+		}
+		return c.Recv(resp)
+	})
 }
 
 func (c *Conn) Send(msg any) error {
@@ -1,7 +1,11 @@
 package usb
 
 import (
+	"errors"
+	"net"
+	"os"
 	"testing"
+	"time"
 )
 
 func TestConn_ListDevices(t *testing.T) {
@@ -28,3 +32,30 @@ func TestConn_ListDevices(t *testing.T) {
 		t.Logf("%#v", pair)
 	}
 }
+
+func TestConnRequestTimeout(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	go func() { // usbmuxd reads the request but never answers
+		buf := make([]byte, 1024)
+		for {
+			if _, err := server.Read(buf); err != nil {
+				return
+			}
+		}
+	}()
+
+	Timeout = 50 * time.Millisecond
+	defer func() { Timeout = 0 }()
+
+	conn := &Conn{Conn: client}
+	start := time.Now()
+	err := conn.Request(&listDevicesRequest{MessageType: "ListDevices"}, &listDevicesResponse{})
+	if !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("Request() error = %v, want a deadline exceeded error", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Request() took %v with a %v timeout", elapsed, Timeout)
+	}
+}
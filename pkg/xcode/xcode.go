@@ -14,6 +14,7 @@ import (
 	"os"
 	"path/filepath"
 
+	"github.com/blacktop/ipsw/internal/ffi"
 	"github.com/blacktop/ipsw/internal/utils"
 )
 
@@ -81,26 +82,32 @@ func WriteToJSON(devices []Device, dest string) error {
 }
 
 //export c_pkg_xcode_xcode_GetDevices
-func c_pkg_xcode_xcode_GetDevices(outJson **C.char, outJsonLen *C.uint, err **C.char, errLen *C.uint) C.char {
+func c_pkg_xcode_xcode_GetDevices(outJson **C.char, outJsonLen *C.uint, err **C.char, errLen *C.uint) (status C.char) {
+	defer ffi.Recover("c_pkg_xcode_xcode_GetDevices", func(perr error) {
+		outError := perr.Error()
+		*err = C.CString(outError)
+		*errLen = C.uint(len(outError))
+		status = C.char(ffi.InternalPanic)
+	})
 	devices, devicesError := GetDevices()
 	if devicesError != nil {
 		outError := fmt.Sprintf("c_pkg_xcode_xcode_GetDevices: GetDeviceIPSWs failed with %w", devicesError)
 		*err = C.CString(outError)
 		*errLen = C.uint(len(outError))
-		return C.char(0)
+		return C.char(ffi.Failure)
 	}
 	fret, jsonErr := json.Marshal(devices)
 	if jsonErr != nil {
 		outError := fmt.Sprintf("c_pkg_xcode_xcode_GetDevices: Failed to serialize Device object: %w", jsonErr)
 		*err = C.CString(outError)
 		*errLen = C.uint(len(outError))
-		return C.char(0)
+		return C.char(ffi.Failure)
 	}
 	cs := C.CString(string(fret))
 	*outJson = cs
 	*outJsonLen = C.uint(C.strlen(cs))
 
-	return C.char(1)
+	return C.char(ffi.Success)
 }
 
 // GetDevices reads the devices from embedded JSON